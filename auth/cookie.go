@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+)
+
+const (
+	SessionCookieName = "session"
+	CSRFCookieName    = "csrf_token"
+	CSRFHeaderName    = "X-CSRF-Token"
+
+	csrfTokenPurpose = "csrf:"
+)
+
+// SessionCookies reports whether tokens are handed to browsers as cookies
+func (j *JWTAuth) SessionCookies() bool {
+	return j.sessionCookies
+}
+
+// SetSessionCookies sets the token as an HttpOnly session cookie along with
+// the CSRF token the browser has to echo in the X-CSRF-Token header of
+// state-changing requests. The CSRF cookie is readable by scripts of the
+// site, which is what makes the double submit work.
+func (j *JWTAuth) SetSessionCookies(w http.ResponseWriter, token string) {
+	maxAge := int(j.expiryDuration.Seconds())
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   j.secureCookies,
+		// lax, as the cookie is set on the redirect chain started by the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    j.csrfToken(token),
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   j.secureCookies,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// ClearSessionCookies removes the session and CSRF cookies
+func (j *JWTAuth) ClearSessionCookies(w http.ResponseWriter) {
+	for _, name := range []string{SessionCookieName, CSRFCookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: name == SessionCookieName,
+			Secure:   j.secureCookies,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+// fetchSessionCookie fetches the token from the session cookie
+func fetchSessionCookie(r *http.Request) string {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return ""
+	}
+
+	return cookie.Value
+}
+
+// csrfToken derives the CSRF token of a session token. Binding it to the
+// session keeps a CSRF cookie planted by a sibling domain from being
+// accepted with someone else's session.
+func (j *JWTAuth) csrfToken(token string) string {
+	mac := hmac.New(sha256.New, j.secretKey)
+	mac.Write([]byte(csrfTokenPurpose + token))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkCSRF checks the CSRF header of a cookie authenticated request. Safe
+// methods are let through as they must not change state.
+func (j *JWTAuth) checkCSRF(r *http.Request, token string) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	csrfHeader := r.Header.Get(CSRFHeaderName)
+	if csrfHeader == "" {
+		return false
+	}
+
+	csrfCookie, err := r.Cookie(CSRFCookieName)
+	if err != nil || subtle.ConstantTimeCompare([]byte(csrfCookie.Value), []byte(csrfHeader)) != 1 {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(j.csrfToken(token)), []byte(csrfHeader)) == 1
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthenticatorSessionCookies(t *testing.T) {
+	sessions := activeSessions{"active": true, "other": true}
+	jwtAuth := NewJWTAuth(testSecretKey, time.Hour, true, true, sessions)
+
+	token := newTestToken(t, jwtAuth, "active")
+	otherToken := newTestToken(t, jwtAuth, "other")
+
+	testCases := []struct {
+		name       string
+		method     string
+		csrfCookie string
+		csrfHeader string
+		wantStatus int
+	}{
+		{
+			name:       "safe method without csrf token",
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "matching csrf token",
+			method:     http.MethodPost,
+			csrfCookie: jwtAuth.csrfToken(token),
+			csrfHeader: jwtAuth.csrfToken(token),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing csrf header",
+			method:     http.MethodPost,
+			csrfCookie: jwtAuth.csrfToken(token),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "missing csrf cookie",
+			method:     http.MethodDelete,
+			csrfHeader: jwtAuth.csrfToken(token),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "csrf cookie and header mismatch",
+			method:     http.MethodPatch,
+			csrfCookie: jwtAuth.csrfToken(token),
+			csrfHeader: jwtAuth.csrfToken(otherToken),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "csrf token of another session",
+			method:     http.MethodPut,
+			csrfCookie: jwtAuth.csrfToken(otherToken),
+			csrfHeader: jwtAuth.csrfToken(otherToken),
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/task", nil)
+			r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: token})
+			if tc.csrfCookie != "" {
+				r.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: tc.csrfCookie})
+			}
+			if tc.csrfHeader != "" {
+				r.Header.Set(CSRFHeaderName, tc.csrfHeader)
+			}
+
+			if status := authenticate(jwtAuth, r); status != tc.wantStatus {
+				t.Errorf("status is %v, want %v", status, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorBearerTokenSkipsCSRF(t *testing.T) {
+	jwtAuth := NewJWTAuth(testSecretKey, time.Hour, true, true, activeSessions{"active": true})
+
+	r := httptest.NewRequest(http.MethodPost, "/task", nil)
+	r.Header.Set("Authorization", "Bearer "+newTestToken(t, jwtAuth, "active"))
+
+	if status := authenticate(jwtAuth, r); status != http.StatusOK {
+		t.Errorf("status is %v, want %v", status, http.StatusOK)
+	}
+}
+
+func TestAuthenticatorIgnoresCookiesWhenDisabled(t *testing.T) {
+	jwtAuth := NewJWTAuth(testSecretKey, time.Hour, false, false, activeSessions{"active": true})
+
+	r := httptest.NewRequest(http.MethodGet, "/task", nil)
+	r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: newTestToken(t, jwtAuth, "active")})
+
+	if status := authenticate(jwtAuth, r); status != http.StatusUnauthorized {
+		t.Errorf("status is %v, want %v", status, http.StatusUnauthorized)
+	}
+}
@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -14,6 +15,8 @@ import (
 
 const (
 	ClaimsKeyUserID = "userID"
+
+	legacyUserIDPrefix = "github:"
 )
 
 type contextKey struct {
@@ -33,20 +36,39 @@ type JWTAuth struct {
 	signatureAlgorithm jwa.SignatureAlgorithm
 	expiryDuration     time.Duration
 	verifier           jwt.ParseOption
+
+	sessionCookies bool
+	secureCookies  bool
+
+	sessionValidator SessionValidator
 }
 
-func NewJWTAuth(secretKey string, expiryDuration time.Duration) *JWTAuth {
+// NewJWTAuth returns an authenticator of HS256 tokens. When sessionCookies is
+// set, browsers are handed the token in a cookie, which the Authenticator
+// accepts in place of the bearer header. Tokens carrying a session id are
+// only accepted while the sessionValidator reports the session as active.
+func NewJWTAuth(secretKey string, expiryDuration time.Duration, sessionCookies bool,
+	secureCookies bool, sessionValidator SessionValidator) *JWTAuth {
+
 	return &JWTAuth{
 		signatureAlgorithm: jwa.HS256,
 		secretKey:          []byte(secretKey),
 		expiryDuration:     expiryDuration,
 		verifier:           jwt.WithVerify(jwa.HS256, []byte(secretKey)),
+		sessionCookies:     sessionCookies,
+		secureCookies:      secureCookies,
+		sessionValidator:   sessionValidator,
 	}
 }
 
+// CreateToken signs a token of the claims, expiring after the expiry
+// duration. An expiry time given in the claims is kept when it comes earlier.
 func (j *JWTAuth) CreateToken(claims map[string]interface{}) (string, error) {
 	token := jwt.New()
 	for key, value := range claims {
+		if key == jwt.ExpirationKey {
+			continue
+		}
 		token.Set(key, value)
 	}
 
@@ -57,7 +79,12 @@ func (j *JWTAuth) CreateToken(claims map[string]interface{}) (string, error) {
 		return "", err
 	}
 
-	err = token.Set(jwt.ExpirationKey, int64(currentTime+int64(j.expiryDuration.Seconds())))
+	expiresAt := currentTime + int64(j.expiryDuration.Seconds())
+	if notAfter, ok := claims[jwt.ExpirationKey].(time.Time); ok && notAfter.Unix() < expiresAt {
+		expiresAt = notAfter.Unix()
+	}
+
+	err = token.Set(jwt.ExpirationKey, expiresAt)
 	if err != nil {
 		return "", err
 	}
@@ -70,10 +97,23 @@ func (j *JWTAuth) CreateToken(claims map[string]interface{}) (string, error) {
 	return string(signedToken), nil
 }
 
+// Authenticator verifies the bearer token of the request, or the session
+// cookie when session cookies are enabled. Cookie authenticated requests
+// that change state have to carry a matching CSRF token.
 func (j *JWTAuth) Authenticator(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tokenString := FetchBearerToken(r)
 
+		if tokenString == "" && j.sessionCookies {
+			tokenString = fetchSessionCookie(r)
+
+			if tokenString != "" && !j.checkCSRF(r, tokenString) {
+				log.Errorf("error as csrf token of %v %v is missing or invalid", r.Method, r.URL.Path)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		}
+
 		if tokenString == "" {
 			log.Error("error as authorization token is empty")
 			w.WriteHeader(http.StatusUnauthorized)
@@ -95,10 +135,28 @@ func (j *JWTAuth) Authenticator(next http.Handler) http.Handler {
 
 		ctx := context.WithValue(r.Context(), TokenCtxKey, token)
 
+		active, err := j.validateSession(ctx)
+		if err != nil {
+			log.Errorf("error validating session: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if !active {
+			log.Info("token rejected as its session is revoked or expired")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// ExpiryDuration is the lifetime of the tokens issued
+func (j *JWTAuth) ExpiryDuration() time.Duration {
+	return j.expiryDuration
+}
+
 // FetchBearerToken fetches the bearer token from the request header
 func FetchBearerToken(r *http.Request) string {
 	bearer := r.Header.Get("Authorization")
@@ -126,7 +184,7 @@ func FetchClaimValFromCtx(ctx context.Context, claimKey string) (interface{}, er
 
 	claimVal, ok := claims[claimKey]
 	if !ok {
-		return "", errors.New("")
+		return "", fmt.Errorf("error as claim %v is missing", claimKey)
 	}
 
 	return claimVal, nil
@@ -140,3 +198,24 @@ func FetchTokenFromCtx(ctx context.Context) (jwt.Token, error) {
 
 	return token, nil
 }
+
+// FetchUserIDFromCtx fetches the user id claim of the token in the context
+func FetchUserIDFromCtx(ctx context.Context) (string, error) {
+	userIDVal, err := FetchClaimValFromCtx(ctx, ClaimsKeyUserID)
+	if err != nil {
+		return "", fmt.Errorf("error fetching claim %v value: %v", ClaimsKeyUserID, err)
+	}
+
+	userID, ok := userIDVal.(string)
+	if !ok {
+		return "", fmt.Errorf("error type asserting value %v of %v key", userIDVal, ClaimsKeyUserID)
+	}
+
+	// tokens issued before user ids were namespaced by provider carry the
+	// raw github id
+	if !strings.Contains(userID, ":") {
+		userID = legacyUserIDPrefix + userID
+	}
+
+	return userID, nil
+}
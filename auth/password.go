@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// bcrypt ignores anything past 72 bytes
+	PasswordMaxLength = 72
+)
+
+// dummyPasswordHash is compared against when an account does not exist, so
+// that a login takes as long for unknown usernames as for wrong passwords
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// HashPassword returns the bcrypt hash of the password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// CheckPassword reports whether the password matches the hash. An empty
+// hash is compared against a dummy hash and never matches.
+func CheckPassword(passwordHash string, password string) bool {
+	if passwordHash == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) == nil
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckPassword(t *testing.T) {
+	passwordHash, err := HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("error hashing password: %v", err)
+	}
+
+	if passwordHash == "correct horse battery" {
+		t.Fatalf("password stored as is")
+	}
+
+	testCases := []struct {
+		name         string
+		passwordHash string
+		password     string
+		want         bool
+	}{
+		{
+			name:         "right password",
+			passwordHash: passwordHash,
+			password:     "correct horse battery",
+			want:         true,
+		},
+		{
+			name:         "wrong password",
+			passwordHash: passwordHash,
+			password:     "correct horse staple",
+		},
+		{
+			name:         "empty password",
+			passwordHash: passwordHash,
+		},
+		{
+			name:     "empty hash",
+			password: "dummy password",
+		},
+		{
+			name:         "invalid hash",
+			passwordHash: "not a bcrypt hash",
+			password:     "correct horse battery",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := CheckPassword(tc.passwordHash, tc.password); got != tc.want {
+				t.Errorf("password matches is %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHashPasswordMaxLength(t *testing.T) {
+	_, err := HashPassword(strings.Repeat("a", PasswordMaxLength))
+	if err != nil {
+		t.Errorf("error hashing password of max length: %v", err)
+	}
+}
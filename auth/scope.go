@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ClaimsKeyScopes = "scopes"
+)
+
+// Scopes carried by the tokens issued by the service
+const (
+	ScopeTasksRead  = "tasks:read"
+	ScopeTasksWrite = "tasks:write"
+	ScopeAdmin      = "admin"
+)
+
+// DefaultUserScopes are the scopes granted to a user on login. Tokens issued
+// before scopes were introduced carry no scopes claim and are treated as
+// having these scopes.
+var DefaultUserScopes = []string{ScopeTasksRead, ScopeTasksWrite}
+
+// KnownScopes lists every scope the service understands
+var KnownScopes = []string{ScopeTasksRead, ScopeTasksWrite, ScopeAdmin}
+
+type insufficientScopeResponse struct {
+	Error        string `json:"error"`
+	MissingScope string `json:"missingScope"`
+}
+
+// RequireScope returns a middleware that rejects requests whose token does
+// not carry the given scope. The admin scope satisfies every scope.
+func (j *JWTAuth) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, err := FetchScopesFromCtx(r.Context())
+			if err != nil {
+				log.Errorf("error fetching scopes from ctx: %v", err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			if !HasScope(scopes, scope) {
+				log.Infof("request to %v rejected as scope %v is missing", r.URL.Path, scope)
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("WWW-Authenticate",
+					fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(insufficientScopeResponse{
+					Error:        "insufficient_scope",
+					MissingScope: scope,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HasScope reports whether the scopes satisfy the required scope
+func HasScope(scopes []string, required string) bool {
+	for _, scope := range scopes {
+		if scope == required || scope == ScopeAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsKnownScope reports whether the scope is understood by the service
+func IsKnownScope(scope string) bool {
+	for _, known := range KnownScopes {
+		if scope == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FetchScopesFromCtx fetches the scopes of the token in the context
+func FetchScopesFromCtx(ctx context.Context) ([]string, error) {
+	token, err := FetchTokenFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scopesVal, ok := token.Get(ClaimsKeyScopes)
+	if !ok {
+		return DefaultUserScopes, nil
+	}
+
+	return parseScopes(scopesVal)
+}
+
+func parseScopes(scopesVal interface{}) ([]string, error) {
+	switch scopes := scopesVal.(type) {
+	case []string:
+		return scopes, nil
+	case string:
+		return strings.Fields(scopes), nil
+	case []interface{}:
+		parsed := make([]string, 0, len(scopes))
+		for _, scope := range scopes {
+			scopeStr, ok := scope.(string)
+			if !ok {
+				return nil, fmt.Errorf("error type asserting scope %v", scope)
+			}
+			parsed = append(parsed, scopeStr)
+		}
+		return parsed, nil
+	}
+
+	return nil, fmt.Errorf("error type asserting value %v of %v key", scopesVal, ClaimsKeyScopes)
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+const (
+	SealKeyLength = 32
+)
+
+// Sealer encrypts secrets kept at rest, e.g. third party access tokens,
+// with AES-256-GCM
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer returns a sealer of the base64 encoded 32 byte key
+func NewSealer(encodedKey string) (*Sealer, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding seal key: %v", err)
+	}
+
+	if len(key) != SealKeyLength {
+		return nil, fmt.Errorf("error as seal key is %d bytes instead of %d", len(key), SealKeyLength)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sealer{
+		aead: aead,
+	}, nil
+}
+
+// Seal encrypts the plaintext bound to the additional data, which has to be
+// given again to open it. Binding a secret to its owner keeps a sealed
+// value from being opened as someone else's.
+func (s *Sealer) Seal(plaintext []byte, additionalData []byte) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := s.aead.Seal(nonce, nonce, plaintext, additionalData)
+
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value sealed with the same key and additional data
+func (s *Sealer) Open(sealed string, additionalData []byte) ([]byte, error) {
+	sealedBytes, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding sealed value: %v", err)
+	}
+
+	nonceSize := s.aead.NonceSize()
+	if len(sealedBytes) < nonceSize {
+		return nil, errors.New("error as sealed value is too short")
+	}
+
+	return s.aead.Open(nil, sealedBytes[:nonceSize], sealedBytes[nonceSize:], additionalData)
+}
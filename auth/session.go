@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	ClaimsKeySessionID = "sid"
+)
+
+// SessionValidator reports whether the session a token was issued on is
+// still active. It is backed by the session store, so a session revoked on
+// one instance is rejected by all of them.
+type SessionValidator interface {
+	ValidateSession(ctx context.Context, userID string, sessionID string, seenAt time.Time) (bool, error)
+}
+
+// FetchSessionIDFromCtx fetches the session id claim of the token in the
+// context. Tokens issued before sessions were introduced carry none.
+func FetchSessionIDFromCtx(ctx context.Context) (string, bool, error) {
+	token, err := FetchTokenFromCtx(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	sessionIDVal, ok := token.Get(ClaimsKeySessionID)
+	if !ok {
+		return "", false, nil
+	}
+
+	sessionID, ok := sessionIDVal.(string)
+	if !ok {
+		return "", false, fmt.Errorf("error type asserting value %v of %v key", sessionIDVal, ClaimsKeySessionID)
+	}
+
+	return sessionID, true, nil
+}
+
+// validateSession checks the session of the token in the context. Tokens
+// without a session cannot be revoked, so they are rejected and their users
+// log in again.
+func (j *JWTAuth) validateSession(ctx context.Context) (bool, error) {
+	if j.sessionValidator == nil {
+		return true, nil
+	}
+
+	sessionID, ok, err := FetchSessionIDFromCtx(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if !ok {
+		return false, nil
+	}
+
+	userID, err := FetchUserIDFromCtx(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return j.sessionValidator.ValidateSession(ctx, userID, sessionID, time.Now().UTC())
+}
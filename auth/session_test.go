@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testSecretKey = "test-secret-key"
+
+// activeSessions is a SessionValidator holding the active sessions by id
+type activeSessions map[string]bool
+
+func (a activeSessions) ValidateSession(ctx context.Context, userID string, sessionID string,
+	seenAt time.Time) (bool, error) {
+
+	return a[sessionID], nil
+}
+
+// newTestToken returns a token of the user, on the session unless it is
+// empty
+func newTestToken(t *testing.T, jwtAuth *JWTAuth, sessionID string) string {
+	t.Helper()
+
+	claims := map[string]interface{}{
+		ClaimsKeyUserID: "local:alice",
+		ClaimsKeyScopes: DefaultUserScopes,
+	}
+	if sessionID != "" {
+		claims[ClaimsKeySessionID] = sessionID
+	}
+
+	token, err := jwtAuth.CreateToken(claims)
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+
+	return token
+}
+
+// authenticate serves the request through the Authenticator, returning the
+// status code
+func authenticate(jwtAuth *JWTAuth, r *http.Request) int {
+	handler := jwtAuth.Authenticator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+
+	return recorder.Code
+}
+
+func TestAuthenticatorSessions(t *testing.T) {
+	sessions := activeSessions{"active": true, "revoked": false}
+	jwtAuth := NewJWTAuth(testSecretKey, time.Hour, false, false, sessions)
+
+	testCases := []struct {
+		name       string
+		sessionID  string
+		wantStatus int
+	}{
+		{
+			name:       "active session",
+			sessionID:  "active",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "revoked session",
+			sessionID:  "revoked",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unknown session",
+			sessionID:  "unknown",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "token without session",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/me", nil)
+			r.Header.Set("Authorization", "Bearer "+newTestToken(t, jwtAuth, tc.sessionID))
+
+			if status := authenticate(jwtAuth, r); status != tc.wantStatus {
+				t.Errorf("status is %v, want %v", status, tc.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Key is the SHA1 key of the test vectors of RFC 6238
+var rfc6238Key = []byte("12345678901234567890")
+
+func TestTOTPCode(t *testing.T) {
+	// the codes of RFC 6238 appendix B, cut to six digits
+	testCases := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+
+	for _, tc := range testCases {
+		if code := totpCode(rfc6238Key, tc.unix/30); code != tc.want {
+			t.Errorf("code at %v is %v, want %v", tc.unix, code, tc.want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Key)
+	at := time.Unix(1111111111, 0)
+	step := at.Unix() / 30
+
+	testCases := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{
+			name:     "code of the current period",
+			secret:   secret,
+			code:     "050471",
+			wantStep: step,
+			wantOK:   true,
+		},
+		{
+			name:     "code of the previous period",
+			secret:   secret,
+			code:     totpCode(rfc6238Key, step-1),
+			wantStep: step - 1,
+			wantOK:   true,
+		},
+		{
+			name:     "code of the next period",
+			secret:   secret,
+			code:     totpCode(rfc6238Key, step+1),
+			wantStep: step + 1,
+			wantOK:   true,
+		},
+		{
+			name:   "code of two periods ago",
+			secret: secret,
+			code:   totpCode(rfc6238Key, step-2),
+		},
+		{
+			name:     "lowercase secret and padded code",
+			secret:   " " + strings.ToLower(secret) + " ",
+			code:     " 050471 ",
+			wantStep: step,
+			wantOK:   true,
+		},
+		{
+			name:   "wrong code",
+			secret: secret,
+			code:   "123456",
+		},
+		{
+			name:   "code of eight digits",
+			secret: secret,
+			code:   "07081804",
+		},
+		{
+			name:   "invalid secret",
+			secret: "not base32!",
+			code:   "050471",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotStep, ok := VerifyTOTP(tc.secret, tc.code, at)
+			if ok != tc.wantOK {
+				t.Fatalf("code accepted is %v, want %v", ok, tc.wantOK)
+			}
+
+			if gotStep != tc.wantStep {
+				t.Errorf("step is %v, want %v", gotStep, tc.wantStep)
+			}
+		})
+	}
+}
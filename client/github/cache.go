@@ -0,0 +1,84 @@
+package github
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	defaultUserInfoCacheSize = 256
+)
+
+type userInfoCacheEntry struct {
+	etag     string
+	userInfo UserInfo
+	lastUsed time.Time
+}
+
+// userInfoCache keeps the last user info and its ETag per access token, so
+// that user info can be fetched with conditional requests, which github does
+// not count against the rate limit
+type userInfoCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*userInfoCacheEntry
+}
+
+func newUserInfoCache(size int) *userInfoCache {
+	return &userInfoCache{
+		size:    size,
+		entries: make(map[string]*userInfoCacheEntry),
+	}
+}
+
+func (u *userInfoCache) get(accessToken string) (userInfoCacheEntry, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	entry, ok := u.entries[cacheKey(accessToken)]
+	if !ok {
+		return userInfoCacheEntry{}, false
+	}
+	entry.lastUsed = time.Now()
+
+	return *entry, true
+}
+
+func (u *userInfoCache) put(accessToken string, etag string, userInfo UserInfo) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key := cacheKey(accessToken)
+	if _, ok := u.entries[key]; !ok && len(u.entries) >= u.size {
+		u.evictLeastRecentlyUsed()
+	}
+
+	u.entries[key] = &userInfoCacheEntry{
+		etag:     etag,
+		userInfo: userInfo,
+		lastUsed: time.Now(),
+	}
+}
+
+func (u *userInfoCache) evictLeastRecentlyUsed() {
+	var oldestKey string
+	var oldest time.Time
+
+	for key, entry := range u.entries {
+		if oldestKey == "" || entry.lastUsed.Before(oldest) {
+			oldestKey = key
+			oldest = entry.lastUsed
+		}
+	}
+
+	delete(u.entries, oldestKey)
+}
+
+// cacheKey hashes the access token so that tokens are not kept in memory
+// longer than needed
+func cacheKey(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return hex.EncodeToString(sum[:])
+}
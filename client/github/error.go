@@ -0,0 +1,84 @@
+package github
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// ErrGithubClient implements Error interface
+type ErrGithubClient string
+
+const (
+	ErrGithubBadVerificationCode ErrGithubClient = "error bad or expired verification code"
+	ErrGithubUnauthorized        ErrGithubClient = "error unauthorized by github"
+	ErrGithubRateLimited         ErrGithubClient = "error rate limited by github"
+	ErrGithubUpstream            ErrGithubClient = "error github upstream failure"
+	ErrGithubNotFound            ErrGithubClient = "error not found on github"
+)
+
+func (e ErrGithubClient) Error() string {
+	return string(e)
+}
+
+const (
+	oAuthErrorBadVerificationCode = "bad_verification_code"
+)
+
+// checkResponse maps a non successful github response to one of the typed
+// errors, keeping the status and a bounded part of the body for the logs
+func checkResponse(resp *http.Response, respBody []byte) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	detail := fmt.Sprintf("status %d: %s", resp.StatusCode, truncate(respBody, 256))
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return errors.Wrap(ErrGithubUnauthorized, detail)
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0",
+		resp.StatusCode == http.StatusForbidden && resp.Header.Get("Retry-After") != "":
+		return errors.Wrap(ErrGithubRateLimited, detail)
+	case resp.StatusCode == http.StatusForbidden:
+		return errors.Wrap(ErrGithubUnauthorized, detail)
+	case resp.StatusCode == http.StatusNotFound:
+		return errors.Wrap(ErrGithubNotFound, detail)
+	}
+
+	return errors.Wrap(ErrGithubUpstream, detail)
+}
+
+// checkOAuthError maps the error github reports in the body of a 200
+// access token response to one of the typed errors
+func checkOAuthError(accessTokenResponse AccessTokenResponse) error {
+	if accessTokenResponse.Error == "" {
+		if accessTokenResponse.AccessToken == "" {
+			return errors.Wrap(ErrGithubUpstream, "access token is missing in the response")
+		}
+		return nil
+	}
+
+	detail := accessTokenResponse.Error
+	if accessTokenResponse.ErrorDescription != "" {
+		detail = fmt.Sprintf("%s (%s)", detail, accessTokenResponse.ErrorDescription)
+	}
+
+	if accessTokenResponse.Error == oAuthErrorBadVerificationCode {
+		return errors.Wrap(ErrGithubBadVerificationCode, detail)
+	}
+
+	return errors.Wrap(ErrGithubUpstream, detail)
+}
+
+func truncate(body []byte, size int) string {
+	body = bytes.TrimSpace(body)
+	if len(body) <= size {
+		return string(body)
+	}
+
+	return string(body[:size]) + "..."
+}
@@ -5,42 +5,62 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
+const (
+	codeChallengeMethodS256 = "S256"
+)
+
+// Client is a github oauth and api client. It holds no per user state, so a
+// single instance is safe to share between concurrent logins; access tokens
+// are passed on every call.
 type Client struct {
 	*http.Client
 	oAuthURL     string
 	apiURL       string
 	clientID     string
 	clientSecret string
-	accessToken  string
+	scopes       []string
+
+	maxRetries    int
+	rateLimits    *rateLimitTracker
+	userInfoCache *userInfoCache
 }
 
-func New(oAuthURL string, apiURL string, clientID string, clientSecret string,
-	timeoutInSec int32) *Client {
+// New returns a github client. The scopes are requested on authorization,
+// none gives read access to public information only.
+func New(oAuthURL string, apiURL string, clientID string, clientSecret string, scopes []string,
+	timeoutInSec int32, maxRetries int) *Client {
 
 	return &Client{
 		oAuthURL:     oAuthURL,
 		apiURL:       apiURL,
 		clientID:     clientID,
 		clientSecret: clientSecret,
+		scopes:       scopes,
 		Client: &http.Client{
 			Timeout: time.Duration(timeoutInSec) * time.Second,
 		},
+		maxRetries:    maxRetries,
+		rateLimits:    newRateLimitTracker(defaultRateLimitTrackerSize),
+		userInfoCache: newUserInfoCache(defaultUserInfoCacheSize),
 	}
 }
 
-func (c *Client) GetAccessToken(ctx context.Context, authCode string) (string, error) {
+func (c *Client) GetAccessToken(ctx context.Context, authCode string, codeVerifier string) (string, error) {
 	var accessTokenRequest = AccessTokenRequest{
 		ClientID:     c.clientID,
 		ClientSecret: c.clientSecret,
 		Code:         authCode,
+		CodeVerifier: codeVerifier,
 	}
 
 	body, err := json.Marshal(accessTokenRequest)
@@ -57,71 +77,181 @@ func (c *Client) GetAccessToken(ctx context.Context, authCode string) (string, e
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, oAuthAccessTokenParsedURL.String(),
 		bytes.NewReader(body))
+	if err != nil {
+		return "", errors.Wrap(err, "error creating github access token request")
+	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := c.Do(req)
+	resp, respBody, err := c.do(req)
 	if err != nil {
-		return "", errors.Wrap(err, "error making request")
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	respBody, err := ioutil.ReadAll(resp.Body)
+	err = checkResponse(resp, respBody)
 	if err != nil {
-		return "", errors.Wrap(err, "error reading response body")
+		return "", err
 	}
 
 	var accessTokenResponse AccessTokenResponse
 	err = json.Unmarshal(respBody, &accessTokenResponse)
 	if err != nil {
-		return "", errors.Wrap(err, "error unmarshalling access token response body")
+		return "", errors.Wrap(ErrGithubUpstream, "error unmarshalling access token response body")
+	}
+
+	err = checkOAuthError(accessTokenResponse)
+	if err != nil {
+		return "", err
 	}
 
 	return accessTokenResponse.AccessToken, nil
 }
 
-func (c *Client) GetRedirectAuthorizeURL(ctx context.Context, callbackURL string) (string, error) {
-	authorizeURL := fmt.Sprintf("%s/authorize?client_id=%s&redirect_uri=%s", c.oAuthURL, c.clientID, callbackURL)
+// GetRedirectAuthorizeURL returns the github authorize url bound to the
+// given state and PKCE code challenge, asking for the extra scopes on top of
+// the client's
+func (c *Client) GetRedirectAuthorizeURL(ctx context.Context, callbackURL string, state string,
+	codeChallenge string, extraScopes []string) (string, error) {
+
+	authorizeURL := fmt.Sprintf("%s/authorize", c.oAuthURL)
 
 	authorizeParsedURL, err := url.Parse(authorizeURL)
 	if err != nil {
 		return "", errors.Wrap(err, "error parsing github authorize url")
 	}
 
-	return authorizeParsedURL.String(), nil
-}
+	query := url.Values{}
+	query.Set("client_id", c.clientID)
+	query.Set("redirect_uri", callbackURL)
+	query.Set("state", state)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", codeChallengeMethodS256)
+	scopes := append(append([]string{}, c.scopes...), extraScopes...)
+	if len(scopes) > 0 {
+		query.Set("scope", strings.Join(scopes, " "))
+	}
+	authorizeParsedURL.RawQuery = query.Encode()
 
-func (c *Client) SetAccessToken(ctx context.Context, accessToken string) {
-	c.accessToken = accessToken
+	return authorizeParsedURL.String(), nil
 }
 
-func (c *Client) GetUserInfo(ctx context.Context) (*UserInfo, error) {
+// GetUserInfo fetches the info of the user the access token belongs to.
+// Repeated calls for a token are conditional on the ETag of the last
+// response, and the last known info is returned if github is rate limiting
+// or failing.
+func (c *Client) GetUserInfo(ctx context.Context, accessToken string) (*UserInfo, error) {
 	githubUserInfoURL := fmt.Sprintf("%s/user", c.apiURL)
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, githubUserInfoURL, nil)
+	req, err := c.newAPIRequest(ctx, http.MethodGet, githubUserInfoURL, accessToken, nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating github user info request")
 	}
 
-	authToken := fmt.Sprintf("token %s", c.accessToken)
-	req.Header.Set("Authorization", authToken)
+	cached, isCached := c.userInfoCache.get(accessToken)
+	if isCached && cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
 
-	resp, err := c.Do(req)
-	if err != nil {
-		return nil, errors.Wrap(err, "error making request")
+	resp, respBody, err := c.do(req)
+	if err == nil && resp.StatusCode == http.StatusNotModified && isCached {
+		return &cached.userInfo, nil
+	}
+
+	if err == nil {
+		err = checkResponse(resp, respBody)
 	}
 
-	respBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, errors.Wrap(err, "error reading response body")
+		cause := errors.Cause(err)
+		if isCached && (cause == ErrGithubRateLimited || cause == ErrGithubUpstream) {
+			return &cached.userInfo, nil
+		}
+		return nil, err
 	}
 
 	var userInfo UserInfo
 	err = json.Unmarshal(respBody, &userInfo)
 	if err != nil {
-		return nil, errors.Wrap(err, "error unmarshalling user info body")
+		return nil, errors.Wrap(ErrGithubUpstream, "error unmarshalling user info body")
 	}
 
+	c.userInfoCache.put(accessToken, resp.Header.Get("ETag"), userInfo)
+
 	return &userInfo, nil
 }
+
+func (c *Client) newAPIRequest(ctx context.Context, method string, requestURL string, accessToken string,
+	body []byte) (*http.Request, error) {
+
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+
+	authToken := fmt.Sprintf("token %s", accessToken)
+	req.Header.Set("Authorization", authToken)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req, nil
+}
+
+// do sends the request and reads its body. Idempotent requests are retried
+// with a jittered backoff on server errors and secondary rate limits. The
+// rate limit of api requests is tracked by the access token they carry, and
+// a token is held back until its quota resets once it is used up; oauth
+// requests carry none and are never held back.
+func (c *Client) do(req *http.Request) (*http.Response, []byte, error) {
+	ctx := req.Context()
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+	accessToken := strings.TrimPrefix(req.Header.Get("Authorization"), "token ")
+
+	for attempt := 0; ; attempt++ {
+		if accessToken != "" && c.blocked(accessToken) {
+			return nil, nil, errors.Wrapf(ErrGithubRateLimited, "backing off for %v", c.RetryAfter(accessToken))
+		}
+
+		resp, err := c.Do(req)
+		if err != nil {
+			if !idempotent || attempt >= c.maxRetries || ctx.Err() != nil {
+				return nil, nil, errors.Wrap(err, "error making request")
+			}
+
+			if err := sleep(ctx, retryDelay(nil, attempt)); err != nil {
+				return nil, nil, errors.Wrap(err, "error waiting to retry request")
+			}
+			continue
+		}
+
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error reading response body")
+		}
+
+		if accessToken != "" {
+			c.rateLimits.record(accessToken, resp)
+		}
+
+		if !idempotent || attempt >= c.maxRetries || !shouldRetry(resp) {
+			return resp, respBody, nil
+		}
+
+		delay := retryDelay(resp, attempt)
+		if delay > retryMaxWait {
+			return resp, respBody, nil
+		}
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, nil, errors.Wrap(err, "error waiting to retry request")
+		}
+	}
+}
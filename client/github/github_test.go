@@ -0,0 +1,94 @@
+package github_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+)
+
+const concurrentLogins = 20
+
+// newLoginServer returns a github oauth and api server handing out the
+// token "token-<code>" for a code and the user of id <code> for the token
+func newLoginServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/access_token":
+			var accessTokenRequest github.AccessTokenRequest
+			err := json.NewDecoder(r.Body).Decode(&accessTokenRequest)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			json.NewEncoder(w).Encode(github.AccessTokenResponse{
+				AccessToken: "token-" + accessTokenRequest.Code,
+				TokenType:   "bearer",
+			})
+
+		case "/user":
+			id, err := strconv.Atoi(strings.TrimPrefix(r.Header.Get("Authorization"), "token token-"))
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			json.NewEncoder(w).Encode(github.UserInfo{ID: id, Login: fmt.Sprintf("user-%d", id)})
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// TestConcurrentLogins goes through the callbacks of many logins at once
+// with a single client, as the login handler shares it, and checks that
+// each login gets the user info of its own token. Run it with -race.
+func TestConcurrentLogins(t *testing.T) {
+	server := newLoginServer()
+	defer server.Close()
+
+	githubClient := github.New(server.URL, server.URL, "client-id", "client-secret", nil, 5, 0)
+
+	var wg sync.WaitGroup
+	errs := make([]error, concurrentLogins)
+	userInfos := make([]*github.UserInfo, concurrentLogins)
+
+	for i := 0; i < concurrentLogins; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			ctx := context.Background()
+			accessToken, err := githubClient.GetAccessToken(ctx, strconv.Itoa(i+1), "code-verifier")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			userInfos[i], errs[i] = githubClient.GetUserInfo(ctx, accessToken)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < concurrentLogins; i++ {
+		if errs[i] != nil {
+			t.Errorf("login %d failed: %v", i+1, errs[i])
+			continue
+		}
+
+		if userInfos[i].ID != i+1 {
+			t.Errorf("login %d got the user info of user %d", i+1, userInfos[i].ID)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package githubtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+)
+
+// AddIssue assigns an issue, or a pull request when PullRequest is set, to
+// the user. Missing ids, urls, states and update times are filled in.
+func (h *Handler) AddIssue(assignee string, issue github.Issue) github.Issue {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.issues[assignee] = append(h.issues[assignee], h.newIssue(issue))
+
+	return *h.issues[assignee][len(h.issues[assignee])-1]
+}
+
+// AddReviewRequest requests a review of the pull request from the user
+func (h *Handler) AddReviewRequest(reviewer string, pullRequest github.Issue) github.Issue {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if pullRequest.PullRequest == nil {
+		pullRequest.PullRequest = &github.IssuePullRequest{}
+	}
+
+	h.reviewRequests[reviewer] = append(h.reviewRequests[reviewer], h.newIssue(pullRequest))
+
+	return *h.reviewRequests[reviewer][len(h.reviewRequests[reviewer])-1]
+}
+
+// SetIssueState opens or closes the issue of the url, as seen by every
+// user it is assigned to
+func (h *Handler) SetIssueState(htmlURL string, state string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, issue := range h.allIssues() {
+		if issue.HTMLURL == htmlURL {
+			issue.State = state
+			issue.UpdatedAt = time.Now().UTC()
+		}
+	}
+}
+
+// EditIssue sets the title and body of the issue of the url, as if edited
+// on github
+func (h *Handler) EditIssue(htmlURL string, title string, body string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, issue := range h.allIssues() {
+		if issue.HTMLURL == htmlURL {
+			issue.Title = title
+			issue.Body = body
+			issue.UpdatedAt = time.Now().UTC()
+		}
+	}
+}
+
+// Issue returns the issue of the url
+func (h *Handler) Issue(htmlURL string) (github.Issue, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, issue := range h.allIssues() {
+		if issue.HTMLURL == htmlURL {
+			return *issue, true
+		}
+	}
+
+	return github.Issue{}, false
+}
+
+// allIssues returns the issues assigned, requested for review and created
+// through the api
+func (h *Handler) allIssues() []*github.Issue {
+	var all []*github.Issue
+	for _, issuesOfUser := range []map[string][]*github.Issue{h.issues, h.reviewRequests, h.repoIssues} {
+		for _, issues := range issuesOfUser {
+			all = append(all, issues...)
+		}
+	}
+
+	return all
+}
+
+func (h *Handler) newIssue(issue github.Issue) *github.Issue {
+	h.nextIssueID++
+
+	if issue.ID == 0 {
+		issue.ID = h.nextIssueID
+	}
+	if issue.Number == 0 {
+		issue.Number = int(h.nextIssueID)
+	}
+	if issue.RepositoryURL == "" {
+		issue.RepositoryURL = "https://api.github.com/repos/octo-org/octo-repo"
+	}
+	if issue.HTMLURL == "" {
+		kind := "issues"
+		if issue.PullRequest != nil {
+			kind = "pull"
+		}
+		issue.HTMLURL = fmt.Sprintf("https://github.com/octo-org/octo-repo/%s/%d", kind, issue.Number)
+	}
+	if issue.State == "" {
+		issue.State = github.IssueStateOpen
+	}
+	if issue.UpdatedAt.IsZero() {
+		issue.UpdatedAt = time.Now().UTC()
+	}
+
+	return &issue
+}
+
+// assignedIssues serves /issues?filter=assigned with the state and since
+// filters
+func (h *Handler) assignedIssues(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	state := query.Get("state")
+	if state == "" {
+		state = github.IssueStateOpen
+	}
+
+	var since time.Time
+	if sinceParam := query.Get("since"); sinceParam != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, sinceParam)
+		if err != nil {
+			writeAPIError(w, http.StatusUnprocessableEntity, "Validation Failed")
+			return
+		}
+	}
+
+	h.mu.Lock()
+	issues := make([]github.Issue, 0)
+	for _, issue := range h.issues[user.Login] {
+		if (state == "all" || issue.State == state) && !issue.UpdatedAt.Before(since) {
+			issues = append(issues, *issue)
+		}
+	}
+	h.mu.Unlock()
+
+	writeJSON(w, r, issues)
+}
+
+// repos serves the issues of a repository: GET and PATCH of
+// /repos/{owner}/{repo}/issues/{number} and POST of /repos/{owner}/{repo}/issues
+func (h *Handler) repos(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authenticate(w, r); !ok {
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/repos/"), "/")
+	if len(parts) < 3 || parts[2] != "issues" {
+		writeAPIError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	repository := parts[0] + "/" + parts[1]
+
+	switch {
+	case len(parts) == 3 && r.Method == http.MethodPost:
+		h.createIssue(w, r, repository)
+	case len(parts) == 4 && (r.Method == http.MethodGet || r.Method == http.MethodPatch):
+		number, err := strconv.Atoi(parts[3])
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		h.issue(w, r, repository, number)
+	default:
+		writeAPIError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (h *Handler) createIssue(w http.ResponseWriter, r *http.Request, repository string) {
+	var issueRequest github.IssueRequest
+	err := json.NewDecoder(r.Body).Decode(&issueRequest)
+	if err != nil || issueRequest.Title == "" {
+		writeAPIError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return
+	}
+
+	h.mu.Lock()
+	h.nextIssueID++
+	issue := &github.Issue{
+		ID:            h.nextIssueID,
+		Number:        int(h.nextIssueID),
+		Title:         issueRequest.Title,
+		Body:          issueRequest.Body,
+		State:         github.IssueStateOpen,
+		HTMLURL:       fmt.Sprintf("https://github.com/%s/issues/%d", repository, h.nextIssueID),
+		RepositoryURL: "https://api.github.com/repos/" + repository,
+		UpdatedAt:     time.Now().UTC(),
+	}
+	h.repoIssues[repository] = append(h.repoIssues[repository], issue)
+	created := *issue
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *Handler) issue(w http.ResponseWriter, r *http.Request, repository string, number int) {
+	var issueRequest github.IssueRequest
+	if r.Method == http.MethodPatch {
+		err := json.NewDecoder(r.Body).Decode(&issueRequest)
+		if err != nil {
+			writeAPIError(w, http.StatusUnprocessableEntity, "Validation Failed")
+			return
+		}
+	}
+
+	h.mu.Lock()
+	var found *github.Issue
+	for _, issue := range h.allIssues() {
+		if issue.Number == number && strings.HasSuffix(issue.RepositoryURL, "/repos/"+repository) {
+			found = issue
+			break
+		}
+	}
+
+	if found != nil && r.Method == http.MethodPatch {
+		found.Title = issueRequest.Title
+		found.Body = issueRequest.Body
+		if issueRequest.State != "" {
+			found.State = issueRequest.State
+		}
+		found.UpdatedAt = time.Now().UTC()
+	}
+
+	var issue github.Issue
+	if found != nil {
+		issue = *found
+	}
+	h.mu.Unlock()
+
+	if found == nil {
+		writeAPIError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	writeJSON(w, r, issue)
+}
+
+// searchIssues serves the review-requested:<login> searches of open pull
+// requests, other qualifiers are ignored
+func (h *Handler) searchIssues(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authenticate(w, r); !ok {
+		return
+	}
+
+	var reviewer string
+	for _, qualifier := range strings.Fields(r.URL.Query().Get("q")) {
+		if strings.HasPrefix(qualifier, "review-requested:") {
+			reviewer = strings.TrimPrefix(qualifier, "review-requested:")
+		}
+	}
+
+	h.mu.Lock()
+	items := make([]github.Issue, 0)
+	for _, pullRequest := range h.reviewRequests[reviewer] {
+		if pullRequest.State == github.IssueStateOpen {
+			items = append(items, *pullRequest)
+		}
+	}
+	h.mu.Unlock()
+
+	writeJSON(w, r, github.SearchIssuesResponse{
+		TotalCount: len(items),
+		Items:      items,
+	})
+}
@@ -0,0 +1,442 @@
+// Package githubtest provides a fake github oauth and api server for
+// hermetic tests and local development, without real github credentials.
+package githubtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+)
+
+const (
+	// OAuthPath is the path GITHUB_OAUTH_URL should point at
+	OAuthPath = "/login/oauth"
+
+	defaultRateLimit = 5000
+)
+
+// FailureMode makes the server fail requests the way github does
+type FailureMode int
+
+const (
+	FailureNone FailureMode = iota
+	// FailureBadVerificationCode answers code exchanges with a 200
+	// bad_verification_code error body
+	FailureBadVerificationCode
+	// FailureUnauthorized answers api requests with 401
+	FailureUnauthorized
+	// FailureRateLimited answers api requests with 403 and an exhausted quota
+	FailureRateLimited
+	// FailureSecondaryRateLimited answers api requests with 403 and a Retry-After
+	FailureSecondaryRateLimited
+	// FailureServerError answers every request with 502
+	FailureServerError
+)
+
+// User is a github account known to the server
+type User struct {
+	github.UserInfo
+
+	// Orgs are the logins of the orgs the user is a member of
+	Orgs []string
+	// Teams are the teams the user is an active member of, as org/team-slug
+	Teams []string
+}
+
+type authorization struct {
+	login         string
+	codeChallenge string
+}
+
+// Server is a fake of the parts of github the service talks to
+type Server struct {
+	*httptest.Server
+	Handler *Handler
+}
+
+// Handler implements the fake github endpoints. It can be mounted on any
+// http server; NewServer wraps it in an httptest server.
+type Handler struct {
+	mu sync.Mutex
+
+	users        map[string]User
+	defaultLogin string
+
+	codes  map[string]authorization
+	tokens map[string]string
+
+	issues         map[string][]*github.Issue
+	reviewRequests map[string][]*github.Issue
+	// issues created through the api, by owner/name repository
+	repoIssues  map[string][]*github.Issue
+	nextIssueID int64
+
+	failures   map[string]FailureMode
+	latency    time.Duration
+	rateLimit  int
+	remaining  int
+	retryAfter time.Duration
+
+	requests map[string]int
+
+	mux *http.ServeMux
+}
+
+// NewServer starts a fake github server with the given users. The first
+// user is the one the authorize endpoint logs in unless a login is chosen
+// with the login query param.
+func NewServer(users ...User) *Server {
+	handler := NewHandler(users...)
+
+	return &Server{
+		Server:  httptest.NewServer(handler),
+		Handler: handler,
+	}
+}
+
+// NewHandler returns the fake github endpoints with the given users
+func NewHandler(users ...User) *Handler {
+	h := &Handler{
+		users:          make(map[string]User),
+		codes:          make(map[string]authorization),
+		tokens:         make(map[string]string),
+		issues:         make(map[string][]*github.Issue),
+		reviewRequests: make(map[string][]*github.Issue),
+		repoIssues:     make(map[string][]*github.Issue),
+		failures:       make(map[string]FailureMode),
+		rateLimit:      defaultRateLimit,
+		remaining:      defaultRateLimit,
+		retryAfter:     time.Minute,
+		requests:       make(map[string]int),
+		mux:            http.NewServeMux(),
+	}
+
+	for _, user := range users {
+		h.AddUser(user)
+	}
+
+	h.mux.HandleFunc(OAuthPath+"/authorize", h.authorize)
+	h.mux.HandleFunc(OAuthPath+"/access_token", h.accessToken)
+	h.mux.HandleFunc("/user", h.user)
+	h.mux.HandleFunc("/user/orgs", h.userOrgs)
+	h.mux.HandleFunc("/orgs/", h.orgs)
+	h.mux.HandleFunc("/issues", h.assignedIssues)
+	h.mux.HandleFunc("/search/issues", h.searchIssues)
+	h.mux.HandleFunc("/repos/", h.repos)
+
+	return h
+}
+
+// OAuthURL is the value for GITHUB_OAUTH_URL
+func (s *Server) OAuthURL() string {
+	return s.URL + OAuthPath
+}
+
+// APIURL is the value for GITHUB_API_URL
+func (s *Server) APIURL() string {
+	return s.URL
+}
+
+// AddUser adds or replaces a github account
+func (h *Handler) AddUser(user User) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.users[user.Login] = user
+	if h.defaultLogin == "" {
+		h.defaultLogin = user.Login
+	}
+}
+
+// IssueToken returns an access token for the user without going through the
+// oauth flow
+func (h *Handler) IssueToken(login string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	token := "gho_" + mustRandomToken()
+	h.tokens[token] = login
+
+	return token
+}
+
+// SetFailure makes requests to the path fail with the failure mode. An
+// empty path applies the failure mode to every path.
+func (h *Handler) SetFailure(path string, failureMode FailureMode) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.failures[path] = failureMode
+}
+
+// SetLatency delays every response
+func (h *Handler) SetLatency(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.latency = latency
+}
+
+// SetRateLimit sets the quota reported in the X-RateLimit-* headers
+func (h *Handler) SetRateLimit(limit int, remaining int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.rateLimit = limit
+	h.remaining = remaining
+}
+
+// SetRetryAfter sets the Retry-After sent on secondary rate limits
+func (h *Handler) SetRetryAfter(retryAfter time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.retryAfter = retryAfter
+}
+
+// Requests returns the number of requests received on the path
+func (h *Handler) Requests(path string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.requests[path]
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.requests[r.URL.Path]++
+	latency := h.latency
+	h.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if h.failureMode(r.URL.Path) == FailureServerError {
+		http.Error(w, "upstream failure", http.StatusBadGateway)
+		return
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) failureMode(path string) FailureMode {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if failureMode, ok := h.failures[path]; ok {
+		return failureMode
+	}
+
+	return h.failures[""]
+}
+
+// authorize logs the user in without asking and redirects back with a code
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.String() == "" {
+		http.Error(w, "redirect_uri is missing", http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	login := query.Get("login")
+	if login == "" {
+		login = h.defaultLogin
+	}
+	_, ok := h.users[login]
+	code := mustRandomToken()
+	if ok {
+		h.codes[code] = authorization{
+			login:         login,
+			codeChallenge: query.Get("code_challenge"),
+		}
+	}
+	h.mu.Unlock()
+
+	if !ok {
+		http.Error(w, fmt.Sprintf("user %q is unknown", login), http.StatusNotFound)
+		return
+	}
+
+	callbackQuery := redirectURI.Query()
+	callbackQuery.Set("code", code)
+	if state := query.Get("state"); state != "" {
+		callbackQuery.Set("state", state)
+	}
+	redirectURI.RawQuery = callbackQuery.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// accessToken exchanges a code for a token. Like github, errors are
+// reported in the body of a 200 response.
+func (h *Handler) accessToken(w http.ResponseWriter, r *http.Request) {
+	var accessTokenRequest github.AccessTokenRequest
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		err := json.NewDecoder(r.Body).Decode(&accessTokenRequest)
+		if err != nil {
+			http.Error(w, "error decoding request", http.StatusBadRequest)
+			return
+		}
+	} else {
+		accessTokenRequest.ClientID = r.FormValue("client_id")
+		accessTokenRequest.Code = r.FormValue("code")
+		accessTokenRequest.CodeVerifier = r.FormValue("code_verifier")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.failureMode(r.URL.Path) == FailureBadVerificationCode {
+		writeOAuthError(w, "bad_verification_code")
+		return
+	}
+
+	h.mu.Lock()
+	authorization, ok := h.codes[accessTokenRequest.Code]
+	delete(h.codes, accessTokenRequest.Code)
+	h.mu.Unlock()
+
+	if !ok {
+		writeOAuthError(w, "bad_verification_code")
+		return
+	}
+
+	if authorization.codeChallenge != "" &&
+		auth.PKCEChallenge(accessTokenRequest.CodeVerifier) != authorization.codeChallenge {
+		writeOAuthError(w, "bad_verification_code")
+		return
+	}
+
+	token := h.IssueToken(authorization.login)
+
+	json.NewEncoder(w).Encode(github.AccessTokenResponse{
+		AccessToken: token,
+		TokenType:   "bearer",
+	})
+}
+
+func (h *Handler) user(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, r, user.UserInfo)
+}
+
+func (h *Handler) userOrgs(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	orgs := make([]github.Org, 0, len(user.Orgs))
+	for i, org := range user.Orgs {
+		orgs = append(orgs, github.Org{Login: org, ID: i + 1})
+	}
+
+	writeJSON(w, r, orgs)
+}
+
+// orgs serves the org and team membership checks, which github answers the
+// same whoever the token belongs to as long as it can see the org
+func (h *Handler) orgs(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authenticate(w, r); !ok {
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/orgs/"), "/")
+
+	h.mu.Lock()
+	var member User
+	var known bool
+	if len(parts) > 0 {
+		member, known = h.users[parts[len(parts)-1]]
+	}
+	h.mu.Unlock()
+
+	switch {
+	// /orgs/{org}/members/{login}
+	case len(parts) == 3 && parts[1] == "members":
+		if known && contains(member.Orgs, parts[0]) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeAPIError(w, http.StatusNotFound, "User does not exist or is not a member of the organization")
+	// /orgs/{org}/teams/{team_slug}/memberships/{login}
+	case len(parts) == 5 && parts[1] == "teams" && parts[3] == "memberships":
+		if known && contains(member.Teams, parts[0]+"/"+parts[2]) {
+			writeJSON(w, r, github.TeamMembership{State: "active", Role: "member"})
+			return
+		}
+		writeAPIError(w, http.StatusNotFound, "Not Found")
+	default:
+		writeAPIError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// authenticate resolves the user of the access token and applies the
+// failure modes and rate limit of api requests
+func (h *Handler) authenticate(w http.ResponseWriter, r *http.Request) (User, bool) {
+	h.mu.Lock()
+	if h.remaining > 0 && r.Header.Get("If-None-Match") == "" {
+		h.remaining--
+	}
+	limit, remaining, retryAfter := h.rateLimit, h.remaining, h.retryAfter
+	h.mu.Unlock()
+
+	failureMode := h.failureMode(r.URL.Path)
+	if failureMode == FailureRateLimited {
+		remaining = 0
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	w.Header().Set("X-RateLimit-Resource", "core")
+
+	switch {
+	case failureMode == FailureUnauthorized:
+		writeAPIError(w, http.StatusUnauthorized, "Bad credentials")
+		return User{}, false
+	case failureMode == FailureSecondaryRateLimited:
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+		writeAPIError(w, http.StatusForbidden, "You have exceeded a secondary rate limit")
+		return User{}, false
+	case remaining == 0:
+		writeAPIError(w, http.StatusForbidden, "API rate limit exceeded")
+		return User{}, false
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "token ")
+	token = strings.TrimPrefix(token, "Bearer ")
+
+	h.mu.Lock()
+	login, ok := h.tokens[token]
+	user := h.users[login]
+	h.mu.Unlock()
+
+	if !ok {
+		writeAPIError(w, http.StatusUnauthorized, "Bad credentials")
+		return User{}, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,226 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	IssueStateOpen   = "open"
+	IssueStateClosed = "closed"
+
+	issuesPerPage = 100
+	// github search stops at 1000 results, the same bound keeps listings
+	// of very busy users in check
+	maxIssuePages = 10
+)
+
+// ListAssignedIssues lists the issues and pull requests assigned to the user
+// the access token belongs to, across every repository the token can see.
+// With a zero since only open ones are listed, otherwise every one updated
+// since then, so that closes are seen too.
+func (c *Client) ListAssignedIssues(ctx context.Context, accessToken string, since time.Time) ([]Issue, error) {
+	query := url.Values{}
+	query.Set("filter", "assigned")
+	query.Set("sort", "updated")
+	query.Set("per_page", fmt.Sprint(issuesPerPage))
+	if since.IsZero() {
+		query.Set("state", IssueStateOpen)
+	} else {
+		query.Set("state", "all")
+		query.Set("since", since.UTC().Format(time.RFC3339))
+	}
+
+	issuesURL := fmt.Sprintf("%s/issues?%s", c.apiURL, query.Encode())
+
+	var issues []Issue
+	err := c.getPages(ctx, issuesURL, accessToken, maxIssuePages, func(body []byte) (int, error) {
+		var pageIssues []Issue
+		err := json.Unmarshal(body, &pageIssues)
+		if err != nil {
+			return 0, errors.Wrap(ErrGithubUpstream, "error unmarshalling issues body")
+		}
+
+		issues = append(issues, pageIssues...)
+		return len(pageIssues), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return issues, nil
+}
+
+// SearchReviewRequests lists the open pull requests the user is requested to
+// review
+func (c *Client) SearchReviewRequests(ctx context.Context, accessToken string, login string) ([]Issue, error) {
+	query := url.Values{}
+	query.Set("q", fmt.Sprintf("is:pr is:open archived:false review-requested:%s", login))
+	query.Set("per_page", fmt.Sprint(issuesPerPage))
+
+	searchURL := fmt.Sprintf("%s/search/issues?%s", c.apiURL, query.Encode())
+
+	var issues []Issue
+	err := c.getPages(ctx, searchURL, accessToken, maxIssuePages, func(body []byte) (int, error) {
+		var searchIssuesResponse SearchIssuesResponse
+		err := json.Unmarshal(body, &searchIssuesResponse)
+		if err != nil {
+			return 0, errors.Wrap(ErrGithubUpstream, "error unmarshalling search issues body")
+		}
+
+		issues = append(issues, searchIssuesResponse.Items...)
+		return len(searchIssuesResponse.Items), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return issues, nil
+}
+
+// GetIssue gets the issue of the number in the repository, given as
+// owner/name
+func (c *Client) GetIssue(ctx context.Context, accessToken string, repository string, number int) (*Issue, error) {
+	req, err := c.newAPIRequest(ctx, http.MethodGet, c.issueURL(repository, number), accessToken, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating github issue request")
+	}
+
+	return c.doIssueRequest(req)
+}
+
+// CreateIssue opens an issue in the repository, given as owner/name. The
+// state of the request is ignored by github, new issues are open.
+func (c *Client) CreateIssue(ctx context.Context, accessToken string, repository string,
+	issueRequest IssueRequest) (*Issue, error) {
+
+	issueRequest.State = ""
+
+	reqBody, err := json.Marshal(issueRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling create issue request")
+	}
+
+	createIssueURL := fmt.Sprintf("%s/repos/%s/issues", c.apiURL, escapeRepository(repository))
+
+	req, err := c.newAPIRequest(ctx, http.MethodPost, createIssueURL, accessToken, reqBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating github create issue request")
+	}
+
+	return c.doIssueRequest(req)
+}
+
+// UpdateIssue sets the title, body and state of the issue of the number in
+// the repository, given as owner/name
+func (c *Client) UpdateIssue(ctx context.Context, accessToken string, repository string, number int,
+	issueRequest IssueRequest) (*Issue, error) {
+
+	reqBody, err := json.Marshal(issueRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling update issue request")
+	}
+
+	req, err := c.newAPIRequest(ctx, http.MethodPatch, c.issueURL(repository, number), accessToken, reqBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating github update issue request")
+	}
+
+	return c.doIssueRequest(req)
+}
+
+func (c *Client) doIssueRequest(req *http.Request) (*Issue, error) {
+	resp, respBody, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkResponse(resp, respBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var issue Issue
+	err = json.Unmarshal(respBody, &issue)
+	if err != nil {
+		return nil, errors.Wrap(ErrGithubUpstream, "error unmarshalling issue body")
+	}
+
+	return &issue, nil
+}
+
+func (c *Client) issueURL(repository string, number int) string {
+	return fmt.Sprintf("%s/repos/%s/issues/%d", c.apiURL, escapeRepository(repository), number)
+}
+
+// escapeRepository escapes the owner and name of an owner/name repository
+func escapeRepository(repository string) string {
+	parts := strings.SplitN(repository, "/", 2)
+	for i := range parts {
+		parts[i] = url.PathEscape(parts[i])
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// getPages gets the url and the pages linked from it as next, up to
+// maxPages, handing every page body to readPage
+func (c *Client) getPages(ctx context.Context, pageURL string, accessToken string, maxPages int,
+	readPage func(body []byte) (int, error)) error {
+
+	for page := 1; page <= maxPages && pageURL != ""; page++ {
+		req, err := c.newAPIRequest(ctx, http.MethodGet, pageURL, accessToken, nil)
+		if err != nil {
+			return errors.Wrap(err, "error creating github request")
+		}
+
+		resp, respBody, err := c.do(req)
+		if err != nil {
+			return err
+		}
+
+		err = checkResponse(resp, respBody)
+		if err != nil {
+			return err
+		}
+
+		count, err := readPage(respBody)
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			return nil
+		}
+
+		pageURL = nextPageURL(resp.Header.Get("Link"))
+	}
+
+	return nil
+}
+
+// nextPageURL returns the next url of a Link header such as
+// <https://api.github.com/issues?page=2>; rel="next", <...>; rel="last"
+func nextPageURL(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		sections := strings.Split(part, ";")
+		if len(sections) < 2 {
+			continue
+		}
+
+		for _, param := range sections[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(sections[0]), "<>")
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,98 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	orgsPerPage = 100
+	// a user in more orgs than this is unusual enough to stop paginating
+	maxOrgPages = 10
+)
+
+// GetUserOrgs lists the orgs of the user the access token belongs to.
+// Private memberships are only listed when the token has the read:org scope.
+func (c *Client) GetUserOrgs(ctx context.Context, accessToken string) ([]Org, error) {
+	userOrgsURL := fmt.Sprintf("%s/user/orgs?per_page=%d", c.apiURL, orgsPerPage)
+
+	var orgs []Org
+	err := c.getPages(ctx, userOrgsURL, accessToken, maxOrgPages, func(body []byte) (int, error) {
+		var pageOrgs []Org
+		err := json.Unmarshal(body, &pageOrgs)
+		if err != nil {
+			return 0, errors.Wrap(ErrGithubUpstream, "error unmarshalling user orgs body")
+		}
+
+		orgs = append(orgs, pageOrgs...)
+		return len(pageOrgs), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// IsOrgMember reports whether the user is a member of the org. Private
+// members are only seen by a token of an org member with the read:org scope.
+func (c *Client) IsOrgMember(ctx context.Context, accessToken string, org string, login string) (bool, error) {
+	orgMemberURL := fmt.Sprintf("%s/orgs/%s/members/%s", c.apiURL, url.PathEscape(org), url.PathEscape(login))
+
+	req, err := c.newAPIRequest(ctx, http.MethodGet, orgMemberURL, accessToken, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "error creating github org member request")
+	}
+
+	resp, respBody, err := c.do(req)
+	if err != nil {
+		return false, err
+	}
+
+	err = checkResponse(resp, respBody)
+	if errors.Cause(err) == ErrGithubNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return resp.StatusCode == http.StatusNoContent, nil
+}
+
+// GetTeamMembership returns the membership of the user in the team of the
+// org, ErrGithubNotFound when the user is not a member
+func (c *Client) GetTeamMembership(ctx context.Context, accessToken string, org string, teamSlug string,
+	login string) (*TeamMembership, error) {
+
+	teamMembershipURL := fmt.Sprintf("%s/orgs/%s/teams/%s/memberships/%s", c.apiURL, url.PathEscape(org),
+		url.PathEscape(teamSlug), url.PathEscape(login))
+
+	req, err := c.newAPIRequest(ctx, http.MethodGet, teamMembershipURL, accessToken, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating github team membership request")
+	}
+
+	resp, respBody, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkResponse(resp, respBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var teamMembership TeamMembership
+	err = json.Unmarshal(respBody, &teamMembership)
+	if err != nil {
+		return nil, errors.Wrap(ErrGithubUpstream, "error unmarshalling team membership body")
+	}
+
+	return &teamMembership, nil
+}
@@ -0,0 +1,236 @@
+package github
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	retryBaseDelay = 250 * time.Millisecond
+	retryMaxDelay  = 5 * time.Second
+
+	// a Retry-After longer than this is not waited out, the caller gets
+	// ErrGithubRateLimited instead
+	retryMaxWait = 10 * time.Second
+
+	defaultRateLimitTrackerSize = 256
+)
+
+// RateLimit is the quota github last reported in the X-RateLimit-* headers
+type RateLimit struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	Resource  string    `json:"resource,omitempty"`
+}
+
+// tokenRateLimit is the quota of an access token, github rate limits every
+// token on its own
+type tokenRateLimit struct {
+	rateLimit      RateLimit
+	rateLimitKnown bool
+
+	// set when github asks to back off with Retry-After, requests with the
+	// token are not sent before it passes
+	blockedUntil time.Time
+
+	lastUsed time.Time
+}
+
+// rateLimitTracker keeps the quotas of the most recently used access tokens,
+// keyed by their hash like the user info cache
+type rateLimitTracker struct {
+	mu     sync.Mutex
+	size   int
+	limits map[string]*tokenRateLimit
+}
+
+func newRateLimitTracker(size int) *rateLimitTracker {
+	return &rateLimitTracker{
+		size:   size,
+		limits: make(map[string]*tokenRateLimit),
+	}
+}
+
+func (r *rateLimitTracker) get(accessToken string) tokenRateLimit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	limit, ok := r.limits[cacheKey(accessToken)]
+	if !ok {
+		return tokenRateLimit{}
+	}
+
+	return *limit
+}
+
+func (r *rateLimitTracker) record(accessToken string, resp *http.Response) {
+	rateLimit, rateLimitKnown := parseRateLimit(resp.Header)
+	retryAfter, hasRetryAfter := parseRetryAfter(resp.Header)
+	if !rateLimitKnown && !hasRetryAfter {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := cacheKey(accessToken)
+	limit, ok := r.limits[key]
+	if !ok {
+		if len(r.limits) >= r.size {
+			r.evictLeastRecentlyUsed()
+		}
+		limit = &tokenRateLimit{}
+		r.limits[key] = limit
+	}
+	limit.lastUsed = time.Now()
+
+	if rateLimitKnown {
+		limit.rateLimit = rateLimit
+		limit.rateLimitKnown = true
+	}
+
+	if hasRetryAfter {
+		blockedUntil := time.Now().Add(retryAfter)
+		if blockedUntil.After(limit.blockedUntil) {
+			limit.blockedUntil = blockedUntil
+		}
+	}
+}
+
+func (r *rateLimitTracker) evictLeastRecentlyUsed() {
+	var oldestKey string
+	var oldest time.Time
+
+	for key, limit := range r.limits {
+		if oldestKey == "" || limit.lastUsed.Before(oldest) {
+			oldestKey = key
+			oldest = limit.lastUsed
+		}
+	}
+
+	delete(r.limits, oldestKey)
+}
+
+// RateLimit returns the quota of the access token last reported by github,
+// and false when no response carrying the rate limit headers has been seen
+// for it yet
+func (c *Client) RateLimit(accessToken string) (RateLimit, bool) {
+	limit := c.rateLimits.get(accessToken)
+
+	return limit.rateLimit, limit.rateLimitKnown
+}
+
+// RetryAfter returns how long to wait before github accepts requests with
+// the access token again, zero when it is not rate limited
+func (c *Client) RetryAfter(accessToken string) time.Duration {
+	limit := c.rateLimits.get(accessToken)
+
+	now := time.Now()
+	until := limit.blockedUntil
+
+	if limit.rateLimitKnown && limit.rateLimit.Remaining == 0 && limit.rateLimit.Reset.After(until) {
+		until = limit.rateLimit.Reset
+	}
+
+	if until.After(now) {
+		return until.Sub(now)
+	}
+
+	return 0
+}
+
+// blocked reports whether requests with the access token are held back,
+// as github asked to back off or its quota is used up until the reset
+func (c *Client) blocked(accessToken string) bool {
+	return c.RetryAfter(accessToken) > 0
+}
+
+func parseRateLimit(header http.Header) (RateLimit, bool) {
+	limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return RateLimit{}, false
+	}
+
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return RateLimit{}, false
+	}
+
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return RateLimit{}, false
+	}
+
+	return RateLimit{
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     time.Unix(reset, 0).UTC(),
+		Resource:  header.Get("X-RateLimit-Resource"),
+	}, true
+}
+
+func parseRetryAfter(header http.Header) (time.Duration, bool) {
+	retryAfter := header.Get("Retry-After")
+	if retryAfter == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(retryAfter); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(retryAfter); err == nil {
+		return time.Until(at), true
+	}
+
+	return 0, false
+}
+
+// shouldRetry reports whether a response is worth retrying: server errors
+// and secondary rate limits
+func shouldRetry(resp *http.Response) bool {
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return true
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	_, hasRetryAfter := parseRetryAfter(resp.Header)
+	return resp.StatusCode == http.StatusForbidden && hasRetryAfter
+}
+
+// retryDelay returns the delay before the next attempt, honouring
+// Retry-After and falling back to exponential backoff with full jitter
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header); ok {
+			return retryAfter
+		}
+	}
+
+	backoff := retryBaseDelay << uint(attempt)
+	if backoff > retryMaxDelay {
+		backoff = retryMaxDelay
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,102 @@
+package github_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+	"github.com/AjithPanneerselvam/task-etcd/client/github/githubtest"
+	"github.com/pkg/errors"
+)
+
+func TestRateLimitPerToken(t *testing.T) {
+	ctx := context.Background()
+
+	server := githubtest.NewServer(
+		githubtest.User{UserInfo: github.UserInfo{ID: 1, Login: "alice"}},
+		githubtest.User{UserInfo: github.UserInfo{ID: 2, Login: "bob"}},
+	)
+	defer server.Close()
+
+	githubClient := github.New(server.OAuthURL(), server.APIURL(), "client-id", "client-secret", nil, 5, 0)
+
+	aliceToken := server.Handler.IssueToken("alice")
+	bobToken := server.Handler.IssueToken("bob")
+
+	server.Handler.SetFailure("/user", githubtest.FailureSecondaryRateLimited)
+	_, err := githubClient.GetUserInfo(ctx, aliceToken)
+	if errors.Cause(err) != github.ErrGithubRateLimited {
+		t.Fatalf("GetUserInfo() error = %v, want %v", err, github.ErrGithubRateLimited)
+	}
+	server.Handler.SetFailure("/user", githubtest.FailureNone)
+
+	if githubClient.RetryAfter(aliceToken) == 0 {
+		t.Errorf("RetryAfter() of the rate limited token = 0")
+	}
+
+	if retryAfter := githubClient.RetryAfter(bobToken); retryAfter != 0 {
+		t.Errorf("RetryAfter() of another token = %v, want 0", retryAfter)
+	}
+
+	// the token backs off without asking github
+	requests := server.Handler.Requests("/user")
+	_, err = githubClient.GetUserInfo(ctx, aliceToken)
+	if errors.Cause(err) != github.ErrGithubRateLimited {
+		t.Errorf("GetUserInfo() error = %v, want %v", err, github.ErrGithubRateLimited)
+	}
+	if server.Handler.Requests("/user") != requests {
+		t.Errorf("GetUserInfo() of the rate limited token was sent to github")
+	}
+
+	userInfo, err := githubClient.GetUserInfo(ctx, bobToken)
+	if err != nil || userInfo.Login != "bob" {
+		t.Errorf("GetUserInfo() of another token = %v, %v, want bob", userInfo, err)
+	}
+
+	// logins of other users are not held back
+	_, err = githubClient.GetAccessToken(ctx, "unknown-code", "")
+	if errors.Cause(err) != github.ErrGithubBadVerificationCode {
+		t.Errorf("GetAccessToken() error = %v, want %v", err, github.ErrGithubBadVerificationCode)
+	}
+}
+
+func TestRateLimitExhaustedQuota(t *testing.T) {
+	ctx := context.Background()
+
+	server := githubtest.NewServer(
+		githubtest.User{UserInfo: github.UserInfo{ID: 1, Login: "alice"}},
+		githubtest.User{UserInfo: github.UserInfo{ID: 2, Login: "bob"}},
+	)
+	defer server.Close()
+
+	githubClient := github.New(server.OAuthURL(), server.APIURL(), "client-id", "client-secret", nil, 5, 0)
+
+	aliceToken := server.Handler.IssueToken("alice")
+	bobToken := server.Handler.IssueToken("bob")
+
+	server.Handler.SetFailure("/user", githubtest.FailureRateLimited)
+	_, err := githubClient.GetUserInfo(ctx, aliceToken)
+	if errors.Cause(err) != github.ErrGithubRateLimited {
+		t.Fatalf("GetUserInfo() error = %v, want %v", err, github.ErrGithubRateLimited)
+	}
+	server.Handler.SetFailure("/user", githubtest.FailureNone)
+
+	if githubClient.RetryAfter(aliceToken) == 0 {
+		t.Errorf("RetryAfter() of the token without quota = 0")
+	}
+
+	// the token waits for the reset without asking github
+	requests := server.Handler.Requests("/user")
+	_, err = githubClient.GetUserInfo(ctx, aliceToken)
+	if errors.Cause(err) != github.ErrGithubRateLimited {
+		t.Errorf("GetUserInfo() error = %v, want %v", err, github.ErrGithubRateLimited)
+	}
+	if server.Handler.Requests("/user") != requests {
+		t.Errorf("GetUserInfo() of the token without quota was sent to github")
+	}
+
+	userInfo, err := githubClient.GetUserInfo(ctx, bobToken)
+	if err != nil || userInfo.Login != "bob" {
+		t.Errorf("GetUserInfo() of another token = %v, %v, want bob", userInfo, err)
+	}
+}
@@ -1,20 +1,90 @@
 package github
 
+import (
+	"time"
+)
+
 type AccessTokenRequest struct {
 	ClientID     string `json:"client_id"`
 	ClientSecret string `json:"client_secret"`
 	Code         string `json:"code"`
+	CodeVerifier string `json:"code_verifier,omitempty"`
 }
 
 type AccessTokenResponse struct {
 	AccessToken string `json:"access_token"`
 	TokenType   string `json:"token_type"`
 	Scope       string `json:"scope"`
+
+	// github reports oauth errors in the body of a 200 response
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
 }
 
 type UserInfo struct {
+	Login     string `json:"login"`
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type Org struct {
 	Login string `json:"login"`
 	ID    int    `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+}
+
+type TeamMembership struct {
+	// State is active, or pending until the user accepts the invitation
+	State string `json:"state"`
+	Role  string `json:"role"`
+}
+
+// Issue is an issue or, when PullRequest is set, a pull request
+type Issue struct {
+	ID            int64             `json:"id"`
+	Number        int               `json:"number"`
+	Title         string            `json:"title"`
+	Body          string            `json:"body"`
+	State         string            `json:"state"`
+	HTMLURL       string            `json:"html_url"`
+	RepositoryURL string            `json:"repository_url"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	PullRequest   *IssuePullRequest `json:"pull_request,omitempty"`
+}
+
+type IssuePullRequest struct {
+	HTMLURL  string     `json:"html_url"`
+	MergedAt *time.Time `json:"merged_at,omitempty"`
+}
+
+// IssueRequest creates an issue or updates every field of one
+type IssueRequest struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	State string `json:"state,omitempty"`
+}
+
+type SearchIssuesResponse struct {
+	TotalCount int     `json:"total_count"`
+	Items      []Issue `json:"items"`
+}
+
+// PullRequest is a pull request as sent in pull_request webhook events
+type PullRequest struct {
+	ID       int64      `json:"id"`
+	Number   int        `json:"number"`
+	Title    string     `json:"title"`
+	State    string     `json:"state"`
+	HTMLURL  string     `json:"html_url"`
+	Merged   bool       `json:"merged"`
+	MergedAt *time.Time `json:"merged_at,omitempty"`
+}
+
+// WebhookEvent is the payload of the issues, pull_request and issue_comment
+// webhook events, only one of Issue and PullRequest is set
+type WebhookEvent struct {
+	Action      string       `json:"action"`
+	Issue       *Issue       `json:"issue,omitempty"`
+	PullRequest *PullRequest `json:"pull_request,omitempty"`
 }
@@ -0,0 +1,36 @@
+package github
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const (
+	WebhookEventHeader     = "X-GitHub-Event"
+	WebhookDeliveryHeader  = "X-GitHub-Delivery"
+	WebhookSignatureHeader = "X-Hub-Signature-256"
+
+	WebhookEventPing         = "ping"
+	WebhookEventIssues       = "issues"
+	WebhookEventPullRequest  = "pull_request"
+	WebhookEventIssueComment = "issue_comment"
+
+	webhookSignaturePrefix = "sha256="
+)
+
+// WebhookSignature returns the X-Hub-Signature-256 header of a webhook
+// delivery, the hex encoded HMAC-SHA256 of the body keyed by the webhook
+// secret
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return webhookSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidWebhookSignature checks the X-Hub-Signature-256 header of a webhook
+// delivery in constant time
+func ValidWebhookSignature(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(WebhookSignature(secret, body)))
+}
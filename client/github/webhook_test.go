@@ -0,0 +1,41 @@
+package github
+
+import "testing"
+
+func TestValidWebhookSignature(t *testing.T) {
+	const (
+		secret = "It's a Secret to Everybody"
+		body   = "Hello, World!"
+		// the example delivery of the github webhook docs
+		signature = "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+	)
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      string
+		signature string
+		want      bool
+	}{
+		{name: "valid", secret: secret, body: body, signature: signature, want: true},
+		{name: "other secret", secret: "another secret", body: body, signature: signature},
+		{name: "tampered body", secret: secret, body: "Hello, World?", signature: signature},
+		{name: "missing signature", secret: secret, body: body, signature: ""},
+		{name: "missing prefix", secret: secret, body: body, signature: signature[len("sha256="):]},
+		{name: "sha1 prefix", secret: secret, body: body, signature: "sha1=" + signature[len("sha256="):]},
+		{name: "uppercase hex", secret: secret, body: body,
+			signature: "sha256=757107EA0EB2509FC211221CCE984B8A37570B6D7586C22C46F4379C8B043E17"},
+		{name: "truncated", secret: secret, body: body, signature: signature[:len(signature)-2]},
+		{name: "empty body", secret: secret, body: "", signature: WebhookSignature(secret, nil), want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ValidWebhookSignature(test.secret, []byte(test.body), test.signature)
+			if got != test.want {
+				t.Errorf("ValidWebhookSignature(%q, %q, %q) = %v, want %v", test.secret, test.body,
+					test.signature, got, test.want)
+			}
+		})
+	}
+}
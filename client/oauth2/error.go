@@ -0,0 +1,66 @@
+package oauth2
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// ErrOAuth2Client implements Error interface
+type ErrOAuth2Client string
+
+const (
+	ErrOAuth2InvalidGrant ErrOAuth2Client = "error invalid or expired authorization code"
+	ErrOAuth2Unauthorized ErrOAuth2Client = "error unauthorized by the authorization server"
+	ErrOAuth2RateLimited  ErrOAuth2Client = "error rate limited by the authorization server"
+	ErrOAuth2Upstream     ErrOAuth2Client = "error authorization server failure"
+)
+
+func (e ErrOAuth2Client) Error() string {
+	return string(e)
+}
+
+const (
+	oAuthErrorInvalidGrant = "invalid_grant"
+)
+
+func checkResponse(resp *http.Response, respBody []byte) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	detail := fmt.Sprintf("status %d: %s", resp.StatusCode, truncate(respBody, 256))
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errors.Wrap(ErrOAuth2Unauthorized, detail)
+	case http.StatusTooManyRequests:
+		return errors.Wrap(ErrOAuth2RateLimited, detail)
+	}
+
+	return errors.Wrap(ErrOAuth2Upstream, detail)
+}
+
+func tokenError(tokenResponse TokenResponse) error {
+	detail := tokenResponse.Error
+	if tokenResponse.ErrorDescription != "" {
+		detail = fmt.Sprintf("%s (%s)", detail, tokenResponse.ErrorDescription)
+	}
+
+	if tokenResponse.Error == oAuthErrorInvalidGrant {
+		return errors.Wrap(ErrOAuth2InvalidGrant, detail)
+	}
+
+	return errors.Wrap(ErrOAuth2Upstream, detail)
+}
+
+func truncate(body []byte, size int) string {
+	body = bytes.TrimSpace(body)
+	if len(body) <= size {
+		return string(body)
+	}
+
+	return string(body[:size]) + "..."
+}
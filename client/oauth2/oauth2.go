@@ -0,0 +1,172 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	codeChallengeMethodS256 = "S256"
+)
+
+// Endpoint holds the urls of an oauth2 authorization server
+type Endpoint struct {
+	AuthorizeURL string
+	TokenURL     string
+}
+
+// Client is a generic oauth2 authorization code client. Like the github
+// client it holds no per user state and is safe for concurrent use.
+type Client struct {
+	*http.Client
+	endpoint     Endpoint
+	clientID     string
+	clientSecret string
+	scopes       []string
+}
+
+func New(endpoint Endpoint, clientID string, clientSecret string, scopes []string,
+	timeoutInSec int32) *Client {
+
+	return &Client{
+		endpoint:     endpoint,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+		Client: &http.Client{
+			Timeout: time.Duration(timeoutInSec) * time.Second,
+		},
+	}
+}
+
+// GetRedirectAuthorizeURL returns the authorize url bound to the given state
+// and PKCE code challenge. Extra params, e.g. an OIDC nonce, are added to
+// the query.
+func (c *Client) GetRedirectAuthorizeURL(callbackURL string, state string, codeChallenge string,
+	extraParams url.Values) (string, error) {
+
+	authorizeParsedURL, err := url.Parse(c.endpoint.AuthorizeURL)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing authorize url")
+	}
+
+	query := authorizeParsedURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", c.clientID)
+	query.Set("redirect_uri", callbackURL)
+	query.Set("state", state)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", codeChallengeMethodS256)
+	if len(c.scopes) > 0 {
+		query.Set("scope", strings.Join(c.scopes, " "))
+	}
+	for key, values := range extraParams {
+		query[key] = values
+	}
+	authorizeParsedURL.RawQuery = query.Encode()
+
+	return authorizeParsedURL.String(), nil
+}
+
+// Exchange exchanges the authorization code for tokens
+func (c *Client) Exchange(ctx context.Context, authCode string, callbackURL string,
+	codeVerifier string) (*TokenResponse, error) {
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", authCode)
+	form.Set("redirect_uri", callbackURL)
+	form.Set("client_id", c.clientID)
+	form.Set("client_secret", c.clientSecret)
+	if codeVerifier != "" {
+		form.Set("code_verifier", codeVerifier)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint.TokenURL,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating token request")
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, respBody, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokenResponse TokenResponse
+	jsonErr := json.Unmarshal(respBody, &tokenResponse)
+
+	// oauth2 errors come with a 400, and some servers send them with a 200
+	if tokenResponse.Error != "" {
+		return nil, tokenError(tokenResponse)
+	}
+
+	err = checkResponse(resp, respBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if jsonErr != nil {
+		return nil, errors.Wrap(ErrOAuth2Upstream, "error unmarshalling token response body")
+	}
+
+	if tokenResponse.AccessToken == "" {
+		return nil, errors.Wrap(ErrOAuth2Upstream, "access token is missing in the response")
+	}
+
+	return &tokenResponse, nil
+}
+
+// GetJSON fetches an api resource with the access token and unmarshals it
+func (c *Client) GetJSON(ctx context.Context, resourceURL string, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resourceURL, nil)
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	req.Header.Set("Accept", "application/json")
+
+	resp, respBody, err := c.do(req)
+	if err != nil {
+		return err
+	}
+
+	err = checkResponse(resp, respBody)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(respBody, v)
+	if err != nil {
+		return errors.Wrap(ErrOAuth2Upstream, "error unmarshalling response body")
+	}
+
+	return nil
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, []byte, error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error making request")
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error reading response body")
+	}
+
+	return resp, respBody, nil
+}
@@ -0,0 +1,89 @@
+// Command githubtest runs the fake github server for local development.
+// Point the service at it with
+//
+//	GITHUB_OAUTH_URL=http://localhost:9090/login/oauth
+//	GITHUB_API_URL=http://localhost:9090
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+	"github.com/AjithPanneerselvam/task-etcd/client/github/githubtest"
+	log "github.com/sirupsen/logrus"
+)
+
+var failureModes = map[string]githubtest.FailureMode{
+	"":                     githubtest.FailureNone,
+	"bad-code":             githubtest.FailureBadVerificationCode,
+	"unauthorized":         githubtest.FailureUnauthorized,
+	"rate-limited":         githubtest.FailureRateLimited,
+	"secondary-rate-limit": githubtest.FailureSecondaryRateLimited,
+	"server-error":         githubtest.FailureServerError,
+}
+
+func main() {
+	listenAddr := flag.String("listen", ":9090", "address to listen on")
+	users := flag.String("users", "octocat:1", "comma separated login:id[:org+org[:org/team+org/team]] users, "+
+		"the first one logs in by default")
+	latency := flag.Duration("latency", 0, "delay added to every response")
+	failure := flag.String("failure", "", "failure mode applied to every request: bad-code, unauthorized, "+
+		"rate-limited, secondary-rate-limit or server-error")
+	rateLimit := flag.Int("rate-limit", 5000, "quota reported in the X-RateLimit-* headers")
+	flag.Parse()
+
+	failureMode, ok := failureModes[*failure]
+	if !ok {
+		log.Fatalf("unknown failure mode %q", *failure)
+	}
+
+	handler := githubtest.NewHandler()
+	for _, user := range strings.Split(*users, ",") {
+		githubUser, err := parseUser(user)
+		if err != nil {
+			log.Fatalf("error parsing user %q: %v", user, err)
+		}
+
+		handler.AddUser(githubUser)
+		log.Infof("added user %v of id %v in orgs %v and teams %v", githubUser.Login, githubUser.ID,
+			githubUser.Orgs, githubUser.Teams)
+	}
+
+	handler.SetLatency(*latency)
+	handler.SetFailure("", failureMode)
+	handler.SetRateLimit(*rateLimit, *rateLimit)
+	handler.SetRetryAfter(time.Minute)
+
+	log.Infof("fake github listening at %v", *listenAddr)
+	log.Fatal(http.ListenAndServe(*listenAddr, handler))
+}
+
+func parseUser(user string) (githubtest.User, error) {
+	parts := strings.SplitN(strings.TrimSpace(user), ":", 4)
+	if len(parts) < 2 {
+		return githubtest.User{}, strconv.ErrSyntax
+	}
+
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return githubtest.User{}, err
+	}
+
+	githubUser := githubtest.User{
+		UserInfo: github.UserInfo{Login: parts[0], ID: id, Name: parts[0]},
+	}
+
+	if len(parts) > 2 && parts[2] != "" {
+		githubUser.Orgs = strings.Split(parts[2], "+")
+	}
+
+	if len(parts) > 3 && parts[3] != "" {
+		githubUser.Teams = strings.Split(parts[3], "+")
+	}
+
+	return githubUser, nil
+}
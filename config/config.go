@@ -13,11 +13,90 @@ type Config struct {
 
 	EtcdURLS []string `envconfig:"ETCD_URLS" required:"true"`
 
-	GithubClientID     string `envconfig:"GITHUB_CLIENT_ID" required:"true"`
-	GithubClientSecret string `envconfig:"GITHUB_CLIENT_SECRET" required:"true"`
-	GithubOAuthURL     string `envconfig:"GITHUB_OAUTH_URL" required:"true"`
-	GithubTimeoutInSec int32  `envconfig:"GITHUB_TIMEOUT_IN_SEC" required:"true"`
-	GithubAPIURL       string `envconfig:"GITHUB_API_URL" required:"true"`
+	// github login is enabled when the client id is set
+	GithubClientID     string `envconfig:"GITHUB_CLIENT_ID"`
+	GithubClientSecret string `envconfig:"GITHUB_CLIENT_SECRET"`
+	GithubOAuthURL     string `envconfig:"GITHUB_OAUTH_URL" default:"https://github.com/login/oauth"`
+	GithubTimeoutInSec int32  `envconfig:"GITHUB_TIMEOUT_IN_SEC" default:"2"`
+	GithubAPIURL       string `envconfig:"GITHUB_API_URL" default:"https://api.github.com"`
+	GithubMaxRetries   int    `envconfig:"GITHUB_MAX_RETRIES" default:"2"`
+
+	// github logins are restricted to these orgs, teams (as org/team-slug)
+	// and logins when any is set
+	GithubAllowedOrgs   []string `envconfig:"GITHUB_ALLOWED_ORGS"`
+	GithubAllowedTeams  []string `envconfig:"GITHUB_ALLOWED_TEAMS"`
+	GithubAllowedLogins []string `envconfig:"GITHUB_ALLOWED_LOGINS"`
+	// token of an org member the allow lists are revalidated with
+	GithubMembershipToken         string `envconfig:"GITHUB_MEMBERSHIP_TOKEN"`
+	GithubRevalidateIntervalInMin int64  `envconfig:"GITHUB_REVALIDATE_INTERVAL_IN_MINS" default:"60"`
+
+	// users who opt in get the github issues assigned to them imported as
+	// tasks, their github tokens are sealed with the base64 encoded 32 byte
+	// credential seal key
+	GithubSyncEnabled       bool     `envconfig:"GITHUB_SYNC_ENABLED" default:"false"`
+	GithubSyncScopes        []string `envconfig:"GITHUB_SYNC_SCOPES" default:"public_repo"`
+	GithubSyncIntervalInMin int64    `envconfig:"GITHUB_SYNC_INTERVAL_IN_MINS" default:"30"`
+	CredentialSealKey       string   `envconfig:"CREDENTIAL_SEAL_KEY"`
+	// settles tasks exported to github that changed on both sides: github,
+	// task or manual
+	GithubSyncConflictPolicy string `envconfig:"GITHUB_SYNC_CONFLICT_POLICY" default:"manual"`
+	// the github webhook completing linked tasks is enabled, along with the
+	// sync, when the secret is set
+	GithubWebhookSecret           string `envconfig:"GITHUB_WEBHOOK_SECRET"`
+	GithubWebhookDeliveryTTLInHrs int64  `envconfig:"GITHUB_WEBHOOK_DELIVERY_TTL_IN_HRS" default:"72"`
+
+	// reminders of tasks are delivered by the leader of the instances with
+	// REMINDERS_ENABLED, with the notifiers listed: log, webhook and inbox
+	RemindersEnabled            bool     `envconfig:"REMINDERS_ENABLED" default:"false"`
+	ReminderNotifiers           []string `envconfig:"REMINDER_NOTIFIERS" default:"log"`
+	ReminderPollIntervalInSecs  int64    `envconfig:"REMINDER_POLL_INTERVAL_IN_SECS" default:"15"`
+	ReminderLeaderTTLInSecs     int64    `envconfig:"REMINDER_LEADER_TTL_IN_SECS" default:"15"`
+	ReminderWebhookURL          string   `envconfig:"REMINDER_WEBHOOK_URL"`
+	ReminderWebhookSecret       string   `envconfig:"REMINDER_WEBHOOK_SECRET"`
+	ReminderWebhookTimeoutInSec int32    `envconfig:"REMINDER_WEBHOOK_TIMEOUT_IN_SEC" default:"5"`
+
+	// what becomes of the subtasks of a deleted task, promote or delete, and
+	// of a completed one, keep, complete or require, unless a request says
+	SubtasksOnDelete   string `envconfig:"SUBTASKS_ON_DELETE" default:"promote"`
+	SubtasksOnComplete string `envconfig:"SUBTASKS_ON_COMPLETE" default:"keep"`
+
+	GitlabURL          string `envconfig:"GITLAB_URL" default:"https://gitlab.com"`
+	GitlabClientID     string `envconfig:"GITLAB_CLIENT_ID"`
+	GitlabClientSecret string `envconfig:"GITLAB_CLIENT_SECRET"`
+	GitlabTimeoutInSec int32  `envconfig:"GITLAB_TIMEOUT_IN_SEC" default:"5"`
+
+	OIDCProviderName string   `envconfig:"OIDC_PROVIDER_NAME" default:"oidc"`
+	OIDCIssuerURL    string   `envconfig:"OIDC_ISSUER_URL"`
+	OIDCClientID     string   `envconfig:"OIDC_CLIENT_ID"`
+	OIDCClientSecret string   `envconfig:"OIDC_CLIENT_SECRET"`
+	OIDCScopes       []string `envconfig:"OIDC_SCOPES" default:"openid,profile,email"`
+	OIDCTimeoutInSec int32    `envconfig:"OIDC_TIMEOUT_IN_SEC" default:"5"`
+
+	// claims the profile of an OIDC user is read from
+	OIDCUserIDClaim    string `envconfig:"OIDC_USER_ID_CLAIM" default:"sub"`
+	OIDCLoginClaim     string `envconfig:"OIDC_LOGIN_CLAIM" default:"preferred_username"`
+	OIDCNameClaim      string `envconfig:"OIDC_NAME_CLAIM" default:"name"`
+	OIDCEmailClaim     string `envconfig:"OIDC_EMAIL_CLAIM" default:"email"`
+	OIDCAvatarURLClaim string `envconfig:"OIDC_AVATAR_URL_CLAIM" default:"picture"`
+
+	// github users granted the admin role on login
+	AdminGithubLogins []string `envconfig:"ADMIN_GITHUB_LOGINS"`
+	AdminGithubIDs    []string `envconfig:"ADMIN_GITHUB_IDS"`
+
+	LocalAccountsEnabled        bool   `envconfig:"LOCAL_ACCOUNTS_ENABLED" default:"false"`
+	LocalOpenRegistration       bool   `envconfig:"LOCAL_OPEN_REGISTRATION" default:"false"`
+	LocalMaxFailedLogins        int    `envconfig:"LOCAL_MAX_FAILED_LOGINS" default:"5"`
+	LocalLockoutInMins          int64  `envconfig:"LOCAL_LOCKOUT_IN_MINS" default:"15"`
+	LocalResetTokenTTLInMins    int64  `envconfig:"LOCAL_RESET_TOKEN_TTL_IN_MINS" default:"60"`
+	LocalBootstrapAdminUsername string `envconfig:"LOCAL_BOOTSTRAP_ADMIN_USERNAME"`
+	LocalBootstrapAdminPassword string `envconfig:"LOCAL_BOOTSTRAP_ADMIN_PASSWORD"`
+
+	OAuthStateTTLInSecs int64 `envconfig:"OAUTH_STATE_TTL_IN_SECS" default:"600"`
+	SecureCookies       bool  `envconfig:"SECURE_COOKIES" default:"false"`
+
+	// browsers get the token as an HttpOnly cookie instead of a JSON body,
+	// only along with secure cookies
+	SessionCookiesEnabled bool `envconfig:"SESSION_COOKIES_ENABLED" default:"false"`
 
 	JWTSecretyKey   string `envconfig:"JWT_SECRET_KEY" required:"true"`
 	JWTExpiryInMins int64  `envconfig:"JWT_EXPIRY_IN_MINS" required:"true"`
@@ -7,7 +7,7 @@ import (
 )
 
 // NewEtcdClient returns a new etcd client instance
-func NewEtcdClient(etcdURLs []string) (clientv3.KV, error) {
+func NewEtcdClient(etcdURLs []string) (*clientv3.Client, error) {
 	client, err := clientv3.New(clientv3.Config{
 		Endpoints:   etcdURLs,
 		DialTimeout: 5 * time.Second,
@@ -17,5 +17,5 @@ func NewEtcdClient(etcdURLs []string) (clientv3.KV, error) {
 		return nil, err
 	}
 
-	return clientv3.NewKV(client), nil
+	return client, nil
 }
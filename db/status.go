@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+
+	"github.com/coreos/etcd/clientv3"
+)
+
+// EndpointStatus is the status of an etcd endpoint as seen by the service
+type EndpointStatus struct {
+	Endpoint string `json:"endpoint"`
+	Version  string `json:"version,omitempty"`
+	DBSize   int64  `json:"dbSize,omitempty"`
+	IsLeader bool   `json:"isLeader"`
+	Error    string `json:"error,omitempty"`
+}
+
+// StatusChecker reports the status of the etcd cluster
+type StatusChecker struct {
+	client *clientv3.Client
+}
+
+func NewStatusChecker(client *clientv3.Client) *StatusChecker {
+	return &StatusChecker{
+		client: client,
+	}
+}
+
+// Status returns the status of every endpoint the client is configured
+// with. An unreachable endpoint is reported with its error.
+func (s *StatusChecker) Status(ctx context.Context) []EndpointStatus {
+	endpoints := s.client.Endpoints()
+	statuses := make([]EndpointStatus, 0, len(endpoints))
+
+	for _, endpoint := range endpoints {
+		endpointStatus := EndpointStatus{
+			Endpoint: endpoint,
+		}
+
+		resp, err := s.client.Status(ctx, endpoint)
+		if err != nil {
+			endpointStatus.Error = err.Error()
+		} else {
+			endpointStatus.Version = resp.Version
+			endpointStatus.DBSize = resp.DbSize
+			endpointStatus.IsLeader = resp.Header.MemberId == resp.Leader
+		}
+
+		statuses = append(statuses, endpointStatus)
+	}
+
+	return statuses
+}
@@ -0,0 +1,792 @@
+package account
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/handler/login"
+	"github.com/AjithPanneerselvam/task-etcd/identity"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	accountstore "github.com/AjithPanneerselvam/task-etcd/store/account"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	totpIssuer = "task-etcd"
+
+	PasswordMinLength = 10
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{2,63}$`)
+
+var (
+	errTOTPReplayed       = errors.New("error as the totp code was already used")
+	errTOTPStateUnchanged = errors.New("error as the totp state is unchanged")
+	errTOTPEnabled        = errors.New("error as totp is already enabled")
+)
+
+type AccountHandler struct {
+	accountStore     store.AccountStore
+	userStore        store.UserStore
+	sessionStore     store.SessionStore
+	jwtAuthenticator *auth.JWTAuth
+
+	openRegistration bool
+	maxFailedLogins  int
+	lockoutDuration  time.Duration
+	resetTokenTTL    time.Duration
+}
+
+type CredentialsRequest struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	TOTPCode string   `json:"totpCode,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type ResetPasswordRequest struct {
+	ResetToken  string `json:"resetToken"`
+	NewPassword string `json:"newPassword"`
+}
+
+type ResetTokenResponse struct {
+	ResetToken string    `json:"resetToken"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+type TOTPRequest struct {
+	Code string `json:"code"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewAccountHandler(accountStore store.AccountStore, userStore store.UserStore,
+	sessionStore store.SessionStore, jwtAuthenticator *auth.JWTAuth,
+	openRegistration bool, maxFailedLogins int, lockoutDuration time.Duration,
+	resetTokenTTL time.Duration) *AccountHandler {
+
+	return &AccountHandler{
+		accountStore:     accountStore,
+		userStore:        userStore,
+		sessionStore:     sessionStore,
+		jwtAuthenticator: jwtAuthenticator,
+		openRegistration: openRegistration,
+		maxFailedLogins:  maxFailedLogins,
+		lockoutDuration:  lockoutDuration,
+		resetTokenTTL:    resetTokenTTL,
+	}
+}
+
+// Register creates an account for anyone, when open registration is enabled
+func (a *AccountHandler) Register(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	if !a.openRegistration {
+		log.Info("registration rejected as open registration is disabled")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	var credentialsRequest CredentialsRequest
+	err := json.NewDecoder(r.Body).Decode(&credentialsRequest)
+	if err != nil {
+		log.Errorf("error unmarshalling registration request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// scopes beyond the defaults are granted by admins only
+	credentialsRequest.Scopes = nil
+
+	a.createAccount(w, r, credentialsRequest)
+}
+
+// CreateAccount creates an account on behalf of an admin, optionally with
+// scopes beyond the defaults
+func (a *AccountHandler) CreateAccount(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var credentialsRequest CredentialsRequest
+	err := json.NewDecoder(r.Body).Decode(&credentialsRequest)
+	if err != nil {
+		log.Errorf("error unmarshalling create account request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	for _, scope := range credentialsRequest.Scopes {
+		if !auth.IsKnownScope(scope) {
+			writeError(w, http.StatusBadRequest, "unknown_scope")
+			return
+		}
+	}
+
+	a.createAccount(w, r, credentialsRequest)
+}
+
+func (a *AccountHandler) createAccount(w http.ResponseWriter, r *http.Request, credentialsRequest CredentialsRequest) {
+	ctx := r.Context()
+
+	username := strings.ToLower(strings.TrimSpace(credentialsRequest.Username))
+	if !usernamePattern.MatchString(username) {
+		writeError(w, http.StatusBadRequest, "invalid_username")
+		return
+	}
+
+	if reason := validatePassword(credentialsRequest.Password); reason != "" {
+		writeError(w, http.StatusBadRequest, reason)
+		return
+	}
+
+	passwordHash, err := auth.HashPassword(credentialsRequest.Password)
+	if err != nil {
+		log.Errorf("error hashing password: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	account := store.Account{
+		Username:          username,
+		PasswordHash:      passwordHash,
+		Scopes:            credentialsRequest.Scopes,
+		CreatedAt:         now,
+		PasswordChangedAt: now,
+	}
+
+	err = a.accountStore.CreateAccount(ctx, account)
+	if errors.Cause(err) == accountstore.ErrAccountStoreUsernameTaken {
+		writeError(w, http.StatusConflict, "username_taken")
+		return
+	}
+	if err != nil {
+		log.Errorf("error creating account %v: %v", username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Infof("account %v created", username)
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Login checks the credentials, and the TOTP code once a second factor is
+// enrolled, and issues a token. Accounts are locked for a while after
+// repeated failures.
+func (a *AccountHandler) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	var credentialsRequest CredentialsRequest
+	err := json.NewDecoder(r.Body).Decode(&credentialsRequest)
+	if err != nil {
+		log.Errorf("error unmarshalling login request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	username := strings.ToLower(strings.TrimSpace(credentialsRequest.Username))
+
+	account, err := a.accountStore.ReadAccount(ctx, username)
+	if errors.Cause(err) == accountstore.ErrAccountStoreNoRecord {
+		// same work and response as a wrong password, not to reveal which usernames exist
+		auth.CheckPassword("", credentialsRequest.Password)
+		writeError(w, http.StatusUnauthorized, "invalid_credentials")
+		return
+	}
+	if err != nil {
+		log.Errorf("error reading account %v: %v", username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	if now.Before(account.LockedUntil) {
+		log.Infof("login to locked account %v rejected", username)
+		writeLocked(w, account.LockedUntil.Sub(now))
+		return
+	}
+
+	if !auth.CheckPassword(account.PasswordHash, credentialsRequest.Password) {
+		a.recordFailedLogin(ctx, w, username, http.StatusUnauthorized)
+		return
+	}
+
+	var step int64
+	if account.TOTPEnabled {
+		if credentialsRequest.TOTPCode == "" {
+			writeError(w, http.StatusUnauthorized, "totp_required")
+			return
+		}
+
+		var ok bool
+		step, ok = auth.VerifyTOTP(account.TOTPSecret, credentialsRequest.TOTPCode, now)
+		if !ok || step <= account.LastTOTPStep {
+			a.recordFailedLogin(ctx, w, username, http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// a code is used once, even by logins racing on other instances
+	account, err = a.accountStore.UpdateAccount(ctx, username, func(account *store.Account) error {
+		if step > 0 {
+			if step <= account.LastTOTPStep {
+				return errTOTPReplayed
+			}
+			account.LastTOTPStep = step
+		}
+
+		account.FailedLogins = 0
+		account.LockedUntil = time.Time{}
+
+		return nil
+	})
+	if err == errTOTPReplayed {
+		a.recordFailedLogin(ctx, w, username, http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Errorf("error updating account %v: %v", username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	scopes := account.Scopes
+	if len(scopes) == 0 {
+		scopes = auth.DefaultUserScopes
+	}
+
+	userID := identity.UserID(identity.ProviderLocal, account.Username)
+
+	var roles []string
+	if auth.HasScope(scopes, auth.ScopeAdmin) {
+		roles = []string{store.RoleAdmin}
+	}
+
+	userProfile, err := a.userStore.RecordLogin(ctx, store.UserProfile{
+		UserID:      userID,
+		Provider:    identity.ProviderLocal,
+		Login:       account.Username,
+		DisplayName: account.Username,
+		Roles:       roles,
+		LastLoginAt: now,
+	})
+	if err != nil {
+		log.Errorf("error recording login of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if userProfile.Disabled {
+		log.Infof("login of disabled user %v rejected", userID)
+		writeError(w, http.StatusForbidden, "account_disabled")
+		return
+	}
+	log.Infof("user %v of id %v signed in", account.Username, userID)
+
+	jwtTokenString, err := login.IssueSessionToken(r, a.sessionStore, a.jwtAuthenticator, userID, scopes)
+	if err != nil {
+		log.Errorf("error issuing session token: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if a.jwtAuthenticator.SessionCookies() {
+		a.jwtAuthenticator.SetSessionCookies(w, jwtTokenString)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(login.UserInfo{
+		ID:    userID,
+		Token: jwtTokenString,
+	})
+	if err != nil {
+		log.Errorf("error encoding the login response: %v", err)
+	}
+}
+
+// recordFailedLogin counts a wrong password or code against the account,
+// locking it after maxFailedLogins in a row. The rejection is written with
+// statusCode unless the account got locked.
+func (a *AccountHandler) recordFailedLogin(ctx context.Context, w http.ResponseWriter, username string,
+	statusCode int) {
+
+	var locked bool
+	account, err := a.accountStore.UpdateAccount(ctx, username, func(account *store.Account) error {
+		account.FailedLogins++
+
+		locked = account.FailedLogins >= a.maxFailedLogins
+		if locked {
+			account.FailedLogins = 0
+			account.LockedUntil = time.Now().UTC().Add(a.lockoutDuration)
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Errorf("error recording failed login of account %v: %v", username, err)
+	}
+
+	if err == nil && locked {
+		log.Warnf("account %v locked until %v after repeated failed logins", username, account.LockedUntil)
+		writeLocked(w, a.lockoutDuration)
+		return
+	}
+
+	writeError(w, statusCode, "invalid_credentials")
+}
+
+// ChangePassword changes the password of the caller's local account
+func (a *AccountHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	account, ok := a.fetchCallerAccount(w, r)
+	if !ok {
+		return
+	}
+
+	var changePasswordRequest ChangePasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&changePasswordRequest)
+	if err != nil {
+		log.Errorf("error unmarshalling change password request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// the current password is guessed as easily here as at login
+	now := time.Now().UTC()
+	if now.Before(account.LockedUntil) {
+		log.Infof("password change of locked account %v rejected", account.Username)
+		writeLocked(w, account.LockedUntil.Sub(now))
+		return
+	}
+
+	if !auth.CheckPassword(account.PasswordHash, changePasswordRequest.CurrentPassword) {
+		a.recordFailedLogin(ctx, w, account.Username, http.StatusForbidden)
+		return
+	}
+
+	err = a.setPassword(ctx, account.Username, changePasswordRequest.NewPassword, false)
+	if err != nil {
+		writePasswordError(w, account.Username, err)
+		return
+	}
+
+	// the caller stays signed in on this session only
+	sessionID, _, err := auth.FetchSessionIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching session id from ctx: %v", err)
+	}
+	a.revokeSessions(ctx, account.Username, sessionID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateResetToken issues a one-time password reset token on behalf of an
+// admin, to be handed to the user out of band
+func (a *AccountHandler) CreateResetToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	username := chi.URLParam(r, "username")
+
+	_, err := a.accountStore.ReadAccount(ctx, username)
+	if errors.Cause(err) == accountstore.ErrAccountStoreNoRecord {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("error reading account %v: %v", username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resetToken, err := auth.NewRandomToken()
+	if err != nil {
+		log.Errorf("error generating reset token: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// only the hash is stored, a leaked keyspace does not leak usable tokens
+	err = a.accountStore.CreateResetToken(ctx, hashToken(resetToken), username, a.resetTokenTTL)
+	if err != nil {
+		log.Errorf("error storing reset token of account %v: %v", username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Infof("reset token issued for account %v", username)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ResetTokenResponse{
+		ResetToken: resetToken,
+		ExpiresAt:  time.Now().UTC().Add(a.resetTokenTTL),
+	})
+}
+
+// ResetPassword sets a new password with a one-time reset token. It also
+// lifts a lockout.
+func (a *AccountHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	var resetPasswordRequest ResetPasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&resetPasswordRequest)
+	if err != nil {
+		log.Errorf("error unmarshalling reset password request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if reason := validatePassword(resetPasswordRequest.NewPassword); reason != "" {
+		writeError(w, http.StatusBadRequest, reason)
+		return
+	}
+
+	username, err := a.accountStore.ConsumeResetToken(ctx, hashToken(resetPasswordRequest.ResetToken))
+	if errors.Cause(err) == accountstore.ErrAccountStoreNoResetToken {
+		writeError(w, http.StatusBadRequest, "invalid_reset_token")
+		return
+	}
+	if err != nil {
+		log.Errorf("error consuming reset token: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = a.setPassword(ctx, username, resetPasswordRequest.NewPassword, true)
+	if err != nil {
+		writePasswordError(w, username, err)
+		return
+	}
+	log.Infof("password of account %v reset", username)
+
+	a.revokeSessions(ctx, username, "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeSessions revokes the sessions of the account but the one to keep
+// after its password is changed. The password change stands if revoking
+// fails, so the error is only logged.
+func (a *AccountHandler) revokeSessions(ctx context.Context, username string, keepSessionID string) {
+	userID := identity.UserID(identity.ProviderLocal, username)
+
+	revoked, err := a.sessionStore.DeleteOtherSessions(ctx, userID, keepSessionID)
+	if err != nil {
+		log.Errorf("error revoking sessions of user %v: %v", userID, err)
+		return
+	}
+	log.Infof("%v sessions of user %v revoked on password change", revoked, userID)
+}
+
+// EnrollTOTP generates a TOTP secret for the caller. The second factor is
+// required at login only once a code is confirmed with ConfirmTOTP.
+func (a *AccountHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	account, ok := a.fetchCallerAccount(w, r)
+	if !ok {
+		return
+	}
+
+	if account.TOTPEnabled {
+		writeError(w, http.StatusConflict, "totp_already_enabled")
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		log.Errorf("error generating totp secret: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = a.accountStore.UpdateAccount(ctx, account.Username, func(account *store.Account) error {
+		if account.TOTPEnabled {
+			return errTOTPEnabled
+		}
+
+		account.TOTPSecret = secret
+
+		return nil
+	})
+	if err == errTOTPEnabled {
+		writeError(w, http.StatusConflict, "totp_already_enabled")
+		return
+	}
+	if err != nil {
+		log.Errorf("error updating account %v: %v", account.Username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(TOTPEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(totpIssuer, account.Username, secret),
+	})
+}
+
+// ConfirmTOTP enables the enrolled second factor once the caller proves
+// their authenticator produces valid codes
+func (a *AccountHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	a.setTOTPEnabled(w, r, true)
+}
+
+// DisableTOTP disables the second factor, given a valid code
+func (a *AccountHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	a.setTOTPEnabled(w, r, false)
+}
+
+func (a *AccountHandler) setTOTPEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	account, ok := a.fetchCallerAccount(w, r)
+	if !ok {
+		return
+	}
+
+	var totpRequest TOTPRequest
+	err := json.NewDecoder(r.Body).Decode(&totpRequest)
+	if err != nil {
+		log.Errorf("error unmarshalling totp request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if account.TOTPSecret == "" || account.TOTPEnabled == enabled {
+		writeError(w, http.StatusConflict, "totp_state_unchanged")
+		return
+	}
+
+	step, ok := auth.VerifyTOTP(account.TOTPSecret, totpRequest.Code, time.Now())
+	if !ok || step <= account.LastTOTPStep {
+		writeError(w, http.StatusForbidden, "invalid_totp_code")
+		return
+	}
+
+	secret := account.TOTPSecret
+	_, err = a.accountStore.UpdateAccount(ctx, account.Username, func(account *store.Account) error {
+		// the code was checked against the secret read, which a concurrent
+		// enrollment may have replaced
+		if account.TOTPSecret != secret || account.TOTPEnabled == enabled {
+			return errTOTPStateUnchanged
+		}
+
+		if step <= account.LastTOTPStep {
+			return errTOTPReplayed
+		}
+
+		account.LastTOTPStep = step
+		account.TOTPEnabled = enabled
+		if !enabled {
+			account.TOTPSecret = ""
+		}
+
+		return nil
+	})
+	if err == errTOTPStateUnchanged {
+		writeError(w, http.StatusConflict, "totp_state_unchanged")
+		return
+	}
+	if err == errTOTPReplayed {
+		writeError(w, http.StatusForbidden, "invalid_totp_code")
+		return
+	}
+	if err != nil {
+		log.Errorf("error updating account %v: %v", account.Username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Infof("totp of account %v enabled: %v", account.Username, enabled)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fetchCallerAccount reads the local account of the caller, writing the
+// response itself when there is none
+func (a *AccountHandler) fetchCallerAccount(w http.ResponseWriter, r *http.Request) (*store.Account, bool) {
+	ctx := r.Context()
+
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	username, ok := localUsername(userID)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "not_a_local_account")
+		return nil, false
+	}
+
+	account, err := a.accountStore.ReadAccount(ctx, username)
+	if errors.Cause(err) == accountstore.ErrAccountStoreNoRecord {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Errorf("error reading account %v: %v", username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return account, true
+}
+
+// setPassword sets the password of the account, lifting a lockout when
+// unlock is set
+func (a *AccountHandler) setPassword(ctx context.Context, username string, password string, unlock bool) error {
+	if reason := validatePassword(password); reason != "" {
+		return errInvalidPassword(reason)
+	}
+
+	passwordHash, err := auth.HashPassword(password)
+	if err != nil {
+		return errors.Wrap(err, "error hashing password")
+	}
+
+	_, err = a.accountStore.UpdateAccount(ctx, username, func(account *store.Account) error {
+		account.PasswordHash = passwordHash
+		account.PasswordChangedAt = time.Now().UTC()
+
+		if unlock {
+			account.FailedLogins = 0
+			account.LockedUntil = time.Time{}
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+// EnsureAccount creates the account if it does not exist yet, used to
+// bootstrap the first admin of an install. The username and password have to
+// be ones registration would accept.
+func EnsureAccount(ctx context.Context, accountStore store.AccountStore, username string, password string,
+	scopes []string) error {
+
+	username = strings.ToLower(strings.TrimSpace(username))
+	if !usernamePattern.MatchString(username) {
+		return errors.Errorf("error as username %q is invalid", username)
+	}
+
+	if reason := validatePassword(password); reason != "" {
+		return errors.Errorf("error as password of %v is invalid: %v", username, reason)
+	}
+
+	_, err := accountStore.ReadAccount(ctx, username)
+	if err == nil {
+		return nil
+	}
+	if errors.Cause(err) != accountstore.ErrAccountStoreNoRecord {
+		return err
+	}
+
+	passwordHash, err := auth.HashPassword(password)
+	if err != nil {
+		return errors.Wrap(err, "error hashing password")
+	}
+
+	now := time.Now().UTC()
+	err = accountStore.CreateAccount(ctx, store.Account{
+		Username:          username,
+		PasswordHash:      passwordHash,
+		Scopes:            scopes,
+		CreatedAt:         now,
+		PasswordChangedAt: now,
+	})
+	if errors.Cause(err) == accountstore.ErrAccountStoreUsernameTaken {
+		return nil
+	}
+
+	return err
+}
+
+type errInvalidPassword string
+
+func (e errInvalidPassword) Error() string {
+	return string(e)
+}
+
+func writePasswordError(w http.ResponseWriter, username string, err error) {
+	if reason, ok := err.(errInvalidPassword); ok {
+		writeError(w, http.StatusBadRequest, string(reason))
+		return
+	}
+
+	log.Errorf("error setting password of account %v: %v", username, err)
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+func validatePassword(password string) string {
+	if len(password) < PasswordMinLength {
+		return "password_too_short"
+	}
+
+	if len(password) > auth.PasswordMaxLength {
+		return "password_too_long"
+	}
+
+	return ""
+}
+
+func localUsername(userID string) (string, bool) {
+	prefix := identity.ProviderLocal + ":"
+	if !strings.HasPrefix(userID, prefix) {
+		return "", false
+	}
+
+	username, err := url.QueryUnescape(strings.TrimPrefix(userID, prefix))
+	if err != nil {
+		return "", false
+	}
+
+	return username, true
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeLocked(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	writeError(w, http.StatusTooManyRequests, "account_locked")
+}
+
+func writeError(w http.ResponseWriter, statusCode int, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(errorResponse{Error: errorCode})
+}
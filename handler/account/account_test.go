@@ -0,0 +1,342 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	accountstore "github.com/AjithPanneerselvam/task-etcd/store/account"
+	"github.com/go-chi/chi"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+const (
+	testUsername = "alice"
+	testPassword = "correct horse battery"
+
+	testMaxFailedLogins = 3
+)
+
+// memAccountStore keeps the accounts and reset tokens in memory
+type memAccountStore struct {
+	store.AccountStore
+
+	accounts    map[string]store.Account
+	resetTokens map[string]string
+}
+
+func (m *memAccountStore) ReadAccount(ctx context.Context, username string) (*store.Account, error) {
+	account, ok := m.accounts[username]
+	if !ok {
+		return nil, accountstore.ErrAccountStoreNoRecord
+	}
+
+	return &account, nil
+}
+
+func (m *memAccountStore) UpdateAccount(ctx context.Context, username string,
+	change func(account *store.Account) error) (*store.Account, error) {
+
+	account, ok := m.accounts[username]
+	if !ok {
+		return nil, accountstore.ErrAccountStoreNoRecord
+	}
+
+	err := change(&account)
+	if err != nil {
+		return nil, err
+	}
+	m.accounts[username] = account
+
+	return &account, nil
+}
+
+func (m *memAccountStore) CreateResetToken(ctx context.Context, tokenHash string, username string,
+	ttl time.Duration) error {
+
+	m.resetTokens[tokenHash] = username
+	return nil
+}
+
+func (m *memAccountStore) ConsumeResetToken(ctx context.Context, tokenHash string) (string, error) {
+	username, ok := m.resetTokens[tokenHash]
+	if !ok {
+		return "", accountstore.ErrAccountStoreNoResetToken
+	}
+	delete(m.resetTokens, tokenHash)
+
+	return username, nil
+}
+
+// noSessionStore keeps no sessions, there are none to revoke
+type noSessionStore struct {
+	store.SessionStore
+}
+
+func (noSessionStore) CreateSession(ctx context.Context, session store.Session, ttl time.Duration) error {
+	return nil
+}
+
+func (noSessionStore) DeleteOtherSessions(ctx context.Context, userID string, keepSessionID string) (int, error) {
+	return 0, nil
+}
+
+// loginUserStore returns the profile of every login as recorded
+type loginUserStore struct {
+	store.UserStore
+}
+
+func (loginUserStore) RecordLogin(ctx context.Context, profile store.UserProfile) (*store.UserProfile, error) {
+	return &profile, nil
+}
+
+// newTestAccountHandler returns a handler over the account of testUsername
+// with testPassword
+func newTestAccountHandler(t *testing.T) (*AccountHandler, *memAccountStore) {
+	t.Helper()
+
+	passwordHash, err := auth.HashPassword(testPassword)
+	if err != nil {
+		t.Fatalf("error hashing password: %v", err)
+	}
+
+	accountStore := &memAccountStore{
+		accounts: map[string]store.Account{
+			testUsername: {Username: testUsername, PasswordHash: passwordHash},
+		},
+		resetTokens: make(map[string]string),
+	}
+
+	jwtAuth := auth.NewJWTAuth("test-secret-key", time.Hour, false, false, nil)
+	accountHandler := NewAccountHandler(accountStore, loginUserStore{}, noSessionStore{}, jwtAuth, false,
+		testMaxFailedLogins, time.Hour, time.Hour)
+
+	return accountHandler, accountStore
+}
+
+// newCallerRequest returns a request of the local user, as the
+// Authenticator leaves it
+func newCallerRequest(t *testing.T, method string, body interface{}) *http.Request {
+	t.Helper()
+
+	token := jwt.New()
+	token.Set(auth.ClaimsKeyUserID, "local:"+testUsername)
+	token.Set(auth.ClaimsKeySessionID, "session")
+
+	r := newJSONRequest(t, method, body)
+	return r.WithContext(context.WithValue(r.Context(), auth.TokenCtxKey, token))
+}
+
+func newJSONRequest(t *testing.T, method string, body interface{}) *http.Request {
+	t.Helper()
+
+	buf, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("error marshalling request: %v", err)
+	}
+
+	return httptest.NewRequest(method, "/", bytes.NewReader(buf))
+}
+
+func TestChangePasswordLockout(t *testing.T) {
+	accountHandler, accountStore := newTestAccountHandler(t)
+
+	changePassword := func(currentPassword string) int {
+		recorder := httptest.NewRecorder()
+		accountHandler.ChangePassword(recorder, newCallerRequest(t, http.MethodPut, ChangePasswordRequest{
+			CurrentPassword: currentPassword,
+			NewPassword:     "a brand new password",
+		}))
+
+		return recorder.Code
+	}
+
+	for i := 1; i < testMaxFailedLogins; i++ {
+		if status := changePassword("wrong password"); status != http.StatusForbidden {
+			t.Fatalf("status of wrong password %v is %v, want %v", i, status, http.StatusForbidden)
+		}
+	}
+
+	if status := changePassword("wrong password"); status != http.StatusTooManyRequests {
+		t.Fatalf("status of the last wrong password is %v, want %v", status, http.StatusTooManyRequests)
+	}
+
+	// the right password is refused too until the lockout passes
+	if status := changePassword(testPassword); status != http.StatusTooManyRequests {
+		t.Fatalf("status of locked account is %v, want %v", status, http.StatusTooManyRequests)
+	}
+
+	if !auth.CheckPassword(accountStore.accounts[testUsername].PasswordHash, testPassword) {
+		t.Errorf("password of locked account changed")
+	}
+}
+
+// totpCodeAt returns the code of the secret an authenticator app shows at
+// the time
+func totpCodeAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("error decoding totp secret: %v", err)
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(at.Unix()/30))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// postLogin posts the credentials, returning the status code
+func postLogin(t *testing.T, accountHandler *AccountHandler, password string, totpCode string) int {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	accountHandler.Login(recorder, newJSONRequest(t, http.MethodPost, CredentialsRequest{
+		Username: testUsername,
+		Password: password,
+		TOTPCode: totpCode,
+	}))
+
+	return recorder.Code
+}
+
+func TestLoginLockout(t *testing.T) {
+	accountHandler, accountStore := newTestAccountHandler(t)
+
+	for i := 1; i < testMaxFailedLogins; i++ {
+		if status := postLogin(t, accountHandler, "wrong password", ""); status != http.StatusUnauthorized {
+			t.Fatalf("status of failed login %v is %v, want %v", i, status, http.StatusUnauthorized)
+		}
+	}
+
+	if status := postLogin(t, accountHandler, "wrong password", ""); status != http.StatusTooManyRequests {
+		t.Fatalf("status of the last failed login is %v, want %v", status, http.StatusTooManyRequests)
+	}
+
+	if status := postLogin(t, accountHandler, testPassword, ""); status != http.StatusTooManyRequests {
+		t.Fatalf("status of login to locked account is %v, want %v", status, http.StatusTooManyRequests)
+	}
+
+	// once the lockout passes the failures start over
+	account := accountStore.accounts[testUsername]
+	account.LockedUntil = time.Now().UTC().Add(-time.Second)
+	accountStore.accounts[testUsername] = account
+
+	if status := postLogin(t, accountHandler, testPassword, ""); status != http.StatusOK {
+		t.Fatalf("status of login after the lockout is %v, want %v", status, http.StatusOK)
+	}
+
+	if failedLogins := accountStore.accounts[testUsername].FailedLogins; failedLogins != 0 {
+		t.Errorf("failed logins are %v after a login, want 0", failedLogins)
+	}
+}
+
+func TestLoginTOTPReplay(t *testing.T) {
+	accountHandler, accountStore := newTestAccountHandler(t)
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		t.Fatalf("error generating totp secret: %v", err)
+	}
+
+	account := accountStore.accounts[testUsername]
+	account.TOTPSecret, account.TOTPEnabled = secret, true
+	accountStore.accounts[testUsername] = account
+
+	code := totpCodeAt(t, secret, time.Now())
+
+	if status := postLogin(t, accountHandler, testPassword, ""); status != http.StatusUnauthorized {
+		t.Fatalf("status of login without code is %v, want %v", status, http.StatusUnauthorized)
+	}
+
+	if status := postLogin(t, accountHandler, testPassword, code); status != http.StatusOK {
+		t.Fatalf("status of login with code is %v, want %v", status, http.StatusOK)
+	}
+
+	if status := postLogin(t, accountHandler, testPassword, code); status != http.StatusUnauthorized {
+		t.Fatalf("status of login replaying the code is %v, want %v", status, http.StatusUnauthorized)
+	}
+
+	if failedLogins := accountStore.accounts[testUsername].FailedLogins; failedLogins != 1 {
+		t.Errorf("failed logins are %v after the replay, want 1", failedLogins)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	accountHandler, accountStore := newTestAccountHandler(t)
+
+	account := accountStore.accounts[testUsername]
+	account.LockedUntil = time.Now().UTC().Add(time.Hour)
+	accountStore.accounts[testUsername] = account
+
+	recorder := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("username", testUsername)
+	accountHandler.CreateResetToken(recorder, r.WithContext(context.WithValue(r.Context(),
+		chi.RouteCtxKey, routeCtx)))
+
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("status of issuing reset token is %v, want %v", recorder.Code, http.StatusCreated)
+	}
+
+	var resetTokenResponse ResetTokenResponse
+	err := json.NewDecoder(recorder.Body).Decode(&resetTokenResponse)
+	if err != nil {
+		t.Fatalf("error decoding reset token: %v", err)
+	}
+
+	if _, ok := accountStore.resetTokens[resetTokenResponse.ResetToken]; ok {
+		t.Errorf("reset token stored as is, want its hash")
+	}
+
+	resetPassword := func(resetToken string, newPassword string) int {
+		recorder := httptest.NewRecorder()
+		accountHandler.ResetPassword(recorder, newJSONRequest(t, http.MethodPost, ResetPasswordRequest{
+			ResetToken:  resetToken,
+			NewPassword: newPassword,
+		}))
+
+		return recorder.Code
+	}
+
+	if status := resetPassword("unknown token", "a brand new password"); status != http.StatusBadRequest {
+		t.Errorf("status of reset with unknown token is %v, want %v", status, http.StatusBadRequest)
+	}
+
+	// a password too short leaves the token to be used again
+	if status := resetPassword(resetTokenResponse.ResetToken, "short"); status != http.StatusBadRequest {
+		t.Errorf("status of reset to short password is %v, want %v", status, http.StatusBadRequest)
+	}
+
+	if status := resetPassword(resetTokenResponse.ResetToken, "a brand new password"); status != http.StatusNoContent {
+		t.Fatalf("status of reset is %v, want %v", status, http.StatusNoContent)
+	}
+
+	if status := resetPassword(resetTokenResponse.ResetToken, "another new password"); status != http.StatusBadRequest {
+		t.Errorf("status of reusing the reset token is %v, want %v", status, http.StatusBadRequest)
+	}
+
+	if status := postLogin(t, accountHandler, "a brand new password", ""); status != http.StatusOK {
+		t.Errorf("status of login with the new password is %v, want %v", status, http.StatusOK)
+	}
+}
@@ -0,0 +1,268 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/db"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	userstore "github.com/AjithPanneerselvam/task-etcd/store/user"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type AdminHandler struct {
+	userStore     store.UserStore
+	taskStore     store.TaskStore
+	sessionStore  store.SessionStore
+	statusChecker *db.StatusChecker
+	startedAt     time.Time
+}
+
+type TaskCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+}
+
+type UserResponse struct {
+	store.UserProfile
+	TaskCounts     TaskCounts `json:"taskCounts"`
+	ActiveSessions int        `json:"activeSessions"`
+}
+
+type LogoutUserResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+type StatusResponse struct {
+	Healthy   bool                `json:"healthy"`
+	StartedAt time.Time           `json:"startedAt"`
+	Uptime    string              `json:"uptime"`
+	Users     int                 `json:"users"`
+	Etcd      []db.EndpointStatus `json:"etcd"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewAdminHandler(userStore store.UserStore, taskStore store.TaskStore, sessionStore store.SessionStore,
+	statusChecker *db.StatusChecker) *AdminHandler {
+
+	return &AdminHandler{
+		userStore:     userStore,
+		taskStore:     taskStore,
+		sessionStore:  sessionStore,
+		statusChecker: statusChecker,
+		startedAt:     time.Now().UTC(),
+	}
+}
+
+// GetUsers lists the profiles of every user who has logged in
+func (a *AdminHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	profiles, err := a.userStore.ReadAllProfiles(r.Context())
+	if err != nil {
+		log.Errorf("error reading user profiles: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].UserID < profiles[j].UserID
+	})
+
+	writeJSON(w, http.StatusOK, profiles)
+}
+
+// GetUser returns the profile of a user along with their task counts and
+// active sessions
+func (a *AdminHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := userIDFromRoute(r)
+
+	profile, err := a.userStore.ReadProfile(ctx, userID)
+	if errors.Cause(err) == userstore.ErrUserStoreNoRecord {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("error reading profile of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	tasks, err := a.taskStore.ReadAllTasks(ctx, userID)
+	if err != nil {
+		log.Errorf("error reading tasks of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var taskCounts TaskCounts
+	for _, task := range tasks {
+		taskCounts.Total++
+		if task.IsCompleted {
+			taskCounts.Completed++
+		}
+	}
+
+	sessions, err := a.sessionStore.ReadAllSessions(ctx, userID)
+	if err != nil {
+		log.Errorf("error reading sessions of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, UserResponse{
+		UserProfile:    *profile,
+		TaskCounts:     taskCounts,
+		ActiveSessions: len(sessions),
+	})
+}
+
+// DisableUser keeps the user from logging in and revokes their sessions
+func (a *AdminHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := userIDFromRoute(r)
+
+	callerID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// an admin locking themselves out leaves no one to undo it
+	if callerID == userID {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "cannot_disable_self"})
+		return
+	}
+
+	profile, ok := a.setDisabled(w, r, userID, true)
+	if !ok {
+		return
+	}
+
+	revoked, err := a.sessionStore.DeleteOtherSessions(ctx, userID, "")
+	if err != nil {
+		log.Errorf("error revoking sessions of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Infof("user %v disabled by %v, %v sessions revoked", userID, callerID, revoked)
+
+	writeJSON(w, http.StatusOK, profile)
+}
+
+func (a *AdminHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromRoute(r)
+
+	profile, ok := a.setDisabled(w, r, userID, false)
+	if !ok {
+		return
+	}
+	log.Infof("user %v enabled", userID)
+
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// LogoutUser revokes every session of the user
+func (a *AdminHandler) LogoutUser(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromRoute(r)
+
+	revoked, err := a.sessionStore.DeleteOtherSessions(r.Context(), userID, "")
+	if err != nil {
+		log.Errorf("error revoking sessions of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Infof("%v sessions of user %v revoked by an admin", revoked, userID)
+
+	writeJSON(w, http.StatusOK, LogoutUserResponse{
+		Revoked: revoked,
+	})
+}
+
+// GetStatus reports the uptime of the instance and the status of etcd. The
+// service is healthy when every etcd endpoint is reachable.
+func (a *AdminHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	etcdStatuses := a.statusChecker.Status(ctx)
+
+	healthy := true
+	for _, etcdStatus := range etcdStatuses {
+		if etcdStatus.Error != "" {
+			healthy = false
+		}
+	}
+
+	var users int
+	profiles, err := a.userStore.ReadAllProfiles(ctx)
+	if err != nil {
+		log.Errorf("error reading user profiles: %v", err)
+		healthy = false
+	} else {
+		users = len(profiles)
+	}
+
+	writeJSON(w, http.StatusOK, StatusResponse{
+		Healthy:   healthy,
+		StartedAt: a.startedAt,
+		Uptime:    time.Since(a.startedAt).Truncate(time.Second).String(),
+		Users:     users,
+		Etcd:      etcdStatuses,
+	})
+}
+
+func (a *AdminHandler) setDisabled(w http.ResponseWriter, r *http.Request, userID string,
+	disabled bool) (*store.UserProfile, bool) {
+
+	profile, err := a.userStore.SetDisabled(r.Context(), userID, disabled, time.Now().UTC())
+	if errors.Cause(err) == userstore.ErrUserStoreNoRecord {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Errorf("error updating user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return profile, true
+}
+
+// userIDFromRoute returns the user id in the route. User ids carry the
+// escaped subject of the provider, which arrives escaped once more in the
+// path.
+func userIDFromRoute(r *http.Request) string {
+	userID := chi.URLParam(r, "user-id")
+
+	// the router matches on the raw path only when the path has escapes
+	// that decoding would lose
+	if r.URL.RawPath == "" {
+		return userID
+	}
+
+	unescapedUserID, err := url.PathUnescape(userID)
+	if err != nil {
+		return userID
+	}
+
+	return unescapedUserID
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Errorf("error encoding the response: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package inbox
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+type InboxHandler struct {
+	inboxStore store.InboxStore
+}
+
+func NewInboxHandler(inboxStore store.InboxStore) *InboxHandler {
+	return &InboxHandler{
+		inboxStore: inboxStore,
+	}
+}
+
+// GetInbox lists the notifications of the caller, the newest first
+func (i *InboxHandler) GetInbox(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	notifications, err := i.inboxStore.ReadAllNotifications(ctx, userID)
+	if err != nil {
+		log.Errorf("error reading notifications of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(notifications)
+	if err != nil {
+		log.Errorf("error encoding the inbox response: %v", err)
+	}
+}
+
+// DeleteNotification dismisses a notification of the caller
+func (i *InboxHandler) DeleteNotification(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	notificationID := chi.URLParam(r, "notification-id")
+
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = i.inboxStore.DeleteNotification(ctx, userID, notificationID)
+	if err != nil {
+		log.Errorf("error deleting notification %v of user %v: %v", notificationID, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,245 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/handler/user"
+	"github.com/AjithPanneerselvam/task-etcd/identity"
+	"github.com/AjithPanneerselvam/task-etcd/integration/githubsync"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	credentialstore "github.com/AjithPanneerselvam/task-etcd/store/credential"
+	integrationstore "github.com/AjithPanneerselvam/task-etcd/store/integration"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// the github login asking for the scopes of the sync
+	githubLoginURL = "/login/github?sync=true"
+
+	// manual syncs are throttled, the background sync covers the rest
+	minManualSyncInterval = time.Minute
+)
+
+type IntegrationHandler struct {
+	integrationStore store.IntegrationStore
+	credentialStore  store.CredentialStore
+	taskLinkStore    store.TaskLinkStore
+	githubSyncer     *githubsync.Syncer
+}
+
+// GithubIntegrationResponse is the github sync state of the caller. A user
+// who opted in is connected once a github login stored their token.
+type GithubIntegrationResponse struct {
+	store.IntegrationState
+	Connected bool   `json:"connected"`
+	LoginURL  string `json:"loginUrl,omitempty"`
+}
+
+type UpdateGithubIntegrationRequest struct {
+	Enabled    bool   `json:"enabled"`
+	Repository string `json:"repository"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewIntegrationHandler(integrationStore store.IntegrationStore, credentialStore store.CredentialStore,
+	taskLinkStore store.TaskLinkStore, githubSyncer *githubsync.Syncer) *IntegrationHandler {
+
+	return &IntegrationHandler{
+		integrationStore: integrationStore,
+		credentialStore:  credentialStore,
+		taskLinkStore:    taskLinkStore,
+		githubSyncer:     githubSyncer,
+	}
+}
+
+func (i *IntegrationHandler) GetGithubIntegration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := githubUserID(w, r)
+	if !ok {
+		return
+	}
+
+	state, err := i.readState(r, userID)
+	if err != nil {
+		log.Errorf("error reading github integration of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	i.writeIntegration(w, r, state)
+}
+
+// UpdateGithubIntegration opts the caller in or out of the github sync.
+// Opting out deletes the stored github token, tasks imported earlier are
+// kept.
+func (i *IntegrationHandler) UpdateGithubIntegration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	userID, ok := githubUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var updateRequest UpdateGithubIntegrationRequest
+	err := json.NewDecoder(r.Body).Decode(&updateRequest)
+	if err != nil {
+		log.Errorf("error unmarshalling update github integration request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if updateRequest.Repository != "" && !validRepository(updateRequest.Repository) {
+		writeError(w, http.StatusBadRequest, "invalid_repository")
+		return
+	}
+
+	state, err := i.readState(r, userID)
+	if err != nil {
+		log.Errorf("error reading github integration of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	state.Enabled = updateRequest.Enabled
+	state.Repository = updateRequest.Repository
+
+	err = i.integrationStore.UpsertState(ctx, *state)
+	if err != nil {
+		log.Errorf("error storing github integration of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !state.Enabled {
+		err = i.credentialStore.DeleteCredential(ctx, githubsync.Provider, userID)
+		if err != nil {
+			log.Errorf("error deleting github token of user %v: %v", userID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	log.Infof("github sync of user %v set to enabled %v", userID, state.Enabled)
+
+	i.writeIntegration(w, r, state)
+}
+
+// SyncGithub imports the github issues of the caller right away
+func (i *IntegrationHandler) SyncGithub(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := githubUserID(w, r)
+	if !ok {
+		return
+	}
+
+	state, err := i.readState(r, userID)
+	if err != nil {
+		log.Errorf("error reading github integration of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if wait := minManualSyncInterval - time.Since(state.LastSyncedAt); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		writeError(w, http.StatusTooManyRequests, "synced_recently")
+		return
+	}
+
+	result, err := i.githubSyncer.SyncUser(ctx, userID)
+	switch errors.Cause(err) {
+	case nil:
+	case githubsync.ErrGithubSyncNotEnabled:
+		writeError(w, http.StatusConflict, "github_sync_not_enabled")
+		return
+	case githubsync.ErrGithubSyncNotConnected:
+		writeError(w, http.StatusConflict, "github_not_connected")
+		return
+	default:
+		log.Errorf("error syncing github issues of user %v: %v", userID, err)
+		writeError(w, http.StatusBadGateway, "github_sync_failed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		log.Errorf("error encoding the sync response: %v", err)
+	}
+}
+
+// readState reads the github integration state of the user, a disabled one
+// if the user never opted in
+func (i *IntegrationHandler) readState(r *http.Request, userID string) (*store.IntegrationState, error) {
+	state, err := i.integrationStore.ReadState(r.Context(), githubsync.Provider, userID)
+	if errors.Cause(err) == integrationstore.ErrIntegrationStoreNoRecord {
+		return &store.IntegrationState{
+			Provider: githubsync.Provider,
+			UserID:   userID,
+		}, nil
+	}
+
+	return state, err
+}
+
+func (i *IntegrationHandler) writeIntegration(w http.ResponseWriter, r *http.Request,
+	state *store.IntegrationState) {
+
+	_, err := i.credentialStore.ReadCredential(r.Context(), githubsync.Provider, state.UserID)
+	if err != nil && errors.Cause(err) != credentialstore.ErrCredentialStoreNoRecord {
+		log.Errorf("error reading github token of user %v: %v", state.UserID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := GithubIntegrationResponse{
+		IntegrationState: *state,
+		Connected:        err == nil,
+	}
+
+	// the token is stored on a github login of a user who opted in, through
+	// the login url
+	if state.Enabled && !response.Connected {
+		response.LoginURL = githubLoginURL
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Errorf("error encoding the github integration response: %v", err)
+	}
+}
+
+// githubUserID returns the id of the caller, who has to have logged in with
+// github
+func githubUserID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID, err := auth.FetchUserIDFromCtx(r.Context())
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return "", false
+	}
+
+	profile, ok := user.FetchProfileFromCtx(r.Context())
+	if !ok || profile.Provider != identity.ProviderGithub {
+		writeError(w, http.StatusBadRequest, "github_login_required")
+		return "", false
+	}
+
+	return userID, true
+}
+
+func writeError(w http.ResponseWriter, statusCode int, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(errorResponse{Error: errorCode})
+}
@@ -0,0 +1,236 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+	"github.com/AjithPanneerselvam/task-etcd/integration/githubsync"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	taskstore "github.com/AjithPanneerselvam/task-etcd/store/task"
+	tasklinkstore "github.com/AjithPanneerselvam/task-etcd/store/tasklink"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	LinkStatusPending  = "pending"
+	LinkStatusSynced   = "synced"
+	LinkStatusConflict = "conflict"
+	LinkStatusError    = "error"
+)
+
+var repositoryPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+// TaskLinkResponse is a link of an exported task along with its sync status
+type TaskLinkResponse struct {
+	store.TaskLink
+	Status string `json:"status"`
+}
+
+type CreateTaskLinkRequest struct {
+	TaskID string `json:"taskId"`
+	// Repository defaults to the repository of the integration
+	Repository string `json:"repository"`
+}
+
+type ResolveConflictRequest struct {
+	// Keep is the side kept, github or task
+	Keep string `json:"keep"`
+}
+
+// GetGithubLinks returns the sync status of every task the caller exported
+func (i *IntegrationHandler) GetGithubLinks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := githubUserID(w, r)
+	if !ok {
+		return
+	}
+
+	links, err := i.taskLinkStore.ReadAllLinks(r.Context(), userID)
+	if err != nil {
+		log.Errorf("error reading task links of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	linkResponses := make([]TaskLinkResponse, 0, len(links))
+	for _, link := range links {
+		linkResponses = append(linkResponses, newTaskLinkResponse(link))
+	}
+
+	writeJSON(w, http.StatusOK, linkResponses)
+}
+
+func (i *IntegrationHandler) GetGithubLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := githubUserID(w, r)
+	if !ok {
+		return
+	}
+
+	link, err := i.taskLinkStore.ReadLink(r.Context(), userID, chi.URLParam(r, "task-id"))
+	if errors.Cause(err) == tasklinkstore.ErrTaskLinkStoreNoRecord {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("error reading task link of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newTaskLinkResponse(*link))
+}
+
+// CreateGithubLink exports a task of the caller to a new github issue that
+// is kept in sync with the task from then on
+func (i *IntegrationHandler) CreateGithubLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	userID, ok := githubUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var createRequest CreateTaskLinkRequest
+	err := json.NewDecoder(r.Body).Decode(&createRequest)
+	if err != nil || createRequest.TaskID == "" {
+		log.Errorf("error unmarshalling create task link request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	repository := createRequest.Repository
+	if repository == "" {
+		state, err := i.readState(r, userID)
+		if err != nil {
+			log.Errorf("error reading github integration of user %v: %v", userID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		repository = state.Repository
+	}
+
+	if !validRepository(repository) {
+		writeError(w, http.StatusBadRequest, "invalid_repository")
+		return
+	}
+
+	link, err := i.githubSyncer.LinkTask(ctx, userID, createRequest.TaskID, repository)
+	if err != nil {
+		writeLinkError(w, userID, createRequest.TaskID, err)
+		return
+	}
+	log.Infof("task %v of user %v linked to %v", link.TaskID, userID, link.IssueURL)
+
+	writeJSON(w, http.StatusCreated, newTaskLinkResponse(*link))
+}
+
+// DeleteGithubLink stops syncing a task with its issue, both are kept
+func (i *IntegrationHandler) DeleteGithubLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := githubUserID(w, r)
+	if !ok {
+		return
+	}
+
+	taskID := chi.URLParam(r, "task-id")
+
+	err := i.taskLinkStore.DeleteLink(r.Context(), userID, taskID)
+	if err != nil {
+		log.Errorf("error deleting task link of task %v of user %v: %v", taskID, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResolveGithubLinkConflict settles the conflict of a task changed both
+// here and on github by keeping one side
+func (i *IntegrationHandler) ResolveGithubLinkConflict(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, ok := githubUserID(w, r)
+	if !ok {
+		return
+	}
+
+	taskID := chi.URLParam(r, "task-id")
+
+	var resolveRequest ResolveConflictRequest
+	err := json.NewDecoder(r.Body).Decode(&resolveRequest)
+	if err != nil {
+		log.Errorf("error unmarshalling resolve conflict request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if resolveRequest.Keep != githubsync.ConflictPolicyGithub && resolveRequest.Keep != githubsync.ConflictPolicyTask {
+		writeError(w, http.StatusBadRequest, "invalid_side")
+		return
+	}
+
+	link, err := i.githubSyncer.ResolveConflict(r.Context(), userID, taskID, resolveRequest.Keep)
+	if err != nil {
+		writeLinkError(w, userID, taskID, err)
+		return
+	}
+	log.Infof("conflict of task %v of user %v resolved keeping %v", taskID, userID, resolveRequest.Keep)
+
+	writeJSON(w, http.StatusOK, newTaskLinkResponse(*link))
+}
+
+func newTaskLinkResponse(link store.TaskLink) TaskLinkResponse {
+	status := LinkStatusSynced
+	switch {
+	case link.Conflict:
+		status = LinkStatusConflict
+	case link.LastSyncError != "":
+		status = LinkStatusError
+	case link.LastSyncedAt.IsZero():
+		status = LinkStatusPending
+	}
+
+	return TaskLinkResponse{
+		TaskLink: link,
+		Status:   status,
+	}
+}
+
+// writeLinkError maps the errors of linking and syncing a task to responses
+func writeLinkError(w http.ResponseWriter, userID string, taskID string, err error) {
+	switch errors.Cause(err) {
+	case taskstore.ErrTaskStoreNoRecord, tasklinkstore.ErrTaskLinkStoreNoRecord:
+		w.WriteHeader(http.StatusNotFound)
+	case githubsync.ErrGithubSyncNotEnabled:
+		writeError(w, http.StatusConflict, "github_sync_not_enabled")
+	case githubsync.ErrGithubSyncNotConnected:
+		writeError(w, http.StatusConflict, "github_not_connected")
+	case githubsync.ErrGithubSyncAlreadyLinked:
+		writeError(w, http.StatusConflict, "task_already_linked")
+	case githubsync.ErrGithubSyncNoConflict:
+		writeError(w, http.StatusConflict, "no_conflict")
+	case github.ErrGithubNotFound, github.ErrGithubUnauthorized:
+		log.Errorf("error syncing task %v of user %v: %v", taskID, userID, err)
+		writeError(w, http.StatusBadGateway, "github_repository_not_accessible")
+	default:
+		log.Errorf("error syncing task %v of user %v: %v", taskID, userID, err)
+		writeError(w, http.StatusBadGateway, "github_sync_failed")
+	}
+}
+
+func validRepository(repository string) bool {
+	return repositoryPattern.MatchString(repository)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		log.Errorf("error encoding the response: %v", err)
+	}
+}
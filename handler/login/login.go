@@ -0,0 +1,488 @@
+package login
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/identity"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	integrationstore "github.com/AjithPanneerselvam/task-etcd/store/integration"
+	sessionstore "github.com/AjithPanneerselvam/task-etcd/store/session"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	oAuthStateCookieName = "oauth_state"
+
+	// the query param of github logins that connect the github sync
+	githubSyncParam = "sync"
+
+	callbackURLFormat = "%s/login/%s/callback"
+
+	defaultRetryAfter = time.Minute
+
+	accessDeniedPage = `<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Access denied</title></head>
+<body>
+<h1>Access denied</h1>
+<p>Your %s account is not a member of an organization or team allowed to use this service.</p>
+<p>Ask an administrator for access, or <a href="/">log in with another account</a>.</p>
+</body>
+</html>
+`
+)
+
+type LoginHandler struct {
+	providers     map[string]identity.Provider
+	providerNames []string
+	baseURL       string
+
+	oAuthStateStore store.OAuthStateStore
+	oAuthStateTTL   time.Duration
+	secureCookies   bool
+
+	userStore    store.UserStore
+	sessionStore store.SessionStore
+
+	// the github tokens of users who opted in to the github sync are kept,
+	// nil when the sync is disabled
+	credentialStore  store.CredentialStore
+	integrationStore store.IntegrationStore
+	githubSyncScopes []string
+
+	adminGithubLogins []string
+	adminGithubIDs    []string
+
+	jwtAuthenticator        *auth.JWTAuth
+	loginSuccessRedirectURL string
+}
+
+type UserInfo struct {
+	ID    string `json:"id"`
+	Token string `json:"token"`
+}
+
+// NewLoginHandler returns a handler for logins with the given providers.
+// The callback url of a provider is <baseURL>/login/<provider>/callback.
+// The github users of the admin logins and ids are granted the admin role.
+// The credential and integration stores are nil when the github sync is
+// disabled. Only the github logins that connect the sync ask for its scopes.
+func NewLoginHandler(providers []identity.Provider, baseURL string,
+	oAuthStateStore store.OAuthStateStore, oAuthStateTTL time.Duration, secureCookies bool,
+	userStore store.UserStore, sessionStore store.SessionStore, credentialStore store.CredentialStore,
+	integrationStore store.IntegrationStore, githubSyncScopes []string, adminGithubLogins []string,
+	adminGithubIDs []string, jwtAuthenticator *auth.JWTAuth, loginSuccessRedirectURL string) *LoginHandler {
+
+	providersByName := make(map[string]identity.Provider, len(providers))
+	providerNames := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		providersByName[provider.Name()] = provider
+		providerNames = append(providerNames, provider.Name())
+	}
+
+	return &LoginHandler{
+		providers:               providersByName,
+		providerNames:           providerNames,
+		baseURL:                 baseURL,
+		oAuthStateStore:         oAuthStateStore,
+		oAuthStateTTL:           oAuthStateTTL,
+		secureCookies:           secureCookies,
+		userStore:               userStore,
+		sessionStore:            sessionStore,
+		credentialStore:         credentialStore,
+		integrationStore:        integrationStore,
+		githubSyncScopes:        githubSyncScopes,
+		adminGithubLogins:       adminGithubLogins,
+		adminGithubIDs:          adminGithubIDs,
+		loginSuccessRedirectURL: loginSuccessRedirectURL,
+		jwtAuthenticator:        jwtAuthenticator,
+	}
+}
+
+func (l *LoginHandler) Home(w http.ResponseWriter, r *http.Request) {
+	for _, name := range l.providerNames {
+		escapedName := html.EscapeString(name)
+		fmt.Fprintf(w, `<a href="/login/%s">Login with %s</a><br>`, escapedName, escapedName)
+	}
+}
+
+// Login starts the oauth flow of the provider in the route. A fresh state,
+// PKCE code verifier and nonce are generated per login; the state is bound
+// to the browser with a short lived cookie and the rest is kept server side
+// until the callback. A github login with the sync query param set also
+// asks for the scopes of the github sync, and connects it.
+func (l *LoginHandler) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	provider, ok := l.providerFromRoute(r)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	githubSync, _ := strconv.ParseBool(r.URL.Query().Get(githubSyncParam))
+	if githubSync && (l.credentialStore == nil || provider.Name() != identity.ProviderGithub) {
+		http.Error(w, "github sync is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	state, err := auth.NewRandomToken()
+	if err != nil {
+		log.Errorf("error generating oauth state: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	codeVerifier, err := auth.NewRandomToken()
+	if err != nil {
+		log.Errorf("error generating pkce code verifier: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	nonce, err := auth.NewRandomToken()
+	if err != nil {
+		log.Errorf("error generating nonce: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	oAuthState := store.OAuthState{
+		Provider:     provider.Name(),
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		GithubSync:   githubSync,
+	}
+
+	var scopes []string
+	if githubSync {
+		scopes = l.githubSyncScopes
+	}
+
+	err = l.oAuthStateStore.CreateState(ctx, state, oAuthState, l.oAuthStateTTL)
+	if err != nil {
+		log.Errorf("error storing oauth state: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	redirectURL, err := provider.AuthorizeURL(ctx, identity.AuthRequest{
+		CallbackURL:   l.callbackURL(provider),
+		State:         state,
+		CodeChallenge: auth.PKCEChallenge(codeVerifier),
+		Nonce:         nonce,
+		Scopes:        scopes,
+	})
+	if err != nil {
+		log.Errorf("error fetching %v redirect url: %v", provider.Name(), err)
+		l.writeProviderError(w, provider, nil, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oAuthStateCookieName,
+		Value:    state,
+		Path:     "/login",
+		MaxAge:   int(l.oAuthStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   l.secureCookies,
+		// lax, as the cookie has to be sent on the top level redirect back from the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	log.Infof("login redirecting to URL: %v", redirectURL)
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+func (l *LoginHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	provider, ok := l.providerFromRoute(r)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	code, ok := r.URL.Query()["code"]
+	if !ok {
+		log.Error("error as query param 'code' is missing")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	log.Debugf("Auth code: %v", code)
+
+	oAuthState, err := l.consumeOAuthState(w, r)
+	if err != nil {
+		log.Errorf("error validating oauth state: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if oAuthState.Provider != provider.Name() {
+		log.Errorf("error as oauth state of %v is used for %v callback", oAuthState.Provider, provider.Name())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	token, err := provider.Exchange(ctx, identity.AuthResponse{
+		Code:         code[0],
+		CallbackURL:  l.callbackURL(provider),
+		CodeVerifier: oAuthState.CodeVerifier,
+		Nonce:        oAuthState.Nonce,
+	})
+	if err != nil {
+		log.Errorf("error exchanging %v authorization code: %v", provider.Name(), err)
+		l.writeProviderError(w, provider, nil, err)
+		return
+	}
+
+	profile, err := provider.FetchProfile(ctx, token)
+	if err != nil {
+		log.Errorf("error fetching %v profile: %v", provider.Name(), err)
+		l.writeProviderError(w, provider, token, err)
+		return
+	}
+	log.Debugf("%v profile: %v", provider.Name(), profile)
+
+	userID := profile.UserID()
+	roles := l.roles(profile)
+
+	userProfile, err := l.userStore.RecordLogin(ctx, store.UserProfile{
+		UserID:      userID,
+		Provider:    profile.Provider,
+		Login:       profile.Login,
+		DisplayName: profile.Name,
+		Email:       profile.Email,
+		AvatarURL:   profile.AvatarURL,
+		Roles:       roles,
+		LastLoginAt: time.Now().UTC(),
+	})
+	if err != nil {
+		log.Errorf("error recording login of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if userProfile.Disabled {
+		log.Infof("login of disabled user %v rejected", userID)
+		http.Error(w, "your account is disabled, please contact an administrator", http.StatusForbidden)
+		return
+	}
+	log.Infof("user %v of id %v signed in", profile.Name, userID)
+
+	if oAuthState.GithubSync {
+		l.saveGithubToken(r, profile, token)
+	}
+
+	scopes := auth.DefaultUserScopes
+	if userProfile.HasRole(store.RoleAdmin) {
+		scopes = append([]string{auth.ScopeAdmin}, scopes...)
+	}
+
+	jwtTokenString, err := IssueSessionToken(r, l.sessionStore, l.jwtAuthenticator, userID, scopes)
+	if err != nil {
+		log.Errorf("error issuing session token: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// browsers are handed the token as a cookie and sent on to the home page
+	if l.jwtAuthenticator.SessionCookies() {
+		l.jwtAuthenticator.SetSessionCookies(w, jwtTokenString)
+		http.Redirect(w, r, l.loginSuccessRedirectURL, http.StatusFound)
+		return
+	}
+
+	var uInfo = UserInfo{
+		ID:    userID,
+		Token: jwtTokenString,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(uInfo)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// Logout ends the session of the token and clears the session cookies of
+// the browser
+func (l *LoginHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sessionID, ok, err := auth.FetchSessionIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching session id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if ok {
+		err = l.sessionStore.DeleteSession(ctx, userID, sessionID)
+		if err != nil && errors.Cause(err) != sessionstore.ErrSessionStoreNoRecord {
+			log.Errorf("error deleting session %v of user %v: %v", sessionID, userID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	l.jwtAuthenticator.ClearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// saveGithubToken keeps the github token of a user who opted in to the
+// github sync, from a login that asked for its scopes. A failure does not
+// fail the login, the sync reports the user as not connected instead.
+func (l *LoginHandler) saveGithubToken(r *http.Request, profile *identity.Profile, token *identity.Token) {
+	if l.credentialStore == nil || profile.Provider != identity.ProviderGithub {
+		return
+	}
+
+	ctx := r.Context()
+	userID := profile.UserID()
+
+	state, err := l.integrationStore.ReadState(ctx, identity.ProviderGithub, userID)
+	if errors.Cause(err) == integrationstore.ErrIntegrationStoreNoRecord {
+		return
+	}
+	if err != nil {
+		log.Errorf("error reading github integration of user %v: %v", userID, err)
+		return
+	}
+
+	if !state.Enabled {
+		return
+	}
+
+	err = l.credentialStore.SaveCredential(ctx, identity.ProviderGithub, userID, token.AccessToken)
+	if err != nil {
+		log.Errorf("error saving github token of user %v: %v", userID, err)
+		return
+	}
+	log.Infof("github token of user %v saved for the github sync", userID)
+}
+
+// roles returns the roles the user is granted on login
+func (l *LoginHandler) roles(profile *identity.Profile) []string {
+	if profile.Provider != identity.ProviderGithub {
+		return nil
+	}
+
+	for _, login := range l.adminGithubLogins {
+		if strings.EqualFold(login, profile.Login) {
+			return []string{store.RoleAdmin}
+		}
+	}
+
+	for _, id := range l.adminGithubIDs {
+		if id == profile.Subject {
+			return []string{store.RoleAdmin}
+		}
+	}
+
+	return nil
+}
+
+func (l *LoginHandler) providerFromRoute(r *http.Request) (identity.Provider, bool) {
+	provider, ok := l.providers[chi.URLParam(r, "provider")]
+	return provider, ok
+}
+
+func (l *LoginHandler) callbackURL(provider identity.Provider) string {
+	return fmt.Sprintf(callbackURLFormat, l.baseURL, provider.Name())
+}
+
+// consumeOAuthState checks the state returned by the provider against the
+// state cookie of the browser and consumes the server side state, so that a
+// missing, mismatched or reused state is rejected
+func (l *LoginHandler) consumeOAuthState(w http.ResponseWriter, r *http.Request) (*store.OAuthState, error) {
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		return nil, errors.New("error as query param 'state' is missing")
+	}
+
+	stateCookie, err := r.Cookie(oAuthStateCookieName)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching oauth state cookie")
+	}
+
+	// the state cookie is single use whatever the outcome
+	http.SetCookie(w, &http.Cookie{
+		Name:     oAuthStateCookieName,
+		Path:     "/login",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   l.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if subtle.ConstantTimeCompare([]byte(stateCookie.Value), []byte(state)) != 1 {
+		return nil, errors.New("error as oauth state does not match the state cookie")
+	}
+
+	oAuthState, err := l.oAuthStateStore.ConsumeState(r.Context(), state)
+	if err != nil {
+		return nil, errors.Wrap(err, "error consuming oauth state")
+	}
+
+	return oAuthState, nil
+}
+
+// writeProviderError maps the errors of the identity providers to responses
+// the user can act on. The token is nil when the code exchange failed.
+func (l *LoginHandler) writeProviderError(w http.ResponseWriter, provider identity.Provider, token *identity.Token,
+	err error) {
+
+	switch errors.Cause(err) {
+	case identity.ErrIdentityBadCode:
+		http.Error(w, "login code is invalid or expired, please login again", http.StatusBadRequest)
+		return
+	case identity.ErrIdentityUnauthorized:
+		http.Error(w, fmt.Sprintf("%s denied the authorization", provider.Name()), http.StatusUnauthorized)
+		return
+	case identity.ErrIdentityAccessDenied:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, accessDeniedPage, html.EscapeString(provider.Name()))
+		return
+	case identity.ErrIdentityRateLimited:
+		retryAfter := defaultRetryAfter
+		if rateLimitedProvider, ok := provider.(identity.RateLimitedProvider); ok &&
+			rateLimitedProvider.RetryAfter(token) > 0 {
+			retryAfter = rateLimitedProvider.RetryAfter(token)
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, fmt.Sprintf("%s is rate limiting logins, please retry later", provider.Name()),
+			http.StatusServiceUnavailable)
+		return
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		http.Error(w, fmt.Sprintf("%s timed out", provider.Name()), http.StatusGatewayTimeout)
+		return
+	}
+
+	http.Error(w, fmt.Sprintf("error talking to %s", provider.Name()), http.StatusBadGateway)
+}
@@ -0,0 +1,73 @@
+package login
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/pkg/errors"
+)
+
+const (
+	maxUserAgentLength = 256
+)
+
+// IssueSessionToken creates a session for the login of the user on the
+// device of the request and returns a token bound to it
+func IssueSessionToken(r *http.Request, sessionStore store.SessionStore, jwtAuthenticator *auth.JWTAuth,
+	userID string, scopes []string) (string, error) {
+
+	sessionID, err := auth.NewRandomToken()
+	if err != nil {
+		return "", errors.Wrap(err, "error generating session id")
+	}
+
+	now := time.Now().UTC()
+
+	session := store.Session{
+		ID:         sessionID,
+		UserID:     userID,
+		UserAgent:  userAgent(r),
+		IP:         remoteIP(r),
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+
+	err = sessionStore.CreateSession(r.Context(), session, jwtAuthenticator.ExpiryDuration())
+	if err != nil {
+		return "", errors.Wrap(err, "error creating session")
+	}
+
+	claims := map[string]interface{}{
+		auth.ClaimsKeyUserID:    userID,
+		auth.ClaimsKeyScopes:    scopes,
+		auth.ClaimsKeySessionID: sessionID,
+	}
+
+	token, err := jwtAuthenticator.CreateToken(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating jwt token")
+	}
+
+	return token, nil
+}
+
+func userAgent(r *http.Request) string {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	return userAgent
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
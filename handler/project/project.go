@@ -0,0 +1,391 @@
+package project
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	taskstore "github.com/AjithPanneerselvam/task-etcd/store/task"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// What becomes of the tasks of a deleted project
+const (
+	TasksToInbox = "inbox"
+	TasksDelete  = "delete"
+)
+
+const (
+	maxNameLength = 100
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type ProjectHandler struct {
+	projectStore store.ProjectStore
+}
+
+// ProjectRequest creates or updates a project
+type ProjectRequest struct {
+	Name string `json:"name"`
+	// Color is a #rrggbb color
+	Color    string `json:"color"`
+	Archived bool   `json:"archived"`
+	// Order places the project after the others when created and is kept
+	// when updated, unless set
+	Order *int `json:"order"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type DeleteProjectResponse struct {
+	DeletedTasks int `json:"deletedTasks"`
+	MovedTasks   int `json:"movedTasks"`
+}
+
+func NewProjectHandler(projectStore store.ProjectStore) *ProjectHandler {
+	return &ProjectHandler{
+		projectStore: projectStore,
+	}
+}
+
+// GetProjects lists the projects of the caller in order, the archived ones
+// only with archived=true
+func (p *ProjectHandler) GetProjects(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	projects, err := p.projectStore.ReadAllProjects(ctx, userID)
+	if err != nil {
+		log.Errorf("error reading projects of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	withArchived := r.URL.Query().Get("archived") == "true"
+
+	listed := make([]store.Project, 0, len(projects))
+	for _, project := range projects {
+		if project.Archived && !withArchived {
+			continue
+		}
+
+		listed = append(listed, project)
+	}
+
+	writeJSON(w, http.StatusOK, listed)
+}
+
+func (p *ProjectHandler) GetProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	projectID := chi.URLParam(r, "project-id")
+
+	project, err := p.projectStore.ReadProject(ctx, userID, projectID)
+	if errors.Cause(err) == taskstore.ErrTaskStoreNoProject {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("error reading project %v of user %v: %v", projectID, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, project)
+}
+
+func (p *ProjectHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	projectRequest, ok := decodeProjectRequest(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	project := store.Project{
+		ID:        uuid.NewString(),
+		Name:      projectRequest.Name,
+		Color:     projectRequest.Color,
+		Archived:  projectRequest.Archived,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if projectRequest.Order != nil {
+		project.Order = *projectRequest.Order
+	} else {
+		projects, err := p.projectStore.ReadAllProjects(ctx, userID)
+		if err != nil {
+			log.Errorf("error reading projects of user %v: %v", userID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// projects are read in order, the new one goes last
+		if len(projects) > 0 {
+			project.Order = projects[len(projects)-1].Order + 1
+		}
+	}
+
+	err = p.projectStore.CreateProject(ctx, userID, project)
+	if err != nil {
+		log.Errorf("error storing project %v of user %v: %v", project.ID, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Infof("project %v of user %v is created", project.ID, userID)
+
+	writeJSON(w, http.StatusCreated, project)
+}
+
+// UpdateProject renames, recolors, archives or reorders a project of the
+// caller
+func (p *ProjectHandler) UpdateProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	projectID := chi.URLParam(r, "project-id")
+
+	projectRequest, ok := decodeProjectRequest(w, r)
+	if !ok {
+		return
+	}
+
+	project, err := p.projectStore.ReadProject(ctx, userID, projectID)
+	if errors.Cause(err) == taskstore.ErrTaskStoreNoProject {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("error reading project %v of user %v: %v", projectID, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	project.Name = projectRequest.Name
+	project.Color = projectRequest.Color
+	project.Archived = projectRequest.Archived
+	if projectRequest.Order != nil {
+		project.Order = *projectRequest.Order
+	}
+	project.UpdatedAt = time.Now().UTC()
+
+	err = p.projectStore.UpdateProject(ctx, userID, *project)
+	if errors.Cause(err) == taskstore.ErrTaskStoreNoProject {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("error updating project %v of user %v: %v", projectID, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, project)
+}
+
+// DeleteProject deletes a project of the caller. The tasks query param,
+// inbox or delete, tells whether its tasks are moved to the inbox, the
+// default, or deleted along with it.
+func (p *ProjectHandler) DeleteProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	projectID := chi.URLParam(r, "project-id")
+
+	tasks := r.URL.Query().Get("tasks")
+	if tasks != "" && tasks != TasksToInbox && tasks != TasksDelete {
+		log.Errorf("error as project tasks action %v is unknown", tasks)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	deleteTasks := tasks == TasksDelete
+
+	count, err := p.projectStore.DeleteProject(ctx, userID, projectID, deleteTasks, time.Now().UTC())
+	if errors.Cause(err) == taskstore.ErrTaskStoreNoProject {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Cause(err) == taskstore.ErrTaskStoreTooManyTasks {
+		log.Errorf("error as project %v of user %v has too many tasks to delete at once", projectID, userID)
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "too_many_tasks"})
+		return
+	}
+	if err != nil {
+		log.Errorf("error deleting project %v of user %v: %v", projectID, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var deleteResponse DeleteProjectResponse
+	if deleteTasks {
+		deleteResponse.DeletedTasks = count
+	} else {
+		deleteResponse.MovedTasks = count
+	}
+	log.Infof("project %v of user %v deleted, %+v", projectID, userID, deleteResponse)
+
+	writeJSON(w, http.StatusOK, deleteResponse)
+}
+
+// UpdateProjectWorkflow sets the workflow of the tasks in a project of the
+// caller, which they follow instead of the caller's own
+func (p *ProjectHandler) UpdateProjectWorkflow(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	projectID := chi.URLParam(r, "project-id")
+
+	var workflow store.Workflow
+	err = json.NewDecoder(r.Body).Decode(&workflow)
+	if err != nil {
+		log.Errorf("error unmarshalling workflow from request body: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = workflow.Validate()
+	if err != nil {
+		log.Errorf("error validating workflow of project %v: %v", projectID, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	p.updateWorkflow(w, r, userID, projectID, &workflow)
+}
+
+// DeleteProjectWorkflow has the tasks in a project of the caller follow the
+// caller's own workflow again
+func (p *ProjectHandler) DeleteProjectWorkflow(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	p.updateWorkflow(w, r, userID, chi.URLParam(r, "project-id"), nil)
+}
+
+// updateWorkflow replaces the workflow of the project, nil for the one of the
+// user, and writes the project in the response
+func (p *ProjectHandler) updateWorkflow(w http.ResponseWriter, r *http.Request, userID string, projectID string,
+	workflow *store.Workflow) {
+
+	ctx := r.Context()
+
+	project, err := p.projectStore.ReadProject(ctx, userID, projectID)
+	if errors.Cause(err) == taskstore.ErrTaskStoreNoProject {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("error reading project %v of user %v: %v", projectID, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	project.Workflow = workflow
+	project.UpdatedAt = time.Now().UTC()
+
+	err = p.projectStore.UpdateProject(ctx, userID, *project)
+	if errors.Cause(err) == taskstore.ErrTaskStoreNoProject {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("error updating workflow of project %v of user %v: %v", projectID, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Infof("workflow of project %v of user %v is updated", projectID, userID)
+
+	writeJSON(w, http.StatusOK, project)
+}
+
+// decodeProjectRequest decodes and validates the project of the request,
+// writing the response when it is invalid
+func decodeProjectRequest(w http.ResponseWriter, r *http.Request) (*ProjectRequest, bool) {
+	var projectRequest ProjectRequest
+	err := json.NewDecoder(r.Body).Decode(&projectRequest)
+	if err != nil {
+		log.Errorf("error unmarshalling project from request body: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+
+	projectRequest.Name = strings.TrimSpace(projectRequest.Name)
+	if projectRequest.Name == "" || len(projectRequest.Name) > maxNameLength {
+		log.Errorf("error as project name %q is invalid", projectRequest.Name)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+
+	if projectRequest.Color != "" && !colorPattern.MatchString(projectRequest.Color) {
+		log.Errorf("error as project color %q is invalid", projectRequest.Color)
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+
+	return &projectRequest, true
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Errorf("error encoding the response: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package session
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	sessionstore "github.com/AjithPanneerselvam/task-etcd/store/session"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type SessionHandler struct {
+	sessionStore store.SessionStore
+}
+
+// SessionResponse is a session of the caller, flagged when it is the one the
+// request is made with
+type SessionResponse struct {
+	store.Session
+	Current bool `json:"current"`
+}
+
+type DeleteSessionsResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+func NewSessionHandler(sessionStore store.SessionStore) *SessionHandler {
+	return &SessionHandler{
+		sessionStore: sessionStore,
+	}
+}
+
+// GetSessions lists the sessions of the caller, most recently seen first
+func (s *SessionHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	currentSessionID, _, err := auth.FetchSessionIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching session id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sessions, err := s.sessionStore.ReadAllSessions(ctx, userID)
+	if err != nil {
+		log.Errorf("error reading sessions of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+
+	sessionResponses := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		sessionResponses = append(sessionResponses, SessionResponse{
+			Session: session,
+			Current: session.ID == currentSessionID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(sessionResponses)
+	if err != nil {
+		log.Errorf("error encoding the sessions response: %v", err)
+	}
+}
+
+// DeleteSession revokes a session of the caller, the tokens issued on it
+// are rejected from then on
+func (s *SessionHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sessionID := chi.URLParam(r, "session-id")
+
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = s.sessionStore.DeleteSession(ctx, userID, sessionID)
+	if errors.Cause(err) == sessionstore.ErrSessionStoreNoRecord {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("error deleting session %v of user %v: %v", sessionID, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Infof("session %v of user %v revoked", sessionID, userID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteOtherSessions revokes every session of the caller but the current one
+func (s *SessionHandler) DeleteOtherSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	currentSessionID, _, err := auth.FetchSessionIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching session id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	revoked, err := s.sessionStore.DeleteOtherSessions(ctx, userID, currentSessionID)
+	if err != nil {
+		log.Errorf("error deleting sessions of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Infof("%v sessions of user %v revoked", revoked, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(DeleteSessionsResponse{
+		Revoked: revoked,
+	})
+	if err != nil {
+		log.Errorf("error encoding the delete sessions response: %v", err)
+	}
+}
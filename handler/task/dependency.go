@@ -0,0 +1,387 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	taskstore "github.com/AjithPanneerselvam/task-etcd/store/task"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// a task is blocked by at most this many tasks
+	maxBlockersPerTask = 50
+)
+
+type DependencyRequest struct {
+	// TaskID is the task that blocks the task until it is completed
+	TaskID string `json:"taskId"`
+}
+
+// DependenciesResponse is the tasks a task is blocked by and the tasks it
+// blocks
+type DependenciesResponse struct {
+	BlockedBy []TaskResponse `json:"blockedBy"`
+	Blocking  []TaskResponse `json:"blocking"`
+}
+
+// GetDependencies lists the tasks a task of the caller is blocked by and the
+// tasks it blocks
+func (t *TaskHandler) GetDependencies(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	taskID := chi.URLParam(r, "task-id")
+
+	task, err := t.taskStore.ReadTask(ctx, userID, taskID)
+	if errors.Cause(err) == taskstore.ErrTaskStoreNoRecord {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("error reading task %v from store: %v", taskID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	blockers, err := t.taskStore.ReadTasks(ctx, userID, task.BlockedBy)
+	if err != nil {
+		log.Errorf("error reading tasks blocking task %v from store: %v", taskID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	dependents, err := t.taskStore.ReadDependentTasks(ctx, userID, taskID)
+	if err != nil {
+		log.Errorf("error reading tasks blocked by task %v from store: %v", taskID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	taskResponses, err := t.newTaskResponses(ctx, userID, append(blockers, dependents...), userLocation(r),
+		time.Now())
+	if err != nil {
+		log.Errorf("error reading dependencies of task %v from store: %v", taskID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	dependenciesResponse := DependenciesResponse{
+		BlockedBy: taskResponses[:len(blockers)],
+		Blocking:  taskResponses[len(blockers):],
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(dependenciesResponse)
+	if err != nil {
+		log.Errorf("error encoding the dependencies response: %v", err)
+	}
+}
+
+// AddDependency blocks a task of the caller by another of their tasks, unless
+// the other task is blocked by it, directly or through other tasks
+func (t *TaskHandler) AddDependency(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	taskID := chi.URLParam(r, "task-id")
+
+	var dependencyRequest DependencyRequest
+	err = json.NewDecoder(r.Body).Decode(&dependencyRequest)
+	if err != nil {
+		log.Errorf("error unmarshalling dependency request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if dependencyRequest.TaskID == "" {
+		log.Errorf("error as the task blocking task %v is missing", taskID)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	task, revision, err := t.taskStore.ReadTaskWithRevision(ctx, userID, taskID)
+	if errors.Cause(err) == taskstore.ErrTaskStoreNoRecord {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("error reading task %v from store: %v", taskID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if blockedBy(*task, dependencyRequest.TaskID) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if len(task.BlockedBy) >= maxBlockersPerTask {
+		log.Errorf("error as task %v is blocked by %v tasks already", taskID, len(task.BlockedBy))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	previous := *task
+	task.BlockedBy = append(append([]string{}, previous.BlockedBy...), dependencyRequest.TaskID)
+	task.Stamp(&previous, time.Now().UTC())
+
+	_, updated, err := t.taskStore.UpdateTaskAtRevision(ctx, userID, *task, revision)
+	if err != nil {
+		log.Errorf("error blocking task %v by task %v: %v", taskID, dependencyRequest.TaskID, err)
+		if _, ok := errors.Cause(err).(taskstore.ErrTaskDependency); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// the task, or a task the blocker depends on, changed meanwhile
+	if !updated {
+		log.Infof("task %v changed while being blocked", taskID)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	log.Infof("task %v of user %v is blocked by task %v", taskID, userID, dependencyRequest.TaskID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteDependency unblocks a task of the caller from one of the tasks it is
+// blocked by
+func (t *TaskHandler) DeleteDependency(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	taskID := chi.URLParam(r, "task-id")
+	blockerID := chi.URLParam(r, "blocker-id")
+
+	task, revision, err := t.taskStore.ReadTaskWithRevision(ctx, userID, taskID)
+	if errors.Cause(err) == taskstore.ErrTaskStoreNoRecord {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("error reading task %v from store: %v", taskID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !blockedBy(*task, blockerID) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	previous := *task
+	task.BlockedBy = nil
+	for _, id := range previous.BlockedBy {
+		if id != blockerID {
+			task.BlockedBy = append(task.BlockedBy, id)
+		}
+	}
+	task.Stamp(&previous, time.Now().UTC())
+
+	_, updated, err := t.taskStore.UpdateTaskAtRevision(ctx, userID, *task, revision)
+	if err != nil {
+		log.Errorf("error unblocking task %v from task %v: %v", taskID, blockerID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !updated {
+		log.Infof("task %v changed while being unblocked", taskID)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	log.Infof("task %v of user %v is no longer blocked by task %v", taskID, userID, blockerID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetNextTasks lists the open tasks of the caller in the order they can be
+// worked on, each after the tasks blocking it
+func (t *TaskHandler) GetNextTasks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	tasks, err := t.taskStore.ReadAllTasks(ctx, userID)
+	if err != nil {
+		log.Errorf("error reading tasks from store: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	taskResponses, err := t.newTaskResponses(ctx, userID, dependencyOrder(tasks), userLocation(r), time.Now())
+	if err != nil {
+		log.Errorf("error reading tasks of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(taskResponses)
+	if err != nil {
+		log.Errorf("error encoding the next tasks response: %v", err)
+	}
+}
+
+// blockedTasks returns the open tasks, out of the tasks, that are blocked by
+// an open task. Blocking tasks that are not among the tasks are read from
+// the store, those deleted meanwhile block no more.
+func (t *TaskHandler) blockedTasks(ctx context.Context, userID string, tasks []store.Task) (map[string]bool,
+	error) {
+
+	known := make(map[string]store.Task, len(tasks))
+	for _, task := range tasks {
+		known[task.ID] = task
+	}
+
+	var unknownIDs []string
+	unknown := make(map[string]bool)
+	for _, task := range tasks {
+		for _, blockerID := range task.BlockedBy {
+			if _, ok := known[blockerID]; !ok && !unknown[blockerID] {
+				unknown[blockerID] = true
+				unknownIDs = append(unknownIDs, blockerID)
+			}
+		}
+	}
+
+	if len(unknownIDs) > 0 {
+		blockers, err := t.taskStore.ReadTasks(ctx, userID, unknownIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, blocker := range blockers {
+			known[blocker.ID] = blocker
+		}
+	}
+
+	blocked := make(map[string]bool)
+	for _, task := range tasks {
+		if task.IsCompleted {
+			continue
+		}
+
+		for _, blockerID := range task.BlockedBy {
+			if blocker, ok := known[blockerID]; ok && !blocker.IsCompleted {
+				blocked[task.ID] = true
+				break
+			}
+		}
+	}
+
+	return blocked, nil
+}
+
+// dependencyOrder returns the open tasks ordered so that each comes after the
+// open tasks blocking it, a topological order of the dependencies. Of the
+// tasks free to go next, the one due first goes first, then the oldest.
+func dependencyOrder(tasks []store.Task) []store.Task {
+	open := make([]store.Task, 0, len(tasks))
+	isOpen := make(map[string]bool)
+	for _, task := range tasks {
+		if !task.IsCompleted {
+			open = append(open, task)
+			isOpen[task.ID] = true
+		}
+	}
+
+	sortByDueThenOldest(open)
+
+	// the number of open tasks each task waits for, and the tasks waiting
+	// for each
+	waiting := make(map[string]int)
+	dependents := make(map[string][]string)
+	for _, task := range open {
+		counted := make(map[string]bool)
+		for _, blockerID := range task.BlockedBy {
+			if isOpen[blockerID] && !counted[blockerID] {
+				counted[blockerID] = true
+				waiting[task.ID]++
+				dependents[blockerID] = append(dependents[blockerID], task.ID)
+			}
+		}
+	}
+
+	ordered := make([]store.Task, 0, len(open))
+	taken := make(map[string]bool)
+
+	// each round takes the first task in order that waits for none. Writes
+	// keep the dependencies free of cycles, tasks in one would be left out.
+	for len(ordered) < len(open) {
+		next := -1
+		for i, task := range open {
+			if !taken[task.ID] && waiting[task.ID] == 0 {
+				next = i
+				break
+			}
+		}
+
+		if next < 0 {
+			break
+		}
+
+		task := open[next]
+		taken[task.ID] = true
+		ordered = append(ordered, task)
+
+		for _, dependentID := range dependents[task.ID] {
+			waiting[dependentID]--
+		}
+	}
+
+	return ordered
+}
+
+// sortByDueThenOldest sorts the tasks by their due time, the tasks due at the
+// same time, or without one, oldest first
+func sortByDueThenOldest(tasks []store.Task) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].CreatedAt.Before(tasks[j].CreatedAt)
+	})
+	store.SortTasks(tasks, store.TaskSortDue)
+}
+
+func blockedBy(task store.Task, blockerID string) bool {
+	for _, id := range task.BlockedBy {
+		if id == blockerID {
+			return true
+		}
+	}
+
+	return false
+}
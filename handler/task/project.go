@@ -0,0 +1,191 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	taskstore "github.com/AjithPanneerselvam/task-etcd/store/task"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ProjectInbox lists the tasks in no project
+	ProjectInbox = "inbox"
+
+	// tasks are moved in a single transaction, which etcd bounds to 128
+	// operations by default. Moving a task takes up to 4: its put, its
+	// entries in the project index and the one of its pending reminder.
+	maxMovedTasks = 32
+)
+
+type MoveTasksRequest struct {
+	TaskIDs []string `json:"taskIds"`
+	// ProjectID is the project the tasks are moved to, empty for the inbox
+	ProjectID string `json:"projectId"`
+}
+
+type MoveTasksResponse struct {
+	Moved int `json:"moved"`
+}
+
+// MoveTasks moves tasks of the caller to a project, or to the inbox, all
+// of them or none
+func (t *TaskHandler) MoveTasks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var moveRequest MoveTasksRequest
+	err = json.NewDecoder(r.Body).Decode(&moveRequest)
+	if err != nil {
+		log.Errorf("error unmarshalling move tasks request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if len(moveRequest.TaskIDs) == 0 || len(moveRequest.TaskIDs) > maxMovedTasks {
+		log.Errorf("error as %v tasks cannot be moved at once", len(moveRequest.TaskIDs))
+		writeError(w, http.StatusBadRequest, "too_many_tasks")
+		return
+	}
+
+	ok, err := t.projectExists(ctx, userID, moveRequest.ProjectID)
+	if err != nil {
+		log.Errorf("error reading project %v of user %v: %v", moveRequest.ProjectID, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		log.Errorf("error as project %v of user %v does not exist", moveRequest.ProjectID, userID)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	moved := make(map[string]bool)
+
+	var writes []store.TaskWrite
+	for _, taskID := range moveRequest.TaskIDs {
+		task, revision, err := t.taskStore.ReadTaskWithRevision(ctx, userID, taskID)
+		if errors.Cause(err) == taskstore.ErrTaskStoreNoRecord {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Errorf("error reading task %v from store: %v", taskID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if task.ProjectID == moveRequest.ProjectID || moved[taskID] {
+			continue
+		}
+		moved[taskID] = true
+
+		previous := *task
+		task.ProjectID = moveRequest.ProjectID
+		task.Stamp(&previous, now)
+
+		writes = append(writes, store.TaskWrite{Task: *task, Revision: revision})
+	}
+
+	if len(writes) > 0 {
+		written, err := t.taskStore.WriteTasks(ctx, userID, writes)
+		if errors.Cause(err) == taskstore.ErrTaskStoreTooManyTasks {
+			log.Errorf("error as %v tasks of user %v are too many to move at once", len(writes), userID)
+			writeError(w, http.StatusUnprocessableEntity, "too_many_tasks")
+			return
+		}
+		if err != nil {
+			log.Errorf("error moving tasks of user %v in the store: %v", userID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// a task changed, or the project was deleted, meanwhile
+		if !written {
+			log.Infof("tasks of user %v changed while being moved", userID)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+	}
+	log.Infof("%v tasks of user %v moved to project %q", len(writes), userID, moveRequest.ProjectID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(MoveTasksResponse{
+		Moved: len(writes),
+	})
+	if err != nil {
+		log.Errorf("error encoding the move tasks response: %v", err)
+	}
+}
+
+// readTasksByProject returns the tasks of the project, the tasks in none
+// for the inbox
+func (t *TaskHandler) readTasksByProject(ctx context.Context, userID string, projectID string) ([]store.Task,
+	error) {
+
+	if projectID != ProjectInbox {
+		return t.taskStore.ReadTasksByProject(ctx, userID, projectID)
+	}
+
+	tasks, err := t.taskStore.ReadAllTasks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return inProject(tasks, ""), nil
+}
+
+// validProject reports whether the task can be put in its project, the one
+// it is in already or one that exists
+func (t *TaskHandler) validProject(ctx context.Context, userID string, task store.Task,
+	existingTask *store.Task) (bool, error) {
+
+	if existingTask != nil && existingTask.ProjectID == task.ProjectID {
+		return true, nil
+	}
+
+	return t.projectExists(ctx, userID, task.ProjectID)
+}
+
+// projectExists reports whether the project exists, the inbox always does
+func (t *TaskHandler) projectExists(ctx context.Context, userID string, projectID string) (bool, error) {
+	if projectID == "" {
+		return true, nil
+	}
+
+	_, err := t.projectStore.ReadProject(ctx, userID, projectID)
+	if errors.Cause(err) == taskstore.ErrTaskStoreNoProject {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func inProject(tasks []store.Task, projectID string) []store.Task {
+	filtered := tasks[:0]
+	for _, task := range tasks {
+		if task.ProjectID == projectID {
+			filtered = append(filtered, task)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,194 @@
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/recurrence"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Scopes of an update of an occurrence of a recurring task
+const (
+	// ScopeThis changes the occurrence only
+	ScopeThis = "this"
+	// ScopeFuture changes the occurrence and the open ones after it, and
+	// the occurrences created from then on
+	ScopeFuture = "future"
+)
+
+const (
+	errRecurrenceRuleNeedsFuture recurrence.ErrRecurrence = "error as the rule of a series is changed for future " +
+		"occurrences only"
+)
+
+// recurrenceWrites settles the recurrence of the task updated over the
+// existing one, nil for a new task, and returns the writes of the task
+// along with the occurrences it changes or creates. Completing an
+// occurrence creates the next one, once. It returns nil for a task that is
+// not recurring.
+func (t *TaskHandler) recurrenceWrites(ctx context.Context, userID string, task *store.Task,
+	existingTask *store.Task, revision int64, scope string, timeZone string, now time.Time) ([]store.TaskWrite,
+	error) {
+
+	inSeries := existingTask != nil && existingTask.Recurrence != nil
+
+	task.SeriesID = ""
+	if existingTask != nil {
+		task.SeriesID = existingTask.SeriesID
+	}
+
+	var laterWrites []store.TaskWrite
+	var err error
+
+	switch {
+	case task.Recurrence == nil && !inSeries:
+		return nil, nil
+
+	case task.Recurrence == nil:
+		// the task stops repeating, and with the future scope the open
+		// occurrences after it too
+		if scope == ScopeFuture {
+			laterWrites, err = t.updateLaterOccurrences(ctx, userID, *existingTask, now,
+				func(later *store.Task) {
+					later.Recurrence = nil
+				})
+		}
+
+	case !inSeries:
+		err = recurrence.StartSeries(task, uuid.NewString(), timeZone)
+
+	default:
+		laterWrites, err = t.updateSeries(ctx, userID, task, *existingTask, scope, now)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var nextWrite []store.TaskWrite
+	if task.Recurrence != nil && task.IsCompleted && task.Recurrence.NextTaskID == "" {
+		next, err := recurrence.NextOccurrence(*task, uuid.NewString(), now)
+		if err != nil {
+			return nil, err
+		}
+
+		if next != nil {
+			task.Recurrence.NextTaskID = next.ID
+			nextWrite = append(nextWrite, store.TaskWrite{Task: *next})
+		}
+	}
+
+	writes := append([]store.TaskWrite{{Task: *task, Revision: revision}}, laterWrites...)
+	return append(writes, nextWrite...), nil
+}
+
+// updateSeries keeps the recurrence of the occurrence of a series. With the
+// future scope the changes of its name, description, tags, project, parent,
+// reminder and due time carry over to the open occurrences after it and
+// those to come, and a new rule starts a new series from it.
+func (t *TaskHandler) updateSeries(ctx context.Context, userID string, task *store.Task, existingTask store.Task,
+	scope string, now time.Time) ([]store.TaskWrite, error) {
+
+	rule := recurrence.NormalizeRule(task.Recurrence.Rule)
+	ruleChanged := rule != existingTask.Recurrence.Rule
+
+	series := *existingTask.Recurrence
+	task.Recurrence = &series
+
+	if scope != ScopeFuture {
+		if ruleChanged {
+			return nil, errRecurrenceRuleNeedsFuture
+		}
+		return nil, nil
+	}
+
+	if task.DueAt == nil {
+		return nil, recurrence.ErrRecurrenceNoDueTime
+	}
+
+	if ruleChanged {
+		_, err := recurrence.Parse(rule)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the series moves along with the occurrence
+	var shift time.Duration
+	if existingTask.DueAt != nil {
+		shift = task.DueAt.Sub(*existingTask.DueAt)
+	}
+
+	series.Rule = rule
+	series.Start = series.Start.Add(shift)
+	series.Slot = series.Slot.Add(shift)
+	recurrence.SetTemplate(task)
+
+	occurrence := series.Occurrence
+	if ruleChanged {
+		task.SeriesID = uuid.NewString()
+		series.Start = series.Slot
+		series.Occurrence = 1
+	}
+
+	return t.updateLaterOccurrences(ctx, userID, existingTask, now, func(later *store.Task) {
+		laterSeries := series
+		laterSeries.Occurrence = series.Occurrence + later.Recurrence.Occurrence - occurrence
+		laterSeries.NextTaskID = later.Recurrence.NextTaskID
+
+		if later.DueAt != nil {
+			dueAt := later.DueAt.Add(shift)
+			later.DueAt = &dueAt
+		}
+		laterSeries.Slot = later.Recurrence.Slot.Add(shift)
+
+		later.RemindAt = nil
+		if series.RemindBefore != nil && later.DueAt != nil {
+			remindAt := later.DueAt.Add(-time.Duration(*series.RemindBefore) * time.Second)
+			later.RemindAt = &remindAt
+		}
+
+		later.Name = series.Name
+		later.Description = series.Description
+		later.Tags = series.Tags
+		later.ProjectID = task.ProjectID
+		later.ParentID = task.ParentID
+		later.SeriesID = task.SeriesID
+		later.Recurrence = &laterSeries
+	})
+}
+
+// updateLaterOccurrences returns the writes of the open occurrences of the
+// series after the given one, changed by update
+func (t *TaskHandler) updateLaterOccurrences(ctx context.Context, userID string, occurrence store.Task,
+	now time.Time, update func(later *store.Task)) ([]store.TaskWrite, error) {
+
+	tasks, err := t.taskStore.ReadAllTasks(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading tasks of the series")
+	}
+
+	var writes []store.TaskWrite
+	for _, task := range tasks {
+		if task.ID == occurrence.ID || task.SeriesID != occurrence.SeriesID || task.IsCompleted ||
+			task.Recurrence == nil || task.Recurrence.Occurrence <= occurrence.Recurrence.Occurrence {
+			continue
+		}
+
+		later, revision, err := t.taskStore.ReadTaskWithRevision(ctx, userID, task.ID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading occurrence %v of the series", task.ID)
+		}
+
+		previous := *later
+		update(later)
+		later.Stamp(&previous, now)
+
+		writes = append(writes, store.TaskWrite{Task: *later, Revision: revision})
+	}
+
+	return writes, nil
+}
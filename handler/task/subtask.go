@@ -0,0 +1,213 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/recurrence"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	taskstore "github.com/AjithPanneerselvam/task-etcd/store/task"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// What becomes of the subtasks of a deleted task
+const (
+	// SubtasksPromote moves the subtasks up to the parent of the task
+	SubtasksPromote = "promote"
+	// SubtasksDelete deletes the subtasks along with the task
+	SubtasksDelete = "delete"
+)
+
+// What becomes of the subtasks of a completed task
+const (
+	// SubtasksKeep leaves the subtasks as they are
+	SubtasksKeep = "keep"
+	// SubtasksComplete completes the open subtasks along with the task
+	SubtasksComplete = "complete"
+	// SubtasksRequire completes the task only once its subtasks are
+	SubtasksRequire = "require"
+)
+
+var errSubtasksOpen = errors.New("error as the task has open subtasks")
+
+// TaskTree is a task along with its subtasks
+type TaskTree struct {
+	TaskResponse
+	// CompletionPercent rolls up the completion of the subtasks, each
+	// weighing the same, 100 for a completed task
+	CompletionPercent int        `json:"completionPercent"`
+	Subtasks          []TaskTree `json:"subtasks"`
+}
+
+// ValidSubtaskDeletePolicy reports whether the policy for the subtasks of
+// deleted tasks is known
+func ValidSubtaskDeletePolicy(policy string) bool {
+	return policy == SubtasksPromote || policy == SubtasksDelete
+}
+
+// ValidSubtaskCompletePolicy reports whether the policy for the subtasks of
+// completed tasks is known
+func ValidSubtaskCompletePolicy(policy string) bool {
+	return policy == SubtasksKeep || policy == SubtasksComplete || policy == SubtasksRequire
+}
+
+// GetTaskTree returns a task of the caller along with its subtasks, down the
+// hierarchy, oldest first
+func (t *TaskHandler) GetTaskTree(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	taskID := chi.URLParam(r, "task-id")
+
+	task, err := t.taskStore.ReadTask(ctx, userID, taskID)
+	if errors.Cause(err) == taskstore.ErrTaskStoreNoRecord {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("error reading task %v from store: %v", taskID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	subtasks, err := t.taskStore.ReadSubtasksWithRevision(ctx, userID, taskID)
+	if err != nil {
+		log.Errorf("error reading subtasks of task %v from store: %v", taskID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	tasks := []store.Task{*task}
+	children := make(map[string][]store.Task)
+	for _, subtask := range subtasks {
+		tasks = append(tasks, subtask.Task)
+		children[subtask.Task.ParentID] = append(children[subtask.Task.ParentID], subtask.Task)
+	}
+
+	taskResponses, err := t.newTaskResponses(ctx, userID, tasks, userLocation(r), time.Now())
+	if err != nil {
+		log.Errorf("error reading subtasks of task %v from store: %v", taskID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	responses := make(map[string]TaskResponse, len(taskResponses))
+	for _, taskResponse := range taskResponses {
+		responses[taskResponse.ID] = taskResponse
+	}
+
+	tree, _ := newTaskTree(*task, children, responses)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(tree)
+	if err != nil {
+		log.Errorf("error encoding the task tree response: %v", err)
+	}
+}
+
+// newTaskTree returns the tree of the task out of the subtasks and the
+// response of each task, along with the completion of the task from 0 to 1
+func newTaskTree(task store.Task, children map[string][]store.Task,
+	responses map[string]TaskResponse) (TaskTree, float64) {
+
+	subtasks := children[task.ID]
+	sort.SliceStable(subtasks, func(i, j int) bool {
+		return subtasks[i].CreatedAt.Before(subtasks[j].CreatedAt)
+	})
+
+	tree := TaskTree{
+		TaskResponse: responses[task.ID],
+		Subtasks:     make([]TaskTree, 0, len(subtasks)),
+	}
+
+	var completion float64
+	for _, subtask := range subtasks {
+		subtree, subtaskCompletion := newTaskTree(subtask, children, responses)
+		tree.Subtasks = append(tree.Subtasks, subtree)
+		completion += subtaskCompletion
+	}
+
+	switch {
+	case task.IsCompleted:
+		completion = 1
+	case len(subtasks) > 0:
+		completion /= float64(len(subtasks))
+	}
+
+	tree.CompletionPercent = int(math.Round(completion * 100))
+	return tree, completion
+}
+
+// subtasksFollow reports whether the subtasks of the task follow it, by the
+// policy, as it is completed
+func subtasksFollow(task store.Task, existingTask *store.Task, policy string) bool {
+	return policy != SubtasksKeep && task.IsCompleted && existingTask != nil && !existingTask.IsCompleted
+}
+
+// subtaskCompletionWrites returns the writes of the subtasks of the task as
+// it is completed, by the policy, along with the subtasks read at their
+// revisions, which the writes hold only while unchanged. Recurring subtasks
+// completed along create their next occurrence. It fails with
+// errSubtasksOpen when the policy requires the subtasks to be completed
+// first.
+func (t *TaskHandler) subtaskCompletionWrites(ctx context.Context, userID string, task store.Task,
+	existingTask *store.Task, policy string, now time.Time) ([]store.TaskWrite, []store.TaskWrite, error) {
+
+	if !subtasksFollow(task, existingTask, policy) {
+		return nil, nil, nil
+	}
+
+	subtasks, err := t.taskStore.ReadSubtasksWithRevision(ctx, userID, task.ID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error reading subtasks")
+	}
+
+	var writes []store.TaskWrite
+	for _, subtask := range subtasks {
+		if subtask.Task.IsCompleted {
+			continue
+		}
+
+		if policy == SubtasksRequire {
+			return nil, nil, errSubtasksOpen
+		}
+
+		previous := subtask.Task
+		completed := previous
+		completed.IsCompleted = true
+		completed.Stamp(&previous, now)
+
+		if completed.Recurrence != nil && completed.Recurrence.NextTaskID == "" {
+			series := *completed.Recurrence
+			completed.Recurrence = &series
+
+			next, err := recurrence.NextOccurrence(completed, uuid.NewString(), now)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if next != nil {
+				completed.Recurrence.NextTaskID = next.ID
+				writes = append(writes, store.TaskWrite{Task: *next})
+			}
+		}
+
+		writes = append(writes, store.TaskWrite{Task: completed, Revision: subtask.Revision})
+	}
+
+	return writes, subtasks, nil
+}
@@ -0,0 +1,226 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	taskstore "github.com/AjithPanneerselvam/task-etcd/store/task"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	maxTagsPerTask = 20
+	maxTagLength   = 64
+	// a tag is renamed on a task in a few attempts unless it keeps changing
+	// meanwhile
+	maxRenameAttempts = 3
+)
+
+type RenameTagRequest struct {
+	From string `json:"from"`
+	// To is the new name of the tag, the tags are merged when it is in use
+	To string `json:"to"`
+}
+
+type RenameTagResponse struct {
+	Renamed int `json:"renamed"`
+}
+
+// GetTags lists the tags of the caller with the number of tasks of each
+func (t *TaskHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	tagCounts, err := t.taskStore.ReadTagCounts(ctx, userID)
+	if err != nil {
+		log.Errorf("error reading tags of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(tagCounts)
+	if err != nil {
+		log.Errorf("error encoding the tags response: %v", err)
+	}
+}
+
+// RenameTag renames a tag on every task of the caller, merging it into the
+// new one on tasks that have both
+func (t *TaskHandler) RenameTag(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var renameRequest RenameTagRequest
+	err = json.NewDecoder(r.Body).Decode(&renameRequest)
+	if err != nil {
+		log.Errorf("error unmarshalling rename tag request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	from := strings.TrimSpace(renameRequest.From)
+	to, ok := normalizeTags([]string{renameRequest.To})
+	if from == "" || !ok || len(to) != 1 || to[0] == from {
+		log.Errorf("error as tag %q cannot be renamed to %q", renameRequest.From, renameRequest.To)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	tasks, err := t.taskStore.ReadTasksByTag(ctx, userID, from)
+	if err != nil {
+		log.Errorf("error reading tasks of tag %v of user %v: %v", from, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	renamed := 0
+	for _, task := range tasks {
+		ok, err := t.renameTaskTag(ctx, userID, task.ID, from, to[0])
+		if err != nil {
+			// the tasks renamed so far keep the new tag, renaming again
+			// picks up the rest
+			log.Errorf("error renaming tag %v of task %v of user %v: %v", from, task.ID, userID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if ok {
+			renamed++
+		}
+	}
+	log.Infof("tag %v of user %v renamed to %v on %v tasks", from, userID, to[0], renamed)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(RenameTagResponse{
+		Renamed: renamed,
+	})
+	if err != nil {
+		log.Errorf("error encoding the rename tag response: %v", err)
+	}
+}
+
+// renameTaskTag renames the tag of the task, along with the tag of the
+// occurrences to come of a recurring task, reporting whether the task had it
+func (t *TaskHandler) renameTaskTag(ctx context.Context, userID string, taskID string, from string,
+	to string) (bool, error) {
+
+	for attempt := 0; attempt < maxRenameAttempts; attempt++ {
+		task, revision, err := t.taskStore.ReadTaskWithRevision(ctx, userID, taskID)
+		if errors.Cause(err) == taskstore.ErrTaskStoreNoRecord {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if !hasTag(task.Tags, from) {
+			return false, nil
+		}
+
+		previous := *task
+		task.Tags = renameTag(task.Tags, from, to)
+		if task.Recurrence != nil {
+			series := *task.Recurrence
+			series.Tags = renameTag(series.Tags, from, to)
+			task.Recurrence = &series
+		}
+		task.Stamp(&previous, time.Now().UTC())
+
+		_, updated, err := t.taskStore.UpdateTaskAtRevision(ctx, userID, *task, revision)
+		if err != nil {
+			return false, err
+		}
+
+		if updated {
+			return true, nil
+		}
+	}
+
+	return false, errors.Errorf("error renaming tag of task %v as it keeps changing", taskID)
+}
+
+// normalizeTags trims the tags and drops empty and repeated ones, reporting
+// false when there are too many or one is too long
+func normalizeTags(tags []string) ([]string, bool) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || hasTag(normalized, tag) {
+			continue
+		}
+
+		if len(tag) > maxTagLength {
+			return nil, false
+		}
+
+		normalized = append(normalized, tag)
+	}
+
+	if len(normalized) > maxTagsPerTask {
+		return nil, false
+	}
+
+	return normalized, true
+}
+
+func renameTag(tags []string, from string, to string) []string {
+	renamed := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag == from {
+			tag = to
+		}
+
+		if !hasTag(renamed, tag) {
+			renamed = append(renamed, tag)
+		}
+	}
+
+	return renamed
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validTags normalizes the tags of the task, reporting false when they are
+// invalid
+func validTags(task *store.Task) bool {
+	tags, ok := normalizeTags(task.Tags)
+	if !ok {
+		return false
+	}
+
+	task.Tags = nil
+	if len(tags) > 0 {
+		task.Tags = tags
+	}
+
+	return true
+}
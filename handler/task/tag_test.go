@@ -0,0 +1,118 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+func (m *memTaskStore) ReadTasksByTag(ctx context.Context, userID string, tag string) ([]store.Task, error) {
+	var tasks []store.Task
+	for _, task := range m.tasks {
+		if hasTag(task.Tags, tag) {
+			tasks = append(tasks, task)
+		}
+	}
+
+	return tasks, nil
+}
+
+func (m *memTaskStore) UpdateTaskAtRevision(ctx context.Context, userID string, task store.Task,
+	revision int64) (int64, bool, error) {
+
+	if !m.write([]store.TaskWrite{{Task: task, Revision: revision}}, nil) {
+		return 0, false, nil
+	}
+
+	return m.revision, true, nil
+}
+
+// postRenameTag posts the rename of the tag as the test user, returning the
+// status code and the number of tasks renamed
+func postRenameTag(t *testing.T, taskHandler *TaskHandler, from string, to string) (int, int) {
+	t.Helper()
+
+	buf, err := json.Marshal(RenameTagRequest{From: from, To: to})
+	if err != nil {
+		t.Fatalf("error marshalling request: %v", err)
+	}
+
+	token := jwt.New()
+	token.Set(auth.ClaimsKeyUserID, testUserID)
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(buf))
+	r = r.WithContext(context.WithValue(r.Context(), auth.TokenCtxKey, token))
+
+	recorder := httptest.NewRecorder()
+	taskHandler.RenameTag(recorder, r)
+
+	if recorder.Code != http.StatusOK {
+		return recorder.Code, 0
+	}
+
+	var renameResponse RenameTagResponse
+	err = json.NewDecoder(recorder.Body).Decode(&renameResponse)
+	if err != nil {
+		t.Fatalf("error decoding rename tag response: %v", err)
+	}
+
+	return recorder.Code, renameResponse.Renamed
+}
+
+func TestRenameTag(t *testing.T) {
+	taskStore := newMemTaskStore(
+		store.Task{ID: "groceries", Tags: []string{"errand", "home"}},
+		store.Task{ID: "taxes", Tags: []string{"home", "chores"}},
+		store.Task{ID: "report", Tags: []string{"work"}},
+		store.Task{ID: "plants", Tags: []string{"home"},
+			Recurrence: &store.Recurrence{Rule: "FREQ=DAILY", Tags: []string{"home"}}},
+	)
+	taskHandler := newTestTaskHandler(taskStore, store.DefaultWorkflow(), SubtasksKeep)
+
+	status, renamed := postRenameTag(t, taskHandler, "home", " chores ")
+	if status != http.StatusOK {
+		t.Fatalf("status of rename is %v, want %v", status, http.StatusOK)
+	}
+
+	if renamed != 3 {
+		t.Errorf("%v tasks renamed, want 3", renamed)
+	}
+
+	// the tags are merged on the task that had both
+	wantTags := map[string][]string{
+		"groceries": {"errand", "chores"},
+		"taxes":     {"chores"},
+		"report":    {"work"},
+		"plants":    {"chores"},
+	}
+	for taskID, tags := range wantTags {
+		if task := taskStore.tasks[taskID]; !reflect.DeepEqual(task.Tags, tags) {
+			t.Errorf("tags of task %v are %v, want %v", taskID, task.Tags, tags)
+		}
+	}
+
+	// the occurrences to come carry the new tag as well
+	if tags := taskStore.tasks["plants"].Recurrence.Tags; !reflect.DeepEqual(tags, []string{"chores"}) {
+		t.Errorf("tags of the series are %v, want [chores]", tags)
+	}
+
+	status, renamed = postRenameTag(t, taskHandler, "home", "chores")
+	if status != http.StatusOK || renamed != 0 {
+		t.Errorf("rename of unused tag is %v renaming %v tasks, want %v renaming none", status, renamed,
+			http.StatusOK)
+	}
+
+	for _, to := range []string{"", "chores"} {
+		if status, _ := postRenameTag(t, taskHandler, "chores", to); status != http.StatusBadRequest {
+			t.Errorf("status of rename to %q is %v, want %v", to, status, http.StatusBadRequest)
+		}
+	}
+}
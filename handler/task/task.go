@@ -3,11 +3,14 @@ package task
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/handler/user"
+	"github.com/AjithPanneerselvam/task-etcd/recurrence"
 	"github.com/AjithPanneerselvam/task-etcd/store"
+	taskstore "github.com/AjithPanneerselvam/task-etcd/store/task"
 	"github.com/go-chi/chi"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -15,13 +18,44 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// a task is completed in a few attempts unless it keeps changing
+	// meanwhile
+	maxCompleteAttempts = 3
+)
+
 type TaskHandler struct {
-	taskStore store.TaskStore
+	taskStore     store.TaskStore
+	projectStore  store.ProjectStore
+	workflowStore store.WorkflowStore
+	// what becomes of the subtasks of deleted and completed tasks, unless
+	// the subtasks query param says otherwise
+	subtaskDeletePolicy   string
+	subtaskCompletePolicy string
+}
+
+// TaskResponse is a task along with whether it is overdue and whether it is
+// blocked by an open task. Its status is the one in its workflow and its
+// times are given in the time zone of the user.
+type TaskResponse struct {
+	store.Task
+	Overdue bool `json:"overdue"`
+	Blocked bool `json:"blocked"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
 }
 
-func NewTaskHandler(taskStore store.TaskStore) *TaskHandler {
+func NewTaskHandler(taskStore store.TaskStore, projectStore store.ProjectStore, workflowStore store.WorkflowStore,
+	subtaskDeletePolicy string, subtaskCompletePolicy string) *TaskHandler {
+
 	return &TaskHandler{
-		taskStore: taskStore,
+		taskStore:             taskStore,
+		projectStore:          projectStore,
+		workflowStore:         workflowStore,
+		subtaskDeletePolicy:   subtaskDeletePolicy,
+		subtaskCompletePolicy: subtaskCompletePolicy,
 	}
 }
 
@@ -29,7 +63,7 @@ func (t *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	defer r.Body.Close()
 
-	userID, err := fetchUserIDFromCtx(ctx)
+	userID, err := auth.FetchUserIDFromCtx(ctx)
 	if err != nil {
 		log.Errorf("error fetching user id from ctx: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -46,10 +80,63 @@ func (t *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 
 	task.ID = uuid.NewString()
 	task.IsCompleted = false
+	// only imported tasks are linked to a source
+	task.SourceURL = ""
+	task.SeriesID = ""
+	// dependencies are added once the task exists
+	task.BlockedBy = nil
+	task.Stamp(nil, time.Now().UTC())
+
+	if !validTags(&task) {
+		log.Errorf("error as tags of task %v are invalid", task.ID)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ok, err := t.validProject(ctx, userID, task, nil)
+	if err != nil {
+		log.Errorf("error reading project %v of user %v: %v", task.ProjectID, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		log.Errorf("error as project %v of task %v does not exist", task.ProjectID, task.ID)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	workflow, err := t.workflowOf(ctx, userID, task.ProjectID)
+	if err != nil {
+		log.Errorf("error reading workflow of task %v: %v", task.ID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// tasks are created open, in the first open status unless given another
+	err = resolveStatus(workflow, &task, nil)
+	if err != nil || task.IsCompleted {
+		log.Errorf("error as status %q of task %v is not an open status of its workflow", task.Status, task.ID)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if task.Recurrence != nil {
+		err = recurrence.StartSeries(&task, uuid.NewString(), userTimeZone(r))
+		if err != nil {
+			log.Errorf("error starting series of task %v: %v", task.ID, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
 
 	err = t.taskStore.UpsertTask(ctx, userID, task)
 	if err != nil {
-		log.Error("error storing task %v in the store: %v", task.ID, err)
+		log.Errorf("error storing task %v in the store: %v", task.ID, err)
+		if _, ok := errors.Cause(err).(taskstore.ErrTaskHierarchy); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -71,7 +158,7 @@ func (t *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 
 func (t *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	userID, err := fetchUserIDFromCtx(ctx)
+	userID, err := auth.FetchUserIDFromCtx(ctx)
 	if err != nil {
 		log.Errorf("error fetching user id from ctx: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -83,14 +170,21 @@ func (t *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
 
 	task, err := t.taskStore.ReadTask(ctx, userID, taskID)
 	if err != nil {
-		log.Errorf("error reading task %v from store", taskID, err)
+		log.Errorf("error reading task %v from store: %v", taskID, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	log.Debugf("task of id %v retrieved from store", task.ID)
 
+	taskResponses, err := t.newTaskResponses(ctx, userID, []store.Task{*task}, userLocation(r), time.Now())
+	if err != nil {
+		log.Errorf("error reading task %v from store: %v", taskID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(task)
+	err = json.NewEncoder(w).Encode(taskResponses[0])
 	if err != nil {
 		log.Errorf("error encoding the task response: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -99,14 +193,51 @@ func (t *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
 
 func (t *TaskHandler) GetAllTasks(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	userID, err := fetchUserIDFromCtx(ctx)
+	userID, err := auth.FetchUserIDFromCtx(ctx)
 	if err != nil {
 		log.Errorf("error fetching user id from ctx: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	tasks, err := t.taskStore.ReadAllTasks(ctx, userID)
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy == "" {
+		if profile, ok := user.FetchProfileFromCtx(ctx); ok {
+			sortBy = profile.Preferences.DefaultSort
+		}
+	}
+
+	if sortBy != "" && !store.IsValidTaskSort(sortBy) {
+		log.Errorf("error as sort %v is unknown", sortBy)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// overdue=true lists the overdue tasks only
+	onlyOverdue := r.URL.Query().Get("overdue") == "true"
+
+	// blocked=true lists the blocked tasks only, blocked=false the others
+	onlyBlocked := r.URL.Query().Get("blocked")
+	if onlyBlocked != "" && onlyBlocked != "true" && onlyBlocked != "false" {
+		log.Errorf("error as blocked filter %v is unknown", onlyBlocked)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// tag lists the tasks of the tag only and project the tasks of the
+	// project, or of the inbox, only. Both are read through their index.
+	tag := r.URL.Query().Get("tag")
+	projectID := r.URL.Query().Get("project")
+
+	var tasks []store.Task
+	switch {
+	case tag != "":
+		tasks, err = t.taskStore.ReadTasksByTag(ctx, userID, tag)
+	case projectID != "":
+		tasks, err = t.readTasksByProject(ctx, userID, projectID)
+	default:
+		tasks, err = t.taskStore.ReadAllTasks(ctx, userID)
+	}
 	if err != nil {
 		log.Errorf("error reading tasks from store: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -114,8 +245,37 @@ func (t *TaskHandler) GetAllTasks(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Debugf("tasks retrieved from store")
 
+	if tag != "" && projectID != "" {
+		if projectID == ProjectInbox {
+			projectID = ""
+		}
+		tasks = inProject(tasks, projectID)
+	}
+
+	store.SortTasks(tasks, sortBy)
+
+	allTaskResponses, err := t.newTaskResponses(ctx, userID, tasks, userLocation(r), time.Now())
+	if err != nil {
+		log.Errorf("error reading tasks of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	taskResponses := make([]TaskResponse, 0, len(allTaskResponses))
+	for _, taskResponse := range allTaskResponses {
+		if onlyOverdue && !taskResponse.Overdue {
+			continue
+		}
+
+		if onlyBlocked != "" && taskResponse.Blocked != (onlyBlocked == "true") {
+			continue
+		}
+
+		taskResponses = append(taskResponses, taskResponse)
+	}
+
 	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(tasks)
+	err = json.NewEncoder(w).Encode(taskResponses)
 	if err != nil {
 		log.Errorf("error encoding the tasks response: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -124,7 +284,7 @@ func (t *TaskHandler) GetAllTasks(w http.ResponseWriter, r *http.Request) {
 
 func (t *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	userID, err := fetchUserIDFromCtx(ctx)
+	userID, err := auth.FetchUserIDFromCtx(ctx)
 	if err != nil {
 		log.Errorf("error fetching user id from ctx: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -133,17 +293,40 @@ func (t *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 
 	taskID := chi.URLParam(r, "task-id")
 
-	w.WriteHeader(http.StatusOK)
-	err = t.taskStore.DeleteTask(ctx, userID, taskID)
+	policy := r.URL.Query().Get("subtasks")
+	if policy == "" {
+		policy = t.subtaskDeletePolicy
+	}
+
+	if !ValidSubtaskDeletePolicy(policy) {
+		log.Errorf("error as subtask delete policy %v is unknown", policy)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = t.taskStore.DeleteTask(ctx, userID, taskID, policy == SubtasksDelete, time.Now().UTC())
+	if errors.Cause(err) == taskstore.ErrTaskStoreTooManyTasks {
+		log.Errorf("error as task %v of user %v has too many subtasks to delete at once", taskID, userID)
+		writeError(w, http.StatusUnprocessableEntity, "too_many_tasks")
+		return
+	}
 	if err != nil {
-		log.Errorf("error encoding the tasks response: %v", err)
+		log.Errorf("error deleting task %v of user %v: %v", taskID, userID, err)
 		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+
+	w.WriteHeader(http.StatusOK)
 }
 
+// UpdateTask replaces a task, moving it to its status as its workflow allows.
+// The scope query param, this or future, tells whether an update of an
+// occurrence of a recurring task carries over to the occurrences after it.
+// The subtasks query param, keep, complete or require, tells what becomes of
+// the subtasks of a task completed.
 func (t *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	userID, err := fetchUserIDFromCtx(ctx)
+	userID, err := auth.FetchUserIDFromCtx(ctx)
 	if err != nil {
 		log.Errorf("error fetching user id from ctx: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -152,6 +335,24 @@ func (t *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 
 	taskID := chi.URLParam(r, "task-id")
 
+	scope := r.URL.Query().Get("scope")
+	if scope != "" && scope != ScopeThis && scope != ScopeFuture {
+		log.Errorf("error as update scope %v is unknown", scope)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	policy := r.URL.Query().Get("subtasks")
+	if policy == "" {
+		policy = t.subtaskCompletePolicy
+	}
+
+	if !ValidSubtaskCompletePolicy(policy) {
+		log.Errorf("error as subtask complete policy %v is unknown", policy)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	var task store.Task
 	err = json.NewDecoder(r.Body).Decode(&task)
 	if err != nil {
@@ -161,26 +362,239 @@ func (t *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	}
 	task.ID = taskID
 
-	err = t.taskStore.UpsertTask(ctx, userID, task)
+	if !validTags(&task) {
+		log.Errorf("error as tags of task %v are invalid", taskID)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// the source of an imported task is kept, the sync finds the task by it,
+	// and so are its dependencies, changed through their own endpoints
+	existingTask, revision, err := t.taskStore.ReadTaskWithRevision(ctx, userID, taskID)
+	switch errors.Cause(err) {
+	case nil:
+		task.SourceURL = existingTask.SourceURL
+		task.BlockedBy = existingTask.BlockedBy
+	case taskstore.ErrTaskStoreNoRecord:
+		existingTask = nil
+		task.SourceURL = ""
+		task.BlockedBy = nil
+	default:
+		log.Errorf("error reading task %v from store: %v", taskID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ok, err := t.validProject(ctx, userID, task, existingTask)
 	if err != nil {
-		log.Error("error storing task %v in the store: %v", task.ID, err)
+		log.Errorf("error reading project %v of user %v: %v", task.ProjectID, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		log.Errorf("error as project %v of task %v does not exist", task.ProjectID, taskID)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	written, err := t.updateTask(ctx, userID, &task, existingTask, revision, scope, policy, userTimeZone(r))
+	switch errors.Cause(err) {
+	case nil:
+	case errStatusUnknown:
+		log.Errorf("error as status %q of task %v is not in its workflow", task.Status, taskID)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	case errStatusTransition:
+		log.Infof("task %v cannot move to status %q", taskID, task.Status)
+		w.WriteHeader(http.StatusConflict)
+		return
+	case errSubtasksOpen:
+		log.Infof("task %v is not completed as it has open subtasks", taskID)
+		w.WriteHeader(http.StatusConflict)
+		return
+	case taskstore.ErrTaskStoreTooManyTasks:
+		log.Errorf("error storing task %v in the store: %v", taskID, err)
+		writeError(w, http.StatusUnprocessableEntity, "too_many_tasks")
+		return
+	default:
+		log.Errorf("error updating task %v: %v", taskID, err)
+		switch errors.Cause(err).(type) {
+		case recurrence.ErrRecurrence, taskstore.ErrTaskHierarchy:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	if !written {
+		log.Infof("task %v changed while being updated", task.ID)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	if task.Recurrence != nil && task.Recurrence.NextTaskID != "" &&
+		(existingTask == nil || existingTask.Recurrence == nil || existingTask.Recurrence.NextTaskID == "") {
+		log.Infof("task %v completed, next occurrence %v created", task.ID, task.Recurrence.NextTaskID)
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func fetchUserIDFromCtx(ctx context.Context) (string, error) {
-	userIDVal, err := auth.FetchClaimValFromCtx(ctx, auth.ClaimsKeyUserID)
+// CompleteTask completes the task of the user the way an update completing
+// it does: the task moves to the terminal status of its workflow, a
+// recurring task gets its next occurrence and the subtasks follow by the
+// default policy. The task is written at the revision it was read at, so
+// edits meanwhile are not overwritten. Tasks completed already, deleted, or
+// that the workflow or the policy keep open are left alone. It reports
+// whether the task was completed.
+func (t *TaskHandler) CompleteTask(ctx context.Context, userID string, taskID string) (bool, error) {
+	for attempt := 0; attempt < maxCompleteAttempts; attempt++ {
+		existingTask, revision, err := t.taskStore.ReadTaskWithRevision(ctx, userID, taskID)
+		if errors.Cause(err) == taskstore.ErrTaskStoreNoRecord {
+			return false, nil
+		}
+		if err != nil {
+			return false, errors.Wrap(err, "error reading task")
+		}
+
+		if existingTask.IsCompleted {
+			return false, nil
+		}
+
+		task := *existingTask
+		task.IsCompleted = true
+		task.Status = ""
+
+		written, err := t.updateTask(ctx, userID, &task, existingTask, revision, "", t.subtaskCompletePolicy, "")
+		switch errors.Cause(err) {
+		case errStatusTransition:
+			log.Infof("task %v is not completed as its workflow does not allow it", taskID)
+			return false, nil
+		case errSubtasksOpen:
+			log.Infof("task %v is not completed as it has open subtasks", taskID)
+			return false, nil
+		}
+
+		if err != nil || written {
+			return written, err
+		}
+	}
+
+	return false, errors.Errorf("error completing task %v as it keeps changing", taskID)
+}
+
+// updateTask writes the task over the existing one read at the revision,
+// nil for a new task. The task moves to its status as its workflow allows,
+// and completing it creates its next occurrence and completes its subtasks
+// by the policy. It reports whether the task was written, false when it or
+// a subtask following it changed meanwhile.
+func (t *TaskHandler) updateTask(ctx context.Context, userID string, task *store.Task, existingTask *store.Task,
+	revision int64, scope string, policy string, timeZone string) (bool, error) {
+
+	workflow, err := t.workflowOf(ctx, userID, task.ProjectID)
+	if err != nil {
+		return false, err
+	}
+
+	err = resolveStatus(workflow, task, existingTask)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+	task.Stamp(existingTask, now)
+
+	writes, err := t.recurrenceWrites(ctx, userID, task, existingTask, revision, scope, timeZone, now)
+	if err != nil {
+		return false, errors.Wrap(err, "error updating recurrence")
+	}
+
+	subtaskWrites, subtasks, err := t.subtaskCompletionWrites(ctx, userID, *task, existingTask, policy, now)
+	if err == errSubtasksOpen {
+		return false, err
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "error completing subtasks")
+	}
+
+	if writes == nil {
+		writes = []store.TaskWrite{{Task: *task, Revision: revision}}
+	}
+	writes = append(writes, subtaskWrites...)
+
+	// the task is written at the revision it was read at, along with the
+	// occurrences and the subtasks completed along, so that an occurrence
+	// completed twice at once creates a single next one. A task its subtasks
+	// follow is written only while they are as they were read.
+	var written bool
+	if subtasksFollow(*task, existingTask, policy) {
+		written, err = t.taskStore.WriteTasksWithSubtree(ctx, userID, writes, task.ID, subtasks)
+	} else {
+		written, err = t.taskStore.WriteTasks(ctx, userID, writes)
+	}
 	if err != nil {
-		return "", errors.Wrapf(err, "error fetching claim %v value", auth.ClaimsKeyUserID)
+		return false, errors.Wrap(err, "error storing task")
 	}
 
-	userID, ok := userIDVal.(string)
+	return written, nil
+}
+
+func newTaskResponse(task store.Task, blocked bool, location *time.Location, now time.Time) TaskResponse {
+	task.CreatedAt = task.CreatedAt.In(location)
+	task.UpdatedAt = task.UpdatedAt.In(location)
+	task.CompletedAt = inLocation(task.CompletedAt, location)
+	task.DueAt = inLocation(task.DueAt, location)
+	task.RemindAt = inLocation(task.RemindAt, location)
+	task.RemindedAt = inLocation(task.RemindedAt, location)
+
+	return TaskResponse{
+		Task:    task,
+		Overdue: task.Overdue(now),
+		Blocked: blocked,
+	}
+}
+
+// userLocation returns the time zone of the caller's preferences, utc when
+// none is set
+func userLocation(r *http.Request) *time.Location {
+	timeZone := userTimeZone(r)
+	if timeZone == "" {
+		return time.UTC
+	}
+
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		log.Errorf("error loading time zone %v: %v", timeZone, err)
+		return time.UTC
+	}
+
+	return location
+}
+
+// userTimeZone returns the time zone of the caller's preferences, empty when
+// none is set
+func userTimeZone(r *http.Request) string {
+	profile, ok := user.FetchProfileFromCtx(r.Context())
 	if !ok {
-		return "", fmt.Errorf("error type asserting value %v of %v key", userIDVal, auth.ClaimsKeyUserID)
+		return ""
 	}
 
-	return userID, nil
+	return profile.Preferences.TimeZone
+}
+
+func inLocation(t *time.Time, location *time.Location) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	inLocation := t.In(location)
+	return &inLocation
+}
+
+func writeError(w http.ResponseWriter, statusCode int, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(errorResponse{Error: errorCode})
 }
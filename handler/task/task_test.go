@@ -0,0 +1,340 @@
+package task
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/recurrence"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	taskstore "github.com/AjithPanneerselvam/task-etcd/store/task"
+)
+
+const testUserID = "local:alice"
+
+// memTaskStore keeps the tasks of a user at revisions. edit is applied to the
+// store before each of the first racingEdits writes, as an edit of the user
+// racing the write.
+type memTaskStore struct {
+	store.TaskStore
+
+	tasks     map[string]store.Task
+	revisions map[string]int64
+	revision  int64
+
+	edit        func(m *memTaskStore)
+	racingEdits int
+	writes      int
+}
+
+func newMemTaskStore(tasks ...store.Task) *memTaskStore {
+	m := &memTaskStore{
+		tasks:     make(map[string]store.Task),
+		revisions: make(map[string]int64),
+	}
+
+	for _, task := range tasks {
+		m.put(task)
+	}
+
+	return m
+}
+
+func (m *memTaskStore) put(task store.Task) {
+	m.revision++
+	m.tasks[task.ID] = task
+	m.revisions[task.ID] = m.revision
+}
+
+func (m *memTaskStore) ReadTaskWithRevision(ctx context.Context, userID string, taskID string) (*store.Task, int64,
+	error) {
+
+	task, ok := m.tasks[taskID]
+	if !ok {
+		return nil, 0, taskstore.ErrTaskStoreNoRecord
+	}
+
+	return &task, m.revisions[taskID], nil
+}
+
+func (m *memTaskStore) ReadSubtasksWithRevision(ctx context.Context, userID string, taskID string) ([]store.TaskWrite,
+	error) {
+
+	var subtasks []store.TaskWrite
+	for id, task := range m.tasks {
+		if task.ParentID == taskID {
+			subtasks = append(subtasks, store.TaskWrite{Task: task, Revision: m.revisions[id]})
+		}
+	}
+
+	return subtasks, nil
+}
+
+func (m *memTaskStore) WriteTasks(ctx context.Context, userID string, writes []store.TaskWrite) (bool, error) {
+	return m.write(writes, nil), nil
+}
+
+func (m *memTaskStore) WriteTasksWithSubtree(ctx context.Context, userID string, writes []store.TaskWrite,
+	taskID string, subtasks []store.TaskWrite) (bool, error) {
+
+	return m.write(writes, subtasks), nil
+}
+
+// write writes the tasks unless any of them, or of the guarded ones, changed
+// since it was read
+func (m *memTaskStore) write(writes []store.TaskWrite, guards []store.TaskWrite) bool {
+	m.writes++
+	if m.writes <= m.racingEdits {
+		m.edit(m)
+	}
+
+	for _, write := range append(append([]store.TaskWrite{}, writes...), guards...) {
+		if m.revisions[write.Task.ID] != write.Revision {
+			return false
+		}
+	}
+
+	for _, write := range writes {
+		m.put(write.Task)
+	}
+
+	return true
+}
+
+// fixedWorkflowStore has the same workflow for every user
+type fixedWorkflowStore struct {
+	store.WorkflowStore
+
+	workflow store.Workflow
+}
+
+func (f fixedWorkflowStore) ReadWorkflow(ctx context.Context, userID string) (*store.Workflow, error) {
+	workflow := f.workflow
+	return &workflow, nil
+}
+
+// reviewWorkflow lets tasks be completed only once reviewed
+func reviewWorkflow() store.Workflow {
+	return store.Workflow{
+		Statuses: []store.WorkflowStatus{
+			{Name: "todo", Next: []string{"review"}},
+			{Name: "review", Next: []string{"todo", "shipped"}},
+			{Name: "shipped", Terminal: true},
+		},
+	}
+}
+
+func newTestTaskHandler(taskStore *memTaskStore, workflow store.Workflow, policy string) *TaskHandler {
+	return NewTaskHandler(taskStore, nil, fixedWorkflowStore{workflow: workflow}, SubtasksPromote, policy)
+}
+
+func TestCompleteTask(t *testing.T) {
+	testCases := []struct {
+		name          string
+		task          *store.Task
+		workflow      store.Workflow
+		edit          func(m *memTaskStore)
+		wantCompleted bool
+		wantName      string
+		wantStatus    string
+	}{
+		{
+			name:          "open task",
+			task:          &store.Task{ID: "task", Name: "fix the build", Status: store.StatusTodo},
+			workflow:      store.DefaultWorkflow(),
+			wantCompleted: true,
+			wantName:      "fix the build",
+			wantStatus:    store.StatusDone,
+		},
+		{
+			name:       "completed task",
+			task:       &store.Task{ID: "task", Name: "fix the build", IsCompleted: true, Status: store.StatusDone},
+			workflow:   store.DefaultWorkflow(),
+			wantName:   "fix the build",
+			wantStatus: store.StatusDone,
+		},
+		{
+			name:     "deleted task",
+			workflow: store.DefaultWorkflow(),
+		},
+		{
+			name:     "task renamed meanwhile",
+			task:     &store.Task{ID: "task", Name: "fix the build"},
+			workflow: store.DefaultWorkflow(),
+			edit: func(m *memTaskStore) {
+				task := m.tasks["task"]
+				task.Name = "fix the flaky build"
+				m.put(task)
+			},
+			wantCompleted: true,
+			wantName:      "fix the flaky build",
+			wantStatus:    store.StatusDone,
+		},
+		{
+			name:     "task completed meanwhile",
+			task:     &store.Task{ID: "task", Name: "fix the build"},
+			workflow: store.DefaultWorkflow(),
+			edit: func(m *memTaskStore) {
+				task := m.tasks["task"]
+				task.IsCompleted, task.Status = true, store.StatusDone
+				m.put(task)
+			},
+			wantName:   "fix the build",
+			wantStatus: store.StatusDone,
+		},
+		{
+			name:          "task in review",
+			task:          &store.Task{ID: "task", Name: "fix the build", Status: "review"},
+			workflow:      reviewWorkflow(),
+			wantCompleted: true,
+			wantName:      "fix the build",
+			wantStatus:    "shipped",
+		},
+		{
+			name:       "task the workflow keeps open",
+			task:       &store.Task{ID: "task", Name: "fix the build", Status: "todo"},
+			workflow:   reviewWorkflow(),
+			wantName:   "fix the build",
+			wantStatus: "todo",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			taskStore := newMemTaskStore()
+			if tc.task != nil {
+				taskStore.put(*tc.task)
+			}
+			if tc.edit != nil {
+				taskStore.edit, taskStore.racingEdits = tc.edit, 1
+			}
+			taskHandler := newTestTaskHandler(taskStore, tc.workflow, SubtasksKeep)
+
+			completed, err := taskHandler.CompleteTask(context.Background(), testUserID, "task")
+			if err != nil {
+				t.Fatalf("error completing task: %v", err)
+			}
+
+			if completed != tc.wantCompleted {
+				t.Errorf("completed is %v, want %v", completed, tc.wantCompleted)
+			}
+
+			if tc.task == nil {
+				return
+			}
+
+			task := taskStore.tasks["task"]
+			if task.Name != tc.wantName {
+				t.Errorf("task name is %q, want %q", task.Name, tc.wantName)
+			}
+
+			if task.Status != tc.wantStatus {
+				t.Errorf("task status is %q, want %q", task.Status, tc.wantStatus)
+			}
+
+			wantIsCompleted := tc.wantStatus == store.StatusDone || tc.wantStatus == "shipped"
+			if task.IsCompleted != wantIsCompleted {
+				t.Errorf("task is completed is %v, want %v", task.IsCompleted, wantIsCompleted)
+			}
+		})
+	}
+}
+
+func TestCompleteTaskKeepsChanging(t *testing.T) {
+	taskStore := newMemTaskStore(store.Task{ID: "task", Name: "fix the build"})
+	taskStore.edit = func(m *memTaskStore) {
+		task := m.tasks["task"]
+		task.Name += "!"
+		m.put(task)
+	}
+	taskStore.racingEdits = maxCompleteAttempts
+
+	taskHandler := newTestTaskHandler(taskStore, store.DefaultWorkflow(), SubtasksKeep)
+
+	_, err := taskHandler.CompleteTask(context.Background(), testUserID, "task")
+	if err == nil {
+		t.Fatalf("task completed while it keeps changing")
+	}
+
+	if taskStore.writes != maxCompleteAttempts {
+		t.Errorf("task written %v times, want %v", taskStore.writes, maxCompleteAttempts)
+	}
+}
+
+func TestCompleteRecurringTask(t *testing.T) {
+	dueAt := time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	task := store.Task{
+		ID:         "task",
+		Name:       "water the plants",
+		DueAt:      &dueAt,
+		Recurrence: &store.Recurrence{Rule: "FREQ=DAILY"},
+	}
+	err := recurrence.StartSeries(&task, "series", "")
+	if err != nil {
+		t.Fatalf("error starting series: %v", err)
+	}
+
+	taskStore := newMemTaskStore(task)
+	taskHandler := newTestTaskHandler(taskStore, store.DefaultWorkflow(), SubtasksKeep)
+
+	completed, err := taskHandler.CompleteTask(context.Background(), testUserID, "task")
+	if err != nil || !completed {
+		t.Fatalf("task completed is %v, %v, want true", completed, err)
+	}
+
+	nextTaskID := taskStore.tasks["task"].Recurrence.NextTaskID
+	next, ok := taskStore.tasks[nextTaskID]
+	if nextTaskID == "" || !ok {
+		t.Fatalf("next occurrence is not created")
+	}
+
+	if next.IsCompleted || next.Recurrence.Occurrence != 2 || !next.DueAt.Equal(dueAt.AddDate(0, 0, 1)) {
+		t.Errorf("next occurrence is %+v, want the open second one due a day later", next)
+	}
+
+	// completing the occurrence again creates no other one
+	completed, err = taskHandler.CompleteTask(context.Background(), testUserID, "task")
+	if err != nil || completed {
+		t.Errorf("task completed again is %v, %v, want false", completed, err)
+	}
+
+	if len(taskStore.tasks) != 2 {
+		t.Errorf("%v tasks stored, want 2", len(taskStore.tasks))
+	}
+}
+
+func TestCompleteTaskSubtasks(t *testing.T) {
+	testCases := []struct {
+		policy               string
+		wantCompleted        bool
+		wantSubtaskCompleted bool
+	}{
+		{policy: SubtasksKeep, wantCompleted: true},
+		{policy: SubtasksComplete, wantCompleted: true, wantSubtaskCompleted: true},
+		{policy: SubtasksRequire},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.policy, func(t *testing.T) {
+			taskStore := newMemTaskStore(
+				store.Task{ID: "task", Name: "ship the release"},
+				store.Task{ID: "subtask", Name: "write the notes", ParentID: "task"},
+			)
+			taskHandler := newTestTaskHandler(taskStore, store.DefaultWorkflow(), tc.policy)
+
+			completed, err := taskHandler.CompleteTask(context.Background(), testUserID, "task")
+			if err != nil {
+				t.Fatalf("error completing task: %v", err)
+			}
+
+			if completed != tc.wantCompleted || taskStore.tasks["task"].IsCompleted != tc.wantCompleted {
+				t.Errorf("task completed is %v, want %v", completed, tc.wantCompleted)
+			}
+
+			subtask := taskStore.tasks["subtask"]
+			if subtask.IsCompleted != tc.wantSubtaskCompleted {
+				t.Errorf("subtask completed is %v, want %v", subtask.IsCompleted, tc.wantSubtaskCompleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	taskstore "github.com/AjithPanneerselvam/task-etcd/store/task"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	errStatusUnknown    = errors.New("error as the status is not in the workflow")
+	errStatusTransition = errors.New("error as the workflow does not let the task move to the status")
+)
+
+// BoardColumn is a status of a workflow along with the tasks in it
+type BoardColumn struct {
+	Status   string         `json:"status"`
+	Terminal bool           `json:"terminal"`
+	Tasks    []TaskResponse `json:"tasks"`
+}
+
+// workflows are the workflows of the tasks of a user, by project
+type workflows struct {
+	user     store.Workflow
+	projects map[string]store.Workflow
+}
+
+func (w *workflows) of(projectID string) store.Workflow {
+	if workflow, ok := w.projects[projectID]; ok {
+		return workflow
+	}
+
+	return w.user
+}
+
+// GetWorkflow returns the workflow of the caller, which the tasks in projects
+// without their own follow
+func (t *TaskHandler) GetWorkflow(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	workflow, err := t.workflowStore.ReadWorkflow(ctx, userID)
+	if err != nil {
+		log.Errorf("error reading workflow of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(workflow)
+	if err != nil {
+		log.Errorf("error encoding the workflow response: %v", err)
+	}
+}
+
+// UpdateWorkflow replaces the workflow of the caller. Tasks in a status it
+// no longer has are in its first open or terminal status, by their
+// completion.
+func (t *TaskHandler) UpdateWorkflow(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var workflow store.Workflow
+	err = json.NewDecoder(r.Body).Decode(&workflow)
+	if err != nil {
+		log.Errorf("error unmarshalling workflow from request body: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = workflow.Validate()
+	if err != nil {
+		log.Errorf("error validating workflow of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = t.workflowStore.UpsertWorkflow(ctx, userID, workflow)
+	if err != nil {
+		log.Errorf("error storing workflow of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Infof("workflow of user %v is updated", userID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetBoard lists the tasks of the caller by status, a column for each status
+// of the workflow in order. The project query param, a project or inbox,
+// lists the tasks of the project by its workflow. Otherwise every task is
+// listed by the workflow of the user, the tasks in a status it lacks by
+// their completion. Each column lists the task due first, then the oldest,
+// first.
+func (t *TaskHandler) GetBoard(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	projectID := r.URL.Query().Get("project")
+
+	boardProjectID := projectID
+	if projectID == ProjectInbox {
+		boardProjectID = ""
+	}
+
+	ok, err := t.projectExists(ctx, userID, boardProjectID)
+	if err != nil {
+		log.Errorf("error reading project %v of user %v: %v", projectID, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	workflow, err := t.workflowOf(ctx, userID, boardProjectID)
+	if err != nil {
+		log.Errorf("error reading workflow of project %v of user %v: %v", projectID, userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var tasks []store.Task
+	if projectID == "" {
+		tasks, err = t.taskStore.ReadAllTasks(ctx, userID)
+	} else {
+		tasks, err = t.readTasksByProject(ctx, userID, projectID)
+	}
+	if err != nil {
+		log.Errorf("error reading tasks from store: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sortByDueThenOldest(tasks)
+
+	taskResponses, err := t.newTaskResponses(ctx, userID, tasks, userLocation(r), time.Now())
+	if err != nil {
+		log.Errorf("error reading tasks of user %v: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	columns := make([]BoardColumn, 0, len(workflow.Statuses))
+	columnOf := make(map[string]int)
+	for _, status := range workflow.Statuses {
+		columnOf[status.Name] = len(columns)
+		columns = append(columns, BoardColumn{
+			Status:   status.Name,
+			Terminal: status.Terminal,
+			Tasks:    make([]TaskResponse, 0),
+		})
+	}
+
+	for _, taskResponse := range taskResponses {
+		column := columnOf[workflow.StatusOf(taskResponse.Task)]
+		columns[column].Tasks = append(columns[column].Tasks, taskResponse)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(columns)
+	if err != nil {
+		log.Errorf("error encoding the board response: %v", err)
+	}
+}
+
+// newTaskResponses returns the responses of the tasks in order, each with
+// its status in its workflow and whether it is blocked
+func (t *TaskHandler) newTaskResponses(ctx context.Context, userID string, tasks []store.Task,
+	location *time.Location, now time.Time) ([]TaskResponse, error) {
+
+	blocked, err := t.blockedTasks(ctx, userID, tasks)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading blocking tasks")
+	}
+
+	workflows, err := t.readWorkflows(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	taskResponses := make([]TaskResponse, 0, len(tasks))
+	for _, task := range tasks {
+		workflow := workflows.of(task.ProjectID)
+		task.Status = workflow.StatusOf(task)
+
+		taskResponses = append(taskResponses, newTaskResponse(task, blocked[task.ID], location, now))
+	}
+
+	return taskResponses, nil
+}
+
+// readWorkflows returns the workflows of the user and of their projects
+func (t *TaskHandler) readWorkflows(ctx context.Context, userID string) (*workflows, error) {
+	userWorkflow, err := t.workflowStore.ReadWorkflow(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading workflow")
+	}
+
+	projects, err := t.projectStore.ReadAllProjects(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading projects")
+	}
+
+	workflows := workflows{
+		user:     *userWorkflow,
+		projects: make(map[string]store.Workflow),
+	}
+	for _, project := range projects {
+		if project.Workflow != nil {
+			workflows.projects[project.ID] = *project.Workflow
+		}
+	}
+
+	return &workflows, nil
+}
+
+// workflowOf returns the workflow of the tasks in the project, the one of the
+// user for the inbox or a project without its own
+func (t *TaskHandler) workflowOf(ctx context.Context, userID string, projectID string) (store.Workflow, error) {
+	if projectID != "" {
+		project, err := t.projectStore.ReadProject(ctx, userID, projectID)
+		if err != nil && errors.Cause(err) != taskstore.ErrTaskStoreNoProject {
+			return store.Workflow{}, errors.Wrap(err, "error reading project")
+		}
+
+		if err == nil && project.Workflow != nil {
+			return *project.Workflow, nil
+		}
+	}
+
+	workflow, err := t.workflowStore.ReadWorkflow(ctx, userID)
+	if err != nil {
+		return store.Workflow{}, errors.Wrap(err, "error reading workflow")
+	}
+
+	return *workflow, nil
+}
+
+// resolveStatus sets the status of the task written over its existing
+// version, nil for a new task, and completes the task in a terminal status.
+// A status left out, or left as it was, follows the completion of the task,
+// so that clients unaware of workflows complete and reopen tasks as before.
+// The task moves to its status only as the workflow allows.
+func resolveStatus(workflow store.Workflow, task *store.Task, existingTask *store.Task) error {
+	var current string
+	if existingTask != nil {
+		current = workflow.StatusOf(*existingTask)
+	}
+
+	status := task.Status
+	if status == "" || (existingTask != nil && (status == existingTask.Status || status == current)) {
+		followed := *task
+		followed.Status = current
+		status = workflow.StatusOf(followed)
+	}
+
+	workflowStatus, ok := workflow.Status(status)
+	if !ok {
+		return errStatusUnknown
+	}
+
+	if existingTask != nil && !workflow.CanMove(current, status) {
+		return errStatusTransition
+	}
+
+	task.Status = status
+	task.IsCompleted = workflowStatus.Terminal
+
+	return nil
+}
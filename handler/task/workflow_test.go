@@ -0,0 +1,134 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+)
+
+func TestResolveStatus(t *testing.T) {
+	testCases := []struct {
+		name            string
+		workflow        store.Workflow
+		existingTask    *store.Task
+		task            store.Task
+		wantErr         error
+		wantStatus      string
+		wantIsCompleted bool
+	}{
+		{
+			name:       "new task without status",
+			workflow:   reviewWorkflow(),
+			task:       store.Task{ID: "task"},
+			wantStatus: "todo",
+		},
+		{
+			name:            "new completed task without status",
+			workflow:        reviewWorkflow(),
+			task:            store.Task{ID: "task", IsCompleted: true},
+			wantStatus:      "shipped",
+			wantIsCompleted: true,
+		},
+		{
+			name:       "new task with status",
+			workflow:   reviewWorkflow(),
+			task:       store.Task{ID: "task", Status: "review"},
+			wantStatus: "review",
+		},
+		{
+			name:            "new task in terminal status",
+			workflow:        reviewWorkflow(),
+			task:            store.Task{ID: "task", Status: "shipped"},
+			wantStatus:      "shipped",
+			wantIsCompleted: true,
+		},
+		{
+			name:     "unknown status",
+			workflow: reviewWorkflow(),
+			task:     store.Task{ID: "task", Status: "blocked"},
+			wantErr:  errStatusUnknown,
+		},
+		{
+			name:         "allowed transition",
+			workflow:     reviewWorkflow(),
+			existingTask: &store.Task{ID: "task", Status: "todo"},
+			task:         store.Task{ID: "task", Status: "review"},
+			wantStatus:   "review",
+		},
+		{
+			name:            "transition to terminal status",
+			workflow:        reviewWorkflow(),
+			existingTask:    &store.Task{ID: "task", Status: "review"},
+			task:            store.Task{ID: "task", Status: "shipped"},
+			wantStatus:      "shipped",
+			wantIsCompleted: true,
+		},
+		{
+			name:         "disallowed transition",
+			workflow:     reviewWorkflow(),
+			existingTask: &store.Task{ID: "task", Status: "todo"},
+			task:         store.Task{ID: "task", Status: "shipped"},
+			wantErr:      errStatusTransition,
+		},
+		{
+			name:         "completion the workflow does not allow",
+			workflow:     reviewWorkflow(),
+			existingTask: &store.Task{ID: "task", Status: "todo"},
+			task:         store.Task{ID: "task", Status: "todo", IsCompleted: true},
+			wantErr:      errStatusTransition,
+		},
+		{
+			name:         "status left as it was",
+			workflow:     reviewWorkflow(),
+			existingTask: &store.Task{ID: "task", Status: "review"},
+			task:         store.Task{ID: "task", Status: "review"},
+			wantStatus:   "review",
+		},
+		{
+			name:            "unchanged status following completion",
+			workflow:        store.DefaultWorkflow(),
+			existingTask:    &store.Task{ID: "task", Status: store.StatusTodo},
+			task:            store.Task{ID: "task", Status: store.StatusTodo, IsCompleted: true},
+			wantStatus:      store.StatusDone,
+			wantIsCompleted: true,
+		},
+		{
+			name:         "unchanged status following reopening",
+			workflow:     store.DefaultWorkflow(),
+			existingTask: &store.Task{ID: "task", Status: store.StatusDone, IsCompleted: true},
+			task:         store.Task{ID: "task", Status: store.StatusDone},
+			wantStatus:   store.StatusTodo,
+		},
+		{
+			name:            "status left out following completion",
+			workflow:        store.DefaultWorkflow(),
+			existingTask:    &store.Task{ID: "task", Status: store.StatusTodo},
+			task:            store.Task{ID: "task", IsCompleted: true},
+			wantStatus:      store.StatusDone,
+			wantIsCompleted: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			task := tc.task
+
+			err := resolveStatus(tc.workflow, &task, tc.existingTask)
+			if err != tc.wantErr {
+				t.Fatalf("error resolving status is %v, want %v", err, tc.wantErr)
+			}
+
+			if tc.wantErr != nil {
+				return
+			}
+
+			if task.Status != tc.wantStatus {
+				t.Errorf("task status is %q, want %q", task.Status, tc.wantStatus)
+			}
+
+			if task.IsCompleted != tc.wantIsCompleted {
+				t.Errorf("task is completed is %v, want %v", task.IsCompleted, tc.wantIsCompleted)
+			}
+		})
+	}
+}
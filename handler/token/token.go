@@ -0,0 +1,122 @@
+package token
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/lestrrat-go/jwx/jwt"
+	log "github.com/sirupsen/logrus"
+)
+
+type TokenHandler struct {
+	jwtAuthenticator *auth.JWTAuth
+}
+
+type CreateTokenRequest struct {
+	Scopes []string `json:"scopes"`
+}
+
+type CreateTokenResponse struct {
+	Token  string   `json:"token"`
+	Scopes []string `json:"scopes"`
+}
+
+func NewTokenHandler(jwtAuthenticator *auth.JWTAuth) *TokenHandler {
+	return &TokenHandler{
+		jwtAuthenticator: jwtAuthenticator,
+	}
+}
+
+// CreateToken issues a token for the caller restricted to the requested
+// scopes, e.g. a read-only token for a dashboard. A token can never be
+// granted a scope the caller's own token does not carry, nor outlive it.
+func (t *TokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	userID, err := auth.FetchUserIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching user id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	callerScopes, err := auth.FetchScopesFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching scopes from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var createTokenRequest CreateTokenRequest
+	err = json.NewDecoder(r.Body).Decode(&createTokenRequest)
+	if err != nil {
+		log.Errorf("error unmarshalling create token request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if len(createTokenRequest.Scopes) == 0 {
+		log.Error("error as no scopes are requested")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	for _, scope := range createTokenRequest.Scopes {
+		if !auth.IsKnownScope(scope) {
+			log.Errorf("error as scope %v is unknown", scope)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !auth.HasScope(callerScopes, scope) {
+			log.Infof("user %v requested scope %v beyond their own", userID, scope)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+
+	callerToken, err := auth.FetchTokenFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching token from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// a token cannot renew itself through the tokens it issues
+	claims := map[string]interface{}{
+		auth.ClaimsKeyUserID: userID,
+		auth.ClaimsKeyScopes: createTokenRequest.Scopes,
+		jwt.ExpirationKey:    callerToken.Expiration(),
+	}
+
+	// the token lives and dies with the caller's session
+	sessionID, ok, err := auth.FetchSessionIDFromCtx(ctx)
+	if err != nil {
+		log.Errorf("error fetching session id from ctx: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if ok {
+		claims[auth.ClaimsKeySessionID] = sessionID
+	}
+
+	jwtTokenString, err := t.jwtAuthenticator.CreateToken(claims)
+	if err != nil {
+		log.Errorf("error creating jwt token: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(CreateTokenResponse{
+		Token:  jwtTokenString,
+		Scopes: createTokenRequest.Scopes,
+	})
+	if err != nil {
+		log.Errorf("error encoding the create token response: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	userstore "github.com/AjithPanneerselvam/task-etcd/store/user"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type contextKey struct {
+	name string
+}
+
+func (k *contextKey) String() string {
+	return k.name
+}
+
+var (
+	ProfileCtxKey = &contextKey{"Profile"}
+)
+
+type UserHandler struct {
+	userStore store.UserStore
+}
+
+// UpdateMeRequest holds the preferences to change, preferences left out
+// are kept
+type UpdateMeRequest struct {
+	Preferences struct {
+		TimeZone    *string `json:"timeZone"`
+		DefaultSort *string `json:"defaultSort"`
+	} `json:"preferences"`
+}
+
+type insufficientRoleResponse struct {
+	Error       string `json:"error"`
+	MissingRole string `json:"missingRole"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewUserHandler(userStore store.UserStore) *UserHandler {
+	return &UserHandler{
+		userStore: userStore,
+	}
+}
+
+// ProfileCtx loads the profile of the caller into the request context.
+// Users who have not logged in since profiles were introduced have none.
+func (u *UserHandler) ProfileCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		userID, err := auth.FetchUserIDFromCtx(ctx)
+		if err != nil {
+			log.Errorf("error fetching user id from ctx: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		profile, err := u.userStore.ReadProfile(ctx, userID)
+		if err != nil && errors.Cause(err) != userstore.ErrUserStoreNoRecord {
+			log.Errorf("error reading profile of user %v: %v", userID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if profile != nil && profile.Disabled {
+			log.Infof("request of disabled user %v rejected", userID)
+			writeError(w, http.StatusForbidden, "account_disabled")
+			return
+		}
+
+		if profile != nil {
+			ctx = context.WithValue(ctx, ProfileCtxKey, profile)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireRole returns a middleware that rejects requests of users without
+// the role. It has to run after ProfileCtx.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			profile, ok := FetchProfileFromCtx(r.Context())
+			if !ok || !profile.HasRole(role) {
+				log.Infof("request to %v rejected as role %v is missing", r.URL.Path, role)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(insufficientRoleResponse{
+					Error:       "insufficient_role",
+					MissingRole: role,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// FetchProfileFromCtx fetches the profile loaded by ProfileCtx
+func FetchProfileFromCtx(ctx context.Context) (*store.UserProfile, bool) {
+	profile, ok := ctx.Value(ProfileCtxKey).(*store.UserProfile)
+	return profile, ok
+}
+
+func (u *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	profile, ok := FetchProfileFromCtx(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(profile)
+	if err != nil {
+		log.Errorf("error encoding the profile response: %v", err)
+	}
+}
+
+func (u *UserHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	profile, ok := FetchProfileFromCtx(ctx)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var updateMeRequest UpdateMeRequest
+	err := json.NewDecoder(r.Body).Decode(&updateMeRequest)
+	if err != nil {
+		log.Errorf("error unmarshalling update me request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	preferences := profile.Preferences
+
+	if timeZone := updateMeRequest.Preferences.TimeZone; timeZone != nil {
+		if _, err := time.LoadLocation(*timeZone); err != nil || *timeZone == "Local" {
+			log.Errorf("error as time zone %v is unknown", *timeZone)
+			http.Error(w, "unknown time zone", http.StatusBadRequest)
+			return
+		}
+		preferences.TimeZone = *timeZone
+	}
+
+	if defaultSort := updateMeRequest.Preferences.DefaultSort; defaultSort != nil {
+		if *defaultSort != "" && !store.IsValidTaskSort(*defaultSort) {
+			log.Errorf("error as sort %v is unknown", *defaultSort)
+			http.Error(w, "unknown sort", http.StatusBadRequest)
+			return
+		}
+		preferences.DefaultSort = *defaultSort
+	}
+
+	updatedProfile, err := u.userStore.UpdatePreferences(ctx, profile.UserID, preferences)
+	if err != nil {
+		log.Errorf("error updating preferences of user %v: %v", profile.UserID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(updatedProfile)
+	if err != nil {
+		log.Errorf("error encoding the profile response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, statusCode int, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(errorResponse{Error: errorCode})
+}
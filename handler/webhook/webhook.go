@@ -0,0 +1,131 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+	"github.com/AjithPanneerselvam/task-etcd/integration/githubsync"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// github caps payloads at 25MB, the events handled are far smaller
+	maxPayloadBytes = 5 << 20
+)
+
+type WebhookHandler struct {
+	githubSecret  string
+	deliveryStore store.WebhookDeliveryStore
+	deliveryTTL   time.Duration
+	githubSyncer  *githubsync.Syncer
+}
+
+type webhookResponse struct {
+	Event     string `json:"event"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Completed int    `json:"completed"`
+}
+
+// NewWebhookHandler returns a handler for the github webhook signed with the
+// secret. Deliveries are remembered for the ttl to drop redeliveries.
+func NewWebhookHandler(githubSecret string, deliveryStore store.WebhookDeliveryStore, deliveryTTL time.Duration,
+	githubSyncer *githubsync.Syncer) *WebhookHandler {
+
+	return &WebhookHandler{
+		githubSecret:  githubSecret,
+		deliveryStore: deliveryStore,
+		deliveryTTL:   deliveryTTL,
+		githubSyncer:  githubSyncer,
+	}
+}
+
+// GithubWebhook handles the issues, pull_request and issue_comment events of
+// github, completing the tasks linked to issues and pull requests as they
+// are closed. Other events are acknowledged and ignored.
+func (h *WebhookHandler) GithubWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadBytes))
+	if err != nil {
+		log.Errorf("error reading github webhook payload: %v", err)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if !github.ValidWebhookSignature(h.githubSecret, body, r.Header.Get(github.WebhookSignatureHeader)) {
+		log.Error("error as github webhook signature is invalid")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	eventName := r.Header.Get(github.WebhookEventHeader)
+	deliveryID := r.Header.Get(github.WebhookDeliveryHeader)
+	if eventName == "" || deliveryID == "" {
+		log.Error("error as github webhook event or delivery header is missing")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	response := webhookResponse{Event: eventName}
+
+	switch eventName {
+	case github.WebhookEventIssues, github.WebhookEventPullRequest, github.WebhookEventIssueComment:
+	default:
+		log.Debugf("github webhook event %v of delivery %v ignored", eventName, deliveryID)
+		writeResponse(w, response)
+		return
+	}
+
+	var event github.WebhookEvent
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		log.Errorf("error unmarshalling github webhook payload of delivery %v: %v", deliveryID, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	recorded, err := h.deliveryStore.RecordDelivery(ctx, githubsync.Provider, deliveryID, h.deliveryTTL)
+	if err != nil {
+		log.Errorf("error recording github webhook delivery %v: %v", deliveryID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !recorded {
+		log.Infof("github webhook delivery %v already handled", deliveryID)
+		response.Duplicate = true
+		writeResponse(w, response)
+		return
+	}
+
+	response.Completed, err = h.githubSyncer.HandleWebhookEvent(ctx, eventName, event)
+	if err != nil {
+		log.Errorf("error handling github webhook delivery %v: %v", deliveryID, err)
+
+		// forgotten, so that github's redelivery is handled
+		err = h.deliveryStore.DeleteDelivery(ctx, githubsync.Provider, deliveryID)
+		if err != nil {
+			log.Errorf("error deleting github webhook delivery %v: %v", deliveryID, err)
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(w, response)
+}
+
+func writeResponse(w http.ResponseWriter, response webhookResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Errorf("error encoding the webhook response: %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+package identity
+
+// ErrIdentity implements Error interface
+type ErrIdentity string
+
+const (
+	ErrIdentityBadCode      ErrIdentity = "error bad or expired authorization code"
+	ErrIdentityUnauthorized ErrIdentity = "error unauthorized by the identity provider"
+	ErrIdentityRateLimited  ErrIdentity = "error rate limited by the identity provider"
+	ErrIdentityUpstream     ErrIdentity = "error identity provider failure"
+	ErrIdentityAccessDenied ErrIdentity = "error access denied to the user"
+)
+
+func (e ErrIdentity) Error() string {
+	return string(e)
+}
@@ -0,0 +1,101 @@
+package identity
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ProviderGithub = "github"
+)
+
+type githubProvider struct {
+	githubClient *github.Client
+	access       GithubAccess
+}
+
+// NewGithubProvider returns the github provider. Users not admitted by the
+// access allow lists are denied on login.
+func NewGithubProvider(githubClient *github.Client, access GithubAccess) Provider {
+	return &githubProvider{
+		githubClient: githubClient,
+		access:       access,
+	}
+}
+
+func (g *githubProvider) Name() string {
+	return ProviderGithub
+}
+
+func (g *githubProvider) AuthorizeURL(ctx context.Context, authRequest AuthRequest) (string, error) {
+	return g.githubClient.GetRedirectAuthorizeURL(ctx, authRequest.CallbackURL, authRequest.State,
+		authRequest.CodeChallenge, authRequest.Scopes)
+}
+
+func (g *githubProvider) Exchange(ctx context.Context, authResponse AuthResponse) (*Token, error) {
+	accessToken, err := g.githubClient.GetAccessToken(ctx, authResponse.Code, authResponse.CodeVerifier)
+	if err != nil {
+		return nil, githubError(err)
+	}
+
+	return &Token{AccessToken: accessToken}, nil
+}
+
+func (g *githubProvider) FetchProfile(ctx context.Context, token *Token) (*Profile, error) {
+	userInfo, err := g.githubClient.GetUserInfo(ctx, token.AccessToken)
+	if err != nil {
+		return nil, githubError(err)
+	}
+
+	if rateLimit, ok := g.githubClient.RateLimit(token.AccessToken); ok && rateLimit.Remaining < rateLimit.Limit/10 {
+		log.Warnf("github rate limit is running low: %v of %v left until %v",
+			rateLimit.Remaining, rateLimit.Limit, rateLimit.Reset)
+	}
+
+	admitted, err := g.access.Admits(ctx, g.githubClient, token.AccessToken, userInfo.Login)
+	if err != nil {
+		return nil, githubError(err)
+	}
+
+	if !admitted {
+		return nil, errors.Wrapf(ErrIdentityAccessDenied,
+			"github user %v is not in an allowed org or team", userInfo.Login)
+	}
+
+	return &Profile{
+		Provider:  ProviderGithub,
+		Subject:   strconv.Itoa(userInfo.ID),
+		Login:     userInfo.Login,
+		Name:      userInfo.Name,
+		Email:     userInfo.Email,
+		AvatarURL: userInfo.AvatarURL,
+	}, nil
+}
+
+func (g *githubProvider) RetryAfter(token *Token) time.Duration {
+	if token == nil {
+		return 0
+	}
+
+	return g.githubClient.RetryAfter(token.AccessToken)
+}
+
+func githubError(err error) error {
+	switch errors.Cause(err) {
+	case github.ErrGithubBadVerificationCode:
+		return errors.Wrap(ErrIdentityBadCode, err.Error())
+	case github.ErrGithubUnauthorized:
+		return errors.Wrap(ErrIdentityUnauthorized, err.Error())
+	case github.ErrGithubRateLimited:
+		return errors.Wrap(ErrIdentityRateLimited, err.Error())
+	case github.ErrGithubUpstream:
+		return errors.Wrap(ErrIdentityUpstream, err.Error())
+	}
+
+	return err
+}
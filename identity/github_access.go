@@ -0,0 +1,127 @@
+package identity
+
+import (
+	"context"
+	"strings"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+	"github.com/pkg/errors"
+)
+
+const (
+	githubScopeReadOrg = "read:org"
+
+	teamMembershipActive = "active"
+)
+
+// GithubAccess restricts github logins to the members of orgs or teams, and
+// to individual logins. Teams are given as org/team-slug. A GithubAccess
+// with no lists admits every github user.
+type GithubAccess struct {
+	Orgs   []string
+	Teams  []string
+	Logins []string
+}
+
+// Restricted reports whether any allow list is set
+func (a GithubAccess) Restricted() bool {
+	return len(a.Orgs) > 0 || len(a.Teams) > 0 || len(a.Logins) > 0
+}
+
+// Scopes returns the github scopes the checks need. Private org and team
+// memberships are only visible with read:org.
+func (a GithubAccess) Scopes() []string {
+	if len(a.Orgs) > 0 || len(a.Teams) > 0 {
+		return []string{githubScopeReadOrg}
+	}
+
+	return nil
+}
+
+// Admits checks the user the access token belongs to against the allow
+// lists on login, listing the orgs of the user with their own token
+func (a GithubAccess) Admits(ctx context.Context, githubClient *github.Client, accessToken string,
+	login string) (bool, error) {
+
+	if !a.Restricted() || a.allowsLogin(login) {
+		return true, nil
+	}
+
+	if len(a.Orgs) > 0 {
+		orgs, err := githubClient.GetUserOrgs(ctx, accessToken)
+		if err != nil {
+			return false, errors.Wrap(err, "error fetching github orgs")
+		}
+
+		for _, org := range orgs {
+			if containsFold(a.Orgs, org.Login) {
+				return true, nil
+			}
+		}
+	}
+
+	return a.inAllowedTeam(ctx, githubClient, accessToken, login)
+}
+
+// Revalidate checks a user who logged in earlier against the allow lists,
+// with a token of a member of the allowed orgs rather than the user's own
+func (a GithubAccess) Revalidate(ctx context.Context, githubClient *github.Client, serviceToken string,
+	login string) (bool, error) {
+
+	if !a.Restricted() || a.allowsLogin(login) {
+		return true, nil
+	}
+
+	for _, org := range a.Orgs {
+		isMember, err := githubClient.IsOrgMember(ctx, serviceToken, org, login)
+		if err != nil {
+			return false, errors.Wrapf(err, "error checking membership of github org %v", org)
+		}
+
+		if isMember {
+			return true, nil
+		}
+	}
+
+	return a.inAllowedTeam(ctx, githubClient, serviceToken, login)
+}
+
+func (a GithubAccess) allowsLogin(login string) bool {
+	return containsFold(a.Logins, login)
+}
+
+func (a GithubAccess) inAllowedTeam(ctx context.Context, githubClient *github.Client, accessToken string,
+	login string) (bool, error) {
+
+	for _, team := range a.Teams {
+		parts := strings.SplitN(team, "/", 2)
+		if len(parts) != 2 {
+			return false, errors.Errorf("error as team %v is not of the form org/team-slug", team)
+		}
+
+		teamMembership, err := githubClient.GetTeamMembership(ctx, accessToken, parts[0], parts[1], login)
+		if errors.Cause(err) == github.ErrGithubNotFound {
+			continue
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, "error checking membership of github team %v", team)
+		}
+
+		// invitations not yet accepted do not count
+		if teamMembership.State == teamMembershipActive {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,79 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/oauth2"
+)
+
+const (
+	ProviderGitlab = "gitlab"
+)
+
+type gitlabUserInfo struct {
+	ID        int    `json:"id"`
+	Username  string `json:"username"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type gitlabProvider struct {
+	oAuth2Client *oauth2.Client
+	apiURL       string
+}
+
+// NewGitlabProvider returns a provider for gitlab.com or a self-managed
+// gitlab at the given base url
+func NewGitlabProvider(gitlabURL string, clientID string, clientSecret string, timeoutInSec int32) Provider {
+	gitlabURL = strings.TrimSuffix(gitlabURL, "/")
+
+	endpoint := oauth2.Endpoint{
+		AuthorizeURL: fmt.Sprintf("%s/oauth/authorize", gitlabURL),
+		TokenURL:     fmt.Sprintf("%s/oauth/token", gitlabURL),
+	}
+
+	return &gitlabProvider{
+		oAuth2Client: oauth2.New(endpoint, clientID, clientSecret, []string{"read_user"}, timeoutInSec),
+		apiURL:       fmt.Sprintf("%s/api/v4", gitlabURL),
+	}
+}
+
+func (g *gitlabProvider) Name() string {
+	return ProviderGitlab
+}
+
+func (g *gitlabProvider) AuthorizeURL(ctx context.Context, authRequest AuthRequest) (string, error) {
+	return g.oAuth2Client.GetRedirectAuthorizeURL(authRequest.CallbackURL, authRequest.State,
+		authRequest.CodeChallenge, nil)
+}
+
+func (g *gitlabProvider) Exchange(ctx context.Context, authResponse AuthResponse) (*Token, error) {
+	tokenResponse, err := g.oAuth2Client.Exchange(ctx, authResponse.Code, authResponse.CallbackURL,
+		authResponse.CodeVerifier)
+	if err != nil {
+		return nil, oAuth2Error(err)
+	}
+
+	return &Token{AccessToken: tokenResponse.AccessToken}, nil
+}
+
+func (g *gitlabProvider) FetchProfile(ctx context.Context, token *Token) (*Profile, error) {
+	var userInfo gitlabUserInfo
+	err := g.oAuth2Client.GetJSON(ctx, fmt.Sprintf("%s/user", g.apiURL), token.AccessToken, &userInfo)
+	if err != nil {
+		return nil, oAuth2Error(err)
+	}
+
+	return &Profile{
+		Provider:  ProviderGitlab,
+		Subject:   strconv.Itoa(userInfo.ID),
+		Login:     userInfo.Username,
+		Name:      userInfo.Name,
+		Email:     userInfo.Email,
+		AvatarURL: userInfo.AvatarURL,
+	}, nil
+}
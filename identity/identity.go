@@ -0,0 +1,126 @@
+// Package identity abstracts the identity providers users log in with
+package identity
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ProviderLocal namespaces the ids of local username and password accounts
+	ProviderLocal = "local"
+)
+
+// reservedProviderNames are the names of the builtin providers and of local
+// accounts, which configured providers cannot take
+var reservedProviderNames = []string{ProviderLocal, ProviderGithub, ProviderGitlab}
+
+// AuthRequest holds the per login values the authorize url is bound to
+type AuthRequest struct {
+	CallbackURL   string
+	State         string
+	CodeChallenge string
+	Nonce         string
+	// Scopes are asked for on top of the ones of every login, by the
+	// providers that support it
+	Scopes []string
+}
+
+// AuthResponse holds the authorization code returned to the callback and
+// the per login values it is verified with
+type AuthResponse struct {
+	Code         string
+	CallbackURL  string
+	CodeVerifier string
+	Nonce        string
+}
+
+// Token is what a provider hands out in exchange for an authorization code
+type Token struct {
+	AccessToken string
+	IDToken     string
+	// Claims are the verified claims of the ID token, if the provider issues one
+	Claims map[string]interface{}
+}
+
+// Profile is the identity of a user as reported by a provider
+type Profile struct {
+	Provider  string `json:"provider"`
+	Subject   string `json:"subject"`
+	Login     string `json:"login,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Email     string `json:"email,omitempty"`
+	AvatarURL string `json:"avatarUrl,omitempty"`
+}
+
+// Provider is an oauth2 identity provider users can log in with
+type Provider interface {
+	// Name is the provider name used in routes and user ids
+	Name() string
+	// AuthorizeURL returns the url the browser is redirected to for login
+	AuthorizeURL(ctx context.Context, authRequest AuthRequest) (string, error)
+	// Exchange exchanges the authorization code for a token
+	Exchange(ctx context.Context, authResponse AuthResponse) (*Token, error)
+	// FetchProfile fetches the profile of the user the token belongs to
+	FetchProfile(ctx context.Context, token *Token) (*Profile, error)
+}
+
+// RateLimitedProvider is implemented by providers that know how long to back
+// off once they are rate limited. Providers rate limit each token on its
+// own; the token is nil when the code exchange itself was rate limited.
+type RateLimitedProvider interface {
+	RetryAfter(token *Token) time.Duration
+}
+
+// UserID returns the id of the user in the service. Ids are namespaced by
+// provider, so that ids of different providers never collide; the subject is
+// escaped so that it never contains the ':' separator of the store keys.
+func UserID(provider string, subject string) string {
+	return provider + ":" + url.QueryEscape(subject)
+}
+
+// UserID returns the id of the user of the profile in the service
+func (p *Profile) UserID() string {
+	return UserID(p.Provider, p.Subject)
+}
+
+// ValidateProviderName checks the name of a configured provider. The name
+// namespaces the user ids and is part of the login routes, so it cannot be
+// the name of a builtin provider or of local accounts, nor hold a ':' or a
+// '/'.
+func ValidateProviderName(name string) error {
+	if name == "" || strings.ContainsAny(name, ":/") {
+		return errors.Errorf("error as provider name %q is invalid", name)
+	}
+
+	for _, reservedName := range reservedProviderNames {
+		if name == reservedName {
+			return errors.Errorf("error as provider name %q is reserved", name)
+		}
+	}
+
+	return nil
+}
+
+// ValidateProviders checks that the providers can be told apart by name, as a
+// provider sharing the name of another would take over its logins and users
+func ValidateProviders(providers []Provider) error {
+	names := make(map[string]bool, len(providers))
+	for _, provider := range providers {
+		name := provider.Name()
+		if name == ProviderLocal || strings.ContainsAny(name, ":/") {
+			return errors.Errorf("error as provider name %q is invalid", name)
+		}
+
+		if names[name] {
+			return errors.Errorf("error as provider name %q is taken by two providers", name)
+		}
+		names[name] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package identity_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AjithPanneerselvam/task-etcd/identity"
+)
+
+// namedProvider is a provider known by its name alone
+type namedProvider string
+
+func (n namedProvider) Name() string {
+	return string(n)
+}
+
+func (n namedProvider) AuthorizeURL(ctx context.Context, authRequest identity.AuthRequest) (string, error) {
+	return "", nil
+}
+
+func (n namedProvider) Exchange(ctx context.Context, authResponse identity.AuthResponse) (*identity.Token, error) {
+	return nil, nil
+}
+
+func (n namedProvider) FetchProfile(ctx context.Context, token *identity.Token) (*identity.Profile, error) {
+	return nil, nil
+}
+
+func TestValidateProviderName(t *testing.T) {
+	testCases := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "oidc"},
+		{name: "okta"},
+		{name: "", wantErr: true},
+		{name: identity.ProviderGithub, wantErr: true},
+		{name: identity.ProviderGitlab, wantErr: true},
+		{name: identity.ProviderLocal, wantErr: true},
+		{name: "corp:sso", wantErr: true},
+		{name: "corp/sso", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := identity.ValidateProviderName(tc.name)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("ValidateProviderName(%q) error = %v, want error %v", tc.name, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateProviders(t *testing.T) {
+	testCases := []struct {
+		name      string
+		providers []identity.Provider
+		wantErr   bool
+	}{
+		{
+			name:      "distinct names",
+			providers: []identity.Provider{namedProvider("github"), namedProvider("gitlab"), namedProvider("oidc")},
+		},
+		{
+			name:      "shared name",
+			providers: []identity.Provider{namedProvider("github"), namedProvider("github")},
+			wantErr:   true,
+		},
+		{
+			name:      "local accounts name",
+			providers: []identity.Provider{namedProvider("local")},
+			wantErr:   true,
+		},
+		{
+			name:      "user id separator",
+			providers: []identity.Provider{namedProvider("corp:sso")},
+			wantErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := identity.ValidateProviders(tc.providers)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("ValidateProviders() error = %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
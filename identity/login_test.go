@@ -0,0 +1,174 @@
+package identity_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+	"github.com/AjithPanneerselvam/task-etcd/client/github/githubtest"
+	"github.com/AjithPanneerselvam/task-etcd/identity"
+	"github.com/AjithPanneerselvam/task-etcd/identity/oidctest"
+)
+
+const (
+	concurrentLogins = 20
+
+	testCallbackURL  = "http://localhost/login/callback"
+	testClientID     = "client-id"
+	testClientSecret = "client-secret"
+)
+
+// login goes through the authorization code flow of the provider as the
+// user picked with the hint query param, the way the login callback does
+func login(ctx context.Context, provider identity.Provider, hintParam string, hint string) (*identity.Profile, error) {
+	state, err := auth.NewRandomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	codeVerifier, err := auth.NewRandomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := auth.NewRandomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	authorizeURL, err := provider.AuthorizeURL(ctx, identity.AuthRequest{
+		CallbackURL:   testCallbackURL,
+		State:         state,
+		CodeChallenge: auth.PKCEChallenge(codeVerifier),
+		Nonce:         nonce,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error building authorize url: %v", err)
+	}
+
+	authorizeParsedURL, err := url.Parse(authorizeURL)
+	if err != nil {
+		return nil, err
+	}
+	query := authorizeParsedURL.Query()
+	query.Set(hintParam, hint)
+	authorizeParsedURL.RawQuery = query.Encode()
+
+	noRedirectClient := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := noRedirectClient.Get(authorizeParsedURL.String())
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	callbackURL, err := resp.Location()
+	if err != nil {
+		return nil, fmt.Errorf("error as authorize did not redirect back: %v", err)
+	}
+
+	if callbackURL.Query().Get("state") != state {
+		return nil, fmt.Errorf("error as state %q is not %q", callbackURL.Query().Get("state"), state)
+	}
+
+	token, err := provider.Exchange(ctx, identity.AuthResponse{
+		Code:         callbackURL.Query().Get("code"),
+		CallbackURL:  testCallbackURL,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error exchanging code: %v", err)
+	}
+
+	return provider.FetchProfile(ctx, token)
+}
+
+// runConcurrentLogins logs every user in at once and checks that each login
+// gets the profile of its own user
+func runConcurrentLogins(t *testing.T, provider identity.Provider, hintParam string, hints []string,
+	wantSubjects []string) {
+
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(hints))
+	profiles := make([]*identity.Profile, len(hints))
+
+	for i := range hints {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			profiles[i], errs[i] = login(ctx, provider, hintParam, hints[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range hints {
+		if errs[i] != nil {
+			t.Errorf("login of %v failed: %v", hints[i], errs[i])
+			continue
+		}
+
+		if profiles[i].Subject != wantSubjects[i] {
+			t.Errorf("login of %v got the profile of subject %v, want %v", hints[i], profiles[i].Subject,
+				wantSubjects[i])
+		}
+	}
+}
+
+func TestGithubConcurrentLogins(t *testing.T) {
+	var users []githubtest.User
+	var logins []string
+	var subjects []string
+	for i := 1; i <= concurrentLogins; i++ {
+		login := fmt.Sprintf("user-%d", i)
+		users = append(users, githubtest.User{
+			UserInfo: github.UserInfo{ID: i, Login: login},
+			Orgs:     []string{"acme"},
+		})
+		logins = append(logins, login)
+		subjects = append(subjects, strconv.Itoa(i))
+	}
+
+	server := githubtest.NewServer(users...)
+	defer server.Close()
+
+	githubClient := github.New(server.OAuthURL(), server.APIURL(), testClientID, testClientSecret, nil, 5, 0)
+
+	// the org check makes a second api call with the token of each user
+	provider := identity.NewGithubProvider(githubClient, identity.GithubAccess{Orgs: []string{"acme"}})
+
+	runConcurrentLogins(t, provider, "login", logins, subjects)
+}
+
+func TestOIDCConcurrentLogins(t *testing.T) {
+	var users []oidctest.User
+	var subjects []string
+	for i := 1; i <= concurrentLogins; i++ {
+		subject := fmt.Sprintf("subject-%d", i)
+		users = append(users, oidctest.User{
+			Subject: subject,
+			Claims:  map[string]interface{}{"preferred_username": fmt.Sprintf("user-%d", i)},
+		})
+		subjects = append(subjects, subject)
+	}
+
+	issuer := oidctest.NewIssuer(testClientID, testClientSecret, users...)
+	defer issuer.Close()
+
+	provider := identity.NewOIDCProvider("oidc", issuer.IssuerURL(), testClientID, testClientSecret,
+		[]string{"openid", "profile"}, identity.DefaultOIDCClaims, 5)
+
+	runConcurrentLogins(t, provider, "login_hint", subjects, subjects)
+}
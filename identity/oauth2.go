@@ -0,0 +1,21 @@
+package identity
+
+import (
+	"github.com/AjithPanneerselvam/task-etcd/client/oauth2"
+	"github.com/pkg/errors"
+)
+
+func oAuth2Error(err error) error {
+	switch errors.Cause(err) {
+	case oauth2.ErrOAuth2InvalidGrant:
+		return errors.Wrap(ErrIdentityBadCode, err.Error())
+	case oauth2.ErrOAuth2Unauthorized:
+		return errors.Wrap(ErrIdentityUnauthorized, err.Error())
+	case oauth2.ErrOAuth2RateLimited:
+		return errors.Wrap(ErrIdentityRateLimited, err.Error())
+	case oauth2.ErrOAuth2Upstream:
+		return errors.Wrap(ErrIdentityUpstream, err.Error())
+	}
+
+	return err
+}
@@ -0,0 +1,310 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/oauth2"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/pkg/errors"
+)
+
+const (
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+
+	oidcClaimSubject = "sub"
+	oidcClaimNonce   = "nonce"
+	oidcClaimAZP     = "azp"
+
+	jwksMinRefreshInterval = time.Minute
+)
+
+// OIDCClaims names the claims the profile of an OIDC user is read from
+type OIDCClaims struct {
+	UserID    string
+	Login     string
+	Name      string
+	Email     string
+	AvatarURL string
+}
+
+// DefaultOIDCClaims are the standard OpenID Connect claims
+var DefaultOIDCClaims = OIDCClaims{
+	UserID:    "sub",
+	Login:     "preferred_username",
+	Name:      "name",
+	Email:     "email",
+	AvatarURL: "picture",
+}
+
+// oidcDiscovery is the part of the issuer's discovery document in use
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcProvider struct {
+	name         string
+	issuerURL    string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	claims       OIDCClaims
+	timeoutInSec int32
+	httpClient   *http.Client
+
+	// the discovery document is fetched on first use, so that an issuer
+	// being down does not stop the service from starting
+	mu           sync.Mutex
+	discovery    *oidcDiscovery
+	oAuth2Client *oauth2.Client
+
+	// the key set of the issuer is cached and refreshed in the background,
+	// and on demand when a token is signed with a key not in the cache
+	keySets          *jwk.AutoRefresh
+	keySetsRefreshMu sync.Mutex
+	keySetsRefreshed time.Time
+}
+
+// NewOIDCProvider returns a generic OpenID Connect provider configured from
+// the discovery document of the issuer. ID tokens are verified against the
+// key set of the issuer and the profile is read from the given claims.
+func NewOIDCProvider(name string, issuerURL string, clientID string, clientSecret string,
+	scopes []string, claims OIDCClaims, timeoutInSec int32) Provider {
+
+	httpClient := &http.Client{
+		Timeout: time.Duration(timeoutInSec) * time.Second,
+	}
+
+	return &oidcProvider{
+		name:         name,
+		issuerURL:    strings.TrimSuffix(issuerURL, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+		claims:       claims,
+		timeoutInSec: timeoutInSec,
+		httpClient:   httpClient,
+		keySets:      jwk.NewAutoRefresh(context.Background()),
+	}
+}
+
+func (o *oidcProvider) Name() string {
+	return o.name
+}
+
+func (o *oidcProvider) AuthorizeURL(ctx context.Context, authRequest AuthRequest) (string, error) {
+	oAuth2Client, _, err := o.client(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	extraParams := url.Values{}
+	if authRequest.Nonce != "" {
+		extraParams.Set("nonce", authRequest.Nonce)
+	}
+
+	return oAuth2Client.GetRedirectAuthorizeURL(authRequest.CallbackURL, authRequest.State,
+		authRequest.CodeChallenge, extraParams)
+}
+
+// Exchange exchanges the code and verifies the ID token issued with it:
+// signature, issuer, audience, expiry and the nonce of the login
+func (o *oidcProvider) Exchange(ctx context.Context, authResponse AuthResponse) (*Token, error) {
+	oAuth2Client, discovery, err := o.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenResponse, err := oAuth2Client.Exchange(ctx, authResponse.Code, authResponse.CallbackURL,
+		authResponse.CodeVerifier)
+	if err != nil {
+		return nil, oAuth2Error(err)
+	}
+
+	if tokenResponse.IDToken == "" {
+		return nil, errors.Wrap(ErrIdentityUpstream, "id token is missing in the token response")
+	}
+
+	claims, err := o.verifyIDToken(ctx, discovery, tokenResponse.IDToken, authResponse.Nonce)
+	if err != nil {
+		return nil, errors.Wrap(ErrIdentityUnauthorized, err.Error())
+	}
+
+	return &Token{
+		AccessToken: tokenResponse.AccessToken,
+		IDToken:     tokenResponse.IDToken,
+		Claims:      claims,
+	}, nil
+}
+
+// FetchProfile reads the profile from the claims of the ID token. Claims
+// the issuer leaves out of ID tokens are read from the userinfo endpoint.
+func (o *oidcProvider) FetchProfile(ctx context.Context, token *Token) (*Profile, error) {
+	claims := token.Claims
+	if claims == nil {
+		return nil, errors.Wrap(ErrIdentityUpstream, "id token claims are missing")
+	}
+
+	if o.missingClaims(claims) {
+		userInfoClaims, err := o.fetchUserInfo(ctx, token.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+
+		if claimString(userInfoClaims, oidcClaimSubject) != claimString(claims, oidcClaimSubject) {
+			return nil, errors.Wrap(ErrIdentityUnauthorized, "userinfo subject does not match the id token")
+		}
+
+		for key, value := range userInfoClaims {
+			if _, ok := claims[key]; !ok {
+				claims[key] = value
+			}
+		}
+	}
+
+	subject := claimString(claims, o.claims.UserID)
+	if subject == "" {
+		return nil, errors.Wrapf(ErrIdentityUpstream, "claim %v is missing", o.claims.UserID)
+	}
+
+	return &Profile{
+		Provider:  o.name,
+		Subject:   subject,
+		Login:     claimString(claims, o.claims.Login),
+		Name:      claimString(claims, o.claims.Name),
+		Email:     claimString(claims, o.claims.Email),
+		AvatarURL: claimString(claims, o.claims.AvatarURL),
+	}, nil
+}
+
+func (o *oidcProvider) missingClaims(claims map[string]interface{}) bool {
+	for _, claim := range []string{o.claims.UserID, o.claims.Login, o.claims.Name, o.claims.Email} {
+		if claim == "" {
+			continue
+		}
+
+		if _, ok := claims[claim]; !ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (o *oidcProvider) fetchUserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	oAuth2Client, discovery, err := o.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userInfoClaims := make(map[string]interface{})
+	if discovery.UserinfoEndpoint == "" {
+		return userInfoClaims, nil
+	}
+
+	err = oAuth2Client.GetJSON(ctx, discovery.UserinfoEndpoint, accessToken, &userInfoClaims)
+	if err != nil {
+		return nil, oAuth2Error(err)
+	}
+
+	return userInfoClaims, nil
+}
+
+// client returns the oauth2 client configured from the discovery document,
+// fetching the document if it has not been fetched yet
+func (o *oidcProvider) client(ctx context.Context) (*oauth2.Client, *oidcDiscovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.discovery != nil {
+		return o.oAuth2Client, o.discovery, nil
+	}
+
+	discovery, err := o.fetchDiscovery(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(ErrIdentityUpstream, err.Error())
+	}
+
+	endpoint := oauth2.Endpoint{
+		AuthorizeURL: discovery.AuthorizationEndpoint,
+		TokenURL:     discovery.TokenEndpoint,
+	}
+
+	o.keySets.Configure(discovery.JWKSURI, jwk.WithHTTPClient(o.httpClient),
+		jwk.WithMinRefreshInterval(jwksMinRefreshInterval))
+
+	o.discovery = discovery
+	o.oAuth2Client = oauth2.New(endpoint, o.clientID, o.clientSecret, o.scopes, o.timeoutInSec)
+
+	return o.oAuth2Client, o.discovery, nil
+}
+
+func (o *oidcProvider) fetchDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	discoveryURL := o.issuerURL + oidcDiscoveryPath
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating discovery request")
+	}
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching discovery document")
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading discovery document")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching discovery document: status %d", resp.StatusCode)
+	}
+
+	var discovery oidcDiscovery
+	err = json.Unmarshal(respBody, &discovery)
+	if err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling discovery document")
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != o.issuerURL {
+		return nil, fmt.Errorf("error as discovery issuer %v does not match %v", discovery.Issuer, o.issuerURL)
+	}
+
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("error as discovery document has no authorization, token or jwks endpoint")
+	}
+
+	return &discovery, nil
+}
+
+// claimString returns the claim as a string, numeric claims included
+func claimString(claims map[string]interface{}, claim string) string {
+	if claim == "" {
+		return ""
+	}
+
+	switch value := claims[claim].(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case json.Number:
+		return value.String()
+	}
+
+	return ""
+}
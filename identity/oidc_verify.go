@@ -0,0 +1,93 @@
+package identity
+
+import (
+	"context"
+	"crypto/subtle"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/pkg/errors"
+)
+
+const (
+	idTokenAcceptableSkew = time.Minute
+)
+
+// verifyIDToken verifies the ID token against the key set of the issuer
+// and returns its claims
+func (o *oidcProvider) verifyIDToken(ctx context.Context, discovery *oidcDiscovery, rawIDToken string,
+	nonce string) (map[string]interface{}, error) {
+
+	keySet, err := o.keySets.Fetch(ctx, discovery.JWKSURI)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching issuer key set")
+	}
+
+	idToken, err := parseIDToken(rawIDToken, keySet)
+	if err != nil {
+		// the issuer may have rotated its keys since the key set was cached
+		refreshedKeySet, refreshed := o.refreshKeySet(ctx, discovery.JWKSURI)
+		if !refreshed {
+			return nil, errors.Wrap(err, "error verifying id token signature")
+		}
+
+		idToken, err = parseIDToken(rawIDToken, refreshedKeySet)
+		if err != nil {
+			return nil, errors.Wrap(err, "error verifying id token signature")
+		}
+	}
+
+	err = jwt.Validate(idToken,
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(o.clientID),
+		jwt.WithAcceptableSkew(idTokenAcceptableSkew),
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+		jwt.WithRequiredClaim(jwt.IssuedAtKey),
+		jwt.WithRequiredClaim(jwt.SubjectKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating id token")
+	}
+
+	claims, err := idToken.AsMap(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading id token claims")
+	}
+
+	if nonce != "" && subtle.ConstantTimeCompare([]byte(claimString(claims, oidcClaimNonce)), []byte(nonce)) != 1 {
+		return nil, errors.New("error as id token nonce does not match the login")
+	}
+
+	// a token issued to several audiences must name us as its authorized party
+	if len(idToken.Audience()) > 1 && claimString(claims, oidcClaimAZP) != o.clientID {
+		return nil, errors.New("error as id token is not authorized for the client")
+	}
+
+	return claims, nil
+}
+
+func parseIDToken(rawIDToken string, keySet jwk.Set) (jwt.Token, error) {
+	return jwt.Parse([]byte(rawIDToken),
+		jwt.WithKeySet(keySet),
+		jwt.UseDefaultKey(true),
+		jwt.InferAlgorithmFromKey(true))
+}
+
+// refreshKeySet refetches the key set of the issuer, at most once per
+// minimum refresh interval so that bad tokens cannot hammer the issuer
+func (o *oidcProvider) refreshKeySet(ctx context.Context, jwksURI string) (jwk.Set, bool) {
+	o.keySetsRefreshMu.Lock()
+	defer o.keySetsRefreshMu.Unlock()
+
+	if time.Since(o.keySetsRefreshed) < jwksMinRefreshInterval {
+		return nil, false
+	}
+	o.keySetsRefreshed = time.Now()
+
+	keySet, err := o.keySets.Refresh(ctx, jwksURI)
+	if err != nil {
+		return nil, false
+	}
+
+	return keySet, true
+}
@@ -0,0 +1,357 @@
+// Package oidctest provides a mock OpenID Connect issuer for hermetic tests
+// of OIDC logins: discovery, JWKS, authorization code flow with PKCE and
+// nonce, signed ID tokens and userinfo.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+const (
+	rsaKeySizeInBits = 2048
+	idTokenExpiry    = 5 * time.Minute
+)
+
+// User is an account of the issuer. Claims are added to the ID token and
+// the userinfo response of the user.
+type User struct {
+	Subject string
+	Claims  map[string]interface{}
+}
+
+type authorization struct {
+	subject       string
+	clientID      string
+	nonce         string
+	codeChallenge string
+}
+
+// Issuer is a mock OpenID Connect issuer
+type Issuer struct {
+	*httptest.Server
+
+	mu sync.Mutex
+
+	clientID     string
+	clientSecret string
+
+	users          map[string]User
+	defaultSubject string
+
+	signingKey jwk.Key
+	publicKeys jwk.Set
+
+	codes  map[string]authorization
+	tokens map[string]string
+
+	// claims overriding those of every ID token issued, to craft bad tokens
+	idTokenOverrides map[string]interface{}
+}
+
+// NewIssuer starts a mock issuer accepting the given client credentials.
+// The first user is the one logged in unless another one is chosen with
+// the login_hint query param.
+func NewIssuer(clientID string, clientSecret string, users ...User) *Issuer {
+	issuer := &Issuer{
+		clientID:         clientID,
+		clientSecret:     clientSecret,
+		users:            make(map[string]User),
+		codes:            make(map[string]authorization),
+		tokens:           make(map[string]string),
+		idTokenOverrides: make(map[string]interface{}),
+	}
+
+	for _, user := range users {
+		issuer.AddUser(user)
+	}
+
+	issuer.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/jwks", issuer.jwks)
+	mux.HandleFunc("/authorize", issuer.authorize)
+	mux.HandleFunc("/token", issuer.token)
+	mux.HandleFunc("/userinfo", issuer.userinfo)
+
+	issuer.Server = httptest.NewServer(mux)
+
+	return issuer
+}
+
+// IssuerURL is the value for OIDC_ISSUER_URL
+func (i *Issuer) IssuerURL() string {
+	return i.URL
+}
+
+// AddUser adds or replaces an account
+func (i *Issuer) AddUser(user User) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.users[user.Subject] = user
+	if i.defaultSubject == "" {
+		i.defaultSubject = user.Subject
+	}
+}
+
+// RotateKey replaces the signing key; tokens signed with the old key no
+// longer verify
+func (i *Issuer) RotateKey() {
+	privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeySizeInBits)
+	if err != nil {
+		panic(err)
+	}
+
+	signingKey, err := jwk.New(privateKey)
+	if err != nil {
+		panic(err)
+	}
+
+	kid := randomString()
+	signingKey.Set(jwk.KeyIDKey, kid)
+	signingKey.Set(jwk.AlgorithmKey, jwa.RS256)
+
+	publicKey, err := jwk.New(privateKey.Public())
+	if err != nil {
+		panic(err)
+	}
+	publicKey.Set(jwk.KeyIDKey, kid)
+	publicKey.Set(jwk.AlgorithmKey, jwa.RS256)
+	publicKey.Set(jwk.KeyUsageKey, jwk.ForSignature)
+
+	publicKeys := jwk.NewSet()
+	publicKeys.Add(publicKey)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.signingKey = signingKey
+	i.publicKeys = publicKeys
+}
+
+// OverrideIDTokenClaim sets a claim of every ID token issued from now on,
+// e.g. a foreign audience or a stale nonce. A nil value removes the claim.
+func (i *Issuer) OverrideIDTokenClaim(claim string, value interface{}) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.idTokenOverrides[claim] = value
+}
+
+// ClearIDTokenOverrides goes back to issuing well formed ID tokens
+func (i *Issuer) ClearIDTokenOverrides() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.idTokenOverrides = make(map[string]interface{})
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                i.URL,
+		"authorization_endpoint":                i.URL + "/authorize",
+		"token_endpoint":                        i.URL + "/token",
+		"userinfo_endpoint":                     i.URL + "/userinfo",
+		"jwks_uri":                              i.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	publicKeys := i.publicKeys
+	i.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, publicKeys)
+}
+
+// authorize logs the user in without asking and redirects back with a code
+func (i *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.String() == "" {
+		http.Error(w, "redirect_uri is missing", http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("client_id") != i.clientID {
+		http.Error(w, "client_id is unknown", http.StatusBadRequest)
+		return
+	}
+
+	i.mu.Lock()
+	subject := query.Get("login_hint")
+	if subject == "" {
+		subject = i.defaultSubject
+	}
+	_, ok := i.users[subject]
+	code := randomString()
+	if ok {
+		i.codes[code] = authorization{
+			subject:       subject,
+			clientID:      query.Get("client_id"),
+			nonce:         query.Get("nonce"),
+			codeChallenge: query.Get("code_challenge"),
+		}
+	}
+	i.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "user is unknown", http.StatusNotFound)
+		return
+	}
+
+	callbackQuery := redirectURI.Query()
+	callbackQuery.Set("code", code)
+	callbackQuery.Set("state", query.Get("state"))
+	redirectURI.RawQuery = callbackQuery.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("grant_type") != "authorization_code" {
+		writeOAuthError(w, "unsupported_grant_type")
+		return
+	}
+
+	if r.FormValue("client_id") != i.clientID || r.FormValue("client_secret") != i.clientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	i.mu.Lock()
+	authorization, ok := i.codes[r.FormValue("code")]
+	delete(i.codes, r.FormValue("code"))
+	i.mu.Unlock()
+
+	if !ok || !verifyCodeChallenge(authorization.codeChallenge, r.FormValue("code_verifier")) {
+		writeOAuthError(w, "invalid_grant")
+		return
+	}
+
+	idToken, err := i.signIDToken(authorization)
+	if err != nil {
+		http.Error(w, "error signing id token", http.StatusInternalServerError)
+		return
+	}
+
+	accessToken := randomString()
+
+	i.mu.Lock()
+	i.tokens[accessToken] = authorization.subject
+	i.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(idTokenExpiry.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+func (i *Issuer) userinfo(w http.ResponseWriter, r *http.Request) {
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	i.mu.Lock()
+	subject, ok := i.tokens[accessToken]
+	user := i.users[subject]
+	i.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+
+	claims := map[string]interface{}{"sub": user.Subject}
+	for key, value := range user.Claims {
+		claims[key] = value
+	}
+
+	writeJSON(w, http.StatusOK, claims)
+}
+
+func (i *Issuer) signIDToken(authorization authorization) (string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	user := i.users[authorization.subject]
+	now := time.Now()
+
+	idToken := jwt.New()
+	idToken.Set(jwt.IssuerKey, i.URL)
+	idToken.Set(jwt.SubjectKey, user.Subject)
+	idToken.Set(jwt.AudienceKey, authorization.clientID)
+	idToken.Set(jwt.IssuedAtKey, now.Unix())
+	idToken.Set(jwt.ExpirationKey, now.Add(idTokenExpiry).Unix())
+	if authorization.nonce != "" {
+		idToken.Set("nonce", authorization.nonce)
+	}
+
+	for key, value := range user.Claims {
+		idToken.Set(key, value)
+	}
+
+	for key, value := range i.idTokenOverrides {
+		if value == nil {
+			idToken.Remove(key)
+			continue
+		}
+		idToken.Set(key, value)
+	}
+
+	signed, err := jwt.Sign(idToken, jwa.RS256, i.signingKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(signed), nil
+}
+
+func verifyCodeChallenge(codeChallenge string, codeVerifier string) bool {
+	if codeChallenge == "" {
+		return true
+	}
+
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:]) == codeChallenge
+}
+
+func randomString() string {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeOAuthError(w http.ResponseWriter, oAuthError string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": oAuthError})
+}
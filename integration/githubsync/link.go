@@ -0,0 +1,338 @@
+package githubsync
+
+import (
+	"context"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	credentialstore "github.com/AjithPanneerselvam/task-etcd/store/credential"
+	integrationstore "github.com/AjithPanneerselvam/task-etcd/store/integration"
+	taskstore "github.com/AjithPanneerselvam/task-etcd/store/task"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Exported tasks are kept in sync with their issues both ways: the name with
+// the title, the description with the body and completion with the closed
+// state. A sync compares both sides with their revisions at the last sync,
+// the revision of the task in the store and the update time of the issue,
+// and copies the side that changed over the other. When both changed to
+// different contents the conflict policy decides.
+const (
+	// ConflictPolicyGithub keeps the issue
+	ConflictPolicyGithub = "github"
+	// ConflictPolicyTask keeps the task
+	ConflictPolicyTask = "task"
+	// ConflictPolicyManual marks the link as conflicted until the user
+	// picks a side
+	ConflictPolicyManual = "manual"
+
+	// a task is linked to its issue in a few attempts unless it keeps
+	// changing meanwhile
+	maxLinkAttempts = 3
+)
+
+// ValidConflictPolicy reports whether the conflict policy is known
+func ValidConflictPolicy(conflictPolicy string) bool {
+	switch conflictPolicy {
+	case ConflictPolicyGithub, ConflictPolicyTask, ConflictPolicyManual:
+		return true
+	}
+
+	return false
+}
+
+// linkOutcome is what a sync of a link did
+type linkOutcome int
+
+const (
+	linkUnchanged linkOutcome = iota
+	linkPushed
+	linkPulled
+	linkConflict
+	linkUnlinked
+)
+
+// LinkTask exports the task to a new issue of the repository, given as
+// owner/name, and syncs it right away. Imported tasks and tasks exported
+// already cannot be linked again.
+func (s *Syncer) LinkTask(ctx context.Context, userID string, taskID string, repository string) (*store.TaskLink,
+	error) {
+
+	accessToken, err := s.accessToken(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	task, _, err := s.taskStore.ReadTaskWithRevision(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if task.SourceURL != "" {
+		return nil, ErrGithubSyncAlreadyLinked
+	}
+
+	issue, err := s.githubClient.CreateIssue(ctx, accessToken, repository, issueRequest(*task))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating github issue")
+	}
+	log.Infof("task %v of user %v exported to %v", taskID, userID, issue.HTMLURL)
+
+	// the link starts out behind the task, so the first sync pushes it whole,
+	// the completion included
+	link := store.TaskLink{
+		UserID:         userID,
+		TaskID:         taskID,
+		Provider:       Provider,
+		Repository:     repository,
+		IssueNumber:    issue.Number,
+		IssueURL:       issue.HTMLURL,
+		IssueUpdatedAt: issue.UpdatedAt,
+	}
+
+	err = s.linkTaskSource(ctx, userID, taskID, issue.HTMLURL)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.taskLinkStore.UpsertLink(ctx, link)
+	if err != nil {
+		return nil, errors.Wrap(err, "error storing task link")
+	}
+
+	_, err = s.syncLink(ctx, accessToken, &link, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// ResolveConflict settles the conflict of the link of the task by keeping
+// the given side, ConflictPolicyGithub or ConflictPolicyTask
+func (s *Syncer) ResolveConflict(ctx context.Context, userID string, taskID string, keep string) (*store.TaskLink,
+	error) {
+
+	link, err := s.taskLinkStore.ReadLink(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !link.Conflict {
+		return nil, ErrGithubSyncNoConflict
+	}
+
+	accessToken, err := s.accessToken(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.syncLink(ctx, accessToken, link, keep)
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// syncLinks syncs every task the user exported. A failure of a link is
+// recorded on it and the others are synced still, unless github is rate
+// limiting.
+func (s *Syncer) syncLinks(ctx context.Context, userID string, accessToken string, result *Result) error {
+	links, err := s.taskLinkStore.ReadAllLinks(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for i := range links {
+		outcome, err := s.syncLink(ctx, accessToken, &links[i], "")
+		if errors.Cause(err) == github.ErrGithubRateLimited {
+			return err
+		}
+		if err != nil {
+			log.Errorf("error syncing task %v of user %v with %v: %v", links[i].TaskID, userID, links[i].IssueURL,
+				err)
+			continue
+		}
+
+		switch outcome {
+		case linkPushed:
+			result.Pushed++
+		case linkPulled:
+			result.Pulled++
+		case linkConflict:
+			result.Conflicts++
+		case linkUnlinked:
+			result.Unlinked++
+		}
+	}
+
+	return nil
+}
+
+// syncLink syncs the task of the link with its issue, keeping the given
+// side when set whatever changed. The link is updated with the outcome.
+func (s *Syncer) syncLink(ctx context.Context, accessToken string, link *store.TaskLink,
+	keep string) (linkOutcome, error) {
+
+	task, taskRevision, err := s.taskStore.ReadTaskWithRevision(ctx, link.UserID, link.TaskID)
+	if errors.Cause(err) == taskstore.ErrTaskStoreNoRecord {
+		// the issue is left as it is, it may be worked on by others
+		err = s.taskLinkStore.DeleteLink(ctx, link.UserID, link.TaskID)
+		if err != nil {
+			return linkUnchanged, err
+		}
+		log.Infof("task %v of user %v deleted, unlinked from %v", link.TaskID, link.UserID, link.IssueURL)
+		return linkUnlinked, nil
+	}
+	if err != nil {
+		return linkUnchanged, err
+	}
+
+	issue, err := s.githubClient.GetIssue(ctx, accessToken, link.Repository, link.IssueNumber)
+	if err != nil {
+		return linkUnchanged, s.recordLinkError(ctx, link, errors.Wrap(err, "error getting github issue"))
+	}
+
+	taskChanged := taskRevision != link.TaskRevision
+	issueChanged := !issue.UpdatedAt.Equal(link.IssueUpdatedAt)
+
+	side := keep
+	if side == "" {
+		switch {
+		case link.Conflict:
+			return linkConflict, nil
+		case taskChanged && issueChanged && !sameContent(*task, *issue):
+			side = s.conflictPolicy
+		case taskChanged && issueChanged:
+			// both sides changed alike, only the revisions are recorded
+		case taskChanged:
+			side = ConflictPolicyTask
+		case issueChanged:
+			side = ConflictPolicyGithub
+		default:
+			return linkUnchanged, nil
+		}
+	}
+
+	outcome := linkUnchanged
+	switch side {
+	case ConflictPolicyManual:
+		link.Conflict = true
+		log.Infof("task %v of user %v and %v both changed, left to the user", link.TaskID, link.UserID,
+			link.IssueURL)
+		return linkConflict, s.taskLinkStore.UpsertLink(ctx, *link)
+	case ConflictPolicyTask:
+		issue, err = s.githubClient.UpdateIssue(ctx, accessToken, link.Repository, link.IssueNumber,
+			issueRequest(*task))
+		if err != nil {
+			return linkUnchanged, s.recordLinkError(ctx, link, errors.Wrap(err, "error updating github issue"))
+		}
+		outcome = linkPushed
+	case ConflictPolicyGithub:
+		previous := *task
+		task.Name = issue.Title
+		task.Description = issue.Body
+		task.IsCompleted = issue.State == github.IssueStateClosed
+		task.Stamp(&previous, time.Now().UTC())
+
+		var updated bool
+		taskRevision, updated, err = s.taskStore.UpdateTaskAtRevision(ctx, link.UserID, *task, taskRevision)
+		if err != nil {
+			return linkUnchanged, err
+		}
+
+		// changed meanwhile, the next sync sees the change
+		if !updated {
+			return linkUnchanged, nil
+		}
+		outcome = linkPulled
+	}
+
+	link.TaskRevision = taskRevision
+	link.IssueUpdatedAt = issue.UpdatedAt
+	link.LastSyncedAt = time.Now().UTC()
+	link.LastSyncError = ""
+	link.Conflict = false
+
+	err = s.taskLinkStore.UpsertLink(ctx, *link)
+	if err != nil {
+		return linkUnchanged, errors.Wrap(err, "error storing task link")
+	}
+
+	return outcome, nil
+}
+
+// recordLinkError records the error on the link and returns it
+func (s *Syncer) recordLinkError(ctx context.Context, link *store.TaskLink, syncErr error) error {
+	link.LastSyncError = syncErr.Error()
+
+	err := s.taskLinkStore.UpsertLink(ctx, *link)
+	if err != nil {
+		log.Errorf("error recording sync error of task %v of user %v: %v", link.TaskID, link.UserID, err)
+	}
+
+	return syncErr
+}
+
+// linkTaskSource links the task to the issue, so that the import does not
+// import the issue as another task
+func (s *Syncer) linkTaskSource(ctx context.Context, userID string, taskID string, issueURL string) error {
+	for attempt := 0; attempt < maxLinkAttempts; attempt++ {
+		task, revision, err := s.taskStore.ReadTaskWithRevision(ctx, userID, taskID)
+		if err != nil {
+			return err
+		}
+
+		task.SourceURL = issueURL
+
+		linked, err := s.taskStore.LinkTaskSource(ctx, userID, *task, revision)
+		if err != nil {
+			return err
+		}
+
+		if linked {
+			return nil
+		}
+	}
+
+	return errors.Errorf("error linking task %v to %v as it keeps changing", taskID, issueURL)
+}
+
+func (s *Syncer) accessToken(ctx context.Context, userID string) (string, error) {
+	state, err := s.integrationStore.ReadState(ctx, Provider, userID)
+	if err != nil && errors.Cause(err) != integrationstore.ErrIntegrationStoreNoRecord {
+		return "", err
+	}
+
+	if state == nil || !state.Enabled {
+		return "", ErrGithubSyncNotEnabled
+	}
+
+	accessToken, err := s.credentialStore.ReadCredential(ctx, Provider, userID)
+	if errors.Cause(err) == credentialstore.ErrCredentialStoreNoRecord {
+		return "", ErrGithubSyncNotConnected
+	}
+
+	return accessToken, err
+}
+
+func issueRequest(task store.Task) github.IssueRequest {
+	state := github.IssueStateOpen
+	if task.IsCompleted {
+		state = github.IssueStateClosed
+	}
+
+	return github.IssueRequest{
+		Title: task.Name,
+		Body:  task.Description,
+		State: state,
+	}
+}
+
+func sameContent(task store.Task, issue github.Issue) bool {
+	return task.Name == issue.Title && task.Description == issue.Body &&
+		task.IsCompleted == (issue.State == github.IssueStateClosed)
+}
@@ -0,0 +1,393 @@
+package githubsync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+	"github.com/AjithPanneerselvam/task-etcd/client/github/githubtest"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	taskstore "github.com/AjithPanneerselvam/task-etcd/store/task"
+	tasklinkstore "github.com/AjithPanneerselvam/task-etcd/store/tasklink"
+)
+
+const (
+	testUserID     = "github:1"
+	testRepository = "octo-org/octo-repo"
+)
+
+// revisionTaskStore keeps a task at a revision
+type revisionTaskStore struct {
+	store.TaskStore
+
+	task     *store.Task
+	revision int64
+}
+
+func (r *revisionTaskStore) ReadTaskWithRevision(ctx context.Context, userID string, taskID string) (*store.Task,
+	int64, error) {
+
+	if r.task == nil || r.task.ID != taskID {
+		return nil, 0, taskstore.ErrTaskStoreNoRecord
+	}
+
+	task := *r.task
+	return &task, r.revision, nil
+}
+
+func (r *revisionTaskStore) UpdateTaskAtRevision(ctx context.Context, userID string, task store.Task,
+	revision int64) (int64, bool, error) {
+
+	if revision != r.revision {
+		return 0, false, nil
+	}
+
+	r.edit(func(stored *store.Task) { *stored = task })
+	return r.revision, true, nil
+}
+
+func (r *revisionTaskStore) LinkTaskSource(ctx context.Context, userID string, task store.Task,
+	revision int64) (bool, error) {
+
+	_, updated, err := r.UpdateTaskAtRevision(ctx, userID, task, revision)
+	return updated, err
+}
+
+// edit changes the task as the user would, moving it to a new revision
+func (r *revisionTaskStore) edit(change func(task *store.Task)) {
+	change(r.task)
+	r.revision++
+}
+
+// memLinkStore keeps the links of the user by task
+type memLinkStore struct {
+	links map[string]store.TaskLink
+}
+
+func (m *memLinkStore) UpsertLink(ctx context.Context, link store.TaskLink) error {
+	m.links[link.TaskID] = link
+	return nil
+}
+
+func (m *memLinkStore) ReadLink(ctx context.Context, userID string, taskID string) (*store.TaskLink, error) {
+	link, ok := m.links[taskID]
+	if !ok {
+		return nil, tasklinkstore.ErrTaskLinkStoreNoRecord
+	}
+
+	return &link, nil
+}
+
+func (m *memLinkStore) ReadAllLinks(ctx context.Context, userID string) ([]store.TaskLink, error) {
+	var links []store.TaskLink
+	for _, link := range m.links {
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+func (m *memLinkStore) DeleteLink(ctx context.Context, userID string, taskID string) error {
+	delete(m.links, taskID)
+	return nil
+}
+
+// tokenCredentialStore has the same github token for every user
+type tokenCredentialStore struct {
+	store.CredentialStore
+
+	accessToken string
+}
+
+func (t tokenCredentialStore) ReadCredential(ctx context.Context, provider string, userID string) (string, error) {
+	return t.accessToken, nil
+}
+
+type linkFixture struct {
+	server      *githubtest.Server
+	accessToken string
+	syncer      *Syncer
+	taskStore   *revisionTaskStore
+	linkStore   *memLinkStore
+	link        *store.TaskLink
+}
+
+// newLinkFixture exports a task to a new issue with the conflict policy
+func newLinkFixture(t *testing.T, conflictPolicy string) *linkFixture {
+	t.Helper()
+
+	server := githubtest.NewServer(githubtest.User{UserInfo: github.UserInfo{ID: 1, Login: "alice"}})
+	t.Cleanup(server.Close)
+
+	taskStore := &revisionTaskStore{
+		task:     &store.Task{ID: "task", Name: "fix the build", Description: "it is red"},
+		revision: 1,
+	}
+	linkStore := &memLinkStore{links: make(map[string]store.TaskLink)}
+	accessToken := server.Handler.IssueToken("alice")
+
+	syncer := &Syncer{
+		githubClient:     github.New(server.OAuthURL(), server.APIURL(), "client-id", "client-secret", nil, 5, 0),
+		taskStore:        taskStore,
+		credentialStore:  tokenCredentialStore{accessToken: accessToken},
+		integrationStore: enabledIntegrationStore{},
+		taskLinkStore:    linkStore,
+		conflictPolicy:   conflictPolicy,
+	}
+
+	link, err := syncer.LinkTask(context.Background(), testUserID, "task", testRepository)
+	if err != nil {
+		t.Fatalf("error linking task: %v", err)
+	}
+
+	return &linkFixture{
+		server:      server,
+		accessToken: accessToken,
+		syncer:      syncer,
+		taskStore:   taskStore,
+		linkStore:   linkStore,
+		link:        link,
+	}
+}
+
+// sync syncs the links of the user, returning the result
+func (f *linkFixture) sync(t *testing.T) Result {
+	t.Helper()
+
+	var result Result
+	err := f.syncer.syncLinks(context.Background(), testUserID, f.accessToken, &result)
+	if err != nil {
+		t.Fatalf("error syncing links: %v", err)
+	}
+
+	return result
+}
+
+func (f *linkFixture) issue(t *testing.T) github.Issue {
+	t.Helper()
+
+	issue, ok := f.server.Handler.Issue(f.link.IssueURL)
+	if !ok {
+		t.Fatalf("issue %v does not exist", f.link.IssueURL)
+	}
+
+	return issue
+}
+
+func TestLinkTask(t *testing.T) {
+	f := newLinkFixture(t, ConflictPolicyManual)
+
+	issue := f.issue(t)
+	if issue.Title != "fix the build" || issue.Body != "it is red" || issue.State != github.IssueStateOpen {
+		t.Errorf("issue is %q %q %v, want the task", issue.Title, issue.Body, issue.State)
+	}
+
+	if f.taskStore.task.SourceURL != f.link.IssueURL {
+		t.Errorf("task source is %q, want %q", f.taskStore.task.SourceURL, f.link.IssueURL)
+	}
+
+	if link := f.linkStore.links["task"]; link.TaskRevision != f.taskStore.revision {
+		t.Errorf("link is at task revision %v, want %v", link.TaskRevision, f.taskStore.revision)
+	}
+
+	if result := f.sync(t); result != (Result{}) {
+		t.Errorf("sync of unchanged link is %+v, want nothing done", result)
+	}
+
+	_, err := f.syncer.LinkTask(context.Background(), testUserID, "task", testRepository)
+	if err != ErrGithubSyncAlreadyLinked {
+		t.Errorf("error linking task again is %v, want %v", err, ErrGithubSyncAlreadyLinked)
+	}
+}
+
+func TestSyncLink(t *testing.T) {
+	testCases := []struct {
+		name           string
+		conflictPolicy string
+		editTask       func(task *store.Task)
+		editIssue      func(h *githubtest.Handler, issueURL string)
+		wantResult     Result
+		wantName       string
+		wantTitle      string
+		wantCompleted  bool
+		wantState      string
+	}{
+		{
+			name:           "task renamed",
+			conflictPolicy: ConflictPolicyManual,
+			editTask:       func(task *store.Task) { task.Name = "fix the flaky build" },
+			wantResult:     Result{Pushed: 1},
+			wantName:       "fix the flaky build",
+			wantTitle:      "fix the flaky build",
+			wantState:      github.IssueStateOpen,
+		},
+		{
+			name:           "task completed",
+			conflictPolicy: ConflictPolicyManual,
+			editTask:       func(task *store.Task) { task.IsCompleted = true },
+			wantResult:     Result{Pushed: 1},
+			wantName:       "fix the build",
+			wantTitle:      "fix the build",
+			wantCompleted:  true,
+			wantState:      github.IssueStateClosed,
+		},
+		{
+			name:           "issue edited",
+			conflictPolicy: ConflictPolicyManual,
+			editIssue: func(h *githubtest.Handler, issueURL string) {
+				h.EditIssue(issueURL, "fix the build on arm", "it is red")
+			},
+			wantResult: Result{Pulled: 1},
+			wantName:   "fix the build on arm",
+			wantTitle:  "fix the build on arm",
+			wantState:  github.IssueStateOpen,
+		},
+		{
+			name:           "issue closed",
+			conflictPolicy: ConflictPolicyManual,
+			editIssue: func(h *githubtest.Handler, issueURL string) {
+				h.SetIssueState(issueURL, github.IssueStateClosed)
+			},
+			wantResult:    Result{Pulled: 1},
+			wantName:      "fix the build",
+			wantTitle:     "fix the build",
+			wantCompleted: true,
+			wantState:     github.IssueStateClosed,
+		},
+		{
+			name:           "both changed alike",
+			conflictPolicy: ConflictPolicyManual,
+			editTask:       func(task *store.Task) { task.Name = "fix the flaky build" },
+			editIssue: func(h *githubtest.Handler, issueURL string) {
+				h.EditIssue(issueURL, "fix the flaky build", "it is red")
+			},
+			wantName:  "fix the flaky build",
+			wantTitle: "fix the flaky build",
+			wantState: github.IssueStateOpen,
+		},
+		{
+			name:           "conflict kept on github",
+			conflictPolicy: ConflictPolicyGithub,
+			editTask:       func(task *store.Task) { task.Name = "fix the flaky build" },
+			editIssue: func(h *githubtest.Handler, issueURL string) {
+				h.EditIssue(issueURL, "fix the build on arm", "it is red")
+			},
+			wantResult: Result{Pulled: 1},
+			wantName:   "fix the build on arm",
+			wantTitle:  "fix the build on arm",
+			wantState:  github.IssueStateOpen,
+		},
+		{
+			name:           "conflict kept on the task",
+			conflictPolicy: ConflictPolicyTask,
+			editTask:       func(task *store.Task) { task.Name = "fix the flaky build" },
+			editIssue: func(h *githubtest.Handler, issueURL string) {
+				h.EditIssue(issueURL, "fix the build on arm", "it is red")
+			},
+			wantResult: Result{Pushed: 1},
+			wantName:   "fix the flaky build",
+			wantTitle:  "fix the flaky build",
+			wantState:  github.IssueStateOpen,
+		},
+		{
+			name:           "conflict left to the user",
+			conflictPolicy: ConflictPolicyManual,
+			editTask:       func(task *store.Task) { task.Name = "fix the flaky build" },
+			editIssue: func(h *githubtest.Handler, issueURL string) {
+				h.EditIssue(issueURL, "fix the build on arm", "it is red")
+			},
+			wantResult: Result{Conflicts: 1},
+			wantName:   "fix the flaky build",
+			wantTitle:  "fix the build on arm",
+			wantState:  github.IssueStateOpen,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newLinkFixture(t, tc.conflictPolicy)
+
+			if tc.editTask != nil {
+				f.taskStore.edit(tc.editTask)
+			}
+			if tc.editIssue != nil {
+				tc.editIssue(f.server.Handler, f.link.IssueURL)
+			}
+
+			if result := f.sync(t); result != tc.wantResult {
+				t.Errorf("sync is %+v, want %+v", result, tc.wantResult)
+			}
+
+			task := f.taskStore.task
+			if task.Name != tc.wantName || task.IsCompleted != tc.wantCompleted {
+				t.Errorf("task is %q completed %v, want %q completed %v", task.Name, task.IsCompleted,
+					tc.wantName, tc.wantCompleted)
+			}
+
+			issue := f.issue(t)
+			if issue.Title != tc.wantTitle || issue.State != tc.wantState {
+				t.Errorf("issue is %q %v, want %q %v", issue.Title, issue.State, tc.wantTitle, tc.wantState)
+			}
+
+			// the sync recorded both sides, or the conflict, so the next one
+			// has nothing to do
+			wantResult := Result{}
+			if tc.wantResult.Conflicts > 0 {
+				wantResult.Conflicts = 1
+			}
+			if result := f.sync(t); result != wantResult {
+				t.Errorf("next sync is %+v, want %+v", result, wantResult)
+			}
+		})
+	}
+}
+
+func TestResolveConflict(t *testing.T) {
+	f := newLinkFixture(t, ConflictPolicyManual)
+
+	_, err := f.syncer.ResolveConflict(context.Background(), testUserID, "task", ConflictPolicyTask)
+	if err != ErrGithubSyncNoConflict {
+		t.Errorf("error resolving no conflict is %v, want %v", err, ErrGithubSyncNoConflict)
+	}
+
+	f.taskStore.edit(func(task *store.Task) { task.Name = "fix the flaky build" })
+	f.server.Handler.EditIssue(f.link.IssueURL, "fix the build on arm", "it is red")
+
+	if result := f.sync(t); result.Conflicts != 1 {
+		t.Fatalf("sync is %+v, want a conflict", result)
+	}
+
+	link, err := f.syncer.ResolveConflict(context.Background(), testUserID, "task", ConflictPolicyGithub)
+	if err != nil {
+		t.Fatalf("error resolving conflict: %v", err)
+	}
+
+	if link.Conflict || f.linkStore.links["task"].Conflict {
+		t.Errorf("link is conflicted after resolving")
+	}
+
+	if f.taskStore.task.Name != "fix the build on arm" {
+		t.Errorf("task name is %q, want the one of the issue", f.taskStore.task.Name)
+	}
+
+	if result := f.sync(t); result != (Result{}) {
+		t.Errorf("sync after resolving is %+v, want nothing done", result)
+	}
+}
+
+func TestSyncLinkOfDeletedTask(t *testing.T) {
+	f := newLinkFixture(t, ConflictPolicyManual)
+	f.taskStore.task = nil
+
+	if result := f.sync(t); result != (Result{Unlinked: 1}) {
+		t.Errorf("sync is %+v, want the link unlinked", result)
+	}
+
+	if _, ok := f.linkStore.links["task"]; ok {
+		t.Errorf("link of deleted task is kept")
+	}
+
+	if issue := f.issue(t); issue.State != github.IssueStateOpen {
+		t.Errorf("issue of deleted task is %v, want it left open", issue.State)
+	}
+}
@@ -0,0 +1,313 @@
+// Package githubsync imports the github issues and review requests of users
+// who opted in as tasks.
+package githubsync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+	"github.com/AjithPanneerselvam/task-etcd/identity"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	credentialstore "github.com/AjithPanneerselvam/task-etcd/store/credential"
+	integrationstore "github.com/AjithPanneerselvam/task-etcd/store/integration"
+	taskstore "github.com/AjithPanneerselvam/task-etcd/store/task"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	Provider = identity.ProviderGithub
+
+	jobName = "github-sync"
+
+	// issues updated shortly before the last sync started are listed again,
+	// so clock skew with github does not lose updates
+	sinceOverlap = 5 * time.Minute
+
+	maxDescriptionLength = 2000
+)
+
+// ErrGithubSync implements Error interface
+type ErrGithubSync string
+
+const (
+	ErrGithubSyncNotEnabled    ErrGithubSync = "error github sync is not enabled"
+	ErrGithubSyncNotConnected  ErrGithubSync = "error no github token to sync with"
+	ErrGithubSyncAlreadyLinked ErrGithubSync = "error task is already linked to an issue"
+	ErrGithubSyncNoConflict    ErrGithubSync = "error task link has no conflict to resolve"
+)
+
+func (e ErrGithubSync) Error() string {
+	return string(e)
+}
+
+// TaskCompleter completes a task the way an update of the user completing
+// it does, following the workflow, recurrence and subtasks of the task. It
+// reports whether the task was completed, false for a task deleted,
+// completed already or kept open by its workflow or subtasks.
+type TaskCompleter interface {
+	CompleteTask(ctx context.Context, userID string, taskID string) (bool, error)
+}
+
+// Result counts the changes of a sync: the issues imported and the links
+// of exported tasks synced
+type Result struct {
+	Created   int `json:"created"`
+	Completed int `json:"completed"`
+	Unchanged int `json:"unchanged"`
+
+	Pushed    int `json:"pushed"`
+	Pulled    int `json:"pulled"`
+	Conflicts int `json:"conflicts"`
+	Unlinked  int `json:"unlinked"`
+}
+
+// Syncer imports the open issues and pull requests assigned to a user, and
+// the pull requests they are asked to review, as tasks linked by the url of
+// the issue. An issue is imported once: re-syncs complete the task when the
+// issue is closed, and a task the user deleted is not imported again.
+//
+// Tasks exported to github issues are kept in sync both ways, see link.go.
+type Syncer struct {
+	githubClient     *github.Client
+	taskStore        store.TaskStore
+	taskCompleter    TaskCompleter
+	userStore        store.UserStore
+	credentialStore  store.CredentialStore
+	integrationStore store.IntegrationStore
+	taskLinkStore    store.TaskLinkStore
+	jobLock          store.JobLock
+	conflictPolicy   string
+	interval         time.Duration
+}
+
+// NewSyncer returns a syncer that runs every interval and settles the
+// conflicts of exported tasks with the conflict policy
+func NewSyncer(githubClient *github.Client, taskStore store.TaskStore, taskCompleter TaskCompleter,
+	userStore store.UserStore, credentialStore store.CredentialStore, integrationStore store.IntegrationStore,
+	taskLinkStore store.TaskLinkStore, jobLock store.JobLock, conflictPolicy string,
+	interval time.Duration) *Syncer {
+
+	return &Syncer{
+		githubClient:     githubClient,
+		taskStore:        taskStore,
+		taskCompleter:    taskCompleter,
+		userStore:        userStore,
+		credentialStore:  credentialStore,
+		integrationStore: integrationStore,
+		taskLinkStore:    taskLinkStore,
+		jobLock:          jobLock,
+		conflictPolicy:   conflictPolicy,
+		interval:         interval,
+	}
+}
+
+// Run syncs every user who opted in every interval until the context is
+// done. Only one instance syncs per interval.
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// shorter than the interval, so the lock has expired by the next tick
+		locked, err := s.jobLock.TryLock(ctx, jobName, s.interval*9/10)
+		if err != nil {
+			log.Errorf("error taking github sync lock: %v", err)
+			continue
+		}
+
+		if !locked {
+			log.Debug("github sync is run by another instance")
+			continue
+		}
+
+		s.syncAll(ctx)
+	}
+}
+
+func (s *Syncer) syncAll(ctx context.Context) {
+	states, err := s.integrationStore.ReadAllStates(ctx, Provider)
+	if err != nil {
+		log.Errorf("error reading github integration states: %v", err)
+		return
+	}
+
+	for _, state := range states {
+		if !state.Enabled {
+			continue
+		}
+
+		result, err := s.SyncUser(ctx, state.UserID)
+		if errors.Cause(err) == github.ErrGithubRateLimited {
+			log.Warnf("github sync stopped as github is rate limiting: %v", err)
+			return
+		}
+		if err != nil {
+			log.Errorf("error syncing github issues of user %v: %v", state.UserID, err)
+			continue
+		}
+		log.Infof("github issues of user %v synced: %+v", state.UserID, *result)
+	}
+}
+
+// SyncUser imports the github issues of the user and syncs the tasks they
+// exported. The outcome is recorded in the integration state of the user.
+func (s *Syncer) SyncUser(ctx context.Context, userID string) (*Result, error) {
+	state, err := s.integrationStore.ReadState(ctx, Provider, userID)
+	if errors.Cause(err) == integrationstore.ErrIntegrationStoreNoRecord {
+		return nil, ErrGithubSyncNotEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !state.Enabled {
+		return nil, ErrGithubSyncNotEnabled
+	}
+
+	syncStartedAt := time.Now().UTC()
+
+	result, err := s.sync(ctx, userID, state.LastSyncedAt)
+	if err != nil {
+		state.LastSyncError = err.Error()
+	} else {
+		state.LastSyncedAt = syncStartedAt
+		state.LastSyncError = ""
+		state.Imported += result.Created
+	}
+
+	stateErr := s.integrationStore.UpsertState(ctx, *state)
+	if stateErr != nil {
+		log.Errorf("error recording github sync state of user %v: %v", userID, stateErr)
+	}
+
+	return result, err
+}
+
+func (s *Syncer) sync(ctx context.Context, userID string, lastSyncedAt time.Time) (*Result, error) {
+	accessToken, err := s.credentialStore.ReadCredential(ctx, Provider, userID)
+	if errors.Cause(err) == credentialstore.ErrCredentialStoreNoRecord {
+		return nil, ErrGithubSyncNotConnected
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := s.userStore.ReadProfile(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading user profile")
+	}
+
+	since := lastSyncedAt
+	if !since.IsZero() {
+		since = since.Add(-sinceOverlap)
+	}
+
+	issues, err := s.githubClient.ListAssignedIssues(ctx, accessToken, since)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing assigned github issues")
+	}
+
+	reviewRequests, err := s.githubClient.SearchReviewRequests(ctx, accessToken, profile.Login)
+	if err != nil {
+		return nil, errors.Wrap(err, "error searching github review requests")
+	}
+
+	var result Result
+	for _, issue := range append(issues, reviewRequests...) {
+		err = s.syncIssue(ctx, userID, issue, &result)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error syncing github issue %v", issue.HTMLURL)
+		}
+	}
+
+	err = s.syncLinks(ctx, userID, accessToken, &result)
+	if err != nil {
+		return nil, errors.Wrap(err, "error syncing exported tasks")
+	}
+
+	return &result, nil
+}
+
+func (s *Syncer) syncIssue(ctx context.Context, userID string, issue github.Issue, result *Result) error {
+	taskID, err := s.taskStore.ReadTaskIDBySource(ctx, userID, issue.HTMLURL)
+	if errors.Cause(err) == taskstore.ErrTaskStoreNoSource {
+		if issue.State != github.IssueStateOpen {
+			result.Unchanged++
+			return nil
+		}
+
+		created, err := s.taskStore.CreateSourcedTask(ctx, userID, newTask(issue))
+		if err != nil {
+			return err
+		}
+
+		if created {
+			result.Created++
+		} else {
+			result.Unchanged++
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// a task is never reopened, the user may have completed it on purpose
+	if issue.State != github.IssueStateClosed {
+		result.Unchanged++
+		return nil
+	}
+
+	completed, err := s.taskCompleter.CompleteTask(ctx, userID, taskID)
+	if err != nil {
+		return err
+	}
+
+	if completed {
+		result.Completed++
+	} else {
+		result.Unchanged++
+	}
+
+	return nil
+}
+
+// newTask returns the task of an issue, named after the issue and its
+// repository, e.g. "octo-org/octo-repo#12 Fix the build"
+func newTask(issue github.Issue) store.Task {
+	description := issue.Body
+	if runes := []rune(description); len(runes) > maxDescriptionLength {
+		description = string(runes[:maxDescriptionLength]) + "..."
+	}
+
+	task := store.Task{
+		ID:          uuid.NewString(),
+		Name:        fmt.Sprintf("%s#%d %s", repositoryName(issue), issue.Number, issue.Title),
+		Description: description,
+		SourceURL:   issue.HTMLURL,
+	}
+	task.Stamp(nil, time.Now().UTC())
+
+	return task
+}
+
+// repositoryName returns the owner/name of the repository of the issue
+func repositoryName(issue github.Issue) string {
+	index := strings.Index(issue.RepositoryURL, "/repos/")
+	if index < 0 {
+		return issue.RepositoryURL
+	}
+
+	return issue.RepositoryURL[index+len("/repos/"):]
+}
@@ -0,0 +1,76 @@
+package githubsync
+
+import (
+	"context"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+	integrationstore "github.com/AjithPanneerselvam/task-etcd/store/integration"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// HandleWebhookEvent completes the tasks linked to the issue or pull request
+// of a webhook event once it is closed, whether a pull request was merged or
+// not. Comments on closed issues complete the tasks too, catching up on
+// missed close events. It returns how many tasks were completed.
+func (s *Syncer) HandleWebhookEvent(ctx context.Context, eventName string, event github.WebhookEvent) (int, error) {
+	var sourceURL string
+	var closed bool
+
+	switch {
+	case (eventName == github.WebhookEventIssues || eventName == github.WebhookEventIssueComment) &&
+		event.Issue != nil:
+		sourceURL = event.Issue.HTMLURL
+		closed = event.Issue.State == github.IssueStateClosed
+	case eventName == github.WebhookEventPullRequest && event.PullRequest != nil:
+		sourceURL = event.PullRequest.HTMLURL
+		closed = event.PullRequest.State == github.IssueStateClosed
+	default:
+		return 0, nil
+	}
+
+	// like the sync, tasks are never reopened
+	if !closed || sourceURL == "" {
+		return 0, nil
+	}
+
+	sourcedTasks, err := s.taskStore.ReadSourcedTasks(ctx, sourceURL)
+	if err != nil {
+		return 0, err
+	}
+
+	completed := 0
+	for _, sourcedTask := range sourcedTasks {
+		ok, err := s.completeTask(ctx, sourcedTask.UserID, sourcedTask.TaskID)
+		if err != nil {
+			return completed, errors.Wrapf(err, "error completing task %v of user %v", sourcedTask.TaskID,
+				sourcedTask.UserID)
+		}
+
+		if ok {
+			completed++
+		}
+	}
+
+	if completed > 0 {
+		log.Infof("%v tasks of %v completed by %v event", completed, sourceURL, eventName)
+	}
+
+	return completed, nil
+}
+
+// completeTask completes the task of a user who still has the sync enabled,
+// reporting whether it did
+func (s *Syncer) completeTask(ctx context.Context, userID string, taskID string) (bool, error) {
+	state, err := s.integrationStore.ReadState(ctx, Provider, userID)
+	if err != nil && errors.Cause(err) != integrationstore.ErrIntegrationStoreNoRecord {
+		return false, err
+	}
+
+	// users who opted out are left alone
+	if state == nil || !state.Enabled {
+		return false, nil
+	}
+
+	return s.taskCompleter.CompleteTask(ctx, userID, taskID)
+}
@@ -0,0 +1,127 @@
+package githubsync
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+)
+
+const testIssueURL = "https://github.com/octo-org/octo-repo/issues/12"
+
+// recordingCompleter completes the open tasks it is given, recording the
+// tasks it was asked to complete by user
+type recordingCompleter struct {
+	completed map[string]bool
+	asked     []string
+}
+
+func (r *recordingCompleter) CompleteTask(ctx context.Context, userID string, taskID string) (bool, error) {
+	r.asked = append(r.asked, userID+"/"+taskID)
+
+	if r.completed[taskID] {
+		return false, nil
+	}
+	r.completed[taskID] = true
+
+	return true, nil
+}
+
+// sourcedTaskStore has the tasks created from the test issue
+type sourcedTaskStore struct {
+	store.TaskStore
+
+	sourcedTasks []store.SourcedTask
+}
+
+func (s sourcedTaskStore) ReadSourcedTasks(ctx context.Context, sourceURL string) ([]store.SourcedTask, error) {
+	if sourceURL != testIssueURL {
+		return nil, nil
+	}
+
+	return s.sourcedTasks, nil
+}
+
+// enabledIntegrationStore has the sync enabled for every user
+type enabledIntegrationStore struct {
+	store.IntegrationStore
+}
+
+func (enabledIntegrationStore) ReadState(ctx context.Context, provider string, userID string) (
+	*store.IntegrationState, error) {
+
+	return &store.IntegrationState{Provider: provider, UserID: userID, Enabled: true}, nil
+}
+
+func TestHandleWebhookEvent(t *testing.T) {
+	testCases := []struct {
+		name          string
+		eventName     string
+		event         github.WebhookEvent
+		wantCompleted int
+		wantAsked     []string
+	}{
+		{
+			name:      "issue closed",
+			eventName: github.WebhookEventIssues,
+			event: github.WebhookEvent{
+				Action: "closed",
+				Issue:  &github.Issue{State: github.IssueStateClosed, HTMLURL: testIssueURL},
+			},
+			wantCompleted: 1,
+			wantAsked:     []string{"github:1/task", "github:2/completed-task"},
+		},
+		{
+			name:      "issue reopened",
+			eventName: github.WebhookEventIssues,
+			event: github.WebhookEvent{
+				Action: "reopened",
+				Issue:  &github.Issue{State: github.IssueStateOpen, HTMLURL: testIssueURL},
+			},
+		},
+		{
+			name:      "pull request closed",
+			eventName: github.WebhookEventPullRequest,
+			event: github.WebhookEvent{
+				Action:      "closed",
+				PullRequest: &github.PullRequest{State: github.IssueStateClosed, HTMLURL: testIssueURL},
+			},
+			wantCompleted: 1,
+			wantAsked:     []string{"github:1/task", "github:2/completed-task"},
+		},
+		{
+			name:      "other event",
+			eventName: "push",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			taskCompleter := &recordingCompleter{completed: map[string]bool{"completed-task": true}}
+
+			syncer := &Syncer{
+				taskStore: sourcedTaskStore{sourcedTasks: []store.SourcedTask{
+					{UserID: "github:1", TaskID: "task"},
+					{UserID: "github:2", TaskID: "completed-task"},
+				}},
+				taskCompleter:    taskCompleter,
+				integrationStore: enabledIntegrationStore{},
+			}
+
+			completed, err := syncer.HandleWebhookEvent(context.Background(), tc.eventName, tc.event)
+			if err != nil {
+				t.Fatalf("error handling webhook event: %v", err)
+			}
+
+			if completed != tc.wantCompleted {
+				t.Errorf("%v tasks completed, want %v", completed, tc.wantCompleted)
+			}
+
+			if !reflect.DeepEqual(taskCompleter.asked, tc.wantAsked) {
+				t.Errorf("tasks completed are %v, want %v", taskCompleter.asked, tc.wantAsked)
+			}
+		})
+	}
+}
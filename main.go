@@ -1,12 +1,36 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"time"
+	// embedded time zone database, user time zones are resolved on hosts without one
+	_ "time/tzdata"
 
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
 	"github.com/AjithPanneerselvam/task-etcd/config"
 	"github.com/AjithPanneerselvam/task-etcd/db"
+	"github.com/AjithPanneerselvam/task-etcd/handler/account"
+	taskhandler "github.com/AjithPanneerselvam/task-etcd/handler/task"
+	"github.com/AjithPanneerselvam/task-etcd/identity"
+	"github.com/AjithPanneerselvam/task-etcd/integration/githubsync"
+	"github.com/AjithPanneerselvam/task-etcd/membership"
+	"github.com/AjithPanneerselvam/task-etcd/reminder"
 	"github.com/AjithPanneerselvam/task-etcd/router"
+	accountstore "github.com/AjithPanneerselvam/task-etcd/store/account"
+	"github.com/AjithPanneerselvam/task-etcd/store/credential"
+	"github.com/AjithPanneerselvam/task-etcd/store/election"
+	"github.com/AjithPanneerselvam/task-etcd/store/inbox"
+	"github.com/AjithPanneerselvam/task-etcd/store/integration"
+	"github.com/AjithPanneerselvam/task-etcd/store/joblock"
+	"github.com/AjithPanneerselvam/task-etcd/store/oauthstate"
+	"github.com/AjithPanneerselvam/task-etcd/store/session"
 	"github.com/AjithPanneerselvam/task-etcd/store/task"
+	"github.com/AjithPanneerselvam/task-etcd/store/tasklink"
+	"github.com/AjithPanneerselvam/task-etcd/store/user"
+	"github.com/AjithPanneerselvam/task-etcd/store/webhook"
+	"github.com/AjithPanneerselvam/task-etcd/store/workflow"
 	"github.com/AjithPanneerselvam/task-etcd/util"
 
 	log "github.com/sirupsen/logrus"
@@ -22,16 +46,136 @@ func main() {
 	log.Infof("log level: %v", config.LogLevel)
 	util.SetupLog(config.LogLevel)
 
-	db, err := db.NewEtcdClient(config.EtcdURLS)
+	if config.OIDCIssuerURL != "" {
+		err = identity.ValidateProviderName(config.OIDCProviderName)
+		if err != nil {
+			log.Fatalf("error validating OIDC_PROVIDER_NAME: %v", err)
+		}
+	}
+
+	// the session cookie carries the token, which is not sent over plain http
+	if config.SessionCookiesEnabled && !config.SecureCookies {
+		log.Fatal("error as session cookies are enabled without secure cookies")
+	}
+
+	etcdClient, err := db.NewEtcdClient(config.EtcdURLS)
 	if err != nil {
 		log.Fatal("error creating a etcd client", err)
 	}
 	log.Info("etcd client instantiated")
 
-	taskStore := task.New(db)
+	err = task.Migrate(context.Background(), etcdClient)
+	if err != nil {
+		log.Fatalf("error migrating task store: %v", err)
+	}
+
+	stores := router.Stores{
+		Task:       task.New(etcdClient),
+		Project:    task.NewProjectStore(etcdClient),
+		Workflow:   workflow.New(etcdClient),
+		OAuthState: oauthstate.New(etcdClient),
+		Account:    accountstore.New(etcdClient),
+		User:       user.New(etcdClient),
+		Session:    session.New(etcdClient),
+	}
+
+	if config.LocalAccountsEnabled && config.LocalBootstrapAdminUsername != "" {
+		err = account.EnsureAccount(context.Background(), stores.Account, config.LocalBootstrapAdminUsername,
+			config.LocalBootstrapAdminPassword, append([]string{auth.ScopeAdmin}, auth.DefaultUserScopes...))
+		if err != nil {
+			log.Fatalf("error bootstrapping admin account: %v", err)
+		}
+		log.Infof("admin account %v bootstrapped", config.LocalBootstrapAdminUsername)
+	}
+
+	if !taskhandler.ValidSubtaskDeletePolicy(config.SubtasksOnDelete) {
+		log.Fatalf("error as subtask delete policy %v is unknown", config.SubtasksOnDelete)
+	}
+
+	if !taskhandler.ValidSubtaskCompletePolicy(config.SubtasksOnComplete) {
+		log.Fatalf("error as subtask complete policy %v is unknown", config.SubtasksOnComplete)
+	}
+
+	var githubSyncer *githubsync.Syncer
+	if config.GithubSyncEnabled {
+		if !githubsync.ValidConflictPolicy(config.GithubSyncConflictPolicy) {
+			log.Fatalf("error as github sync conflict policy %v is unknown", config.GithubSyncConflictPolicy)
+		}
+
+		sealer, err := auth.NewSealer(config.CredentialSealKey)
+		if err != nil {
+			log.Fatalf("error creating credential sealer: %v", err)
+		}
+
+		stores.Credential = credential.New(etcdClient, sealer)
+		stores.Integration = integration.New(etcdClient)
+		stores.TaskLink = tasklink.New(etcdClient)
+		if config.GithubWebhookSecret != "" {
+			stores.WebhookDelivery = webhook.New(etcdClient)
+		}
+
+		githubClient := github.New(config.GithubOAuthURL, config.GithubAPIURL, config.GithubClientID,
+			config.GithubClientSecret, nil, config.GithubTimeoutInSec, config.GithubMaxRetries)
+		// issues closed on github complete their tasks as users do
+		taskCompleter := taskhandler.NewTaskHandler(stores.Task, stores.Project, stores.Workflow,
+			config.SubtasksOnDelete, config.SubtasksOnComplete)
+		githubSyncer = githubsync.NewSyncer(githubClient, stores.Task, taskCompleter, stores.User,
+			stores.Credential, stores.Integration, stores.TaskLink, joblock.New(etcdClient),
+			config.GithubSyncConflictPolicy, time.Minute*time.Duration(config.GithubSyncIntervalInMin))
+
+		go githubSyncer.Run(context.Background())
+		log.Infof("syncing github issues every %v mins", config.GithubSyncIntervalInMin)
+	}
+
+	if config.RemindersEnabled {
+		notifiers := make(reminder.Notifiers, 0, len(config.ReminderNotifiers))
+		for _, notifierName := range config.ReminderNotifiers {
+			switch notifierName {
+			case reminder.NotifierLog:
+				notifiers = append(notifiers, reminder.NewLogNotifier())
+			case reminder.NotifierWebhook:
+				if config.ReminderWebhookURL == "" {
+					log.Fatal("error as the reminder webhook notifier needs REMINDER_WEBHOOK_URL")
+				}
+				notifiers = append(notifiers, reminder.NewWebhookNotifier(config.ReminderWebhookURL,
+					config.ReminderWebhookSecret, config.ReminderWebhookTimeoutInSec))
+			case reminder.NotifierInbox:
+				stores.Inbox = inbox.New(etcdClient)
+				notifiers = append(notifiers, reminder.NewInboxNotifier(stores.Inbox))
+			default:
+				log.Fatalf("error as reminder notifier %v is unknown", notifierName)
+			}
+		}
+
+		scheduler := reminder.NewScheduler(stores.Task,
+			election.New(etcdClient, time.Second*time.Duration(config.ReminderLeaderTTLInSecs)), notifiers,
+			time.Second*time.Duration(config.ReminderPollIntervalInSecs))
+
+		go scheduler.Run(context.Background())
+		log.Infof("delivering task reminders with %v", config.ReminderNotifiers)
+	}
+
+	githubAccess := router.GithubAccess(config)
+	switch {
+	case githubAccess.Restricted() && config.GithubMembershipToken != "":
+		githubClient := github.New(config.GithubOAuthURL, config.GithubAPIURL, config.GithubClientID,
+			config.GithubClientSecret, nil, config.GithubTimeoutInSec, config.GithubMaxRetries)
+		revalidator := membership.NewRevalidator(githubAccess, githubClient, config.GithubMembershipToken,
+			stores.User, stores.Session, joblock.New(etcdClient),
+			time.Minute*time.Duration(config.GithubRevalidateIntervalInMin))
+
+		go revalidator.Run(context.Background())
+		log.Infof("revalidating github users every %v mins", config.GithubRevalidateIntervalInMin)
+	case githubAccess.Restricted():
+		log.Warn("github logins are restricted but GITHUB_MEMBERSHIP_TOKEN is not set, " +
+			"departed members keep access until their sessions expire")
+	}
 
 	router := router.NewRouter()
-	router.AddRoutes(config, taskStore)
+	err = router.AddRoutes(config, stores, db.NewStatusChecker(etcdClient), githubSyncer)
+	if err != nil {
+		log.Fatalf("error adding routes: %v", err)
+	}
 
 	log.Infof("starting server at port %v", config.ListenPort)
 	http.ListenAndServe(":"+config.ListenPort, router)
@@ -0,0 +1,132 @@
+// Package membership keeps the sessions of github users in line with the
+// org and team allow lists after they have logged in.
+package membership
+
+import (
+	"context"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/client/github"
+	"github.com/AjithPanneerselvam/task-etcd/identity"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	jobName = "github-revalidate"
+)
+
+// Revalidator periodically checks the github users with active sessions
+// against the allow lists and revokes the sessions of those no longer
+// admitted, e.g. after leaving the org. Their next login is denied.
+type Revalidator struct {
+	access       identity.GithubAccess
+	githubClient *github.Client
+	serviceToken string
+
+	userStore    store.UserStore
+	sessionStore store.SessionStore
+	jobLock      store.JobLock
+	interval     time.Duration
+}
+
+// NewRevalidator returns a revalidator checking memberships with the
+// service token, which has to belong to a member of the allowed orgs with
+// the read:org scope to see private memberships
+func NewRevalidator(access identity.GithubAccess, githubClient *github.Client, serviceToken string,
+	userStore store.UserStore, sessionStore store.SessionStore, jobLock store.JobLock,
+	interval time.Duration) *Revalidator {
+
+	return &Revalidator{
+		access:       access,
+		githubClient: githubClient,
+		serviceToken: serviceToken,
+		userStore:    userStore,
+		sessionStore: sessionStore,
+		jobLock:      jobLock,
+		interval:     interval,
+	}
+}
+
+// Run revalidates every interval until the context is done. Only one
+// instance revalidates per interval.
+func (r *Revalidator) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// shorter than the interval, so the lock has expired by the next tick
+		locked, err := r.jobLock.TryLock(ctx, jobName, r.interval*9/10)
+		if err != nil {
+			log.Errorf("error taking github revalidation lock: %v", err)
+			continue
+		}
+
+		if !locked {
+			log.Debug("github revalidation is run by another instance")
+			continue
+		}
+
+		err = r.RevalidateAll(ctx)
+		if err != nil {
+			log.Errorf("error revalidating github users: %v", err)
+		}
+	}
+}
+
+// RevalidateAll checks every github user with an active session. A user
+// whose membership cannot be checked keeps their sessions.
+func (r *Revalidator) RevalidateAll(ctx context.Context) error {
+	profiles, err := r.userStore.ReadAllProfiles(ctx)
+	if err != nil {
+		return errors.Wrap(err, "error reading user profiles")
+	}
+
+	var checked, revoked int
+	for _, profile := range profiles {
+		if profile.Provider != identity.ProviderGithub || profile.Disabled {
+			continue
+		}
+
+		sessions, err := r.sessionStore.ReadAllSessions(ctx, profile.UserID)
+		if err != nil {
+			return errors.Wrapf(err, "error reading sessions of user %v", profile.UserID)
+		}
+
+		if len(sessions) == 0 {
+			continue
+		}
+
+		admitted, err := r.access.Revalidate(ctx, r.githubClient, r.serviceToken, profile.Login)
+		if errors.Cause(err) == github.ErrGithubRateLimited {
+			return errors.Wrapf(err, "error revalidating after %v users", checked)
+		}
+		if err != nil {
+			log.Errorf("error revalidating github user %v: %v", profile.Login, err)
+			continue
+		}
+		checked++
+
+		if admitted {
+			continue
+		}
+
+		deleted, err := r.sessionStore.DeleteOtherSessions(ctx, profile.UserID, "")
+		if err != nil {
+			return errors.Wrapf(err, "error revoking sessions of user %v", profile.UserID)
+		}
+		revoked++
+		log.Infof("github user %v is no longer admitted, %v sessions revoked", profile.Login, deleted)
+	}
+
+	log.Infof("revalidated %v github users, %v no longer admitted", checked, revoked)
+
+	return nil
+}
@@ -0,0 +1,413 @@
+// Package recurrence repeats tasks by RFC 5545 recurrence rules.
+package recurrence
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Frequencies supported
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+
+	maxInterval = 366
+	// periods scanned for the next occurrence before the rule is taken to
+	// have none, e.g. the 31st of every other month starting in february
+	maxPeriods = 1000
+)
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// WeekdayNum is a day of the week, the nth of the month when the ordinal
+// is set, counted from the end when negative
+type WeekdayNum struct {
+	Ordinal int
+	Weekday time.Weekday
+}
+
+// Rule is a recurrence rule, the subset of RFC 5545 RRULE of daily, weekly
+// and monthly frequencies with INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY and
+// WKST
+type Rule struct {
+	Freq     string
+	Interval int
+	// Count limits the occurrences, the first included, when not zero
+	Count int
+	// Until is the last time an occurrence can be at when not zero. A date
+	// without a time includes the whole day.
+	Until      time.Time
+	untilDate  bool
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	WeekStart  time.Weekday
+}
+
+// Parse parses a recurrence rule, such as FREQ=WEEKLY;BYDAY=MO,FR;COUNT=10,
+// with or without the RRULE: prefix. Its errors are caused by
+// ErrRecurrenceInvalidRule.
+func Parse(rule string) (*Rule, error) {
+	r, err := parse(rule)
+	if err != nil {
+		return nil, errors.Wrap(ErrRecurrenceInvalidRule, err.Error())
+	}
+
+	return r, nil
+}
+
+func parse(rule string) (*Rule, error) {
+	r := Rule{
+		Interval:  1,
+		WeekStart: time.Monday,
+	}
+
+	rule = NormalizeRule(rule)
+	if rule == "" {
+		return nil, errors.New("error as recurrence rule is empty")
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(rule, ";") {
+		name, value, ok := cut(part, "=")
+		if !ok || value == "" {
+			return nil, errors.Errorf("error parsing recurrence rule part %q", part)
+		}
+
+		if seen[name] {
+			return nil, errors.Errorf("error as recurrence rule part %v is repeated", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			r.Freq = value
+		case "INTERVAL":
+			r.Interval, err = parseInt(value, 1, maxInterval)
+		case "COUNT":
+			r.Count, err = parseInt(value, 1, 0)
+		case "UNTIL":
+			r.Until, r.untilDate, err = parseUntil(value)
+		case "BYDAY":
+			r.ByDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseByMonthDay(value)
+		case "WKST":
+			weekday, ok := weekdays[value]
+			if !ok {
+				err = errors.Errorf("unknown weekday %v", value)
+			}
+			r.WeekStart = weekday
+		default:
+			return nil, errors.Errorf("error as recurrence rule part %v is not supported", name)
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing recurrence rule part %v", name)
+		}
+	}
+
+	err := r.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func (r *Rule) validate() error {
+	switch r.Freq {
+	case FreqDaily, FreqWeekly, FreqMonthly:
+	case "":
+		return errors.New("error as recurrence rule has no FREQ")
+	default:
+		return errors.Errorf("error as recurrence frequency %v is not supported", r.Freq)
+	}
+
+	if r.Count > 0 && !r.Until.IsZero() {
+		return errors.New("error as recurrence rule has both COUNT and UNTIL")
+	}
+
+	if len(r.ByMonthDay) > 0 && r.Freq != FreqMonthly {
+		return errors.New("error as BYMONTHDAY is supported for monthly recurrences only")
+	}
+
+	if len(r.ByMonthDay) > 0 && len(r.ByDay) > 0 {
+		return errors.New("error as BYDAY and BYMONTHDAY together are not supported")
+	}
+
+	for _, day := range r.ByDay {
+		if day.Ordinal != 0 && r.Freq != FreqMonthly {
+			return errors.New("error as BYDAY ordinals are supported for monthly recurrences only")
+		}
+	}
+
+	return nil
+}
+
+// Next returns the first occurrence of the series starting at start that is
+// after the given time, false when the series ends before. Occurrences are
+// at the time of day of start, in its location. COUNT is left to the
+// caller, who knows the number of the occurrence.
+func (r *Rule) Next(start time.Time, after time.Time) (time.Time, bool) {
+	location := start.Location()
+	after = after.In(location)
+
+	until := r.Until
+	if r.untilDate {
+		until = time.Date(until.Year(), until.Month(), until.Day(), 23, 59, 59, 0, location)
+	}
+
+	// periods before the one of start hold no occurrences
+	from := after
+	if from.Before(start) {
+		from = start
+	}
+
+	for i := 0; i < maxPeriods; i++ {
+		candidates, ok := r.periodCandidates(start, from, i)
+		if !ok {
+			continue
+		}
+
+		for _, candidate := range candidates {
+			if !until.IsZero() && candidate.After(until) {
+				return time.Time{}, false
+			}
+
+			if candidate.After(after) && !candidate.Before(start) {
+				return candidate, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// periodCandidates returns the occurrences of the ith period from the one
+// holding from in order, false when the interval skips the period
+func (r *Rule) periodCandidates(start time.Time, from time.Time, i int) ([]time.Time, bool) {
+	location := start.Location()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, location)
+	}
+
+	switch r.Freq {
+	case FreqDaily:
+		day := at(from.Year(), from.Month(), from.Day()+i)
+		if daysBetween(start, day)%r.Interval != 0 {
+			return nil, false
+		}
+
+		if len(r.ByDay) > 0 && !r.onWeekday(day.Weekday()) {
+			return nil, true
+		}
+
+		return []time.Time{day}, true
+
+	case FreqWeekly:
+		weekStart := at(from.Year(), from.Month(), from.Day()-r.weekdayOffset(from.Weekday())+7*i)
+		firstWeekStart := at(start.Year(), start.Month(), start.Day()-r.weekdayOffset(start.Weekday()))
+		if (daysBetween(firstWeekStart, weekStart)/7)%r.Interval != 0 {
+			return nil, false
+		}
+
+		offsets := []int{r.weekdayOffset(start.Weekday())}
+		if len(r.ByDay) > 0 {
+			offsets = offsets[:0]
+			for _, day := range r.ByDay {
+				offsets = append(offsets, r.weekdayOffset(day.Weekday))
+			}
+		}
+		sort.Ints(offsets)
+
+		candidates := make([]time.Time, 0, len(offsets))
+		for _, offset := range offsets {
+			candidates = append(candidates, at(weekStart.Year(), weekStart.Month(), weekStart.Day()+offset))
+		}
+
+		return candidates, true
+
+	case FreqMonthly:
+		month := at(from.Year(), from.Month()+time.Month(i), 1)
+		months := (month.Year()-start.Year())*12 + int(month.Month()-start.Month())
+		if months%r.Interval != 0 {
+			return nil, false
+		}
+
+		days := r.monthDays(month, start.Day())
+
+		candidates := make([]time.Time, 0, len(days))
+		for _, day := range days {
+			candidates = append(candidates, at(month.Year(), month.Month(), day))
+		}
+
+		return candidates, true
+	}
+
+	return nil, false
+}
+
+// monthDays returns the days of the month of the rule in order, the day of
+// start unless BYMONTHDAY or BYDAY is set. Days the month does not have are
+// skipped.
+func (r *Rule) monthDays(month time.Time, startDay int) []int {
+	daysInMonth := time.Date(month.Year(), month.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	firstWeekday := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC).Weekday()
+
+	var days []int
+	switch {
+	case len(r.ByMonthDay) > 0:
+		for _, monthDay := range r.ByMonthDay {
+			if monthDay < 0 {
+				monthDay = daysInMonth + monthDay + 1
+			}
+			days = append(days, monthDay)
+		}
+
+	case len(r.ByDay) > 0:
+		for _, byDay := range r.ByDay {
+			first := 1 + (int(byDay.Weekday)-int(firstWeekday)+7)%7
+
+			var matching []int
+			for day := first; day <= daysInMonth; day += 7 {
+				matching = append(matching, day)
+			}
+
+			switch {
+			case byDay.Ordinal == 0:
+				days = append(days, matching...)
+			case byDay.Ordinal > 0 && byDay.Ordinal <= len(matching):
+				days = append(days, matching[byDay.Ordinal-1])
+			case byDay.Ordinal < 0 && -byDay.Ordinal <= len(matching):
+				days = append(days, matching[len(matching)+byDay.Ordinal])
+			}
+		}
+
+	default:
+		days = append(days, startDay)
+	}
+
+	sort.Ints(days)
+
+	valid := days[:0]
+	for i, day := range days {
+		if day < 1 || day > daysInMonth || (i > 0 && day == days[i-1]) {
+			continue
+		}
+		valid = append(valid, day)
+	}
+
+	return valid
+}
+
+func (r *Rule) onWeekday(weekday time.Weekday) bool {
+	for _, day := range r.ByDay {
+		if day.Weekday == weekday {
+			return true
+		}
+	}
+
+	return false
+}
+
+// weekdayOffset returns the number of days from the start of the week
+func (r *Rule) weekdayOffset(weekday time.Weekday) int {
+	return (int(weekday) - int(r.WeekStart) + 7) % 7
+}
+
+// daysBetween returns the number of calendar days from a to b, whatever
+// daylight saving changes are in between
+func daysBetween(a time.Time, b time.Time) int {
+	aDate := time.Date(a.Year(), a.Month(), a.Day(), 12, 0, 0, 0, time.UTC)
+	bDate := time.Date(b.Year(), b.Month(), b.Day(), 12, 0, 0, 0, time.UTC)
+	return int(bDate.Sub(aDate).Hours() / 24)
+}
+
+func parseInt(value string, min int, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if n < min || (max > 0 && n > max) {
+		return 0, errors.Errorf("%v is out of range", n)
+	}
+
+	return n, nil
+}
+
+func parseUntil(value string) (time.Time, bool, error) {
+	if until, err := time.Parse("20060102T150405Z", value); err == nil {
+		return until, false, nil
+	}
+
+	until, err := time.Parse("20060102", value)
+	if err != nil {
+		return time.Time{}, false, errors.Errorf("%v is neither a utc date time nor a date", value)
+	}
+
+	return until, true, nil
+}
+
+func parseByDay(value string) ([]WeekdayNum, error) {
+	var byDay []WeekdayNum
+	for _, day := range strings.Split(value, ",") {
+		if len(day) < 2 {
+			return nil, errors.Errorf("unknown weekday %v", day)
+		}
+
+		weekday, ok := weekdays[day[len(day)-2:]]
+		if !ok {
+			return nil, errors.Errorf("unknown weekday %v", day)
+		}
+
+		ordinal := 0
+		if prefix := day[:len(day)-2]; prefix != "" {
+			var err error
+			ordinal, err = strconv.Atoi(prefix)
+			if err != nil || ordinal == 0 || ordinal < -5 || ordinal > 5 {
+				return nil, errors.Errorf("invalid weekday ordinal %v", prefix)
+			}
+		}
+
+		byDay = append(byDay, WeekdayNum{Ordinal: ordinal, Weekday: weekday})
+	}
+
+	return byDay, nil
+}
+
+func parseByMonthDay(value string) ([]int, error) {
+	var byMonthDay []int
+	for _, day := range strings.Split(value, ",") {
+		monthDay, err := strconv.Atoi(day)
+		if err != nil || monthDay == 0 || monthDay < -31 || monthDay > 31 {
+			return nil, errors.Errorf("invalid month day %v", day)
+		}
+
+		byMonthDay = append(byMonthDay, monthDay)
+	}
+
+	return byMonthDay, nil
+}
+
+func cut(s string, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+
+	return s, "", false
+}
@@ -0,0 +1,209 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rule    string
+		wantErr bool
+	}{
+		{rule: "FREQ=DAILY"},
+		{rule: "RRULE:FREQ=WEEKLY;BYDAY=MO,FR;COUNT=10"},
+		{rule: "rrule:freq=monthly;byday=-1fr"},
+		{rule: "FREQ=MONTHLY;BYMONTHDAY=1,-1;UNTIL=20241231"},
+		{rule: "FREQ=DAILY;UNTIL=20241231T235959Z"},
+		{rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,SU;WKST=SU"},
+		{rule: "", wantErr: true},
+		{rule: "INTERVAL=2", wantErr: true},
+		{rule: "FREQ=YEARLY", wantErr: true},
+		{rule: "FREQ=DAILY;FREQ=WEEKLY", wantErr: true},
+		{rule: "FREQ=DAILY;INTERVAL=0", wantErr: true},
+		{rule: "FREQ=DAILY;INTERVAL=367", wantErr: true},
+		{rule: "FREQ=DAILY;COUNT=0", wantErr: true},
+		{rule: "FREQ=DAILY;COUNT=2;UNTIL=20241231", wantErr: true},
+		{rule: "FREQ=DAILY;UNTIL=2024-12-31", wantErr: true},
+		{rule: "FREQ=WEEKLY;BYDAY=XX", wantErr: true},
+		{rule: "FREQ=WEEKLY;BYDAY=1MO", wantErr: true},
+		{rule: "FREQ=MONTHLY;BYDAY=6MO", wantErr: true},
+		{rule: "FREQ=WEEKLY;BYMONTHDAY=1", wantErr: true},
+		{rule: "FREQ=MONTHLY;BYMONTHDAY=32", wantErr: true},
+		{rule: "FREQ=MONTHLY;BYMONTHDAY=1;BYDAY=MO", wantErr: true},
+		{rule: "FREQ=DAILY;WKST=XX", wantErr: true},
+		{rule: "FREQ=DAILY;BYHOUR=9", wantErr: true},
+		{rule: "FREQ=DAILY;COUNT", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rule, func(t *testing.T) {
+			_, err := Parse(test.rule)
+			if test.wantErr {
+				if errors.Cause(err) != ErrRecurrenceInvalidRule {
+					t.Errorf("Parse(%q) error = %v, want %v", test.rule, err, ErrRecurrenceInvalidRule)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Parse(%q) error = %v", test.rule, err)
+			}
+		})
+	}
+}
+
+func TestRuleNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("error loading time zone: %v", err)
+	}
+
+	date := func(year int, month time.Month, day int, location *time.Location) time.Time {
+		return time.Date(year, month, day, 9, 0, 0, 0, location)
+	}
+	// 2024-01-01 is a monday
+	utc := func(month time.Month, day int) time.Time {
+		return date(2024, month, day, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		after time.Time
+		// the occurrences following after, in order
+		want []time.Time
+		// whether the series ends after the occurrences wanted
+		ends bool
+	}{
+		{
+			name:  "daily",
+			rule:  "FREQ=DAILY",
+			start: utc(1, 1),
+			want:  []time.Time{utc(1, 2), utc(1, 3), utc(1, 4)},
+		},
+		{
+			name:  "daily from a later time",
+			rule:  "FREQ=DAILY",
+			start: utc(1, 1),
+			after: time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC),
+			want:  []time.Time{utc(6, 16), utc(6, 17)},
+		},
+		{
+			name:  "every third day",
+			rule:  "FREQ=DAILY;INTERVAL=3",
+			start: utc(1, 1),
+			want:  []time.Time{utc(1, 4), utc(1, 7), utc(1, 10)},
+		},
+		{
+			name:  "weekdays of a daily rule",
+			rule:  "FREQ=DAILY;BYDAY=SA,SU",
+			start: utc(1, 1),
+			want:  []time.Time{utc(1, 6), utc(1, 7), utc(1, 13)},
+		},
+		{
+			name:  "weekly on days",
+			rule:  "FREQ=WEEKLY;BYDAY=MO,FR",
+			start: utc(1, 1),
+			want:  []time.Time{utc(1, 5), utc(1, 8), utc(1, 12)},
+		},
+		{
+			name:  "every other week",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU",
+			start: utc(1, 1),
+			want:  []time.Time{utc(1, 2), utc(1, 16), utc(1, 30)},
+		},
+		// the WKST examples of RFC 5545
+		{
+			name:  "week starting on monday",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,SU;WKST=MO",
+			start: date(1997, 8, 5, newYork),
+			want:  []time.Time{date(1997, 8, 10, newYork), date(1997, 8, 19, newYork), date(1997, 8, 24, newYork)},
+		},
+		{
+			name:  "week starting on sunday",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,SU;WKST=SU",
+			start: date(1997, 8, 5, newYork),
+			want:  []time.Time{date(1997, 8, 17, newYork), date(1997, 8, 19, newYork), date(1997, 8, 31, newYork)},
+		},
+		{
+			name:  "monthly on the last day",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: utc(1, 1),
+			want:  []time.Time{utc(1, 31), utc(2, 29), utc(3, 31)},
+		},
+		{
+			name:  "monthly skipping months without the day",
+			rule:  "FREQ=MONTHLY",
+			start: utc(1, 31),
+			want:  []time.Time{utc(3, 31), utc(5, 31), utc(7, 31)},
+		},
+		{
+			name:  "monthly on the second tuesday",
+			rule:  "FREQ=MONTHLY;BYDAY=2TU",
+			start: utc(1, 1),
+			want:  []time.Time{utc(1, 9), utc(2, 13), utc(3, 12)},
+		},
+		{
+			name:  "monthly on the last friday",
+			rule:  "FREQ=MONTHLY;BYDAY=-1FR",
+			start: utc(1, 1),
+			want:  []time.Time{utc(1, 26), utc(2, 23), utc(3, 29)},
+		},
+		{
+			name:  "until a date including the day",
+			rule:  "FREQ=DAILY;UNTIL=20240103",
+			start: utc(1, 1),
+			want:  []time.Time{utc(1, 2), utc(1, 3)},
+			ends:  true,
+		},
+		{
+			name:  "until a time before the time of day",
+			rule:  "FREQ=DAILY;UNTIL=20240102T080000Z",
+			start: utc(1, 1),
+			ends:  true,
+		},
+		{
+			name:  "no month with the day",
+			rule:  "FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=30",
+			start: utc(2, 1),
+			ends:  true,
+		},
+		{
+			name:  "time of day kept across daylight saving",
+			rule:  "FREQ=DAILY",
+			start: date(2024, 3, 9, newYork),
+			want:  []time.Time{date(2024, 3, 10, newYork), date(2024, 3, 11, newYork)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule, err := Parse(test.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", test.rule, err)
+			}
+
+			after := test.after
+			if after.IsZero() {
+				after = test.start
+			}
+
+			for _, want := range test.want {
+				got, ok := rule.Next(test.start, after)
+				if !ok || !got.Equal(want) {
+					t.Fatalf("Next(%v, %v) = %v, %v, want %v", test.start, after, got, ok, want)
+				}
+				after = got
+			}
+
+			if got, ok := rule.Next(test.start, after); ok == test.ends {
+				t.Errorf("Next(%v, %v) = %v, %v, want the series to end: %v", test.start, after, got, ok,
+					test.ends)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package recurrence
+
+import (
+	"strings"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/pkg/errors"
+)
+
+// ErrRecurrence implements Error interface
+type ErrRecurrence string
+
+const (
+	ErrRecurrenceNoDueTime   ErrRecurrence = "error as a recurring task needs a due time"
+	ErrRecurrenceInvalidRule ErrRecurrence = "error as the recurrence rule is invalid"
+)
+
+func (e ErrRecurrence) Error() string {
+	return string(e)
+}
+
+// NormalizeRule returns the rule as stored, upper case without the RRULE:
+// prefix
+func NormalizeRule(rule string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+}
+
+// StartSeries makes the task, with the rule of its recurrence set, the
+// first occurrence of a new series. The rule is followed in the time zone,
+// or the utc offset of the due time when empty.
+func StartSeries(task *store.Task, seriesID string, timeZone string) error {
+	if task.DueAt == nil {
+		return ErrRecurrenceNoDueTime
+	}
+
+	rule := NormalizeRule(task.Recurrence.Rule)
+	_, err := Parse(rule)
+	if err != nil {
+		return err
+	}
+
+	start := *task.DueAt
+	if timeZone != "" {
+		location, err := time.LoadLocation(timeZone)
+		if err != nil {
+			return errors.Wrapf(err, "error loading time zone %v", timeZone)
+		}
+		start = start.In(location)
+	}
+
+	task.SeriesID = seriesID
+	task.Recurrence = &store.Recurrence{
+		Rule:       rule,
+		TimeZone:   timeZone,
+		Start:      start,
+		Occurrence: 1,
+		Slot:       start,
+	}
+	SetTemplate(task)
+
+	return nil
+}
+
+// SetTemplate makes the name, description, tags and reminder of the task
+// the ones of the occurrences to come
+func SetTemplate(task *store.Task) {
+	task.Recurrence.Name = task.Name
+	task.Recurrence.Description = task.Description
+	task.Recurrence.Tags = task.Tags
+	task.Recurrence.RemindBefore = nil
+
+	if task.RemindAt != nil && task.DueAt != nil {
+		remindBefore := int64(task.DueAt.Sub(*task.RemindAt).Seconds())
+		task.Recurrence.RemindBefore = &remindBefore
+	}
+}
+
+// NextOccurrence returns the occurrence of the series following the task,
+// in its project and under its parent, due at the next time of the rule
+// after the slot of the task. It returns nil when the series ends with the
+// task.
+func NextOccurrence(task store.Task, id string, now time.Time) (*store.Task, error) {
+	current := task.Recurrence
+	if current == nil {
+		return nil, nil
+	}
+
+	rule, err := Parse(current.Rule)
+	if err != nil {
+		return nil, err
+	}
+
+	if rule.Count > 0 && current.Occurrence >= rule.Count {
+		return nil, nil
+	}
+
+	start, err := inTimeZone(current.Start, current.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+
+	dueAt, ok := rule.Next(start, current.Slot)
+	if !ok {
+		return nil, nil
+	}
+
+	recurrence := *current
+	recurrence.Occurrence++
+	recurrence.Slot = dueAt
+	recurrence.NextTaskID = ""
+
+	next := store.Task{
+		ID:          id,
+		Name:        current.Name,
+		Description: current.Description,
+		Tags:        current.Tags,
+		ProjectID:   task.ProjectID,
+		ParentID:    task.ParentID,
+		DueAt:       &dueAt,
+		SeriesID:    task.SeriesID,
+		Recurrence:  &recurrence,
+	}
+
+	if current.RemindBefore != nil {
+		remindAt := dueAt.Add(-time.Duration(*current.RemindBefore) * time.Second)
+		next.RemindAt = &remindAt
+	}
+
+	next.Stamp(nil, now)
+
+	return &next, nil
+}
+
+func inTimeZone(t time.Time, timeZone string) (time.Time, error) {
+	if timeZone == "" {
+		return t, nil
+	}
+
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "error loading time zone %v", timeZone)
+	}
+
+	return t.In(location), nil
+}
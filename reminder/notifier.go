@@ -0,0 +1,133 @@
+package reminder
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Names of the notifiers
+const (
+	NotifierLog     = "log"
+	NotifierWebhook = "webhook"
+	NotifierInbox   = "inbox"
+
+	// WebhookSignatureHeader carries the hex encoded HMAC-SHA256 of the
+	// payload keyed with the webhook secret, when one is set
+	WebhookSignatureHeader = "X-Reminder-Signature-256"
+)
+
+// Notifier delivers reminders to users. A reminder may be delivered more
+// than once, notifications of the same id are the same reminder.
+type Notifier interface {
+	Notify(ctx context.Context, notification store.Notification) error
+}
+
+// Notifiers delivers reminders with every notifier, all of them are tried
+// even when one fails
+type Notifiers []Notifier
+
+func (n Notifiers) Notify(ctx context.Context, notification store.Notification) error {
+	var notifyErr error
+	for _, notifier := range n {
+		err := notifier.Notify(ctx, notification)
+		if err != nil && notifyErr == nil {
+			notifyErr = err
+		}
+	}
+
+	return notifyErr
+}
+
+// LogNotifier logs reminders, for setups with no other way to deliver them
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (l *LogNotifier) Notify(ctx context.Context, notification store.Notification) error {
+	log.Infof("reminder %v of user %v: %v", notification.ID, notification.UserID, notification.Title)
+	return nil
+}
+
+// WebhookNotifier posts reminders as JSON to a url
+type WebhookNotifier struct {
+	url        string
+	secret     string
+	httpClient *http.Client
+}
+
+// NewWebhookNotifier returns a notifier posting to the url, signing the
+// payload with the secret unless it is empty
+func NewWebhookNotifier(url string, secret string, timeoutInSec int32) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		secret: secret,
+		httpClient: &http.Client{
+			Timeout: time.Second * time.Duration(timeoutInSec),
+		},
+	}
+}
+
+func (wn *WebhookNotifier) Notify(ctx context.Context, notification store.Notification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling reminder webhook payload")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wn.url, bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrap(err, "error creating reminder webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if wn.secret != "" {
+		mac := hmac.New(sha256.New, []byte(wn.secret))
+		mac.Write(payload)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := wn.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error posting reminder webhook")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("error as reminder webhook responded with status %v", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// InboxNotifier keeps reminders in the inbox of the user, read with
+// GET /me/inbox
+type InboxNotifier struct {
+	inboxStore store.InboxStore
+}
+
+func NewInboxNotifier(inboxStore store.InboxStore) *InboxNotifier {
+	return &InboxNotifier{
+		inboxStore: inboxStore,
+	}
+}
+
+func (i *InboxNotifier) Notify(ctx context.Context, notification store.Notification) error {
+	err := i.inboxStore.AddNotification(ctx, notification)
+	if err != nil {
+		return errors.Wrap(err, "error adding reminder to inbox")
+	}
+
+	return nil
+}
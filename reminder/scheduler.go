@@ -0,0 +1,215 @@
+// Package reminder delivers the reminders of tasks when they are due.
+package reminder
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	taskstore "github.com/AjithPanneerselvam/task-etcd/store/task"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	electionName = "reminders"
+
+	// a reminder that still cannot be delivered this long after it was due
+	// is given up
+	maxDeliveryDelay = 24 * time.Hour
+	// a task is marked reminded in a few attempts unless it keeps changing
+	// meanwhile
+	maxMarkAttempts = 3
+)
+
+// Scheduler delivers the pending reminders of tasks as they fall due. Of
+// the instances running one, the leader of an election delivers them, and
+// another takes over when it goes away. Reminders are read from the store
+// on every poll, so those due while no instance was running are delivered
+// late rather than lost.
+type Scheduler struct {
+	taskStore    store.TaskStore
+	election     store.LeaderElection
+	notifier     Notifier
+	pollInterval time.Duration
+}
+
+// NewScheduler returns a scheduler looking for due reminders every poll
+// interval, and at the time of the next one when it is sooner
+func NewScheduler(taskStore store.TaskStore, election store.LeaderElection, notifier Notifier,
+	pollInterval time.Duration) *Scheduler {
+
+	return &Scheduler{
+		taskStore:    taskStore,
+		election:     election,
+		notifier:     notifier,
+		pollInterval: pollInterval,
+	}
+}
+
+// Run campaigns for the leadership and delivers reminders while leading,
+// until the context is done
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		leaderCtx, resign, err := s.election.Campaign(ctx, electionName)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Errorf("error campaigning to deliver reminders: %v", err)
+			if !sleep(ctx, s.pollInterval) {
+				return
+			}
+			continue
+		}
+		log.Info("delivering reminders as the leader")
+
+		s.dispatch(leaderCtx)
+		resign()
+
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn("reminder leadership lost, campaigning again")
+	}
+}
+
+// dispatch delivers reminders until the context is done
+func (s *Scheduler) dispatch(ctx context.Context) {
+	for {
+		next, err := s.DispatchDue(ctx, time.Now().UTC())
+		if err != nil {
+			log.Errorf("error delivering reminders: %v", err)
+		}
+
+		wait := s.pollInterval
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+
+		if !sleep(ctx, wait) {
+			return
+		}
+	}
+}
+
+// DispatchDue delivers the reminders due by now and returns when the next
+// one is due, zero when none is pending. A reminder failing to be delivered
+// is retried on the next call.
+func (s *Scheduler) DispatchDue(ctx context.Context, now time.Time) (time.Time, error) {
+	reminders, err := s.taskStore.ReadAllReminders(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, reminder := range reminders {
+		if reminder.RemindAt.After(now) {
+			return reminder.RemindAt, nil
+		}
+
+		if ctx.Err() != nil {
+			return time.Time{}, ctx.Err()
+		}
+
+		err = s.remind(ctx, reminder, now)
+		if err != nil {
+			log.Errorf("error delivering reminder of task %v of user %v: %v", reminder.TaskID, reminder.UserID,
+				err)
+		}
+	}
+
+	return time.Time{}, nil
+}
+
+// remind delivers the reminder unless the task was completed, and marks the
+// task reminded
+func (s *Scheduler) remind(ctx context.Context, reminder store.Reminder, now time.Time) error {
+	task, revision, err := s.taskStore.ReadTaskWithRevision(ctx, reminder.UserID, reminder.TaskID)
+	if errors.Cause(err) == taskstore.ErrTaskStoreNoRecord {
+		// deleted meanwhile, the reminder is deleted along
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// moved meanwhile, the index holds the new time
+	if !task.ReminderPending() || !task.RemindAt.Equal(reminder.RemindAt) {
+		return nil
+	}
+
+	if task.IsCompleted {
+		log.Debugf("reminder of completed task %v of user %v dropped", task.ID, reminder.UserID)
+	} else {
+		err = s.notifier.Notify(ctx, newNotification(reminder.UserID, *task, now))
+		if err != nil && now.Sub(reminder.RemindAt) < maxDeliveryDelay {
+			return err
+		}
+		if err != nil {
+			log.Errorf("error delivering reminder of task %v of user %v, given up: %v", task.ID, reminder.UserID,
+				err)
+		}
+	}
+
+	return s.markReminded(ctx, reminder, task, revision, now)
+}
+
+// markReminded records the reminder of the task as delivered, which drops
+// it from the index
+func (s *Scheduler) markReminded(ctx context.Context, reminder store.Reminder, task *store.Task, revision int64,
+	now time.Time) error {
+
+	for attempt := 0; attempt < maxMarkAttempts; attempt++ {
+		remindedAt := now
+		task.RemindedAt = &remindedAt
+
+		_, updated, err := s.taskStore.UpdateTaskAtRevision(ctx, reminder.UserID, *task, revision)
+		if err != nil || updated {
+			return err
+		}
+
+		task, revision, err = s.taskStore.ReadTaskWithRevision(ctx, reminder.UserID, reminder.TaskID)
+		if errors.Cause(err) == taskstore.ErrTaskStoreNoRecord {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if !task.ReminderPending() || !task.RemindAt.Equal(reminder.RemindAt) {
+			return nil
+		}
+	}
+
+	return errors.Errorf("error marking task %v reminded as it keeps changing", reminder.TaskID)
+}
+
+// newNotification returns the notification of the reminder of the task. Its
+// id is the same for every delivery of the reminder.
+func newNotification(userID string, task store.Task, now time.Time) store.Notification {
+	return store.Notification{
+		ID:        fmt.Sprintf("reminder-%v-%v", task.ID, task.RemindAt.Unix()),
+		UserID:    userID,
+		TaskID:    task.ID,
+		Title:     task.Name,
+		DueAt:     task.DueAt,
+		RemindAt:  task.RemindAt,
+		CreatedAt: now,
+	}
+}
+
+// sleep waits for the duration, reporting false when the context is done
+// first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
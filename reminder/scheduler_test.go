@@ -0,0 +1,343 @@
+package reminder
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	taskstore "github.com/AjithPanneerselvam/task-etcd/store/task"
+)
+
+const testUserID = "local:alice"
+
+// reminderTaskStore keeps the tasks of a user at revisions, indexing their
+// pending reminders like the task store. edit is applied to the task before
+// each of the first racingEdits updates, as an edit of the user racing the
+// update.
+type reminderTaskStore struct {
+	store.TaskStore
+
+	mu        sync.Mutex
+	tasks     map[string]store.Task
+	revisions map[string]int64
+	revision  int64
+
+	edit        func(task *store.Task)
+	racingEdits int
+	updates     int
+}
+
+func newReminderTaskStore(tasks ...store.Task) *reminderTaskStore {
+	r := &reminderTaskStore{
+		tasks:     make(map[string]store.Task),
+		revisions: make(map[string]int64),
+	}
+
+	for _, task := range tasks {
+		r.put(task)
+	}
+
+	return r
+}
+
+func (r *reminderTaskStore) put(task store.Task) {
+	r.revision++
+	r.tasks[task.ID] = task
+	r.revisions[task.ID] = r.revision
+}
+
+func (r *reminderTaskStore) ReadAllReminders(ctx context.Context) ([]store.Reminder, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var reminders []store.Reminder
+	for _, task := range r.tasks {
+		if task.ReminderPending() {
+			reminders = append(reminders, store.Reminder{UserID: testUserID, TaskID: task.ID,
+				RemindAt: *task.RemindAt})
+		}
+	}
+
+	sort.Slice(reminders, func(i, j int) bool {
+		return reminders[i].RemindAt.Before(reminders[j].RemindAt)
+	})
+
+	return reminders, nil
+}
+
+func (r *reminderTaskStore) ReadTaskWithRevision(ctx context.Context, userID string, taskID string) (*store.Task,
+	int64, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, ok := r.tasks[taskID]
+	if !ok {
+		return nil, 0, taskstore.ErrTaskStoreNoRecord
+	}
+
+	return &task, r.revisions[taskID], nil
+}
+
+func (r *reminderTaskStore) UpdateTaskAtRevision(ctx context.Context, userID string, task store.Task,
+	revision int64) (int64, bool, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.updates++
+	if r.updates <= r.racingEdits {
+		edited := r.tasks[task.ID]
+		r.edit(&edited)
+		r.put(edited)
+	}
+
+	if r.revisions[task.ID] != revision {
+		return 0, false, nil
+	}
+
+	r.put(task)
+	return r.revision, true, nil
+}
+
+// recordingNotifier records the notifications delivered, failing with err
+// when set
+type recordingNotifier struct {
+	mu            sync.Mutex
+	err           error
+	notifications []store.Notification
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, notification store.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	r.notifications = append(r.notifications, notification)
+	return nil
+}
+
+func (r *recordingNotifier) delivered() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.notifications)
+}
+
+func timeRef(t time.Time) *time.Time {
+	return &t
+}
+
+func TestDispatchDue(t *testing.T) {
+	now := time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	notifyErr := errors.New("error delivering notification")
+
+	testCases := []struct {
+		name          string
+		task          store.Task
+		notifyErr     error
+		edit          func(task *store.Task)
+		wantDelivered int
+		wantReminded  bool
+		wantNext      time.Time
+	}{
+		{
+			name:          "due reminder",
+			task:          store.Task{ID: "task", Name: "call mom", RemindAt: timeRef(now.Add(-time.Minute))},
+			wantDelivered: 1,
+			wantReminded:  true,
+		},
+		{
+			name:     "reminder to come",
+			task:     store.Task{ID: "task", Name: "call mom", RemindAt: timeRef(now.Add(time.Hour))},
+			wantNext: now.Add(time.Hour),
+		},
+		{
+			name: "reminder of completed task",
+			task: store.Task{ID: "task", Name: "call mom", RemindAt: timeRef(now.Add(-time.Minute)),
+				IsCompleted: true},
+			wantReminded: true,
+		},
+		{
+			name:      "reminder failing to be delivered",
+			task:      store.Task{ID: "task", Name: "call mom", RemindAt: timeRef(now.Add(-time.Minute))},
+			notifyErr: notifyErr,
+		},
+		{
+			name:         "reminder failing to be delivered for too long",
+			task:         store.Task{ID: "task", Name: "call mom", RemindAt: timeRef(now.Add(-maxDeliveryDelay))},
+			notifyErr:    notifyErr,
+			wantReminded: true,
+		},
+		{
+			name:          "task renamed while marked reminded",
+			task:          store.Task{ID: "task", Name: "call mom", RemindAt: timeRef(now.Add(-time.Minute))},
+			edit:          func(task *store.Task) { task.Name = "call mom back" },
+			wantDelivered: 1,
+			wantReminded:  true,
+		},
+		{
+			name: "reminder moved while marked reminded",
+			task: store.Task{ID: "task", Name: "call mom", RemindAt: timeRef(now.Add(-time.Minute))},
+			edit: func(task *store.Task) {
+				task.RemindAt = timeRef(now.Add(time.Hour))
+			},
+			wantDelivered: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			taskStore := newReminderTaskStore(tc.task)
+			if tc.edit != nil {
+				taskStore.edit, taskStore.racingEdits = tc.edit, 1
+			}
+			notifier := &recordingNotifier{err: tc.notifyErr}
+
+			scheduler := NewScheduler(taskStore, nil, notifier, time.Minute)
+
+			next, err := scheduler.DispatchDue(context.Background(), now)
+			if err != nil {
+				t.Fatalf("error dispatching reminders: %v", err)
+			}
+
+			if !next.Equal(tc.wantNext) {
+				t.Errorf("next reminder is due at %v, want %v", next, tc.wantNext)
+			}
+
+			if delivered := notifier.delivered(); delivered != tc.wantDelivered {
+				t.Errorf("%v reminders delivered, want %v", delivered, tc.wantDelivered)
+			}
+
+			task := taskStore.tasks["task"]
+			if reminded := task.RemindedAt != nil; reminded != tc.wantReminded {
+				t.Errorf("task reminded is %v, want %v", reminded, tc.wantReminded)
+			}
+
+			if tc.wantDelivered > 0 && notifier.notifications[0].ID != newNotification(testUserID, tc.task, now).ID {
+				t.Errorf("notification id is %v, want the one of the reminder", notifier.notifications[0].ID)
+			}
+		})
+	}
+}
+
+func TestDispatchDueOfDeletedTask(t *testing.T) {
+	taskStore := newReminderTaskStore()
+	notifier := &recordingNotifier{}
+
+	scheduler := NewScheduler(&deletedTaskStore{taskStore}, nil, notifier, time.Minute)
+
+	_, err := scheduler.DispatchDue(context.Background(), time.Now().UTC())
+	if err != nil {
+		t.Fatalf("error dispatching reminders: %v", err)
+	}
+
+	if delivered := notifier.delivered(); delivered != 0 {
+		t.Errorf("%v reminders of deleted task delivered, want 0", delivered)
+	}
+}
+
+// deletedTaskStore indexes a reminder of a task deleted since
+type deletedTaskStore struct {
+	*reminderTaskStore
+}
+
+func (d *deletedTaskStore) ReadAllReminders(ctx context.Context) ([]store.Reminder, error) {
+	return []store.Reminder{{UserID: testUserID, TaskID: "deleted", RemindAt: time.Now().UTC().Add(-time.Minute)}},
+		nil
+}
+
+// flakyElection elects the instance after failing the first campaigns with
+// err, and takes the leadership back after leaderFor. The campaign context
+// is cancelled on the last campaign.
+type flakyElection struct {
+	mu        sync.Mutex
+	err       error
+	failures  int
+	leaderFor time.Duration
+	campaigns int
+	resigns   int
+	last      int
+	cancel    context.CancelFunc
+}
+
+func (f *flakyElection) Campaign(ctx context.Context, name string) (context.Context, func(), error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.campaigns++
+	if f.campaigns <= f.failures {
+		return nil, nil, f.err
+	}
+
+	if f.campaigns == f.last {
+		f.cancel()
+		return nil, nil, ctx.Err()
+	}
+
+	leaderCtx, cancel := context.WithTimeout(ctx, f.leaderFor)
+	resign := func() {
+		cancel()
+
+		f.mu.Lock()
+		f.resigns++
+		f.mu.Unlock()
+	}
+
+	return leaderCtx, resign, nil
+}
+
+func TestRun(t *testing.T) {
+	taskStore := newReminderTaskStore(
+		store.Task{ID: "due", Name: "call mom", RemindAt: timeRef(time.Now().UTC().Add(-time.Minute))},
+		store.Task{ID: "later", Name: "water the plants", RemindAt: timeRef(time.Now().UTC().Add(time.Hour))},
+	)
+	notifier := &recordingNotifier{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a failed campaign, then two leaderships lost, then the instance stops
+	election := &flakyElection{
+		err:       errors.New("error reaching etcd"),
+		failures:  1,
+		leaderFor: 20 * time.Millisecond,
+		last:      4,
+		cancel:    cancel,
+	}
+
+	scheduler := NewScheduler(taskStore, election, notifier, time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		scheduler.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("scheduler still running once the context is done")
+	}
+
+	if election.campaigns != election.last {
+		t.Errorf("%v campaigns, want %v", election.campaigns, election.last)
+	}
+
+	if election.resigns != 2 {
+		t.Errorf("%v leaderships given up, want 2", election.resigns)
+	}
+
+	// the reminder is delivered once across leaderships, the later one not
+	// yet
+	if delivered := notifier.delivered(); delivered != 1 {
+		t.Errorf("%v reminders delivered, want 1", delivered)
+	}
+}
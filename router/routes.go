@@ -8,15 +8,27 @@ import (
 	"github.com/AjithPanneerselvam/task-etcd/auth"
 	"github.com/AjithPanneerselvam/task-etcd/client/github"
 	"github.com/AjithPanneerselvam/task-etcd/config"
+	"github.com/AjithPanneerselvam/task-etcd/db"
+	"github.com/AjithPanneerselvam/task-etcd/handler/account"
+	"github.com/AjithPanneerselvam/task-etcd/handler/admin"
+	"github.com/AjithPanneerselvam/task-etcd/handler/inbox"
+	"github.com/AjithPanneerselvam/task-etcd/handler/integration"
 	"github.com/AjithPanneerselvam/task-etcd/handler/login"
+	"github.com/AjithPanneerselvam/task-etcd/handler/project"
+	"github.com/AjithPanneerselvam/task-etcd/handler/session"
 	"github.com/AjithPanneerselvam/task-etcd/handler/task"
+	"github.com/AjithPanneerselvam/task-etcd/handler/token"
+	"github.com/AjithPanneerselvam/task-etcd/handler/user"
+	"github.com/AjithPanneerselvam/task-etcd/handler/webhook"
+	"github.com/AjithPanneerselvam/task-etcd/identity"
+	"github.com/AjithPanneerselvam/task-etcd/integration/githubsync"
 	"github.com/AjithPanneerselvam/task-etcd/store"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
 const (
-	GithubCallbackURLFormat       = "http://%s:%s/login/github/callback"
+	BaseURLFormat                 = "http://%s:%s"
 	LoginSuccessRedirectURLFormat = "http://%s:%s/home"
 )
 
@@ -24,49 +36,295 @@ type Router struct {
 	*chi.Mux
 }
 
+// Stores holds the stores the handlers are backed by
+type Stores struct {
+	Task       store.TaskStore
+	Project    store.ProjectStore
+	Workflow   store.WorkflowStore
+	OAuthState store.OAuthStateStore
+	Account    store.AccountStore
+	User       store.UserStore
+	Session    store.SessionStore
+	// nil when the github sync is disabled
+	Credential  store.CredentialStore
+	Integration store.IntegrationStore
+	TaskLink    store.TaskLinkStore
+	// nil unless the github webhook is enabled too
+	WebhookDelivery store.WebhookDeliveryStore
+	// nil unless reminders are delivered to the inbox
+	Inbox store.InboxStore
+}
+
 func NewRouter() *Router {
 	return &Router{
 		Mux: chi.NewRouter(),
 	}
 }
 
-func (r *Router) AddRoutes(config *config.Config, taskStore store.TaskStore) {
-	githubCallbackURL := fmt.Sprintf(GithubCallbackURLFormat, config.HostName, config.ListenPort)
+// AddRoutes adds the routes of the handlers. The github syncer is nil when
+// the github sync is disabled. It fails when the identity providers
+// configured cannot be told apart.
+func (r *Router) AddRoutes(config *config.Config, stores Stores, statusChecker *db.StatusChecker,
+	githubSyncer *githubsync.Syncer) error {
+
+	baseURL := fmt.Sprintf(BaseURLFormat, config.HostName, config.ListenPort)
 	loginSuccessRedirectURL := fmt.Sprintf(LoginSuccessRedirectURLFormat, config.HostName, config.ListenPort)
 
+	githubAccess := GithubAccess(config)
 	githubClient := github.New(config.GithubOAuthURL, config.GithubAPIURL, config.GithubClientID,
-		config.GithubClientSecret, config.GithubTimeoutInSec)
+		config.GithubClientSecret, githubAccess.Scopes(), config.GithubTimeoutInSec, config.GithubMaxRetries)
+
+	// only the logins connecting the github sync ask for its scopes
+	var githubSyncScopes []string
+	if githubSyncer != nil {
+		githubSyncScopes = config.GithubSyncScopes
+	}
+
+	jwtAuthenticator := auth.NewJWTAuth(config.JWTSecretyKey, time.Minute*time.Duration(config.JWTExpiryInMins),
+		config.SessionCookiesEnabled, config.SecureCookies, stores.Session)
 
-	jwtAuthenticator := auth.NewJWTAuth(config.JWTSecretyKey, time.Minute*time.Duration(config.JWTExpiryInMins))
+	providers := identityProviders(config, githubClient, githubAccess)
+	err := identity.ValidateProviders(providers)
+	if err != nil {
+		return err
+	}
 
-	githubLoginHandler := login.NewGithubLoginHandler(githubClient, githubCallbackURL,
-		jwtAuthenticator, loginSuccessRedirectURL)
-	taskHandler := task.NewTaskHandler(taskStore)
+	loginHandler := login.NewLoginHandler(providers, baseURL,
+		stores.OAuthState, time.Second*time.Duration(config.OAuthStateTTLInSecs), config.SecureCookies,
+		stores.User, stores.Session, stores.Credential, stores.Integration, githubSyncScopes,
+		config.AdminGithubLogins, config.AdminGithubIDs, jwtAuthenticator, loginSuccessRedirectURL)
+	accountHandler := account.NewAccountHandler(stores.Account, stores.User, stores.Session, jwtAuthenticator,
+		config.LocalOpenRegistration, config.LocalMaxFailedLogins, time.Minute*time.Duration(config.LocalLockoutInMins),
+		time.Minute*time.Duration(config.LocalResetTokenTTLInMins))
+	taskHandler := task.NewTaskHandler(stores.Task, stores.Project, stores.Workflow, config.SubtasksOnDelete,
+		config.SubtasksOnComplete)
+	projectHandler := project.NewProjectHandler(stores.Project)
+	userHandler := user.NewUserHandler(stores.User)
+	sessionHandler := session.NewSessionHandler(stores.Session)
+	adminHandler := admin.NewAdminHandler(stores.User, stores.Task, stores.Session, statusChecker)
+	tokenHandler := token.NewTokenHandler(jwtAuthenticator)
+	integrationHandler := integration.NewIntegrationHandler(stores.Integration, stores.Credential, stores.TaskLink,
+		githubSyncer)
+	inboxHandler := inbox.NewInboxHandler(stores.Inbox)
+	webhookHandler := webhook.NewWebhookHandler(config.GithubWebhookSecret, stores.WebhookDelivery,
+		time.Hour*time.Duration(config.GithubWebhookDeliveryTTLInHrs), githubSyncer)
 
 	r.Use(middleware.Logger)
 
-	r.Get("/", githubLoginHandler.Home)
+	r.Get("/", loginHandler.Home)
 
 	// login routes
 	r.Route("/login", func(r chi.Router) {
-		r.Get("/github", githubLoginHandler.Login)
-		r.Get("/github/callback", githubLoginHandler.Callback)
+		r.Get("/{provider}", loginHandler.Login)
+		r.Get("/{provider}/callback", loginHandler.Callback)
+
+		if config.LocalAccountsEnabled {
+			r.Post("/local", accountHandler.Login)
+		}
 	})
 
+	// local account routes
+	if config.LocalAccountsEnabled {
+		r.Route("/accounts", func(r chi.Router) {
+			r.Post("/register", accountHandler.Register)
+			r.Post("/password/reset", accountHandler.ResetPassword)
+
+			r.Group(func(r chi.Router) {
+				r.Use(jwtAuthenticator.Authenticator)
+				r.Use(userHandler.ProfileCtx)
+
+				// read-only tokens cannot change the credentials of the account
+				r.Group(func(r chi.Router) {
+					r.Use(jwtAuthenticator.RequireScope(auth.ScopeTasksWrite))
+
+					r.Put("/me/password", accountHandler.ChangePassword)
+					r.Post("/me/totp", accountHandler.EnrollTOTP)
+					r.Post("/me/totp/confirm", accountHandler.ConfirmTOTP)
+					r.Delete("/me/totp", accountHandler.DisableTOTP)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(jwtAuthenticator.RequireScope(auth.ScopeAdmin))
+
+					r.Post("/", accountHandler.CreateAccount)
+					r.Post("/{username}/reset-token", accountHandler.CreateResetToken)
+				})
+			})
+		})
+	}
+
+	// webhooks are authenticated by their signature
+	if githubSyncer != nil && config.GithubWebhookSecret != "" {
+		r.Post("/webhooks/github", webhookHandler.GithubWebhook)
+	}
+
 	// serve  static  sites
 	fileServer := http.FileServer(http.Dir("./static/"))
 	r.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
+	// web ui the browser lands on after login
+	r.Get("/home", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./static/index.html")
+	})
+
 	// task routes
 	r.Group(func(r chi.Router) {
 		r.Use(jwtAuthenticator.Authenticator)
+		r.Use(userHandler.ProfileCtx)
+
+		r.With(jwtAuthenticator.RequireScope(auth.ScopeTasksWrite)).
+			Post("/logout", loginHandler.Logout)
+
+		r.Route("/me", func(r chi.Router) {
+			r.Get("/", userHandler.GetMe)
+
+			r.Get("/sessions", sessionHandler.GetSessions)
+
+			r.Group(func(r chi.Router) {
+				r.Use(jwtAuthenticator.RequireScope(auth.ScopeTasksWrite))
+
+				r.Patch("/", userHandler.UpdateMe)
+				r.Delete("/sessions", sessionHandler.DeleteOtherSessions)
+				r.Delete("/sessions/{session-id}", sessionHandler.DeleteSession)
+			})
+
+			if stores.Inbox != nil {
+				r.Get("/inbox", inboxHandler.GetInbox)
+				r.With(jwtAuthenticator.RequireScope(auth.ScopeTasksWrite)).
+					Delete("/inbox/{notification-id}", inboxHandler.DeleteNotification)
+			}
+		})
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(jwtAuthenticator.RequireScope(auth.ScopeAdmin))
+			r.Use(user.RequireRole(store.RoleAdmin))
+
+			r.Get("/status", adminHandler.GetStatus)
+			r.Get("/users", adminHandler.GetUsers)
+			r.Get("/users/{user-id}", adminHandler.GetUser)
+			r.Post("/users/{user-id}/disable", adminHandler.DisableUser)
+			r.Post("/users/{user-id}/enable", adminHandler.EnableUser)
+			r.Post("/users/{user-id}/logout", adminHandler.LogoutUser)
+		})
+
+		if githubSyncer != nil {
+			r.Route("/integrations/github", func(r chi.Router) {
+				r.With(jwtAuthenticator.RequireScope(auth.ScopeTasksRead)).
+					Get("/", integrationHandler.GetGithubIntegration)
+				r.With(jwtAuthenticator.RequireScope(auth.ScopeTasksWrite)).
+					Put("/", integrationHandler.UpdateGithubIntegration)
+
+				r.With(jwtAuthenticator.RequireScope(auth.ScopeTasksWrite)).
+					Post("/sync", integrationHandler.SyncGithub)
+
+				// tasks exported to github issues, kept in sync both ways
+				r.Route("/links", func(r chi.Router) {
+					r.With(jwtAuthenticator.RequireScope(auth.ScopeTasksRead)).
+						Get("/", integrationHandler.GetGithubLinks)
+					r.With(jwtAuthenticator.RequireScope(auth.ScopeTasksRead)).
+						Get("/{task-id}", integrationHandler.GetGithubLink)
+
+					r.Group(func(r chi.Router) {
+						r.Use(jwtAuthenticator.RequireScope(auth.ScopeTasksWrite))
+
+						r.Post("/", integrationHandler.CreateGithubLink)
+						r.Delete("/{task-id}", integrationHandler.DeleteGithubLink)
+						r.Post("/{task-id}/resolve", integrationHandler.ResolveGithubLinkConflict)
+					})
+				})
+			})
+		}
+
+		// issues tokens restricted to a subset of the caller's scopes
+		r.Post("/token", tokenHandler.CreateToken)
 
 		r.Route("/task", func(r chi.Router) {
-			r.Post("/create", taskHandler.CreateTask)
-			r.Get("/get/{task-id}", taskHandler.GetTask)
-			r.Get("/get/all", taskHandler.GetAllTasks)
-			r.Delete("/delete/{task-id}", taskHandler.DeleteTask)
-			r.Put("/update/{task-id}", taskHandler.UpdateTask)
+			r.Group(func(r chi.Router) {
+				r.Use(jwtAuthenticator.RequireScope(auth.ScopeTasksRead))
+
+				r.Get("/get/{task-id}", taskHandler.GetTask)
+				r.Get("/get/all", taskHandler.GetAllTasks)
+				r.Get("/{task-id}/tree", taskHandler.GetTaskTree)
+				r.Get("/{task-id}/dependencies", taskHandler.GetDependencies)
+				r.Get("/next", taskHandler.GetNextTasks)
+				r.Get("/board", taskHandler.GetBoard)
+				r.Get("/workflow", taskHandler.GetWorkflow)
+				r.Get("/tags", taskHandler.GetTags)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(jwtAuthenticator.RequireScope(auth.ScopeTasksWrite))
+
+				r.Post("/create", taskHandler.CreateTask)
+				r.Delete("/delete/{task-id}", taskHandler.DeleteTask)
+				r.Put("/update/{task-id}", taskHandler.UpdateTask)
+				r.Post("/tags/rename", taskHandler.RenameTag)
+				r.Post("/move", taskHandler.MoveTasks)
+				r.Post("/{task-id}/dependencies", taskHandler.AddDependency)
+				r.Delete("/{task-id}/dependencies/{blocker-id}", taskHandler.DeleteDependency)
+				r.Put("/workflow", taskHandler.UpdateWorkflow)
+			})
+		})
+
+		r.Route("/projects", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(jwtAuthenticator.RequireScope(auth.ScopeTasksRead))
+
+				r.Get("/", projectHandler.GetProjects)
+				r.Get("/{project-id}", projectHandler.GetProject)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(jwtAuthenticator.RequireScope(auth.ScopeTasksWrite))
+
+				r.Post("/", projectHandler.CreateProject)
+				r.Put("/{project-id}", projectHandler.UpdateProject)
+				r.Delete("/{project-id}", projectHandler.DeleteProject)
+				r.Put("/{project-id}/workflow", projectHandler.UpdateProjectWorkflow)
+				r.Delete("/{project-id}/workflow", projectHandler.DeleteProjectWorkflow)
+			})
 		})
 	})
+
+	return nil
+}
+
+// identityProviders returns the identity providers configured
+func identityProviders(config *config.Config, githubClient *github.Client,
+	githubAccess identity.GithubAccess) []identity.Provider {
+
+	providers := make([]identity.Provider, 0)
+
+	if config.GithubClientID != "" {
+		providers = append(providers, identity.NewGithubProvider(githubClient, githubAccess))
+	}
+
+	if config.GitlabClientID != "" {
+		providers = append(providers, identity.NewGitlabProvider(config.GitlabURL, config.GitlabClientID,
+			config.GitlabClientSecret, config.GitlabTimeoutInSec))
+	}
+
+	if config.OIDCIssuerURL != "" {
+		oidcClaims := identity.OIDCClaims{
+			UserID:    config.OIDCUserIDClaim,
+			Login:     config.OIDCLoginClaim,
+			Name:      config.OIDCNameClaim,
+			Email:     config.OIDCEmailClaim,
+			AvatarURL: config.OIDCAvatarURLClaim,
+		}
+
+		providers = append(providers, identity.NewOIDCProvider(config.OIDCProviderName, config.OIDCIssuerURL,
+			config.OIDCClientID, config.OIDCClientSecret, config.OIDCScopes, oidcClaims, config.OIDCTimeoutInSec))
+	}
+
+	return providers
+}
+
+// GithubAccess returns the allow lists github logins are restricted to
+func GithubAccess(config *config.Config) identity.GithubAccess {
+	return identity.GithubAccess{
+		Orgs:   config.GithubAllowedOrgs,
+		Teams:  config.GithubAllowedTeams,
+		Logins: config.GithubAllowedLogins,
+	}
 }
@@ -0,0 +1,172 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyAccountFormat    = "account:%v"
+	keyResetTokenFormat = "account-reset:%v"
+
+	maxUpdateAttempts = 5
+)
+
+// ErrAccountStore implements Error interface
+type ErrAccountStore string
+
+const (
+	ErrAccountStoreNoRecord      ErrAccountStore = "error no account record"
+	ErrAccountStoreUsernameTaken ErrAccountStore = "error username is taken"
+	ErrAccountStoreNoResetToken  ErrAccountStore = "error no reset token record"
+	ErrAccountStoreConflict      ErrAccountStore = "error concurrent account updates"
+)
+
+func (e ErrAccountStore) Error() string {
+	return string(e)
+}
+
+type accountStore struct {
+	clientv3.KV
+	clientv3.Lease
+}
+
+func New(db *clientv3.Client) store.AccountStore {
+	return &accountStore{
+		KV:    db,
+		Lease: db,
+	}
+}
+
+func (a *accountStore) CreateAccount(ctx context.Context, account store.Account) error {
+	accountInBytes, err := json.Marshal(account)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling account")
+	}
+
+	key := fmt.Sprintf(keyAccountFormat, account.Username)
+
+	resp, err := a.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(accountInBytes))).
+		Commit()
+	if err != nil {
+		return errors.Wrap(err, "error creating account in the store")
+	}
+
+	if !resp.Succeeded {
+		return ErrAccountStoreUsernameTaken
+	}
+
+	return nil
+}
+
+func (a *accountStore) ReadAccount(ctx context.Context, username string) (*store.Account, error) {
+	account, _, err := a.read(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// UpdateAccount applies the change to the current account, retrying when the
+// account is changed concurrently, e.g. by a failed login on another
+// instance. The change is applied afresh on every attempt.
+func (a *accountStore) UpdateAccount(ctx context.Context, username string,
+	change func(account *store.Account) error) (*store.Account, error) {
+
+	key := fmt.Sprintf(keyAccountFormat, username)
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		account, modRevision, err := a.read(ctx, username)
+		if err != nil {
+			return nil, err
+		}
+
+		err = change(account)
+		if err != nil {
+			return nil, err
+		}
+
+		accountInBytes, err := json.Marshal(account)
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshalling account")
+		}
+
+		resp, err := a.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", modRevision)).
+			Then(clientv3.OpPut(key, string(accountInBytes))).
+			Commit()
+		if err != nil {
+			return nil, errors.Wrap(err, "error updating account in the store")
+		}
+
+		if resp.Succeeded {
+			return account, nil
+		}
+	}
+
+	return nil, ErrAccountStoreConflict
+}
+
+// read returns the account and its mod revision
+func (a *accountStore) read(ctx context.Context, username string) (*store.Account, int64, error) {
+	key := fmt.Sprintf(keyAccountFormat, username)
+
+	resp, err := a.Get(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(resp.Kvs) != 1 {
+		return nil, 0, ErrAccountStoreNoRecord
+	}
+
+	var account store.Account
+	err = json.Unmarshal(resp.Kvs[0].Value, &account)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error unmarshalling account from store")
+	}
+
+	return &account, resp.Kvs[0].ModRevision, nil
+}
+
+func (a *accountStore) CreateResetToken(ctx context.Context, tokenHash string, username string,
+	ttl time.Duration) error {
+
+	lease, err := a.Grant(ctx, int64(ttl.Seconds()))
+	if err != nil {
+		return errors.Wrap(err, "error granting lease for reset token")
+	}
+
+	key := fmt.Sprintf(keyResetTokenFormat, tokenHash)
+
+	_, err = a.Put(ctx, key, username, clientv3.WithLease(lease.ID))
+	if err != nil {
+		return errors.Wrap(err, "error creating reset token in the store")
+	}
+
+	return nil
+}
+
+func (a *accountStore) ConsumeResetToken(ctx context.Context, tokenHash string) (string, error) {
+	key := fmt.Sprintf(keyResetTokenFormat, tokenHash)
+
+	resp, err := a.Delete(ctx, key, clientv3.WithPrevKV())
+	if err != nil {
+		return "", errors.Wrap(err, "error deleting reset token from the store")
+	}
+
+	if len(resp.PrevKvs) != 1 {
+		return "", ErrAccountStoreNoResetToken
+	}
+
+	return string(resp.PrevKvs[0].Value), nil
+}
@@ -0,0 +1,86 @@
+package credential
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AjithPanneerselvam/task-etcd/auth"
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyCredentialFormat = "credential:%v:%v"
+)
+
+// ErrCredentialStore implements Error interface
+type ErrCredentialStore string
+
+const (
+	ErrCredentialStoreNoRecord ErrCredentialStore = "error no credential record"
+)
+
+func (e ErrCredentialStore) Error() string {
+	return string(e)
+}
+
+type credentialStore struct {
+	clientv3.KV
+	sealer *auth.Sealer
+}
+
+func New(db clientv3.KV, sealer *auth.Sealer) store.CredentialStore {
+	return &credentialStore{
+		KV:     db,
+		sealer: sealer,
+	}
+}
+
+func (c *credentialStore) SaveCredential(ctx context.Context, provider string, userID string, token string) error {
+	key := fmt.Sprintf(keyCredentialFormat, provider, userID)
+
+	// sealed to its key, a credential copied under another user fails to open
+	sealedToken, err := c.sealer.Seal([]byte(token), []byte(key))
+	if err != nil {
+		return errors.Wrap(err, "error sealing credential")
+	}
+
+	_, err = c.Put(ctx, key, sealedToken)
+	if err != nil {
+		return errors.Wrap(err, "error saving credential in the store")
+	}
+
+	return nil
+}
+
+func (c *credentialStore) ReadCredential(ctx context.Context, provider string, userID string) (string, error) {
+	key := fmt.Sprintf(keyCredentialFormat, provider, userID)
+
+	resp, err := c.Get(ctx, key)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading credential from the store")
+	}
+
+	if len(resp.Kvs) != 1 {
+		return "", ErrCredentialStoreNoRecord
+	}
+
+	token, err := c.sealer.Open(string(resp.Kvs[0].Value), []byte(key))
+	if err != nil {
+		return "", errors.Wrap(err, "error opening sealed credential")
+	}
+
+	return string(token), nil
+}
+
+func (c *credentialStore) DeleteCredential(ctx context.Context, provider string, userID string) error {
+	key := fmt.Sprintf(keyCredentialFormat, provider, userID)
+
+	_, err := c.Delete(ctx, key)
+	if err != nil {
+		return errors.Wrap(err, "error deleting credential from the store")
+	}
+
+	return nil
+}
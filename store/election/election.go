@@ -0,0 +1,71 @@
+package election
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyElectionFormat = "election:%v"
+)
+
+type leaderElection struct {
+	client *clientv3.Client
+	ttl    time.Duration
+}
+
+// New returns an election whose leader holds the leadership as long as it
+// keeps its session alive. A leader that dies loses it once the ttl passes.
+func New(db *clientv3.Client, ttl time.Duration) store.LeaderElection {
+	return &leaderElection{
+		client: db,
+		ttl:    ttl,
+	}
+}
+
+func (l *leaderElection) Campaign(ctx context.Context, name string) (context.Context, func(), error) {
+	session, err := concurrency.NewSession(l.client, concurrency.WithTTL(int(l.ttl.Seconds())),
+		concurrency.WithContext(ctx))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error creating election session")
+	}
+
+	hostname, _ := os.Hostname()
+	election := concurrency.NewElection(session, fmt.Sprintf(keyElectionFormat, name))
+
+	err = election.Campaign(ctx, hostname)
+	if err != nil {
+		session.Close()
+		return nil, nil, errors.Wrapf(err, "error campaigning for election %v", name)
+	}
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-session.Done():
+		case <-leaderCtx.Done():
+		}
+		cancel()
+	}()
+
+	resign := func() {
+		cancel()
+
+		// the campaign context may be done already, the leadership is given
+		// up regardless so that another instance takes over right away
+		resignCtx, resignCancel := context.WithTimeout(context.Background(), l.ttl)
+		defer resignCancel()
+
+		election.Resign(resignCtx)
+		session.Close()
+	}
+
+	return leaderCtx, resign, nil
+}
@@ -0,0 +1,83 @@
+package inbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyNotificationFormat = "inbox:%v:%v"
+	// the trailing separator keeps the inbox of user "1" apart from the one of user "12"
+	keyNotificationsFormat = "inbox:%v:"
+)
+
+type inboxStore struct {
+	clientv3.KV
+}
+
+func New(db clientv3.KV) store.InboxStore {
+	return &inboxStore{
+		db,
+	}
+}
+
+func (i *inboxStore) AddNotification(ctx context.Context, notification store.Notification) error {
+	notificationInBytes, err := json.Marshal(notification)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling notification")
+	}
+
+	key := fmt.Sprintf(keyNotificationFormat, notification.UserID, notification.ID)
+
+	_, err = i.Put(ctx, key, string(notificationInBytes))
+	if err != nil {
+		return errors.Wrap(err, "error storing notification")
+	}
+
+	return nil
+}
+
+// ReadAllNotifications returns the notifications of the user, the newest
+// first
+func (i *inboxStore) ReadAllNotifications(ctx context.Context, userID string) ([]store.Notification, error) {
+	key := fmt.Sprintf(keyNotificationsFormat, userID)
+
+	resp, err := i.Get(ctx, key, clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading notifications from the store")
+	}
+
+	notifications := make([]store.Notification, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var notification store.Notification
+		err = json.Unmarshal(kv.Value, &notification)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling notification %v from store", string(kv.Key))
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].CreatedAt.After(notifications[j].CreatedAt)
+	})
+
+	return notifications, nil
+}
+
+func (i *inboxStore) DeleteNotification(ctx context.Context, userID string, notificationID string) error {
+	key := fmt.Sprintf(keyNotificationFormat, userID, notificationID)
+
+	_, err := i.Delete(ctx, key)
+	if err != nil {
+		return errors.Wrap(err, "error deleting notification")
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyIntegrationFormat       = "integration:%v:%v"
+	keyIntegrationPrefixFormat = "integration:%v:"
+)
+
+// ErrIntegrationStore implements Error interface
+type ErrIntegrationStore string
+
+const (
+	ErrIntegrationStoreNoRecord ErrIntegrationStore = "error no integration record"
+)
+
+func (e ErrIntegrationStore) Error() string {
+	return string(e)
+}
+
+type integrationStore struct {
+	clientv3.KV
+}
+
+func New(db clientv3.KV) store.IntegrationStore {
+	return &integrationStore{
+		db,
+	}
+}
+
+func (i *integrationStore) UpsertState(ctx context.Context, state store.IntegrationState) error {
+	stateInBytes, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling integration state")
+	}
+
+	key := fmt.Sprintf(keyIntegrationFormat, state.Provider, state.UserID)
+
+	_, err = i.Put(ctx, key, string(stateInBytes))
+	if err != nil {
+		return errors.Wrap(err, "error storing integration state")
+	}
+
+	return nil
+}
+
+func (i *integrationStore) ReadState(ctx context.Context, provider string,
+	userID string) (*store.IntegrationState, error) {
+
+	key := fmt.Sprintf(keyIntegrationFormat, provider, userID)
+
+	resp, err := i.Get(ctx, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading integration state from the store")
+	}
+
+	if len(resp.Kvs) != 1 {
+		return nil, ErrIntegrationStoreNoRecord
+	}
+
+	var state store.IntegrationState
+	err = json.Unmarshal(resp.Kvs[0].Value, &state)
+	if err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling integration state from store")
+	}
+
+	return &state, nil
+}
+
+func (i *integrationStore) ReadAllStates(ctx context.Context, provider string) ([]store.IntegrationState, error) {
+	keyPrefix := fmt.Sprintf(keyIntegrationPrefixFormat, provider)
+
+	resp, err := i.Get(ctx, keyPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading integration states from the store")
+	}
+
+	states := make([]store.IntegrationState, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var state store.IntegrationState
+		err = json.Unmarshal(kv.Value, &state)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling integration state %v from store", string(kv.Key))
+		}
+
+		states = append(states, state)
+	}
+
+	return states, nil
+}
@@ -0,0 +1,57 @@
+package joblock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyJobLockFormat = "job-lock:%v"
+)
+
+type jobLock struct {
+	clientv3.KV
+	clientv3.Lease
+}
+
+func New(db *clientv3.Client) store.JobLock {
+	return &jobLock{
+		KV:    db,
+		Lease: db,
+	}
+}
+
+func (j *jobLock) TryLock(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	// the lock is never released, it expires with the lease so that the job
+	// runs at most once per ttl whichever instance wins
+	lease, err := j.Grant(ctx, int64(ttl.Seconds()))
+	if err != nil {
+		return false, errors.Wrap(err, "error granting lease for job lock")
+	}
+
+	key := fmt.Sprintf(keyJobLockFormat, name)
+	hostname, _ := os.Hostname()
+
+	resp, err := j.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, hostname, clientv3.WithLease(lease.ID))).
+		Commit()
+	if err != nil {
+		return false, errors.Wrap(err, "error taking job lock")
+	}
+
+	if !resp.Succeeded {
+		_, err = j.Revoke(ctx, lease.ID)
+		if err != nil {
+			return false, errors.Wrap(err, "error revoking unused job lock lease")
+		}
+	}
+
+	return resp.Succeeded, nil
+}
@@ -0,0 +1,84 @@
+package oauthstate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyOAuthStateFormat = "oauth-state:%v"
+)
+
+// ErrOAuthStateStore implements Error interface
+type ErrOAuthStateStore string
+
+const (
+	ErrOAuthStateStoreNoRecord ErrOAuthStateStore = "error no oauth state record"
+)
+
+func (e ErrOAuthStateStore) Error() string {
+	return string(e)
+}
+
+type oAuthStateStore struct {
+	clientv3.KV
+	clientv3.Lease
+}
+
+func New(db *clientv3.Client) store.OAuthStateStore {
+	return &oAuthStateStore{
+		KV:    db,
+		Lease: db,
+	}
+}
+
+func (o *oAuthStateStore) CreateState(ctx context.Context, state string, oAuthState store.OAuthState,
+	ttl time.Duration) error {
+
+	oAuthStateInBytes, err := json.Marshal(oAuthState)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling oauth state")
+	}
+
+	// the lease expires states of logins that are never completed
+	lease, err := o.Grant(ctx, int64(ttl.Seconds()))
+	if err != nil {
+		return errors.Wrap(err, "error granting lease for oauth state")
+	}
+
+	key := fmt.Sprintf(keyOAuthStateFormat, state)
+
+	_, err = o.Put(ctx, key, string(oAuthStateInBytes), clientv3.WithLease(lease.ID))
+	if err != nil {
+		return errors.Wrap(err, "error creating oauth state in the store")
+	}
+
+	return nil
+}
+
+func (o *oAuthStateStore) ConsumeState(ctx context.Context, state string) (*store.OAuthState, error) {
+	key := fmt.Sprintf(keyOAuthStateFormat, state)
+
+	resp, err := o.Delete(ctx, key, clientv3.WithPrevKV())
+	if err != nil {
+		return nil, errors.Wrap(err, "error deleting oauth state from the store")
+	}
+
+	if len(resp.PrevKvs) != 1 {
+		return nil, ErrOAuthStateStoreNoRecord
+	}
+
+	var oAuthState store.OAuthState
+	err = json.Unmarshal(resp.PrevKvs[0].Value, &oAuthState)
+	if err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling oauth state from store")
+	}
+
+	return &oAuthState, nil
+}
@@ -0,0 +1,172 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+const (
+	keySessionFormat       = "session:%v:%v"
+	keySessionPrefixFormat = "session:%v:"
+
+	// sessions are validated on every request, last seen is only written
+	// once per interval to keep the writes down
+	lastSeenInterval = time.Minute
+)
+
+// ErrSessionStore implements Error interface
+type ErrSessionStore string
+
+const (
+	ErrSessionStoreNoRecord ErrSessionStore = "error no session record"
+)
+
+func (e ErrSessionStore) Error() string {
+	return string(e)
+}
+
+type sessionStore struct {
+	clientv3.KV
+	clientv3.Lease
+}
+
+func New(db *clientv3.Client) store.SessionStore {
+	return &sessionStore{
+		KV:    db,
+		Lease: db,
+	}
+}
+
+func (s *sessionStore) CreateSession(ctx context.Context, session store.Session, ttl time.Duration) error {
+	sessionInBytes, err := json.Marshal(session)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling session")
+	}
+
+	// the lease expires the session along with the tokens issued on it
+	lease, err := s.Grant(ctx, int64(ttl.Seconds()))
+	if err != nil {
+		return errors.Wrap(err, "error granting lease for session")
+	}
+
+	key := fmt.Sprintf(keySessionFormat, session.UserID, session.ID)
+
+	_, err = s.Put(ctx, key, string(sessionInBytes), clientv3.WithLease(lease.ID))
+	if err != nil {
+		return errors.Wrap(err, "error creating session in the store")
+	}
+
+	return nil
+}
+
+func (s *sessionStore) ReadAllSessions(ctx context.Context, userID string) ([]store.Session, error) {
+	keyPrefix := fmt.Sprintf(keySessionPrefixFormat, userID)
+
+	resp, err := s.Get(ctx, keyPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading sessions from the store")
+	}
+
+	sessions := make([]store.Session, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var session store.Session
+		err = json.Unmarshal(kv.Value, &session)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling session %v from store", string(kv.Key))
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+func (s *sessionStore) DeleteSession(ctx context.Context, userID string, sessionID string) error {
+	key := fmt.Sprintf(keySessionFormat, userID, sessionID)
+
+	resp, err := s.Delete(ctx, key)
+	if err != nil {
+		return errors.Wrap(err, "error deleting session from the store")
+	}
+
+	if resp.Deleted == 0 {
+		return ErrSessionStoreNoRecord
+	}
+
+	return nil
+}
+
+func (s *sessionStore) DeleteOtherSessions(ctx context.Context, userID string, keepSessionID string) (int, error) {
+	keyPrefix := fmt.Sprintf(keySessionPrefixFormat, userID)
+	keepKey := fmt.Sprintf(keySessionFormat, userID, keepSessionID)
+
+	resp, err := s.Get(ctx, keyPrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return 0, errors.Wrap(err, "error reading sessions from the store")
+	}
+
+	var deleted int
+	for _, kv := range resp.Kvs {
+		if string(kv.Key) == keepKey {
+			continue
+		}
+
+		deleteResp, err := s.Delete(ctx, string(kv.Key))
+		if err != nil {
+			return deleted, errors.Wrap(err, "error deleting session from the store")
+		}
+		deleted += int(deleteResp.Deleted)
+	}
+
+	return deleted, nil
+}
+
+func (s *sessionStore) ValidateSession(ctx context.Context, userID string, sessionID string,
+	seenAt time.Time) (bool, error) {
+
+	key := fmt.Sprintf(keySessionFormat, userID, sessionID)
+
+	resp, err := s.Get(ctx, key)
+	if err != nil {
+		return false, errors.Wrap(err, "error reading session from the store")
+	}
+
+	if len(resp.Kvs) != 1 {
+		return false, nil
+	}
+
+	var session store.Session
+	err = json.Unmarshal(resp.Kvs[0].Value, &session)
+	if err != nil {
+		return false, errors.Wrap(err, "error unmarshalling session from store")
+	}
+
+	if seenAt.Sub(session.LastSeenAt) < lastSeenInterval {
+		return true, nil
+	}
+
+	session.LastSeenAt = seenAt
+
+	sessionInBytes, err := json.Marshal(session)
+	if err != nil {
+		return false, errors.Wrap(err, "error marshalling session")
+	}
+
+	// the compare keeps a session deleted in the meantime from being put
+	// back, losing the race to another instance's update is harmless
+	_, err = s.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", resp.Kvs[0].ModRevision)).
+		Then(clientv3.OpPut(key, string(sessionInBytes), clientv3.WithIgnoreLease())).
+		Commit()
+	if err != nil {
+		return false, errors.Wrap(err, "error updating session last seen")
+	}
+
+	return true, nil
+}
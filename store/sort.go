@@ -0,0 +1,60 @@
+package store
+
+import (
+	"sort"
+	"strings"
+)
+
+// Sort orders of task listings
+const (
+	TaskSortName      = "name"
+	TaskSortCompleted = "completed"
+	TaskSortCreated   = "created"
+	TaskSortUpdated   = "updated"
+	TaskSortDue       = "due"
+)
+
+var taskSortLess = map[string]func(a, b Task) bool{
+	TaskSortName: func(a, b Task) bool {
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	},
+	// open tasks first
+	TaskSortCompleted: func(a, b Task) bool {
+		return !a.IsCompleted && b.IsCompleted
+	},
+	// newest first
+	TaskSortCreated: func(a, b Task) bool {
+		return a.CreatedAt.After(b.CreatedAt)
+	},
+	// most recently updated first
+	TaskSortUpdated: func(a, b Task) bool {
+		return a.UpdatedAt.After(b.UpdatedAt)
+	},
+	// soonest due first, tasks without a due time last
+	TaskSortDue: func(a, b Task) bool {
+		if a.DueAt == nil || b.DueAt == nil {
+			return a.DueAt != nil && b.DueAt == nil
+		}
+
+		return a.DueAt.Before(*b.DueAt)
+	},
+}
+
+// IsValidTaskSort reports whether tasks can be sorted by the sort order
+func IsValidTaskSort(sortBy string) bool {
+	_, ok := taskSortLess[sortBy]
+	return ok
+}
+
+// SortTasks sorts the tasks in place by the sort order. Tasks are left in
+// store order for an unknown or empty sort order.
+func SortTasks(tasks []Task, sortBy string) {
+	less, ok := taskSortLess[sortBy]
+	if !ok {
+		return
+	}
+
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return less(tasks[i], tasks[j])
+	})
+}
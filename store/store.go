@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"time"
 )
 
 type Task struct {
@@ -9,11 +10,466 @@ type Task struct {
 	Name        string `json:"name"`
 	Description string `json:"description,omitempty"`
 	IsCompleted bool   `json:"isCompleted"`
+	// Status is the status of the task in the workflow of its project, or of
+	// the user. IsCompleted tells whether it is a terminal one.
+	Status string `json:"status,omitempty"`
+	// Tags are free-form labels, the tasks of a tag are listed through an
+	// index
+	Tags []string `json:"tags,omitempty"`
+	// ProjectID is the project the task is in, empty for the inbox
+	ProjectID string `json:"projectId,omitempty"`
+	// ParentID is the task this one is a subtask of
+	ParentID string `json:"parentId,omitempty"`
+	// BlockedBy are the tasks this one depends on, it is blocked while any
+	// of them is open
+	BlockedBy []string `json:"blockedBy,omitempty"`
+
+	// SourceURL links a task imported from elsewhere, e.g. a github issue,
+	// to its source
+	SourceURL string `json:"sourceUrl,omitempty"`
+
+	// maintained by the server with Stamp, values sent by clients are
+	// overwritten
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+
+	// DueAt and RemindAt are instants, sent along with their utc offset
+	DueAt    *time.Time `json:"dueAt,omitempty"`
+	RemindAt *time.Time `json:"remindAt,omitempty"`
+	// RemindedAt is set by the server once the reminder is delivered, and
+	// cleared by Stamp when the reminder is moved
+	RemindedAt *time.Time `json:"remindedAt,omitempty"`
+
+	// SeriesID links the occurrences of a recurring task
+	SeriesID   string      `json:"seriesId,omitempty"`
+	Recurrence *Recurrence `json:"recurrence,omitempty"`
+}
+
+// Recurrence repeats a task by a recurrence rule. The next occurrence is
+// created as the task is completed. Only the rule is set by clients, the
+// rest is maintained by the server.
+type Recurrence struct {
+	// Rule is an RFC 5545 RRULE, e.g. FREQ=WEEKLY;BYDAY=MO,FR;COUNT=10
+	Rule string `json:"rule"`
+	// TimeZone the rule is followed in, the due time's utc offset when empty
+	TimeZone string `json:"timeZone,omitempty"`
+	// Start is the due time of the first occurrence of the series
+	Start time.Time `json:"start"`
+	// Occurrence is the number of the occurrence in the series, from 1
+	Occurrence int `json:"occurrence"`
+	// Slot is the due time of the occurrence by the rule, kept when only
+	// this occurrence is moved
+	Slot time.Time `json:"slot"`
+
+	// the occurrences to come are created with these
+	Name         string   `json:"name"`
+	Description  string   `json:"description,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	RemindBefore *int64   `json:"remindBeforeSecs,omitempty"`
+
+	// NextTaskID is the occurrence created on completing this one
+	NextTaskID string `json:"nextTaskId,omitempty"`
+}
+
+// Stamp sets the timestamps of the task written at now over its previous
+// version, nil for a new task. A task completed again keeps the time it was
+// first completed at.
+func (t *Task) Stamp(previous *Task, now time.Time) {
+	t.CreatedAt = now
+	t.UpdatedAt = now
+	t.CompletedAt = nil
+	t.RemindedAt = nil
+
+	if previous != nil {
+		if !previous.CreatedAt.IsZero() {
+			t.CreatedAt = previous.CreatedAt
+		}
+
+		if t.IsCompleted && previous.IsCompleted {
+			t.CompletedAt = previous.CompletedAt
+		}
+
+		if sameTime(t.RemindAt, previous.RemindAt) {
+			t.RemindedAt = previous.RemindedAt
+		}
+	}
+
+	if t.IsCompleted && t.CompletedAt == nil {
+		completedAt := now
+		t.CompletedAt = &completedAt
+	}
+}
+
+// Overdue reports whether the task is still open past its due time
+func (t *Task) Overdue(now time.Time) bool {
+	return !t.IsCompleted && t.DueAt != nil && t.DueAt.Before(now)
+}
+
+// ReminderPending reports whether the reminder of the task is yet to be
+// delivered
+func (t *Task) ReminderPending() bool {
+	return t.RemindAt != nil && t.RemindedAt == nil
+}
+
+func sameTime(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
 }
 
 type TaskStore interface {
 	UpsertTask(ctx context.Context, userID string, task Task) error
 	ReadTask(ctx context.Context, userID string, taskID string) (*Task, error)
 	ReadAllTasks(ctx context.Context, userID string) ([]Task, error)
-	DeleteTask(ctx context.Context, userID string, taskID string) error
+	// DeleteTask deletes the task along with its subtasks when
+	// deleteSubtasks is set, otherwise its subtasks are moved up to its
+	// parent at now
+	DeleteTask(ctx context.Context, userID string, taskID string, deleteSubtasks bool, now time.Time) error
+	// CreateSourcedTask creates a task linked to its source unless a task
+	// was ever created from the source, reporting whether it did. Deleting
+	// the task keeps the link, so a deleted import is not created again.
+	CreateSourcedTask(ctx context.Context, userID string, task Task) (bool, error)
+	// ReadTaskIDBySource returns the id of the task created from the source
+	ReadTaskIDBySource(ctx context.Context, userID string, sourceURL string) (string, error)
+	// ReadSourcedTasks returns the tasks created from the source, of every user
+	ReadSourcedTasks(ctx context.Context, sourceURL string) ([]SourcedTask, error)
+	// ReadTaskWithRevision returns the task along with its revision, which
+	// changes on every update of the task
+	ReadTaskWithRevision(ctx context.Context, userID string, taskID string) (*Task, int64, error)
+	// UpdateTaskAtRevision updates the task unless it changed since the
+	// revision, returning the new revision and whether it did
+	UpdateTaskAtRevision(ctx context.Context, userID string, task Task, revision int64) (int64, bool, error)
+	// LinkTaskSource updates the task, linked to its source, unless it
+	// changed since the revision or another task was created from the source,
+	// reporting whether it did
+	LinkTaskSource(ctx context.Context, userID string, task Task, revision int64) (bool, error)
+	// ReadAllReminders returns the pending reminders of every user, the
+	// earliest first. A reminder is pending from the write of a task with a
+	// remind time until the write marking it reminded.
+	ReadAllReminders(ctx context.Context) ([]Reminder, error)
+	// WriteTasks writes the tasks together unless any changed since its
+	// revision, reporting whether it did, failing when there are more tasks
+	// than etcd allows in a transaction
+	WriteTasks(ctx context.Context, userID string, writes []TaskWrite) (bool, error)
+	// ReadTasksByTag returns the tasks of the user with the tag
+	ReadTasksByTag(ctx context.Context, userID string, tag string) ([]Task, error)
+	// ReadTagCounts returns the tags of the user with the number of tasks of
+	// each
+	ReadTagCounts(ctx context.Context, userID string) ([]TagCount, error)
+	// ReadTasksByProject returns the tasks of the user in the project
+	ReadTasksByProject(ctx context.Context, userID string, projectID string) ([]Task, error)
+	// ReadSubtasksWithRevision returns the subtasks of the task, and theirs
+	// down the hierarchy, along with their revisions
+	ReadSubtasksWithRevision(ctx context.Context, userID string, taskID string) ([]TaskWrite, error)
+	// WriteTasksWithSubtree writes the tasks together like WriteTasks, only
+	// while the subtasks of the task are the ones given at their revisions:
+	// none changed, was added or was removed
+	WriteTasksWithSubtree(ctx context.Context, userID string, writes []TaskWrite, taskID string,
+		subtasks []TaskWrite) (bool, error)
+	// ReadTasks returns the tasks of the ids, leaving out those that do not
+	// exist
+	ReadTasks(ctx context.Context, userID string, taskIDs []string) ([]Task, error)
+	// ReadDependentTasks returns the tasks blocked by the task
+	ReadDependentTasks(ctx context.Context, userID string, taskID string) ([]Task, error)
+}
+
+// Project groups tasks of a user, the tasks in none are in the inbox
+type Project struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Color    string `json:"color,omitempty"`
+	Archived bool   `json:"archived"`
+	// Order places the project among the projects of the user, the lowest
+	// first
+	Order int `json:"order"`
+	// Workflow is the workflow of the tasks in the project, the one of the
+	// user when nil
+	Workflow *Workflow `json:"workflow,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type ProjectStore interface {
+	CreateProject(ctx context.Context, userID string, project Project) error
+	ReadProject(ctx context.Context, userID string, projectID string) (*Project, error)
+	// ReadAllProjects returns the projects of the user in order
+	ReadAllProjects(ctx context.Context, userID string) ([]Project, error)
+	// UpdateProject replaces the project, failing if it was deleted
+	UpdateProject(ctx context.Context, userID string, project Project) error
+	// DeleteProject deletes the project together with its tasks, or moves
+	// them to the inbox at now unless deleteTasks is set, and returns the
+	// number of tasks deleted or moved. Subtasks of deleted tasks in other
+	// projects are moved up out of them. A project with more tasks than
+	// etcd allows in a transaction cannot be deleted.
+	DeleteProject(ctx context.Context, userID string, projectID string, deleteTasks bool,
+		now time.Time) (int, error)
+}
+
+type WorkflowStore interface {
+	// ReadWorkflow returns the workflow of the user, the default one until
+	// the user sets theirs
+	ReadWorkflow(ctx context.Context, userID string) (*Workflow, error)
+	UpsertWorkflow(ctx context.Context, userID string, workflow Workflow) error
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// TaskWrite is a task to be written at the revision it was read at, zero
+// for a task to be created
+type TaskWrite struct {
+	Task     Task
+	Revision int64
+}
+
+// Reminder is the pending reminder of a task
+type Reminder struct {
+	UserID   string    `json:"userId"`
+	TaskID   string    `json:"taskId"`
+	RemindAt time.Time `json:"remindAt"`
+}
+
+// SourcedTask is a task created from a source, such as a github issue
+type SourcedTask struct {
+	UserID string
+	TaskID string
+}
+
+// OAuthState is the server side half of an in-flight OAuth login
+type OAuthState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"codeVerifier"`
+	Nonce        string `json:"nonce,omitempty"`
+	// GithubSync is set on the github logins that connect the github sync,
+	// which ask for its scopes
+	GithubSync bool `json:"githubSync,omitempty"`
+}
+
+type OAuthStateStore interface {
+	CreateState(ctx context.Context, state string, oAuthState OAuthState, ttl time.Duration) error
+	// ConsumeState returns and deletes the state, so that a state can be used only once
+	ConsumeState(ctx context.Context, state string) (*OAuthState, error)
+}
+
+// Account is a local username and password account
+type Account struct {
+	Username     string   `json:"username"`
+	PasswordHash string   `json:"passwordHash"`
+	Scopes       []string `json:"scopes,omitempty"`
+
+	// TOTPSecret is set once a second factor is being enrolled, and only
+	// required at login once TOTPEnabled is confirmed
+	TOTPSecret   string `json:"totpSecret,omitempty"`
+	TOTPEnabled  bool   `json:"totpEnabled"`
+	LastTOTPStep int64  `json:"lastTotpStep,omitempty"`
+
+	FailedLogins int       `json:"failedLogins"`
+	LockedUntil  time.Time `json:"lockedUntil,omitempty"`
+
+	CreatedAt         time.Time `json:"createdAt"`
+	PasswordChangedAt time.Time `json:"passwordChangedAt"`
+}
+
+type AccountStore interface {
+	// CreateAccount creates the account, failing if the username is taken
+	CreateAccount(ctx context.Context, account Account) error
+	ReadAccount(ctx context.Context, username string) (*Account, error)
+	// UpdateAccount applies the change to the current account, retrying
+	// while it is changed concurrently. An error of the change is returned
+	// as is.
+	UpdateAccount(ctx context.Context, username string, change func(account *Account) error) (*Account, error)
+	// CreateResetToken stores a one-time password reset token by its hash
+	CreateResetToken(ctx context.Context, tokenHash string, username string, ttl time.Duration) error
+	// ConsumeResetToken returns the username of the token and deletes it
+	ConsumeResetToken(ctx context.Context, tokenHash string) (string, error)
+}
+
+// UserProfile is the profile of a user. The identity fields are refreshed
+// from the identity provider on every login, preferences are the user's own.
+type UserProfile struct {
+	UserID      string `json:"userId"`
+	Provider    string `json:"provider"`
+	Login       string `json:"login,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	Email       string `json:"email,omitempty"`
+	AvatarURL   string `json:"avatarUrl,omitempty"`
+
+	FirstSeenAt time.Time `json:"firstSeenAt"`
+	LastLoginAt time.Time `json:"lastLoginAt"`
+
+	Preferences UserPreferences `json:"preferences"`
+
+	// Roles are granted on login, from the configured admins or the scopes
+	// of a local account
+	Roles []string `json:"roles,omitempty"`
+
+	// a disabled user can neither log in nor use tokens issued earlier
+	Disabled   bool      `json:"disabled"`
+	DisabledAt time.Time `json:"disabledAt,omitempty"`
+}
+
+// Roles of users
+const (
+	RoleAdmin = "admin"
+)
+
+// HasRole reports whether the user has the role
+func (u *UserProfile) HasRole(role string) bool {
+	for _, userRole := range u.Roles {
+		if userRole == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+type UserPreferences struct {
+	TimeZone    string `json:"timeZone,omitempty"`
+	DefaultSort string `json:"defaultSort,omitempty"`
+}
+
+type UserStore interface {
+	// RecordLogin creates the profile on the first login and refreshes its
+	// identity fields, roles and last login time on later ones
+	RecordLogin(ctx context.Context, profile UserProfile) (*UserProfile, error)
+	ReadProfile(ctx context.Context, userID string) (*UserProfile, error)
+	ReadAllProfiles(ctx context.Context) ([]UserProfile, error)
+	UpdatePreferences(ctx context.Context, userID string, preferences UserPreferences) (*UserProfile, error)
+	SetDisabled(ctx context.Context, userID string, disabled bool, at time.Time) (*UserProfile, error)
+}
+
+// Session is a login of a user on a device. Every token issued on the login
+// carries the session id, so deleting the session revokes them.
+type Session struct {
+	ID        string `json:"id"`
+	UserID    string `json:"userId"`
+	UserAgent string `json:"userAgent,omitempty"`
+	IP        string `json:"ip,omitempty"`
+
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+}
+
+type SessionStore interface {
+	// CreateSession stores the session until the ttl, the lifetime of the
+	// tokens issued on it, passes
+	CreateSession(ctx context.Context, session Session, ttl time.Duration) error
+	ReadAllSessions(ctx context.Context, userID string) ([]Session, error)
+	DeleteSession(ctx context.Context, userID string, sessionID string) error
+	// DeleteOtherSessions deletes every session of the user but the given
+	// one and returns how many were deleted
+	DeleteOtherSessions(ctx context.Context, userID string, keepSessionID string) (int, error)
+	// ValidateSession reports whether the session is still active and
+	// records it as seen
+	ValidateSession(ctx context.Context, userID string, sessionID string, seenAt time.Time) (bool, error)
+}
+
+// JobLock elects one instance to run a periodic job
+type JobLock interface {
+	// TryLock takes the lock of the job for the ttl, reporting false when
+	// another instance holds it
+	TryLock(ctx context.Context, name string, ttl time.Duration) (bool, error)
+}
+
+// LeaderElection elects one instance, out of those campaigning, to run a
+// long running job
+type LeaderElection interface {
+	// Campaign blocks until the instance is elected leader of the election of
+	// the name. The returned context is done once the leadership is lost, and
+	// resign gives it up.
+	Campaign(ctx context.Context, name string) (leaderCtx context.Context, resign func(), err error)
+}
+
+// Notification is a message to a user, kept in their inbox until deleted
+type Notification struct {
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	TaskID string `json:"taskId,omitempty"`
+	Title  string `json:"title"`
+
+	DueAt     *time.Time `json:"dueAt,omitempty"`
+	RemindAt  *time.Time `json:"remindAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type InboxStore interface {
+	// AddNotification stores the notification, replacing the one of the same
+	// id so that a notification delivered again is kept once
+	AddNotification(ctx context.Context, notification Notification) error
+	ReadAllNotifications(ctx context.Context, userID string) ([]Notification, error)
+	DeleteNotification(ctx context.Context, userID string, notificationID string) error
+}
+
+// CredentialStore keeps third party access tokens of users, sealed at rest
+type CredentialStore interface {
+	SaveCredential(ctx context.Context, provider string, userID string, token string) error
+	ReadCredential(ctx context.Context, provider string, userID string) (string, error)
+	DeleteCredential(ctx context.Context, provider string, userID string) error
+}
+
+// IntegrationState is the state of an integration of a user with a third
+// party service
+type IntegrationState struct {
+	Provider string `json:"provider"`
+	UserID   string `json:"userId"`
+	Enabled  bool   `json:"enabled"`
+	// Repository is the owner/name repository tasks are exported to unless
+	// another one is chosen
+	Repository string `json:"repository,omitempty"`
+
+	LastSyncedAt  time.Time `json:"lastSyncedAt,omitempty"`
+	LastSyncError string    `json:"lastSyncError,omitempty"`
+	// Imported counts the tasks created by the integration
+	Imported int `json:"imported"`
+}
+
+type IntegrationStore interface {
+	UpsertState(ctx context.Context, state IntegrationState) error
+	ReadState(ctx context.Context, provider string, userID string) (*IntegrationState, error)
+	ReadAllStates(ctx context.Context, provider string) ([]IntegrationState, error)
+}
+
+// TaskLink links a task to the issue it is kept in sync with. The revisions
+// of both sides at the last sync tell which side changed since.
+type TaskLink struct {
+	UserID      string `json:"userId"`
+	TaskID      string `json:"taskId"`
+	Provider    string `json:"provider"`
+	Repository  string `json:"repository"`
+	IssueNumber int    `json:"issueNumber"`
+	IssueURL    string `json:"issueUrl"`
+
+	TaskRevision   int64     `json:"taskRevision"`
+	IssueUpdatedAt time.Time `json:"issueUpdatedAt"`
+
+	LastSyncedAt  time.Time `json:"lastSyncedAt,omitempty"`
+	LastSyncError string    `json:"lastSyncError,omitempty"`
+	// Conflict is set when both sides changed and the conflict is left to
+	// the user to resolve, the link is not synced until then
+	Conflict bool `json:"conflict"`
+}
+
+type TaskLinkStore interface {
+	UpsertLink(ctx context.Context, link TaskLink) error
+	ReadLink(ctx context.Context, userID string, taskID string) (*TaskLink, error)
+	ReadAllLinks(ctx context.Context, userID string) ([]TaskLink, error)
+	DeleteLink(ctx context.Context, userID string, taskID string) error
+}
+
+// WebhookDeliveryStore remembers the webhook deliveries received, so that a
+// redelivered event is handled once
+type WebhookDeliveryStore interface {
+	// RecordDelivery records the delivery for the ttl, reporting false when
+	// it was already recorded
+	RecordDelivery(ctx context.Context, provider string, deliveryID string, ttl time.Duration) (bool, error)
+	// DeleteDelivery forgets the delivery, so that it is handled when
+	// redelivered
+	DeleteDelivery(ctx context.Context, provider string, deliveryID string) error
 }
@@ -0,0 +1,175 @@
+package task
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+const (
+	// indexes the tasks blocked by a task, written along with the blocked
+	// task
+	keyTaskDependentFormat  = "task-dependent:%v:%v:%v"
+	keyTaskDependentsFormat = "task-dependent:%v:%v:"
+)
+
+// ErrTaskDependency implements Error interface
+type ErrTaskDependency string
+
+const (
+	ErrTaskDependencyNoTask ErrTaskDependency = "error as the blocking task does not exist"
+	ErrTaskDependencyCycle  ErrTaskDependency = "error as a task cannot be blocked by itself or by the tasks it blocks"
+)
+
+func (e ErrTaskDependency) Error() string {
+	return string(e)
+}
+
+func (t *taskStore) ReadTasks(ctx context.Context, userID string, taskIDs []string) ([]store.Task, error) {
+	taskWrites, err := t.readTasks(ctx, userID, taskIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading tasks from the store")
+	}
+
+	return tasksOf(taskWrites), nil
+}
+
+// ReadDependentTasks returns the tasks blocked by the task, read through the
+// dependent index
+func (t *taskStore) ReadDependentTasks(ctx context.Context, userID string, taskID string) ([]store.Task, error) {
+	dependentIDs, _, err := t.readIndexIDs(ctx, keyTaskDependentsFormat, userID, []string{taskID})
+	if err != nil {
+		return nil, err
+	}
+
+	taskWrites, err := t.readTasks(ctx, userID, dependentIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading dependent tasks from the store")
+	}
+
+	return tasksOf(taskWrites), nil
+}
+
+// dependencyCmps checks that the blockers newly added to the task exist and
+// do not depend on the task, directly or through other tasks, and returns
+// the compares holding while the tasks they depend on are unchanged. Tasks
+// written along with it are taken at their pending version.
+func (t *taskStore) dependencyCmps(ctx context.Context, userID string, task store.Task, blockerIDs []string,
+	pending map[string]store.Task) ([]clientv3.Cmp, error) {
+
+	var compares []clientv3.Cmp
+	visited := make(map[string]bool)
+
+	// the tasks blocking the new blockers are walked level by level, a
+	// cycle leads back to the task
+	level := blockerIDs
+	for first := true; len(level) > 0; first = false {
+		var next []string
+		var storedIDs []string
+		for _, blockerID := range level {
+			if blockerID == task.ID {
+				return nil, ErrTaskDependencyCycle
+			}
+
+			if visited[blockerID] {
+				continue
+			}
+			visited[blockerID] = true
+
+			if blocker, ok := pending[blockerID]; ok {
+				next = append(next, blocker.BlockedBy...)
+				continue
+			}
+			storedIDs = append(storedIDs, blockerID)
+		}
+
+		blockers, err := t.readTasks(ctx, userID, storedIDs)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading blocking tasks from the store")
+		}
+
+		if first && len(blockers) != len(storedIDs) {
+			return nil, ErrTaskDependencyNoTask
+		}
+
+		for _, blocker := range blockers {
+			key := fmt.Sprintf(keyTaskFormat, userID, blocker.Task.ID)
+			compares = append(compares, clientv3.Compare(clientv3.ModRevision(key), "=", blocker.Revision))
+			next = append(next, blocker.Task.BlockedBy...)
+		}
+
+		level = next
+	}
+
+	return compares, nil
+}
+
+// addedBlockers returns the tasks blocking the task that did not block its
+// previous version, nil for a task that is new
+func addedBlockers(previous *store.Task, task store.Task) []string {
+	previousBlockers := make(map[string]bool)
+	if previous != nil {
+		for _, blockerID := range previous.BlockedBy {
+			previousBlockers[blockerID] = true
+		}
+	}
+
+	var added []string
+	for _, blockerID := range task.BlockedBy {
+		if !previousBlockers[blockerID] {
+			added = append(added, blockerID)
+		}
+	}
+
+	return added
+}
+
+// withoutTasks returns the blockers that are not among the tasks
+func withoutTasks(blockerIDs []string, tasks map[string]store.Task) []string {
+	var kept []string
+	for _, blockerID := range blockerIDs {
+		if _, ok := tasks[blockerID]; !ok {
+			kept = append(kept, blockerID)
+		}
+	}
+
+	return kept
+}
+
+// dependencyOps returns the operations moving the entries of the task in the
+// dependent index from its previous blockers to its current ones, nil for a
+// task that is new or deleted
+func dependencyOps(userID string, previous *store.Task, task *store.Task) []clientv3.Op {
+	previousBlockers := make(map[string]bool)
+	if previous != nil {
+		for _, blockerID := range previous.BlockedBy {
+			previousBlockers[blockerID] = true
+		}
+	}
+
+	currentBlockers := make(map[string]bool)
+	if task != nil {
+		for _, blockerID := range task.BlockedBy {
+			currentBlockers[blockerID] = true
+		}
+	}
+
+	var ops []clientv3.Op
+	for blockerID := range previousBlockers {
+		if !currentBlockers[blockerID] {
+			ops = append(ops, clientv3.OpDelete(fmt.Sprintf(keyTaskDependentFormat, userID, blockerID,
+				previous.ID)))
+		}
+	}
+
+	for blockerID := range currentBlockers {
+		if !previousBlockers[blockerID] {
+			ops = append(ops, clientv3.OpPut(fmt.Sprintf(keyTaskDependentFormat, userID, blockerID, task.ID), ""))
+		}
+	}
+
+	return ops
+}
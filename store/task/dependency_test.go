@@ -0,0 +1,113 @@
+package task
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+)
+
+func TestDependencyCmps(t *testing.T) {
+	// a blocks b, which blocks c; d is on its own
+	tasks := []store.Task{
+		{ID: "a"},
+		{ID: "b", BlockedBy: []string{"a"}},
+		{ID: "c", BlockedBy: []string{"b"}},
+		{ID: "d"},
+	}
+
+	tests := []struct {
+		name       string
+		task       store.Task
+		blockerIDs []string
+		pending    []store.Task
+		wantErr    error
+		// the tasks whose change breaks the compares
+		guardedTasks []string
+	}{
+		{
+			name:         "blocker without blockers",
+			task:         store.Task{ID: "new"},
+			blockerIDs:   []string{"d"},
+			guardedTasks: []string{"d"},
+		},
+		{
+			name:         "blocker with blockers",
+			task:         store.Task{ID: "d"},
+			blockerIDs:   []string{"c"},
+			guardedTasks: []string{"a", "b", "c"},
+		},
+		{
+			name:         "blockers sharing blockers",
+			task:         store.Task{ID: "new"},
+			blockerIDs:   []string{"b", "c"},
+			guardedTasks: []string{"a", "b", "c"},
+		},
+		{
+			name:       "missing blocker",
+			task:       store.Task{ID: "d"},
+			blockerIDs: []string{"missing"},
+			wantErr:    ErrTaskDependencyNoTask,
+		},
+		{
+			name:       "blocked by itself",
+			task:       store.Task{ID: "a"},
+			blockerIDs: []string{"a"},
+			wantErr:    ErrTaskDependencyCycle,
+		},
+		{
+			name:       "blocked by a task it blocks",
+			task:       store.Task{ID: "a"},
+			blockerIDs: []string{"b"},
+			wantErr:    ErrTaskDependencyCycle,
+		},
+		{
+			name:       "blocked by a task it blocks through others",
+			task:       store.Task{ID: "a"},
+			blockerIDs: []string{"d", "c"},
+			wantErr:    ErrTaskDependencyCycle,
+		},
+		{
+			name:         "pending blocker",
+			task:         store.Task{ID: "d"},
+			blockerIDs:   []string{"pending"},
+			pending:      []store.Task{{ID: "pending", BlockedBy: []string{"b"}}},
+			guardedTasks: []string{"a", "b"},
+		},
+		{
+			name:       "pending blocker it blocks",
+			task:       store.Task{ID: "d"},
+			blockerIDs: []string{"pending"},
+			pending:    []store.Task{{ID: "pending", BlockedBy: []string{"d"}}},
+			wantErr:    ErrTaskDependencyCycle,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			taskStore, kv := newTestTaskStore(t, tasks...)
+
+			pending := make(map[string]store.Task)
+			for _, task := range test.pending {
+				pending[task.ID] = task
+			}
+
+			cmps := func() []clientv3.Cmp {
+				compares, err := taskStore.dependencyCmps(context.Background(), testUserID, test.task,
+					test.blockerIDs, pending)
+				if err != test.wantErr {
+					t.Fatalf("dependencyCmps() error = %v, want %v", err, test.wantErr)
+				}
+				return compares
+			}
+
+			if test.wantErr != nil {
+				cmps()
+				return
+			}
+
+			checkGuards(t, kv, cmps, test.guardedTasks, nil, "")
+		})
+	}
+}
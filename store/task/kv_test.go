@@ -0,0 +1,339 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	pb "github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// the default --max-txn-ops of etcd
+const memKVMaxTxnOps = 128
+
+type memKVEntry struct {
+	value          string
+	createRevision int64
+	modRevision    int64
+}
+
+// memKV is an in memory clientv3.KV keeping the revisions of keys like etcd
+// does, for tests of the store without an etcd server. Only the operations
+// and compares the store uses are supported.
+type memKV struct {
+	mu       sync.Mutex
+	entries  map[string]*memKVEntry
+	revision int64
+}
+
+func newMemKV() *memKV {
+	return &memKV{
+		entries:  make(map[string]*memKVEntry),
+		revision: 1,
+	}
+}
+
+func (m *memKV) Put(ctx context.Context, key string, value string, opts ...clientv3.OpOption) (*clientv3.PutResponse,
+	error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.apply([]clientv3.Op{clientv3.OpPut(key, value, opts...)})
+	return &clientv3.PutResponse{Header: m.header()}, nil
+}
+
+func (m *memKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.get(clientv3.OpGet(key, opts...)), nil
+}
+
+func (m *memKV) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse,
+	error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.apply([]clientv3.Op{clientv3.OpDelete(key, opts...)})
+	return &clientv3.DeleteResponse{Header: m.header()}, nil
+}
+
+func (m *memKV) Compact(ctx context.Context, rev int64, opts ...clientv3.CompactOption) (*clientv3.CompactResponse,
+	error) {
+
+	return &clientv3.CompactResponse{Header: m.header()}, nil
+}
+
+func (m *memKV) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	panic("memKV does not support Do")
+}
+
+func (m *memKV) Txn(ctx context.Context) clientv3.Txn {
+	return &memTxn{kv: m}
+}
+
+func (m *memKV) header() *pb.ResponseHeader {
+	return &pb.ResponseHeader{Revision: m.revision}
+}
+
+// keys returns the keys of the range in order, the key alone when the range
+// end is empty
+func (m *memKV) keys(key string, rangeEnd string) []string {
+	if rangeEnd == "" {
+		if _, ok := m.entries[key]; ok {
+			return []string{key}
+		}
+		return nil
+	}
+
+	var keys []string
+	for k := range m.entries {
+		if k >= key && (rangeEnd == "\x00" || k < rangeEnd) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (m *memKV) get(op clientv3.Op) *clientv3.GetResponse {
+	resp := &clientv3.GetResponse{Header: m.header()}
+	for _, key := range m.keys(string(op.KeyBytes()), string(op.RangeBytes())) {
+		entry := m.entries[key]
+		kv := &mvccpb.KeyValue{
+			Key:            []byte(key),
+			CreateRevision: entry.createRevision,
+			ModRevision:    entry.modRevision,
+		}
+		if !op.IsKeysOnly() {
+			kv.Value = []byte(entry.value)
+		}
+		resp.Kvs = append(resp.Kvs, kv)
+	}
+	resp.Count = int64(len(resp.Kvs))
+
+	return resp
+}
+
+// apply applies the operations at a single new revision, if any changes a key
+func (m *memKV) apply(ops []clientv3.Op) []*pb.ResponseOp {
+	responses := make([]*pb.ResponseOp, 0, len(ops))
+	revision := m.revision + 1
+	changed := false
+
+	for _, op := range ops {
+		switch {
+		case op.IsGet():
+			resp := m.get(op)
+			responses = append(responses, &pb.ResponseOp{
+				Response: &pb.ResponseOp_ResponseRange{ResponseRange: (*pb.RangeResponse)(resp)},
+			})
+
+		case op.IsPut():
+			key := string(op.KeyBytes())
+			entry, ok := m.entries[key]
+			if !ok {
+				entry = &memKVEntry{createRevision: revision}
+				m.entries[key] = entry
+			}
+			entry.value = string(op.ValueBytes())
+			entry.modRevision = revision
+			changed = true
+			responses = append(responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponsePut{}})
+
+		case op.IsDelete():
+			for _, key := range m.keys(string(op.KeyBytes()), string(op.RangeBytes())) {
+				delete(m.entries, key)
+				changed = true
+			}
+			responses = append(responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponseDeleteRange{}})
+		}
+	}
+
+	if changed {
+		m.revision = revision
+	}
+
+	return responses
+}
+
+type memTxn struct {
+	kv       *memKV
+	compares []clientv3.Cmp
+	thenOps  []clientv3.Op
+	elseOps  []clientv3.Op
+}
+
+func (t *memTxn) If(compares ...clientv3.Cmp) clientv3.Txn {
+	t.compares = compares
+	return t
+}
+
+func (t *memTxn) Then(ops ...clientv3.Op) clientv3.Txn {
+	t.thenOps = ops
+	return t
+}
+
+func (t *memTxn) Else(ops ...clientv3.Op) clientv3.Txn {
+	t.elseOps = ops
+	return t
+}
+
+// Commit rejects the transactions etcd rejects: too many compares or
+// operations, or a key written twice
+func (t *memTxn) Commit() (*clientv3.TxnResponse, error) {
+	t.kv.mu.Lock()
+	defer t.kv.mu.Unlock()
+
+	if len(t.compares) > memKVMaxTxnOps || len(t.thenOps) > memKVMaxTxnOps || len(t.elseOps) > memKVMaxTxnOps {
+		return nil, rpctypes.ErrTooManyOps
+	}
+
+	written := make(map[string]bool)
+	for _, op := range t.thenOps {
+		if !op.IsPut() && !op.IsDelete() {
+			continue
+		}
+
+		key := string(op.KeyBytes())
+		if written[key] {
+			return nil, rpctypes.ErrDuplicateKey
+		}
+		written[key] = true
+	}
+
+	succeeded := true
+	for _, compare := range t.compares {
+		succeeded = succeeded && t.kv.holds(compare)
+	}
+
+	ops := t.thenOps
+	if !succeeded {
+		ops = t.elseOps
+	}
+
+	responses := t.kv.apply(ops)
+
+	return &clientv3.TxnResponse{
+		Header:    t.kv.header(),
+		Succeeded: succeeded,
+		Responses: responses,
+	}, nil
+}
+
+// holds evaluates a revision compare, over every key of its range. A key
+// that does not exist is at revision 0.
+func (m *memKV) holds(compare clientv3.Cmp) bool {
+	entries := make([]memKVEntry, 0)
+	for _, key := range m.keys(string(compare.Key), string(compare.RangeEnd)) {
+		entries = append(entries, *m.entries[key])
+	}
+	if len(entries) == 0 {
+		entries = append(entries, memKVEntry{})
+	}
+
+	for _, entry := range entries {
+		var revision, target int64
+		switch compare.Target {
+		case pb.Compare_MOD:
+			revision, target = entry.modRevision, compare.TargetUnion.(*pb.Compare_ModRevision).ModRevision
+		case pb.Compare_CREATE:
+			revision, target = entry.createRevision, compare.TargetUnion.(*pb.Compare_CreateRevision).CreateRevision
+		default:
+			panic("memKV only supports revision compares")
+		}
+
+		var ok bool
+		switch compare.Result {
+		case pb.Compare_EQUAL:
+			ok = revision == target
+		case pb.Compare_NOT_EQUAL:
+			ok = revision != target
+		case pb.Compare_GREATER:
+			ok = revision > target
+		case pb.Compare_LESS:
+			ok = revision < target
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+const testUserID = "local:alice"
+
+// newTestTaskStore returns a task store over a memKV holding the tasks,
+// written in order
+func newTestTaskStore(t *testing.T, tasks ...store.Task) (*taskStore, *memKV) {
+	t.Helper()
+
+	kv := newMemKV()
+	taskStore := &taskStore{kv}
+
+	for _, task := range tasks {
+		err := taskStore.UpsertTask(context.Background(), testUserID, task)
+		if err != nil {
+			t.Fatalf("error writing task %v: %v", task.ID, err)
+		}
+	}
+
+	return taskStore, kv
+}
+
+// checkGuards checks that the compares returned by cmps hold until one of
+// the tasks guarded is changed, or a subtask or dependent task is added to
+// one of the tasks whose index is guarded
+func checkGuards(t *testing.T, kv *memKV, cmps func() []clientv3.Cmp, guardedTasks []string,
+	guardedIndexes []string, indexFormat string) {
+
+	t.Helper()
+
+	holds := func(compares []clientv3.Cmp) bool {
+		resp, err := kv.Txn(context.Background()).If(compares...).Commit()
+		if err != nil {
+			t.Fatalf("error evaluating compares: %v", err)
+		}
+		return resp.Succeeded
+	}
+
+	if !holds(cmps()) {
+		t.Fatalf("compares do not hold over unchanged tasks")
+	}
+
+	for _, taskID := range guardedTasks {
+		compares := cmps()
+
+		key := fmt.Sprintf(keyTaskFormat, testUserID, taskID)
+		resp, _ := kv.Get(context.Background(), key)
+		if len(resp.Kvs) != 1 {
+			t.Fatalf("error as task %v is not stored", taskID)
+		}
+		kv.Put(context.Background(), key, string(resp.Kvs[0].Value))
+
+		if holds(compares) {
+			t.Errorf("compares hold after task %v changed", taskID)
+		}
+	}
+
+	for _, taskID := range guardedIndexes {
+		compares := cmps()
+
+		kv.Put(context.Background(), fmt.Sprintf(indexFormat, testUserID, taskID, "added"), "")
+
+		if holds(compares) {
+			t.Errorf("compares hold after a task was added to the index of task %v", taskID)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	keyMigrationFormat = "migration:task:%v"
+	keyTaskPrefix      = "task:"
+
+	legacyUserIDProvider = "github"
+)
+
+type migration struct {
+	name string
+	run  func(ctx context.Context, db clientv3.KV) error
+}
+
+// migrations run in order, each one once per keyspace. A migration must be
+// safe to run concurrently from several instances.
+var migrations = []migration{
+	{name: "namespace-user-ids", run: namespaceUserIDs},
+	{name: "task-timestamps", run: backfillTimestamps},
+}
+
+// Migrate runs the task store migrations that have not run yet
+func Migrate(ctx context.Context, db clientv3.KV) error {
+	for _, m := range migrations {
+		key := fmt.Sprintf(keyMigrationFormat, m.name)
+
+		resp, err := db.Get(ctx, key, clientv3.WithCountOnly())
+		if err != nil {
+			return errors.Wrapf(err, "error reading migration %v status", m.name)
+		}
+
+		if resp.Count > 0 {
+			continue
+		}
+
+		log.Infof("running task store migration %v", m.name)
+
+		err = m.run(ctx, db)
+		if err != nil {
+			return errors.Wrapf(err, "error running migration %v", m.name)
+		}
+
+		_, err = db.Put(ctx, key, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			return errors.Wrapf(err, "error recording migration %v", m.name)
+		}
+	}
+
+	return nil
+}
+
+// namespaceUserIDs moves the tasks stored under raw github user ids, from
+// before user ids were namespaced by provider, to the github namespace
+func namespaceUserIDs(ctx context.Context, db clientv3.KV) error {
+	resp, err := db.Get(ctx, keyTaskPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return errors.Wrap(err, "error reading tasks")
+	}
+
+	moved := 0
+	for _, kv := range resp.Kvs {
+		parts := strings.Split(string(kv.Key), ":")
+		if len(parts) != 3 || !isNumeric(parts[1]) {
+			continue
+		}
+
+		userID := legacyUserIDProvider + ":" + parts[1]
+		newKey := fmt.Sprintf(keyTaskFormat, userID, parts[2])
+
+		// skip keys changed or already moved by a concurrent instance
+		txnResp, err := db.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(string(kv.Key)), "=", kv.ModRevision),
+				clientv3.Compare(clientv3.CreateRevision(newKey), "=", 0)).
+			Then(clientv3.OpPut(newKey, string(kv.Value)), clientv3.OpDelete(string(kv.Key))).
+			Commit()
+		if err != nil {
+			return errors.Wrapf(err, "error moving task %v", string(kv.Key))
+		}
+
+		if txnResp.Succeeded {
+			moved++
+		}
+	}
+
+	log.Infof("moved %v tasks to namespaced user ids", moved)
+
+	return nil
+}
+
+// backfillTimestamps sets the timestamps of the tasks written before tasks
+// had them, estimated from the revisions they were created and last updated
+// at. A completed task is taken to have been completed on its last update.
+func backfillTimestamps(ctx context.Context, db clientv3.KV) error {
+	clock, err := newRevisionClock(ctx, db)
+	if err != nil {
+		return errors.Wrap(err, "error reading revision times")
+	}
+
+	resp, err := db.Get(ctx, keyTaskPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return errors.Wrap(err, "error reading tasks")
+	}
+
+	backfilled := 0
+	for _, kv := range resp.Kvs {
+		var task store.Task
+		err = json.Unmarshal(kv.Value, &task)
+		if err != nil {
+			return errors.Wrapf(err, "error unmarshalling task %v", string(kv.Key))
+		}
+
+		if !task.CreatedAt.IsZero() {
+			continue
+		}
+
+		task.CreatedAt = clock.Time(kv.CreateRevision)
+		task.UpdatedAt = clock.Time(kv.ModRevision)
+		if task.IsCompleted {
+			completedAt := task.UpdatedAt
+			task.CompletedAt = &completedAt
+		}
+
+		taskInBytes, err := json.Marshal(task)
+		if err != nil {
+			return errors.Wrap(err, "error marshalling task")
+		}
+
+		// skip tasks changed meanwhile, they were stamped by the change
+		txnResp, err := db.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(string(kv.Key)), "=", kv.ModRevision)).
+			Then(clientv3.OpPut(string(kv.Key), string(taskInBytes))).
+			Commit()
+		if err != nil {
+			return errors.Wrapf(err, "error backfilling task %v", string(kv.Key))
+		}
+
+		if txnResp.Succeeded {
+			backfilled++
+		}
+	}
+
+	log.Infof("backfilled timestamps of %v tasks", backfilled)
+
+	return nil
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
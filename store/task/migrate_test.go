@@ -0,0 +1,103 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+)
+
+// snapshotTasks returns the stored tasks by key
+func snapshotTasks(t *testing.T, kv *memKV) map[string]memKVEntry {
+	t.Helper()
+
+	resp, err := kv.Get(context.Background(), keyTaskPrefix, clientv3.WithPrefix())
+	if err != nil {
+		t.Fatalf("error reading tasks: %v", err)
+	}
+
+	tasks := make(map[string]memKVEntry)
+	for _, entry := range resp.Kvs {
+		tasks[string(entry.Key)] = memKVEntry{
+			value:          string(entry.Value),
+			createRevision: entry.CreateRevision,
+			modRevision:    entry.ModRevision,
+		}
+	}
+
+	return tasks
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	kv := newMemKV()
+
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	kv.Put(ctx, "account:alice", `{"createdAt":"`+start.Format(time.RFC3339)+`"}`)
+
+	// a task of a raw github user id, written before tasks had timestamps
+	kv.Put(ctx, "task:42:legacy", `{"id":"legacy","name":"fix the build","isCompleted":true}`)
+	taskStore := &taskStore{kv}
+	err := taskStore.UpsertTask(ctx, testUserID, store.Task{ID: "current", Name: "ship it"})
+	if err != nil {
+		t.Fatalf("error writing task: %v", err)
+	}
+
+	err = Migrate(ctx, kv)
+	if err != nil {
+		t.Fatalf("error migrating: %v", err)
+	}
+
+	migrated := snapshotTasks(t, kv)
+
+	if _, ok := migrated["task:42:legacy"]; ok {
+		t.Errorf("task of raw user id is not moved")
+	}
+
+	entry, ok := migrated["task:github:42:legacy"]
+	if !ok {
+		t.Fatalf("task is not moved to the github namespace")
+	}
+
+	var task store.Task
+	err = json.Unmarshal([]byte(entry.value), &task)
+	if err != nil {
+		t.Fatalf("error unmarshalling task: %v", err)
+	}
+
+	if task.CreatedAt.IsZero() || task.CreatedAt.Before(start) {
+		t.Errorf("task created at %v, want after %v", task.CreatedAt, start)
+	}
+
+	if task.CompletedAt == nil || !task.CompletedAt.Equal(task.UpdatedAt) {
+		t.Errorf("task completed at %v, want at its update %v", task.CompletedAt, task.UpdatedAt)
+	}
+
+	revision := kv.revision
+
+	err = Migrate(ctx, kv)
+	if err != nil {
+		t.Fatalf("error migrating again: %v", err)
+	}
+
+	if kv.revision != revision {
+		t.Errorf("migrating again wrote to the store")
+	}
+
+	// migrations running again, as from an instance racing the record of
+	// the first run, leave the tasks as they are
+	for _, m := range migrations {
+		err = m.run(ctx, kv)
+		if err != nil {
+			t.Fatalf("error running migration %v again: %v", m.name, err)
+		}
+	}
+
+	if tasks := snapshotTasks(t, kv); !reflect.DeepEqual(tasks, migrated) {
+		t.Errorf("tasks are %v after migrating again, want %v", tasks, migrated)
+	}
+}
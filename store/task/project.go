@@ -0,0 +1,273 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyProjectFormat = "project:%v:%v"
+	// the trailing separator keeps the projects of user "1" apart from those of user "12"
+	keyProjectsFormat = "project:%v:"
+	// indexes the tasks of a user by project, written along with the task
+	keyProjectTaskFormat  = "task-project:%v:%v:%v"
+	keyProjectTasksFormat = "task-project:%v:%v:"
+)
+
+// NewProjectStore returns the store of projects. Projects are kept along
+// with the tasks, so that a project is deleted together with its tasks.
+func NewProjectStore(db clientv3.KV) store.ProjectStore {
+	return &taskStore{
+		db,
+	}
+}
+
+func (t *taskStore) CreateProject(ctx context.Context, userID string, project store.Project) error {
+	projectInBytes, err := json.Marshal(project)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling project")
+	}
+
+	key := fmt.Sprintf(keyProjectFormat, userID, project.ID)
+
+	resp, err := t.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(projectInBytes))).
+		Commit()
+	if err != nil {
+		return errors.Wrap(err, "error creating project in the store")
+	}
+
+	if !resp.Succeeded {
+		return errors.Errorf("error as project %v already exists", project.ID)
+	}
+
+	return nil
+}
+
+func (t *taskStore) ReadProject(ctx context.Context, userID string, projectID string) (*store.Project, error) {
+	resp, err := t.Get(ctx, fmt.Sprintf(keyProjectFormat, userID, projectID))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading project from the store")
+	}
+
+	if len(resp.Kvs) != 1 {
+		return nil, ErrTaskStoreNoProject
+	}
+
+	var project store.Project
+	err = json.Unmarshal(resp.Kvs[0].Value, &project)
+	if err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling project response from store")
+	}
+
+	return &project, nil
+}
+
+// ReadAllProjects returns the projects of the user by their order, then by
+// name
+func (t *taskStore) ReadAllProjects(ctx context.Context, userID string) ([]store.Project, error) {
+	resp, err := t.Get(ctx, fmt.Sprintf(keyProjectsFormat, userID), clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading projects from the store")
+	}
+
+	projects := make([]store.Project, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var project store.Project
+		err = json.Unmarshal(kv.Value, &project)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling project %v from store", string(kv.Key))
+		}
+
+		projects = append(projects, project)
+	}
+
+	sort.SliceStable(projects, func(i, j int) bool {
+		if projects[i].Order != projects[j].Order {
+			return projects[i].Order < projects[j].Order
+		}
+
+		return strings.ToLower(projects[i].Name) < strings.ToLower(projects[j].Name)
+	})
+
+	return projects, nil
+}
+
+func (t *taskStore) UpdateProject(ctx context.Context, userID string, project store.Project) error {
+	projectInBytes, err := json.Marshal(project)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling project")
+	}
+
+	key := fmt.Sprintf(keyProjectFormat, userID, project.ID)
+
+	// a project deleted meanwhile is not created again
+	resp, err := t.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), ">", 0)).
+		Then(clientv3.OpPut(key, string(projectInBytes))).
+		Commit()
+	if err != nil {
+		return errors.Wrap(err, "error updating project in the store")
+	}
+
+	if !resp.Succeeded {
+		return ErrTaskStoreNoProject
+	}
+
+	return nil
+}
+
+// DeleteProject deletes the project along with its tasks, or moves them to
+// the inbox, in a single transaction. The transaction is made only if
+// neither the project nor its tasks changed and no task was put in the
+// project since they were read. A project with more tasks than the
+// transaction holds fails with ErrTaskStoreTooManyTasks.
+func (t *taskStore) DeleteProject(ctx context.Context, userID string, projectID string, deleteTasks bool,
+	now time.Time) (int, error) {
+
+	projectKey := fmt.Sprintf(keyProjectFormat, userID, projectID)
+	prefix := fmt.Sprintf(keyProjectTasksFormat, userID, projectID)
+
+	for attempt := 0; attempt < maxWriteAttempts; attempt++ {
+		projectResp, err := t.Get(ctx, projectKey)
+		if err != nil {
+			return 0, errors.Wrap(err, "error reading project from the store")
+		}
+
+		if len(projectResp.Kvs) != 1 {
+			return 0, ErrTaskStoreNoProject
+		}
+
+		taskIDs, indexRevision, err := t.readProjectTaskIDs(ctx, userID, projectID)
+		if err != nil {
+			return 0, err
+		}
+
+		taskWrites, err := t.readTasks(ctx, userID, taskIDs)
+		if err != nil {
+			return 0, errors.Wrap(err, "error reading tasks of the project from the store")
+		}
+
+		compares := []clientv3.Cmp{
+			clientv3.Compare(clientv3.ModRevision(projectKey), "=", projectResp.Kvs[0].ModRevision),
+			// entries of the index are only put and deleted, so none was
+			// put since the read
+			clientv3.Compare(clientv3.ModRevision(prefix), "<", indexRevision+1).WithPrefix(),
+		}
+		ops := []clientv3.Op{clientv3.OpDelete(projectKey)}
+
+		if deleteTasks {
+			// subtasks in other projects are kept, moved up out of the
+			// deleted tasks
+			removeCmps, removeOps, err := t.removeTasksTxn(ctx, userID, taskWrites, now)
+			if err != nil {
+				return 0, err
+			}
+			compares = append(compares, removeCmps...)
+			ops = append(ops, removeOps...)
+		} else {
+			for _, taskWrite := range taskWrites {
+				previous := taskWrite.Task
+				key := fmt.Sprintf(keyTaskFormat, userID, previous.ID)
+				compares = append(compares, clientv3.Compare(clientv3.ModRevision(key), "=", taskWrite.Revision))
+
+				task := previous
+				task.ProjectID = ""
+				task.Stamp(&previous, now)
+
+				taskOps, err := putTaskOps(userID, &previous, task)
+				if err != nil {
+					return 0, err
+				}
+				ops = append(ops, taskOps...)
+			}
+		}
+
+		resp, err := t.Txn(ctx).If(compares...).Then(ops...).Commit()
+		if err != nil {
+			return 0, errors.Wrap(txnError(err), "error deleting project from the store")
+		}
+
+		if resp.Succeeded {
+			return len(taskWrites), nil
+		}
+	}
+
+	return 0, errors.Errorf("error deleting project %v as its tasks keep changing", projectID)
+}
+
+// ReadTasksByProject returns the tasks of the user in the project, read
+// through the project index
+func (t *taskStore) ReadTasksByProject(ctx context.Context, userID string, projectID string) ([]store.Task,
+	error) {
+
+	taskIDs, _, err := t.readProjectTaskIDs(ctx, userID, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	taskWrites, err := t.readTasks(ctx, userID, taskIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading tasks of the project from the store")
+	}
+
+	return tasksOf(taskWrites), nil
+}
+
+// readProjectTaskIDs returns the ids of the tasks in the project along with
+// the revision of the store they were read at
+func (t *taskStore) readProjectTaskIDs(ctx context.Context, userID string, projectID string) ([]string, int64,
+	error) {
+
+	prefix := fmt.Sprintf(keyProjectTasksFormat, userID, projectID)
+
+	resp, err := t.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error reading project index from the store")
+	}
+
+	taskIDs := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		taskIDs = append(taskIDs, strings.TrimPrefix(string(kv.Key), prefix))
+	}
+
+	return taskIDs, resp.Header.Revision, nil
+}
+
+// projectOps returns the operations moving the entry of the task in the
+// project index from its previous project to its current one, nil for a
+// task that is new or deleted
+func projectOps(userID string, previous *store.Task, task *store.Task) []clientv3.Op {
+	var previousProjectID, projectID string
+	if previous != nil {
+		previousProjectID = previous.ProjectID
+	}
+	if task != nil {
+		projectID = task.ProjectID
+	}
+
+	if previousProjectID == projectID {
+		return nil
+	}
+
+	var ops []clientv3.Op
+	if previousProjectID != "" {
+		ops = append(ops, clientv3.OpDelete(fmt.Sprintf(keyProjectTaskFormat, userID, previousProjectID,
+			previous.ID)))
+	}
+
+	if projectID != "" {
+		ops = append(ops, clientv3.OpPut(fmt.Sprintf(keyProjectTaskFormat, userID, projectID, task.ID), ""))
+	}
+
+	return ops
+}
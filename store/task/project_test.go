@@ -0,0 +1,215 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/pkg/errors"
+)
+
+// newTestProjectStore returns a task store over a memKV holding the projects,
+// each with the number of tasks given, every task with a pending reminder
+func newTestProjectStore(t *testing.T, projectTasks map[string]int) *taskStore {
+	t.Helper()
+
+	taskStore, _ := newTestTaskStore(t)
+	ctx := context.Background()
+	remindAt := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	for projectID, count := range projectTasks {
+		err := taskStore.CreateProject(ctx, testUserID, store.Project{ID: projectID, Name: projectID})
+		if err != nil {
+			t.Fatalf("error creating project %v: %v", projectID, err)
+		}
+
+		for i := 0; i < count; i++ {
+			task := store.Task{
+				ID:        fmt.Sprintf("%v-%d", projectID, i),
+				ProjectID: projectID,
+				RemindAt:  &remindAt,
+			}
+			err := taskStore.UpsertTask(ctx, testUserID, task)
+			if err != nil {
+				t.Fatalf("error writing task %v: %v", task.ID, err)
+			}
+		}
+	}
+
+	return taskStore
+}
+
+func TestWriteTasksMove(t *testing.T) {
+	// the most tasks the task handler moves at once
+	const movedTasks = 32
+
+	ctx := context.Background()
+	taskStore := newTestProjectStore(t, map[string]int{"from": movedTasks, "to": 0})
+
+	taskIDs := make([]string, 0, movedTasks)
+	for i := 0; i < movedTasks; i++ {
+		taskIDs = append(taskIDs, fmt.Sprintf("from-%d", i))
+	}
+
+	taskWrites, err := taskStore.readTasks(ctx, testUserID, taskIDs)
+	if err != nil {
+		t.Fatalf("error reading tasks: %v", err)
+	}
+
+	for i := range taskWrites {
+		taskWrites[i].Task.ProjectID = "to"
+	}
+
+	written, err := taskStore.WriteTasks(ctx, testUserID, taskWrites)
+	if err != nil {
+		t.Fatalf("error moving %v tasks: %v", movedTasks, err)
+	}
+
+	if !written {
+		t.Fatalf("%v unchanged tasks not moved", movedTasks)
+	}
+
+	tasks, err := taskStore.ReadTasksByProject(ctx, testUserID, "to")
+	if err != nil {
+		t.Fatalf("error reading tasks of project: %v", err)
+	}
+
+	if len(tasks) != movedTasks {
+		t.Errorf("project has %v tasks, want %v", len(tasks), movedTasks)
+	}
+}
+
+func TestDeleteProjectTaskCount(t *testing.T) {
+	testCases := []struct {
+		name        string
+		tasks       int
+		deleteTasks bool
+		wantErr     error
+	}{
+		{
+			name:  "tasks moved to the inbox",
+			tasks: 40,
+		},
+		{
+			name:        "tasks deleted",
+			tasks:       40,
+			deleteTasks: true,
+		},
+		{
+			name:    "too many tasks to move",
+			tasks:   100,
+			wantErr: ErrTaskStoreTooManyTasks,
+		},
+		{
+			name:        "too many tasks to delete",
+			tasks:       100,
+			deleteTasks: true,
+			wantErr:     ErrTaskStoreTooManyTasks,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			taskStore := newTestProjectStore(t, map[string]int{"project": tc.tasks})
+
+			count, err := taskStore.DeleteProject(ctx, testUserID, "project", tc.deleteTasks, time.Now().UTC())
+			if errors.Cause(err) != tc.wantErr {
+				t.Fatalf("error deleting project is %v, want %v", err, tc.wantErr)
+			}
+
+			_, readErr := taskStore.ReadProject(ctx, testUserID, "project")
+
+			if tc.wantErr != nil {
+				if readErr != nil {
+					t.Errorf("error reading project left as it was: %v", readErr)
+				}
+				return
+			}
+
+			if count != tc.tasks {
+				t.Errorf("%v tasks deleted or moved, want %v", count, tc.tasks)
+			}
+
+			if errors.Cause(readErr) != ErrTaskStoreNoProject {
+				t.Errorf("error reading deleted project is %v, want %v", readErr, ErrTaskStoreNoProject)
+			}
+		})
+	}
+}
+
+func TestPutTaskOpsReminder(t *testing.T) {
+	remindAt := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	remindedAt := remindAt.Add(time.Minute)
+
+	testCases := []struct {
+		name       string
+		previous   *store.Task
+		task       store.Task
+		wantPut    bool
+		wantDelete bool
+	}{
+		{
+			name: "new task without reminder",
+			task: store.Task{ID: "task"},
+		},
+		{
+			name:    "new task with reminder",
+			task:    store.Task{ID: "task", RemindAt: &remindAt},
+			wantPut: true,
+		},
+		{
+			name:     "task without reminder",
+			previous: &store.Task{ID: "task"},
+			task:     store.Task{ID: "task", Name: "renamed"},
+		},
+		{
+			name:     "task with reminder",
+			previous: &store.Task{ID: "task", RemindAt: &remindAt},
+			task:     store.Task{ID: "task", Name: "renamed", RemindAt: &remindAt},
+			wantPut:  true,
+		},
+		{
+			name:       "task reminded",
+			previous:   &store.Task{ID: "task", RemindAt: &remindAt},
+			task:       store.Task{ID: "task", RemindAt: &remindAt, RemindedAt: &remindedAt},
+			wantDelete: true,
+		},
+		{
+			name:       "task reminder removed",
+			previous:   &store.Task{ID: "task", RemindAt: &remindAt},
+			task:       store.Task{ID: "task"},
+			wantDelete: true,
+		},
+	}
+
+	reminderKey := fmt.Sprintf(keyTaskReminderFormat, testUserID, "task")
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ops, err := putTaskOps(testUserID, tc.previous, tc.task)
+			if err != nil {
+				t.Fatalf("error building operations: %v", err)
+			}
+
+			var put, deleted bool
+			for _, op := range ops {
+				if string(op.KeyBytes()) != reminderKey {
+					continue
+				}
+				put = put || op.IsPut()
+				deleted = deleted || op.IsDelete()
+			}
+
+			if put != tc.wantPut {
+				t.Errorf("reminder put is %v, want %v", put, tc.wantPut)
+			}
+
+			if deleted != tc.wantDelete {
+				t.Errorf("reminder deleted is %v, want %v", deleted, tc.wantDelete)
+			}
+		})
+	}
+}
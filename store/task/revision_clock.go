@@ -0,0 +1,135 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+// revisionAnchor is a revision of the store known to have been written at a
+// time
+type revisionAnchor struct {
+	revision int64
+	at       time.Time
+}
+
+// revisionClock estimates when a revision of the store was written. etcd
+// keeps no time per revision, so the times are interpolated between the
+// revisions of records that hold the time they were written at.
+type revisionClock struct {
+	anchors []revisionAnchor
+}
+
+// timestampedRecords are the records the times of revisions are read from:
+// the key prefix, the revision of a record the time is of and how to read
+// the time from its value
+var timestampedRecords = []struct {
+	prefix   string
+	revision func(createRevision int64, modRevision int64) int64
+	readTime func(value []byte) (time.Time, error)
+}{
+	{"migration:", modRevision, readRFC3339},
+	{"webhook-delivery:", createRevision, readRFC3339},
+	{"user:", createRevision, readJSONTime("firstSeenAt")},
+	{"account:", createRevision, readJSONTime("createdAt")},
+	{"session:", createRevision, readJSONTime("createdAt")},
+}
+
+// newRevisionClock reads the anchors of the clock from the store, the
+// current revision being written now
+func newRevisionClock(ctx context.Context, db clientv3.KV) (*revisionClock, error) {
+	var anchors []revisionAnchor
+	var currentRevision int64
+	now := time.Now().UTC()
+
+	for _, record := range timestampedRecords {
+		resp, err := db.Get(ctx, record.prefix, clientv3.WithPrefix())
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %v records", record.prefix)
+		}
+		currentRevision = resp.Header.Revision
+
+		for _, kv := range resp.Kvs {
+			at, err := record.readTime(kv.Value)
+			if err != nil || at.IsZero() || at.After(now) {
+				continue
+			}
+
+			anchors = append(anchors, revisionAnchor{
+				revision: record.revision(kv.CreateRevision, kv.ModRevision),
+				at:       at,
+			})
+		}
+	}
+
+	anchors = append(anchors, revisionAnchor{revision: currentRevision, at: now})
+
+	sort.Slice(anchors, func(i, j int) bool {
+		return anchors[i].revision < anchors[j].revision
+	})
+
+	// time only moves forward, anchors contradicting earlier ones are
+	// dropped as clock skew
+	monotonic := anchors[:0]
+	for _, anchor := range anchors {
+		if len(monotonic) > 0 && anchor.at.Before(monotonic[len(monotonic)-1].at) {
+			continue
+		}
+		monotonic = append(monotonic, anchor)
+	}
+
+	return &revisionClock{anchors: monotonic}, nil
+}
+
+// Time estimates when the revision was written. Revisions before the first
+// anchor are given its time.
+func (c *revisionClock) Time(revision int64) time.Time {
+	index := sort.Search(len(c.anchors), func(i int) bool {
+		return c.anchors[i].revision >= revision
+	})
+
+	switch {
+	case index == 0:
+		return c.anchors[0].at
+	case index == len(c.anchors):
+		return c.anchors[len(c.anchors)-1].at
+	}
+
+	before, after := c.anchors[index-1], c.anchors[index]
+	if after.revision == revision {
+		return after.at
+	}
+
+	fraction := float64(revision-before.revision) / float64(after.revision-before.revision)
+	return before.at.Add(time.Duration(fraction * float64(after.at.Sub(before.at)))).UTC()
+}
+
+func createRevision(createRevision int64, _ int64) int64 {
+	return createRevision
+}
+
+func modRevision(_ int64, modRevision int64) int64 {
+	return modRevision
+}
+
+func readRFC3339(value []byte) (time.Time, error) {
+	return time.Parse(time.RFC3339, string(value))
+}
+
+func readJSONTime(field string) func(value []byte) (time.Time, error) {
+	return func(value []byte) (time.Time, error) {
+		var fields map[string]json.RawMessage
+		err := json.Unmarshal(value, &fields)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		var at time.Time
+		err = json.Unmarshal(fields[field], &at)
+		return at, err
+	}
+}
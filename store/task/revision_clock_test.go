@@ -0,0 +1,76 @@
+package task
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRevisionClockTime(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &revisionClock{anchors: []revisionAnchor{
+		{revision: 10, at: start},
+		{revision: 20, at: start.Add(100 * time.Second)},
+		{revision: 40, at: start.Add(300 * time.Second)},
+	}}
+
+	testCases := []struct {
+		name     string
+		revision int64
+		want     time.Time
+	}{
+		{name: "before the first anchor", revision: 3, want: start},
+		{name: "at the first anchor", revision: 10, want: start},
+		{name: "between anchors", revision: 15, want: start.Add(50 * time.Second)},
+		{name: "at an anchor", revision: 20, want: start.Add(100 * time.Second)},
+		{name: "between later anchors", revision: 35, want: start.Add(250 * time.Second)},
+		{name: "at the last anchor", revision: 40, want: start.Add(300 * time.Second)},
+		{name: "past the last anchor", revision: 90, want: start.Add(300 * time.Second)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := clock.Time(tc.revision); !got.Equal(tc.want) {
+				t.Errorf("time of revision %v is %v, want %v", tc.revision, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewRevisionClock(t *testing.T) {
+	ctx := context.Background()
+	kv := newMemKV()
+
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+
+	kv.Put(ctx, "account:alice", `{"createdAt":"`+start.Format(time.RFC3339)+`"}`)
+	// written later but stamped earlier, as by an instance with a skewed clock
+	kv.Put(ctx, "account:bob", `{"createdAt":"`+start.Add(-time.Minute).Format(time.RFC3339)+`"}`)
+	kv.Put(ctx, "session:s1", `{"createdAt":"`+start.Add(10*time.Minute).Format(time.RFC3339)+`"}`)
+	kv.Put(ctx, "session:s2", `{"createdAt":"`+time.Now().UTC().Add(time.Hour).Format(time.RFC3339)+`"}`)
+	kv.Put(ctx, "user:local:carol", `not json`)
+
+	clock, err := newRevisionClock(ctx, kv)
+	if err != nil {
+		t.Fatalf("error reading revision clock: %v", err)
+	}
+
+	wantRevisions := []int64{2, 4, kv.revision}
+	if len(clock.anchors) != len(wantRevisions) {
+		t.Fatalf("clock has %v anchors, want %v: %v", len(clock.anchors), len(wantRevisions), clock.anchors)
+	}
+
+	for i, anchor := range clock.anchors {
+		if anchor.revision != wantRevisions[i] {
+			t.Errorf("anchor %v is of revision %v, want %v", i, anchor.revision, wantRevisions[i])
+		}
+	}
+
+	if got := clock.Time(2); !got.Equal(start) {
+		t.Errorf("time of revision 2 is %v, want %v", got, start)
+	}
+
+	if got := clock.Time(3); !got.Equal(start.Add(5 * time.Minute)) {
+		t.Errorf("time of revision 3 is %v, want %v", got, start.Add(5*time.Minute))
+	}
+}
@@ -0,0 +1,298 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+const (
+	// indexes the subtasks of a task, written along with the subtask
+	keyTaskChildFormat    = "task-child:%v:%v:%v"
+	keyTaskChildrenFormat = "task-child:%v:%v:"
+
+	// a task and its subtasks span at most this many levels
+	maxTaskDepth = 5
+)
+
+// ErrTaskHierarchy implements Error interface
+type ErrTaskHierarchy string
+
+const (
+	ErrTaskHierarchyNoParent ErrTaskHierarchy = "error as the parent task does not exist"
+	ErrTaskHierarchyCycle    ErrTaskHierarchy = "error as a task cannot be a subtask of itself or of its subtasks"
+	ErrTaskHierarchyTooDeep  ErrTaskHierarchy = "error as subtasks are nested too deep"
+)
+
+func (e ErrTaskHierarchy) Error() string {
+	return string(e)
+}
+
+// subtree is the subtasks of a task, read through the subtask index
+type subtree struct {
+	// tasks are the subtasks at their revisions, level by level
+	tasks []store.TaskWrite
+	// height is the number of levels below the task
+	height int
+	// compares hold while no subtask was added to the subtree since
+	compares []clientv3.Cmp
+}
+
+func (t *taskStore) ReadSubtasksWithRevision(ctx context.Context, userID string, taskID string) ([]store.TaskWrite,
+	error) {
+
+	subtree, err := t.readSubtree(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	return subtree.tasks, nil
+}
+
+func (t *taskStore) WriteTasksWithSubtree(ctx context.Context, userID string, writes []store.TaskWrite,
+	taskID string, subtasks []store.TaskWrite) (bool, error) {
+
+	subtree, err := t.readSubtree(ctx, userID, taskID)
+	if err != nil {
+		return false, err
+	}
+
+	if !sameRevisions(subtree.tasks, subtasks) {
+		return false, nil
+	}
+
+	compares := append([]clientv3.Cmp{}, subtree.compares...)
+	for _, subtask := range subtree.tasks {
+		key := fmt.Sprintf(keyTaskFormat, userID, subtask.Task.ID)
+		compares = append(compares, clientv3.Compare(clientv3.ModRevision(key), "=", subtask.Revision))
+	}
+
+	written, _, err := t.writeTasks(ctx, userID, writes, compares, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "error writing tasks in the store")
+	}
+
+	return written, nil
+}
+
+func (t *taskStore) readSubtree(ctx context.Context, userID string, taskID string) (*subtree, error) {
+	var s subtree
+
+	level := []string{taskID}
+	for len(level) > 0 {
+		// the depth is bounded, a deeper subtree would have a cycle
+		if s.height > maxTaskDepth {
+			return nil, errors.Errorf("error as subtasks of task %v are nested too deep", taskID)
+		}
+
+		childIDs, compares, err := t.readIndexIDs(ctx, keyTaskChildrenFormat, userID, level)
+		if err != nil {
+			return nil, err
+		}
+		s.compares = append(s.compares, compares...)
+
+		if len(childIDs) == 0 {
+			break
+		}
+
+		children, err := t.readTasks(ctx, userID, childIDs)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading subtasks from the store")
+		}
+		s.tasks = append(s.tasks, children...)
+		s.height++
+
+		level = level[:0]
+		for _, child := range children {
+			level = append(level, child.Task.ID)
+		}
+	}
+
+	return &s, nil
+}
+
+// hierarchyCmps checks that the task, put under a new parent, is neither
+// nested too deep nor a subtask of itself, and returns the compares holding
+// while its ancestors and subtasks are unchanged. Tasks written along with
+// it are taken at their pending version.
+func (t *taskStore) hierarchyCmps(ctx context.Context, userID string, task store.Task, isNew bool,
+	pending map[string]store.Task) ([]clientv3.Cmp, error) {
+
+	var compares []clientv3.Cmp
+
+	// levels from the root down to the task
+	depth := 1
+	for parentID := task.ParentID; parentID != ""; {
+		if parentID == task.ID {
+			return nil, ErrTaskHierarchyCycle
+		}
+
+		depth++
+		if depth > maxTaskDepth {
+			return nil, ErrTaskHierarchyTooDeep
+		}
+
+		parent, ok := pending[parentID]
+		if !ok {
+			storedParent, revision, err := t.ReadTaskWithRevision(ctx, userID, parentID)
+			if errors.Cause(err) == ErrTaskStoreNoRecord {
+				return nil, ErrTaskHierarchyNoParent
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			key := fmt.Sprintf(keyTaskFormat, userID, parentID)
+			compares = append(compares, clientv3.Compare(clientv3.ModRevision(key), "=", revision))
+			parent = *storedParent
+		}
+
+		parentID = parent.ParentID
+	}
+
+	if isNew {
+		return compares, nil
+	}
+
+	// the subtasks move along with the task
+	subtree, err := t.readSubtree(ctx, userID, task.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if depth+subtree.height > maxTaskDepth {
+		return nil, ErrTaskHierarchyTooDeep
+	}
+
+	return append(compares, subtree.compares...), nil
+}
+
+// removeTasksTxn returns the compares and operations deleting the tasks,
+// read at their revisions. The subtasks of a deleted task that are kept are
+// moved up to its closest ancestor that is kept, and the tasks it blocks no
+// longer depend on it, at now.
+func (t *taskStore) removeTasksTxn(ctx context.Context, userID string, removed []store.TaskWrite,
+	now time.Time) ([]clientv3.Cmp, []clientv3.Op, error) {
+
+	removedTasks := make(map[string]store.Task)
+	taskIDs := make([]string, 0, len(removed))
+
+	var compares []clientv3.Cmp
+	var ops []clientv3.Op
+	for _, taskWrite := range removed {
+		removedTasks[taskWrite.Task.ID] = taskWrite.Task
+		taskIDs = append(taskIDs, taskWrite.Task.ID)
+
+		key := fmt.Sprintf(keyTaskFormat, userID, taskWrite.Task.ID)
+		compares = append(compares, clientv3.Compare(clientv3.ModRevision(key), "=", taskWrite.Revision))
+		ops = append(ops, deleteTaskOps(userID, taskWrite.Task)...)
+	}
+
+	childIDs, childCmps, err := t.readIndexIDs(ctx, keyTaskChildrenFormat, userID, taskIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	compares = append(compares, childCmps...)
+
+	dependentIDs, dependentCmps, err := t.readIndexIDs(ctx, keyTaskDependentsFormat, userID, taskIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	compares = append(compares, dependentCmps...)
+
+	// a kept task both under and blocked by deleted ones is written once
+	keptIDs := make([]string, 0, len(childIDs)+len(dependentIDs))
+	seen := make(map[string]bool)
+	for _, taskID := range append(childIDs, dependentIDs...) {
+		if _, ok := removedTasks[taskID]; ok || seen[taskID] {
+			continue
+		}
+		seen[taskID] = true
+		keptIDs = append(keptIDs, taskID)
+	}
+
+	kept, err := t.readTasks(ctx, userID, keptIDs)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error reading subtasks and dependent tasks from the store")
+	}
+
+	for _, keptTask := range kept {
+		key := fmt.Sprintf(keyTaskFormat, userID, keptTask.Task.ID)
+		compares = append(compares, clientv3.Compare(clientv3.ModRevision(key), "=", keptTask.Revision))
+
+		previous := keptTask.Task
+		task := previous
+		for {
+			parent, ok := removedTasks[task.ParentID]
+			if !ok {
+				break
+			}
+			task.ParentID = parent.ParentID
+		}
+		task.BlockedBy = withoutTasks(previous.BlockedBy, removedTasks)
+		task.Stamp(&previous, now)
+
+		keptOps, err := putTaskOps(userID, &previous, task)
+		if err != nil {
+			return nil, nil, err
+		}
+		ops = append(ops, keptOps...)
+	}
+
+	return compares, ops, nil
+}
+
+// childOps returns the operations moving the entry of the task in the
+// subtask index from its previous parent to its current one, nil for a task
+// that is new or deleted
+func childOps(userID string, previous *store.Task, task *store.Task) []clientv3.Op {
+	var previousParentID, parentID string
+	if previous != nil {
+		previousParentID = previous.ParentID
+	}
+	if task != nil {
+		parentID = task.ParentID
+	}
+
+	if previousParentID == parentID {
+		return nil
+	}
+
+	var ops []clientv3.Op
+	if previousParentID != "" {
+		ops = append(ops, clientv3.OpDelete(fmt.Sprintf(keyTaskChildFormat, userID, previousParentID,
+			previous.ID)))
+	}
+
+	if parentID != "" {
+		ops = append(ops, clientv3.OpPut(fmt.Sprintf(keyTaskChildFormat, userID, parentID, task.ID), ""))
+	}
+
+	return ops
+}
+
+// sameRevisions reports whether both hold the same tasks at the same
+// revisions
+func sameRevisions(a []store.TaskWrite, b []store.TaskWrite) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	revisions := make(map[string]int64, len(a))
+	for _, taskWrite := range a {
+		revisions[taskWrite.Task.ID] = taskWrite.Revision
+	}
+
+	for _, taskWrite := range b {
+		revision, ok := revisions[taskWrite.Task.ID]
+		if !ok || revision != taskWrite.Revision {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,200 @@
+package task
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+)
+
+func TestHierarchyCmps(t *testing.T) {
+	// a > b > c, d alone, and e1 > e2 > e3 > e4 > e5 as deep as subtasks go
+	tasks := []store.Task{
+		{ID: "a"},
+		{ID: "b", ParentID: "a"},
+		{ID: "c", ParentID: "b"},
+		{ID: "d"},
+		{ID: "e1"},
+		{ID: "e2", ParentID: "e1"},
+		{ID: "e3", ParentID: "e2"},
+		{ID: "e4", ParentID: "e3"},
+		{ID: "e5", ParentID: "e4"},
+	}
+
+	tests := []struct {
+		name    string
+		task    store.Task
+		isNew   bool
+		pending []store.Task
+		wantErr error
+		// the tasks whose change breaks the compares
+		guardedTasks []string
+		// the tasks a subtask added to breaks the compares
+		guardedSubtasks []string
+	}{
+		{
+			name:  "new task without parent",
+			task:  store.Task{ID: "new"},
+			isNew: true,
+		},
+		{
+			name:         "new subtask",
+			task:         store.Task{ID: "new", ParentID: "c"},
+			isNew:        true,
+			guardedTasks: []string{"a", "b", "c"},
+		},
+		{
+			name:    "new subtask of a missing task",
+			task:    store.Task{ID: "new", ParentID: "missing"},
+			isNew:   true,
+			wantErr: ErrTaskHierarchyNoParent,
+		},
+		{
+			name:    "new subtask too deep",
+			task:    store.Task{ID: "new", ParentID: "e5"},
+			isNew:   true,
+			wantErr: ErrTaskHierarchyTooDeep,
+		},
+		{
+			name:         "new subtask of a pending task",
+			task:         store.Task{ID: "new", ParentID: "pending"},
+			isNew:        true,
+			pending:      []store.Task{{ID: "pending", ParentID: "a"}},
+			guardedTasks: []string{"a"},
+		},
+		{
+			name:    "subtask of itself",
+			task:    store.Task{ID: "a", ParentID: "a"},
+			wantErr: ErrTaskHierarchyCycle,
+		},
+		{
+			name:    "subtask of its subtask",
+			task:    store.Task{ID: "a", ParentID: "c"},
+			wantErr: ErrTaskHierarchyCycle,
+		},
+		{
+			name:    "subtask of a pending subtask",
+			task:    store.Task{ID: "d", ParentID: "pending"},
+			pending: []store.Task{{ID: "pending", ParentID: "d"}},
+			wantErr: ErrTaskHierarchyCycle,
+		},
+		{
+			name:            "moved without subtasks",
+			task:            store.Task{ID: "d", ParentID: "e4"},
+			guardedTasks:    []string{"e1", "e2", "e3", "e4"},
+			guardedSubtasks: []string{"d"},
+		},
+		{
+			name:            "moved with subtasks",
+			task:            store.Task{ID: "b", ParentID: "e3"},
+			guardedTasks:    []string{"e1", "e2", "e3"},
+			guardedSubtasks: []string{"b", "c"},
+		},
+		{
+			name:    "moved with subtasks too deep",
+			task:    store.Task{ID: "b", ParentID: "e4"},
+			wantErr: ErrTaskHierarchyTooDeep,
+		},
+		{
+			name:            "moved to the top",
+			task:            store.Task{ID: "b"},
+			guardedSubtasks: []string{"b", "c"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			taskStore, kv := newTestTaskStore(t, tasks...)
+
+			pending := make(map[string]store.Task)
+			for _, task := range test.pending {
+				pending[task.ID] = task
+			}
+
+			cmps := func() []clientv3.Cmp {
+				compares, err := taskStore.hierarchyCmps(context.Background(), testUserID, test.task, test.isNew,
+					pending)
+				if err != test.wantErr {
+					t.Fatalf("hierarchyCmps() error = %v, want %v", err, test.wantErr)
+				}
+				return compares
+			}
+
+			if test.wantErr != nil {
+				cmps()
+				return
+			}
+
+			checkGuards(t, kv, cmps, test.guardedTasks, test.guardedSubtasks, keyTaskChildFormat)
+		})
+	}
+}
+
+func TestWriteTasksWithSubtree(t *testing.T) {
+	// a > b > c, with b and c completed
+	tasks := []store.Task{
+		{ID: "a"},
+		{ID: "b", ParentID: "a", IsCompleted: true},
+		{ID: "c", ParentID: "b", IsCompleted: true},
+	}
+
+	tests := []struct {
+		name string
+		// change is made to the subtree after it is read
+		change      *store.Task
+		wantWritten bool
+	}{
+		{
+			name:        "unchanged subtasks",
+			wantWritten: true,
+		},
+		{
+			name:   "subtask reopened",
+			change: &store.Task{ID: "c", ParentID: "b"},
+		},
+		{
+			name:   "subtask added",
+			change: &store.Task{ID: "d", ParentID: "b"},
+		},
+		{
+			name:   "subtask moved out",
+			change: &store.Task{ID: "c", IsCompleted: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			taskStore, _ := newTestTaskStore(t, tasks...)
+
+			task, revision, err := taskStore.ReadTaskWithRevision(ctx, testUserID, "a")
+			if err != nil {
+				t.Fatalf("error reading task: %v", err)
+			}
+
+			subtasks, err := taskStore.ReadSubtasksWithRevision(ctx, testUserID, "a")
+			if err != nil {
+				t.Fatalf("error reading subtasks: %v", err)
+			}
+
+			if test.change != nil {
+				err = taskStore.UpsertTask(ctx, testUserID, *test.change)
+				if err != nil {
+					t.Fatalf("error changing task %v: %v", test.change.ID, err)
+				}
+			}
+
+			task.IsCompleted = true
+			written, err := taskStore.WriteTasksWithSubtree(ctx, testUserID,
+				[]store.TaskWrite{{Task: *task, Revision: revision}}, "a", subtasks)
+			if err != nil {
+				t.Fatalf("WriteTasksWithSubtree() error = %v", err)
+			}
+
+			if written != test.wantWritten {
+				t.Errorf("WriteTasksWithSubtree() = %v, want %v", written, test.wantWritten)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+const (
+	// indexes the tasks of a user by tag, written along with the task. Tags
+	// are escaped so that a tag cannot hold the separator.
+	keyTaskTagFormat  = "task-tag:%v:%v:%v"
+	keyTagTasksFormat = "task-tag:%v:%v:"
+	keyUserTagsFormat = "task-tag:%v:"
+)
+
+// ReadTasksByTag returns the tasks of the user with the tag, read through
+// the tag index
+func (t *taskStore) ReadTasksByTag(ctx context.Context, userID string, tag string) ([]store.Task, error) {
+	prefix := fmt.Sprintf(keyTagTasksFormat, userID, url.QueryEscape(tag))
+
+	resp, err := t.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading tag index from the store")
+	}
+
+	taskIDs := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		taskIDs = append(taskIDs, strings.TrimPrefix(string(kv.Key), prefix))
+	}
+
+	taskWrites, err := t.readTasks(ctx, userID, taskIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading tagged tasks from the store")
+	}
+
+	return tasksOf(taskWrites), nil
+}
+
+// ReadTagCounts returns the tags of the user with the number of tasks of
+// each, in order of the tags
+func (t *taskStore) ReadTagCounts(ctx context.Context, userID string) ([]store.TagCount, error) {
+	prefix := fmt.Sprintf(keyUserTagsFormat, userID)
+
+	resp, err := t.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading tag index from the store")
+	}
+
+	counts := make(map[string]int)
+	for _, kv := range resp.Kvs {
+		escapedTag := strings.TrimPrefix(string(kv.Key), prefix)
+		if i := strings.LastIndex(escapedTag, ":"); i >= 0 {
+			escapedTag = escapedTag[:i]
+		}
+
+		tag, err := url.QueryUnescape(escapedTag)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error unescaping tag of %v", string(kv.Key))
+		}
+
+		counts[tag]++
+	}
+
+	tagCounts := make([]store.TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tagCounts = append(tagCounts, store.TagCount{Tag: tag, Count: count})
+	}
+
+	sort.Slice(tagCounts, func(i, j int) bool {
+		return tagCounts[i].Tag < tagCounts[j].Tag
+	})
+
+	return tagCounts, nil
+}
+
+// tagOps returns the operations moving the entries of the task in the tag
+// index from its previous tags to its current ones, nil for a task that is
+// new or deleted
+func tagOps(userID string, previous *store.Task, task *store.Task) []clientv3.Op {
+	previousTags := make(map[string]bool)
+	if previous != nil {
+		for _, tag := range previous.Tags {
+			previousTags[tag] = true
+		}
+	}
+
+	currentTags := make(map[string]bool)
+	if task != nil {
+		for _, tag := range task.Tags {
+			currentTags[tag] = true
+		}
+	}
+
+	var ops []clientv3.Op
+	for tag := range previousTags {
+		if !currentTags[tag] {
+			ops = append(ops, clientv3.OpDelete(taskTagKey(userID, tag, previous.ID)))
+		}
+	}
+
+	for tag := range currentTags {
+		if !previousTags[tag] {
+			ops = append(ops, clientv3.OpPut(taskTagKey(userID, tag, task.ID), ""))
+		}
+	}
+
+	return ops
+}
+
+func taskTagKey(userID string, tag string, taskID string) string {
+	return fmt.Sprintf(keyTaskTagFormat, userID, url.QueryEscape(tag), taskID)
+}
@@ -0,0 +1,158 @@
+package task
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+)
+
+func TestTagOps(t *testing.T) {
+	testCases := []struct {
+		name       string
+		previous   *store.Task
+		task       *store.Task
+		wantPuts   []string
+		wantDelete []string
+	}{
+		{
+			name:     "new task",
+			task:     &store.Task{ID: "task", Tags: []string{"home", "errand"}},
+			wantPuts: []string{taskTagKey(testUserID, "errand", "task"), taskTagKey(testUserID, "home", "task")},
+		},
+		{
+			name:       "deleted task",
+			previous:   &store.Task{ID: "task", Tags: []string{"home"}},
+			wantDelete: []string{taskTagKey(testUserID, "home", "task")},
+		},
+		{
+			name:     "tags unchanged",
+			previous: &store.Task{ID: "task", Tags: []string{"home", "errand"}},
+			task:     &store.Task{ID: "task", Tags: []string{"errand", "home"}},
+		},
+		{
+			name:       "tag replaced",
+			previous:   &store.Task{ID: "task", Tags: []string{"home", "errand"}},
+			task:       &store.Task{ID: "task", Tags: []string{"home", "work"}},
+			wantPuts:   []string{taskTagKey(testUserID, "work", "task")},
+			wantDelete: []string{taskTagKey(testUserID, "errand", "task")},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var puts, deletes []string
+			for _, op := range tagOps(testUserID, tc.previous, tc.task) {
+				if op.IsPut() {
+					puts = append(puts, string(op.KeyBytes()))
+				} else if op.IsDelete() {
+					deletes = append(deletes, string(op.KeyBytes()))
+				}
+			}
+			sort.Strings(puts)
+			sort.Strings(deletes)
+
+			if !reflect.DeepEqual(puts, tc.wantPuts) {
+				t.Errorf("tag index puts are %v, want %v", puts, tc.wantPuts)
+			}
+
+			if !reflect.DeepEqual(deletes, tc.wantDelete) {
+				t.Errorf("tag index deletes are %v, want %v", deletes, tc.wantDelete)
+			}
+		})
+	}
+}
+
+func TestTagIndex(t *testing.T) {
+	ctx := context.Background()
+
+	// a tag holding the separator of the index is not mistaken for another
+	// one or for a task id
+	taskStore, _ := newTestTaskStore(t,
+		store.Task{ID: "groceries", Tags: []string{"home", "errand"}},
+		store.Task{ID: "taxes", Tags: []string{"home", "due:april"}},
+		store.Task{ID: "report", Tags: []string{"due"}},
+	)
+
+	tagTaskIDs := func(tag string) []string {
+		t.Helper()
+
+		tasks, err := taskStore.ReadTasksByTag(ctx, testUserID, tag)
+		if err != nil {
+			t.Fatalf("error reading tasks of tag %v: %v", tag, err)
+		}
+
+		taskIDs := make([]string, 0, len(tasks))
+		for _, task := range tasks {
+			taskIDs = append(taskIDs, task.ID)
+		}
+		sort.Strings(taskIDs)
+
+		return taskIDs
+	}
+
+	wantTagTasks := map[string][]string{
+		"home":      {"groceries", "taxes"},
+		"errand":    {"groceries"},
+		"due:april": {"taxes"},
+		"due":       {"report"},
+		"work":      {},
+	}
+	for tag, wantTaskIDs := range wantTagTasks {
+		if taskIDs := tagTaskIDs(tag); !reflect.DeepEqual(taskIDs, wantTaskIDs) {
+			t.Errorf("tasks of tag %v are %v, want %v", tag, taskIDs, wantTaskIDs)
+		}
+	}
+
+	tagCounts, err := taskStore.ReadTagCounts(ctx, testUserID)
+	if err != nil {
+		t.Fatalf("error reading tag counts: %v", err)
+	}
+
+	wantTagCounts := []store.TagCount{
+		{Tag: "due", Count: 1},
+		{Tag: "due:april", Count: 1},
+		{Tag: "errand", Count: 1},
+		{Tag: "home", Count: 2},
+	}
+	if !reflect.DeepEqual(tagCounts, wantTagCounts) {
+		t.Errorf("tag counts are %v, want %v", tagCounts, wantTagCounts)
+	}
+
+	// the index follows the tags of the task as it is updated and deleted
+	task, revision, err := taskStore.ReadTaskWithRevision(ctx, testUserID, "groceries")
+	if err != nil {
+		t.Fatalf("error reading task: %v", err)
+	}
+
+	task.Tags = []string{"errand"}
+	_, updated, err := taskStore.UpdateTaskAtRevision(ctx, testUserID, *task, revision)
+	if err != nil || !updated {
+		t.Fatalf("task updated is %v, %v, want true", updated, err)
+	}
+
+	err = taskStore.DeleteTask(ctx, testUserID, "taxes", false, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("error deleting task: %v", err)
+	}
+
+	if taskIDs := tagTaskIDs("home"); len(taskIDs) != 0 {
+		t.Errorf("tasks of tag home are %v once untagged and deleted, want none", taskIDs)
+	}
+
+	tagCounts, err = taskStore.ReadTagCounts(ctx, testUserID)
+	if err != nil {
+		t.Fatalf("error reading tag counts: %v", err)
+	}
+
+	wantTagCounts = []store.TagCount{
+		{Tag: "due", Count: 1},
+		{Tag: "errand", Count: 1},
+	}
+	if !reflect.DeepEqual(tagCounts, wantTagCounts) {
+		t.Errorf("tag counts are %v, want %v", tagCounts, wantTagCounts)
+	}
+}
@@ -2,30 +2,68 @@ package task
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/AjithPanneerselvam/task-etcd/store"
 	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
 	"github.com/pkg/errors"
 )
 
 const (
-	keyTaskFormat  = "task:%v:%v"
-	keyTasksFormat = "task:%v"
+	keyTaskFormat = "task:%v:%v"
+	// the trailing separator keeps the tasks of user "1" apart from those of user "12"
+	keyTasksFormat = "task:%v:"
+	// maps a source to the task created from it, keyed by a hash of the
+	// source url to keep keys bounded. The hash comes first so that the tasks
+	// of a source are listed across users.
+	keyTaskSourceFormat  = "task-source:%x:%v"
+	keySourceTasksFormat = "task-source:%x:"
+	// indexes the pending reminders of tasks across users, written along
+	// with the task
+	keyTaskReminderFormat  = "task-reminder:%v:%v"
+	keyTaskRemindersPrefix = "task-reminder:"
+
+	// anyRevision writes a task whatever its revision
+	anyRevision = -1
+	// a task is written in a few attempts unless it keeps changing meanwhile
+	maxWriteAttempts = 3
+	// tasks read by id are read in batches of gets, each batch in a single
+	// round trip
+	maxTaskGetsPerBatch = 100
 )
 
 // ErrTaskStore implements Error interface
 type ErrTaskStore string
 
 const (
-	ErrTaskStoreNoRecord ErrTaskStore = "error no task record"
+	ErrTaskStoreNoRecord  ErrTaskStore = "error no task record"
+	ErrTaskStoreNoSource  ErrTaskStore = "error no task of the source"
+	ErrTaskStoreNoProject ErrTaskStore = "error no project record"
+	// ErrTaskStoreTooManyTasks is returned when the tasks changed together
+	// take more operations than etcd allows in a transaction
+	ErrTaskStoreTooManyTasks ErrTaskStore = "error too many tasks to change in a single transaction"
 )
 
 func (e ErrTaskStore) Error() string {
 	return string(e)
 }
 
+// txnError returns ErrTaskStoreTooManyTasks for a transaction etcd rejected
+// as too large, the error otherwise
+func txnError(err error) error {
+	if errors.Cause(err) == rpctypes.ErrTooManyOps {
+		return ErrTaskStoreTooManyTasks
+	}
+
+	return err
+}
+
 type taskStore struct {
 	clientv3.KV
 }
@@ -37,19 +75,19 @@ func New(db clientv3.KV) store.TaskStore {
 }
 
 func (t *taskStore) UpsertTask(ctx context.Context, userID string, task store.Task) error {
-	taskInBytes, err := json.Marshal(task)
-	if err != nil {
-		return errors.Wrap(err, "error marshalling task")
-	}
-
-	key := fmt.Sprintf(keyTaskFormat, userID, task.ID)
+	for attempt := 0; attempt < maxWriteAttempts; attempt++ {
+		written, _, err := t.writeTasks(ctx, userID, []store.TaskWrite{{Task: task, Revision: anyRevision}}, nil,
+			nil)
+		if err != nil {
+			return errors.Wrapf(err, "error creating task in the store")
+		}
 
-	_, err = t.Put(ctx, key, string(taskInBytes))
-	if err != nil {
-		return errors.Wrapf(err, "error creating task in the store")
+		if written {
+			return nil
+		}
 	}
 
-	return nil
+	return errors.Errorf("error storing task %v as it keeps changing", task.ID)
 }
 
 func (t *taskStore) ReadTask(ctx context.Context, userID string, taskID string) (*store.Task, error) {
@@ -75,6 +113,41 @@ func (t *taskStore) ReadTask(ctx context.Context, userID string, taskID string)
 	return &task, nil
 }
 
+func (t *taskStore) ReadTaskWithRevision(ctx context.Context, userID string, taskID string) (*store.Task,
+	int64, error) {
+
+	key := fmt.Sprintf(keyTaskFormat, userID, taskID)
+
+	resp, err := t.Get(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(resp.Kvs) != 1 {
+		return nil, 0, ErrTaskStoreNoRecord
+	}
+
+	var task store.Task
+	err = json.Unmarshal(resp.Kvs[0].Value, &task)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error unmarshalling task response from store")
+	}
+
+	return &task, resp.Kvs[0].ModRevision, nil
+}
+
+func (t *taskStore) UpdateTaskAtRevision(ctx context.Context, userID string, task store.Task,
+	revision int64) (int64, bool, error) {
+
+	updated, newRevision, err := t.writeTasks(ctx, userID, []store.TaskWrite{{Task: task, Revision: revision}}, nil,
+		nil)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "error updating task in the store")
+	}
+
+	return newRevision, updated, nil
+}
+
 func (t *taskStore) ReadAllTasks(ctx context.Context, userID string) ([]store.Task, error) {
 
 	key := fmt.Sprintf(keyTasksFormat, userID)
@@ -99,8 +172,361 @@ func (t *taskStore) ReadAllTasks(ctx context.Context, userID string) ([]store.Ta
 	return tasks, nil
 }
 
-func (t *taskStore) DeleteTask(ctx context.Context, userID string, taskID string) error {
-	key := fmt.Sprintf(keyTaskFormat, userID, taskID)
-	_, err := t.Delete(ctx, key)
-	return err
+// DeleteTask deletes the task, along with its subtasks when deleteSubtasks
+// is set. Otherwise its subtasks are moved up to its parent at now.
+func (t *taskStore) DeleteTask(ctx context.Context, userID string, taskID string, deleteSubtasks bool,
+	now time.Time) error {
+
+	for attempt := 0; attempt < maxWriteAttempts; attempt++ {
+		task, revision, err := t.ReadTaskWithRevision(ctx, userID, taskID)
+		if errors.Cause(err) == ErrTaskStoreNoRecord {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		removed := []store.TaskWrite{{Task: *task, Revision: revision}}
+		if deleteSubtasks {
+			subtasks, err := t.ReadSubtasksWithRevision(ctx, userID, taskID)
+			if err != nil {
+				return err
+			}
+			removed = append(removed, subtasks...)
+		}
+
+		compares, ops, err := t.removeTasksTxn(ctx, userID, removed, now)
+		if err != nil {
+			return err
+		}
+
+		resp, err := t.Txn(ctx).If(compares...).Then(ops...).Commit()
+		if err != nil {
+			return errors.Wrap(txnError(err), "error deleting task from the store")
+		}
+
+		if resp.Succeeded {
+			return nil
+		}
+	}
+
+	return errors.Errorf("error deleting task %v as it keeps changing", taskID)
+}
+
+func (t *taskStore) CreateSourcedTask(ctx context.Context, userID string, task store.Task) (bool, error) {
+	sourceKey := taskSourceKey(userID, task.SourceURL)
+
+	// the task and its source link are created together, so concurrent
+	// imports of a source create a single task
+	created, _, err := t.writeTasks(ctx, userID, []store.TaskWrite{{Task: task}},
+		[]clientv3.Cmp{clientv3.Compare(clientv3.CreateRevision(sourceKey), "=", 0)},
+		[]clientv3.Op{clientv3.OpPut(sourceKey, task.ID)})
+	if err != nil {
+		return false, errors.Wrap(err, "error creating sourced task in the store")
+	}
+
+	return created, nil
+}
+
+func (t *taskStore) LinkTaskSource(ctx context.Context, userID string, task store.Task,
+	revision int64) (bool, error) {
+
+	sourceKey := taskSourceKey(userID, task.SourceURL)
+
+	linked, _, err := t.writeTasks(ctx, userID, []store.TaskWrite{{Task: task, Revision: revision}},
+		[]clientv3.Cmp{clientv3.Compare(clientv3.CreateRevision(sourceKey), "=", 0)},
+		[]clientv3.Op{clientv3.OpPut(sourceKey, task.ID)})
+	if err != nil {
+		return false, errors.Wrap(err, "error linking task source in the store")
+	}
+
+	return linked, nil
+}
+
+func (t *taskStore) ReadTaskIDBySource(ctx context.Context, userID string, sourceURL string) (string, error) {
+	resp, err := t.Get(ctx, taskSourceKey(userID, sourceURL))
+	if err != nil {
+		return "", errors.Wrap(err, "error reading task source from the store")
+	}
+
+	if len(resp.Kvs) != 1 {
+		return "", ErrTaskStoreNoSource
+	}
+
+	return string(resp.Kvs[0].Value), nil
+}
+
+func (t *taskStore) ReadSourcedTasks(ctx context.Context, sourceURL string) ([]store.SourcedTask, error) {
+	prefix := fmt.Sprintf(keySourceTasksFormat, sha256.Sum256([]byte(sourceURL)))
+
+	resp, err := t.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading task sources from the store")
+	}
+
+	sourcedTasks := make([]store.SourcedTask, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		sourcedTasks = append(sourcedTasks, store.SourcedTask{
+			UserID: strings.TrimPrefix(string(kv.Key), prefix),
+			TaskID: string(kv.Value),
+		})
+	}
+
+	return sourcedTasks, nil
+}
+
+func (t *taskStore) ReadAllReminders(ctx context.Context) ([]store.Reminder, error) {
+	resp, err := t.Get(ctx, keyTaskRemindersPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading task reminders from the store")
+	}
+
+	reminders := make([]store.Reminder, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var reminder store.Reminder
+		err = json.Unmarshal(kv.Value, &reminder)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling task reminder %v from store", string(kv.Key))
+		}
+
+		reminders = append(reminders, reminder)
+	}
+
+	sort.Slice(reminders, func(i, j int) bool {
+		return reminders[i].RemindAt.Before(reminders[j].RemindAt)
+	})
+
+	return reminders, nil
+}
+
+func (t *taskStore) WriteTasks(ctx context.Context, userID string, writes []store.TaskWrite) (bool, error) {
+	written, _, err := t.writeTasks(ctx, userID, writes, nil, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "error writing tasks in the store")
+	}
+
+	return written, nil
+}
+
+// writeTasks writes the tasks together, each unless it changed since its
+// revision, along with their entries in the indexes. A task put under a new
+// parent is checked against the hierarchy, failing with an ErrTaskHierarchy,
+// and a task blocked by new tasks against the dependencies, failing with an
+// ErrTaskDependency. The extra operations are part of the write, which is
+// made only if the extra comparisons hold too. It reports whether the tasks
+// were written and the revision they were written at.
+func (t *taskStore) writeTasks(ctx context.Context, userID string, writes []store.TaskWrite,
+	extraCmps []clientv3.Cmp, extraOps []clientv3.Op) (bool, int64, error) {
+
+	compares := append([]clientv3.Cmp{}, extraCmps...)
+	ops := append([]clientv3.Op{}, extraOps...)
+
+	pending := make(map[string]store.Task)
+	for _, write := range writes {
+		pending[write.Task.ID] = write.Task
+	}
+
+	// tasks moved together share the compare of their project, as etcd
+	// bounds the compares of a transaction too
+	guardedProjects := make(map[string]bool)
+
+	for _, write := range writes {
+		key := fmt.Sprintf(keyTaskFormat, userID, write.Task.ID)
+
+		// the indexes are updated from the version being replaced
+		previous, revision, err := t.ReadTaskWithRevision(ctx, userID, write.Task.ID)
+		if err != nil && errors.Cause(err) != ErrTaskStoreNoRecord {
+			return false, 0, err
+		}
+
+		if write.Revision != anyRevision && write.Revision != revision {
+			return false, 0, nil
+		}
+
+		if revision == 0 {
+			compares = append(compares, clientv3.Compare(clientv3.CreateRevision(key), "=", 0))
+		} else {
+			compares = append(compares, clientv3.Compare(clientv3.ModRevision(key), "=", revision))
+		}
+
+		// a task is put in a project only while the project exists
+		if write.Task.ProjectID != "" && !guardedProjects[write.Task.ProjectID] {
+			guardedProjects[write.Task.ProjectID] = true
+			projectKey := fmt.Sprintf(keyProjectFormat, userID, write.Task.ProjectID)
+			compares = append(compares, clientv3.Compare(clientv3.CreateRevision(projectKey), ">", 0))
+		}
+
+		if write.Task.ParentID != "" && (previous == nil || previous.ParentID != write.Task.ParentID) {
+			hierarchyCmps, err := t.hierarchyCmps(ctx, userID, write.Task, previous == nil, pending)
+			if err != nil {
+				return false, 0, err
+			}
+			compares = append(compares, hierarchyCmps...)
+		}
+
+		if blockerIDs := addedBlockers(previous, write.Task); len(blockerIDs) > 0 {
+			dependencyCmps, err := t.dependencyCmps(ctx, userID, write.Task, blockerIDs, pending)
+			if err != nil {
+				return false, 0, err
+			}
+			compares = append(compares, dependencyCmps...)
+		}
+
+		taskOps, err := putTaskOps(userID, previous, write.Task)
+		if err != nil {
+			return false, 0, err
+		}
+		ops = append(ops, taskOps...)
+	}
+
+	resp, err := t.Txn(ctx).If(compares...).Then(ops...).Commit()
+	if err != nil {
+		return false, 0, txnError(err)
+	}
+
+	// the revision of the store after the write is the one of the tasks
+	return resp.Succeeded, resp.Header.Revision, nil
+}
+
+// readTasks returns the tasks of the ids along with their revisions, leaving
+// out those that do not exist
+func (t *taskStore) readTasks(ctx context.Context, userID string, taskIDs []string) ([]store.TaskWrite, error) {
+	taskWrites := make([]store.TaskWrite, 0, len(taskIDs))
+
+	for start := 0; start < len(taskIDs); start += maxTaskGetsPerBatch {
+		end := start + maxTaskGetsPerBatch
+		if end > len(taskIDs) {
+			end = len(taskIDs)
+		}
+
+		ops := make([]clientv3.Op, 0, end-start)
+		for _, taskID := range taskIDs[start:end] {
+			ops = append(ops, clientv3.OpGet(fmt.Sprintf(keyTaskFormat, userID, taskID)))
+		}
+
+		resp, err := t.Txn(ctx).Then(ops...).Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, opResp := range resp.Responses {
+			for _, kv := range opResp.GetResponseRange().Kvs {
+				var task store.Task
+				err = json.Unmarshal(kv.Value, &task)
+				if err != nil {
+					return nil, errors.Wrap(err, "error unmarshalling task response from store")
+				}
+
+				taskWrites = append(taskWrites, store.TaskWrite{Task: task, Revision: kv.ModRevision})
+			}
+		}
+	}
+
+	return taskWrites, nil
+}
+
+// readIndexIDs returns the ids indexed under each of the tasks in the index
+// of the prefix format, along with the compares holding while none is added
+func (t *taskStore) readIndexIDs(ctx context.Context, prefixFormat string, userID string,
+	taskIDs []string) ([]string, []clientv3.Cmp, error) {
+
+	var indexedIDs []string
+	var compares []clientv3.Cmp
+
+	for start := 0; start < len(taskIDs); start += maxTaskGetsPerBatch {
+		end := start + maxTaskGetsPerBatch
+		if end > len(taskIDs) {
+			end = len(taskIDs)
+		}
+
+		prefixes := make([]string, 0, end-start)
+		ops := make([]clientv3.Op, 0, end-start)
+		for _, taskID := range taskIDs[start:end] {
+			prefix := fmt.Sprintf(prefixFormat, userID, taskID)
+			prefixes = append(prefixes, prefix)
+			ops = append(ops, clientv3.OpGet(prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly()))
+		}
+
+		resp, err := t.Txn(ctx).Then(ops...).Commit()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error reading task index from the store")
+		}
+
+		for i, opResp := range resp.Responses {
+			for _, kv := range opResp.GetResponseRange().Kvs {
+				indexedIDs = append(indexedIDs, strings.TrimPrefix(string(kv.Key), prefixes[i]))
+			}
+
+			// entries of the index are only put and deleted, so none was
+			// put since the read
+			compares = append(compares,
+				clientv3.Compare(clientv3.ModRevision(prefixes[i]), "<", resp.Header.Revision+1).WithPrefix())
+		}
+	}
+
+	return indexedIDs, compares, nil
+}
+
+func tasksOf(taskWrites []store.TaskWrite) []store.Task {
+	tasks := make([]store.Task, 0, len(taskWrites))
+	for _, taskWrite := range taskWrites {
+		tasks = append(tasks, taskWrite.Task)
+	}
+
+	return tasks
+}
+
+// putTaskOps returns the operations writing the task over its previous
+// version, nil for a new task, along with its entries in the indexes. The
+// reminder index holds the task while its reminder is pending, so its entry
+// is only deleted when the previous version had one.
+func putTaskOps(userID string, previous *store.Task, task store.Task) ([]clientv3.Op, error) {
+	taskInBytes, err := json.Marshal(task)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling task")
+	}
+
+	key := fmt.Sprintf(keyTaskFormat, userID, task.ID)
+	reminderKey := fmt.Sprintf(keyTaskReminderFormat, userID, task.ID)
+
+	ops := append([]clientv3.Op{clientv3.OpPut(key, string(taskInBytes))}, tagOps(userID, previous, &task)...)
+	ops = append(ops, projectOps(userID, previous, &task)...)
+	ops = append(ops, childOps(userID, previous, &task)...)
+	ops = append(ops, dependencyOps(userID, previous, &task)...)
+
+	if !task.ReminderPending() {
+		if previous != nil && previous.ReminderPending() {
+			ops = append(ops, clientv3.OpDelete(reminderKey))
+		}
+		return ops, nil
+	}
+
+	reminderInBytes, err := json.Marshal(store.Reminder{
+		UserID:   userID,
+		TaskID:   task.ID,
+		RemindAt: task.RemindAt.UTC(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling task reminder")
+	}
+
+	return append(ops, clientv3.OpPut(reminderKey, string(reminderInBytes))), nil
+}
+
+// deleteTaskOps returns the operations deleting the task along with its
+// entries in the indexes
+func deleteTaskOps(userID string, task store.Task) []clientv3.Op {
+	ops := []clientv3.Op{clientv3.OpDelete(fmt.Sprintf(keyTaskFormat, userID, task.ID))}
+	if task.ReminderPending() {
+		ops = append(ops, clientv3.OpDelete(fmt.Sprintf(keyTaskReminderFormat, userID, task.ID)))
+	}
+	ops = append(ops, tagOps(userID, &task, nil)...)
+	ops = append(ops, projectOps(userID, &task, nil)...)
+	ops = append(ops, childOps(userID, &task, nil)...)
+
+	return append(ops, dependencyOps(userID, &task, nil)...)
+}
+
+func taskSourceKey(userID string, sourceURL string) string {
+	return fmt.Sprintf(keyTaskSourceFormat, sha256.Sum256([]byte(sourceURL)), userID)
 }
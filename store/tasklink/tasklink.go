@@ -0,0 +1,108 @@
+package tasklink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyTaskLinkFormat = "task-link:%v:%v"
+	// the trailing separator keeps the links of user "1" apart from those of user "12"
+	keyTaskLinksFormat = "task-link:%v:"
+)
+
+// ErrTaskLinkStore implements Error interface
+type ErrTaskLinkStore string
+
+const (
+	ErrTaskLinkStoreNoRecord ErrTaskLinkStore = "error no task link record"
+)
+
+func (e ErrTaskLinkStore) Error() string {
+	return string(e)
+}
+
+type taskLinkStore struct {
+	clientv3.KV
+}
+
+func New(db clientv3.KV) store.TaskLinkStore {
+	return &taskLinkStore{
+		db,
+	}
+}
+
+func (t *taskLinkStore) UpsertLink(ctx context.Context, link store.TaskLink) error {
+	linkInBytes, err := json.Marshal(link)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling task link")
+	}
+
+	key := fmt.Sprintf(keyTaskLinkFormat, link.UserID, link.TaskID)
+
+	_, err = t.Put(ctx, key, string(linkInBytes))
+	if err != nil {
+		return errors.Wrap(err, "error storing task link")
+	}
+
+	return nil
+}
+
+func (t *taskLinkStore) ReadLink(ctx context.Context, userID string, taskID string) (*store.TaskLink, error) {
+	key := fmt.Sprintf(keyTaskLinkFormat, userID, taskID)
+
+	resp, err := t.Get(ctx, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading task link from the store")
+	}
+
+	if len(resp.Kvs) != 1 {
+		return nil, ErrTaskLinkStoreNoRecord
+	}
+
+	var link store.TaskLink
+	err = json.Unmarshal(resp.Kvs[0].Value, &link)
+	if err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling task link from store")
+	}
+
+	return &link, nil
+}
+
+func (t *taskLinkStore) ReadAllLinks(ctx context.Context, userID string) ([]store.TaskLink, error) {
+	keyPrefix := fmt.Sprintf(keyTaskLinksFormat, userID)
+
+	resp, err := t.Get(ctx, keyPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading task links from the store")
+	}
+
+	links := make([]store.TaskLink, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var link store.TaskLink
+		err = json.Unmarshal(kv.Value, &link)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling task link %v from store", string(kv.Key))
+		}
+
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+func (t *taskLinkStore) DeleteLink(ctx context.Context, userID string, taskID string) error {
+	key := fmt.Sprintf(keyTaskLinkFormat, userID, taskID)
+
+	_, err := t.Delete(ctx, key)
+	if err != nil {
+		return errors.Wrap(err, "error deleting task link")
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyUserFormat = "user:%v"
+	keyUserPrefix = "user:"
+
+	maxUpdateAttempts = 5
+)
+
+// ErrUserStore implements Error interface
+type ErrUserStore string
+
+const (
+	ErrUserStoreNoRecord ErrUserStore = "error no user record"
+	ErrUserStoreConflict ErrUserStore = "error concurrent user updates"
+)
+
+func (e ErrUserStore) Error() string {
+	return string(e)
+}
+
+type userStore struct {
+	clientv3.KV
+}
+
+func New(db clientv3.KV) store.UserStore {
+	return &userStore{
+		db,
+	}
+}
+
+func (u *userStore) RecordLogin(ctx context.Context, profile store.UserProfile) (*store.UserProfile, error) {
+	return u.update(ctx, profile.UserID, func(existing *store.UserProfile) (*store.UserProfile, error) {
+		if existing == nil {
+			profile.FirstSeenAt = profile.LastLoginAt
+			return &profile, nil
+		}
+
+		existing.Provider = profile.Provider
+		existing.Login = profile.Login
+		existing.DisplayName = profile.DisplayName
+		existing.Email = profile.Email
+		existing.AvatarURL = profile.AvatarURL
+		existing.Roles = profile.Roles
+		existing.LastLoginAt = profile.LastLoginAt
+
+		return existing, nil
+	})
+}
+
+func (u *userStore) ReadProfile(ctx context.Context, userID string) (*store.UserProfile, error) {
+	profile, _, err := u.read(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if profile == nil {
+		return nil, ErrUserStoreNoRecord
+	}
+
+	return profile, nil
+}
+
+func (u *userStore) ReadAllProfiles(ctx context.Context) ([]store.UserProfile, error) {
+	resp, err := u.Get(ctx, keyUserPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading user profiles from the store")
+	}
+
+	profiles := make([]store.UserProfile, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var profile store.UserProfile
+		err = json.Unmarshal(kv.Value, &profile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling user profile %v from store", string(kv.Key))
+		}
+
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, nil
+}
+
+func (u *userStore) UpdatePreferences(ctx context.Context, userID string,
+	preferences store.UserPreferences) (*store.UserProfile, error) {
+
+	return u.update(ctx, userID, func(existing *store.UserProfile) (*store.UserProfile, error) {
+		if existing == nil {
+			return nil, ErrUserStoreNoRecord
+		}
+
+		existing.Preferences = preferences
+
+		return existing, nil
+	})
+}
+
+func (u *userStore) SetDisabled(ctx context.Context, userID string, disabled bool,
+	at time.Time) (*store.UserProfile, error) {
+
+	return u.update(ctx, userID, func(existing *store.UserProfile) (*store.UserProfile, error) {
+		if existing == nil {
+			return nil, ErrUserStoreNoRecord
+		}
+
+		existing.Disabled = disabled
+		existing.DisabledAt = time.Time{}
+		if disabled {
+			existing.DisabledAt = at
+		}
+
+		return existing, nil
+	})
+}
+
+// update applies the change to the current profile, retrying when the
+// profile is changed concurrently, e.g. by a login on another instance
+func (u *userStore) update(ctx context.Context, userID string,
+	change func(existing *store.UserProfile) (*store.UserProfile, error)) (*store.UserProfile, error) {
+
+	key := fmt.Sprintf(keyUserFormat, userID)
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		existing, modRevision, err := u.read(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		profile, err := change(existing)
+		if err != nil {
+			return nil, err
+		}
+
+		profileInBytes, err := json.Marshal(profile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshalling user profile")
+		}
+
+		resp, err := u.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", modRevision)).
+			Then(clientv3.OpPut(key, string(profileInBytes))).
+			Commit()
+		if err != nil {
+			return nil, errors.Wrap(err, "error storing user profile")
+		}
+
+		if resp.Succeeded {
+			return profile, nil
+		}
+	}
+
+	return nil, ErrUserStoreConflict
+}
+
+// read returns the profile and its mod revision, a nil profile and zero
+// revision when there is none
+func (u *userStore) read(ctx context.Context, userID string) (*store.UserProfile, int64, error) {
+	key := fmt.Sprintf(keyUserFormat, userID)
+
+	resp, err := u.Get(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(resp.Kvs) != 1 {
+		return nil, 0, nil
+	}
+
+	var profile store.UserProfile
+	err = json.Unmarshal(resp.Kvs[0].Value, &profile)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error unmarshalling user profile from store")
+	}
+
+	return &profile, resp.Kvs[0].ModRevision, nil
+}
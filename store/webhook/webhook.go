@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyWebhookDeliveryFormat = "webhook-delivery:%v:%v"
+)
+
+type webhookDeliveryStore struct {
+	clientv3.KV
+	clientv3.Lease
+}
+
+func New(db *clientv3.Client) store.WebhookDeliveryStore {
+	return &webhookDeliveryStore{
+		KV:    db,
+		Lease: db,
+	}
+}
+
+func (w *webhookDeliveryStore) RecordDelivery(ctx context.Context, provider string, deliveryID string,
+	ttl time.Duration) (bool, error) {
+
+	// deliveries are forgotten with the lease, redeliveries are only
+	// expected within a few days
+	lease, err := w.Grant(ctx, int64(ttl.Seconds()))
+	if err != nil {
+		return false, errors.Wrap(err, "error granting lease for webhook delivery")
+	}
+
+	key := fmt.Sprintf(keyWebhookDeliveryFormat, provider, deliveryID)
+
+	resp, err := w.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, time.Now().UTC().Format(time.RFC3339), clientv3.WithLease(lease.ID))).
+		Commit()
+	if err != nil {
+		return false, errors.Wrap(err, "error recording webhook delivery")
+	}
+
+	if !resp.Succeeded {
+		_, err = w.Revoke(ctx, lease.ID)
+		if err != nil {
+			return false, errors.Wrap(err, "error revoking unused webhook delivery lease")
+		}
+	}
+
+	return resp.Succeeded, nil
+}
+
+func (w *webhookDeliveryStore) DeleteDelivery(ctx context.Context, provider string, deliveryID string) error {
+	key := fmt.Sprintf(keyWebhookDeliveryFormat, provider, deliveryID)
+
+	_, err := w.Delete(ctx, key)
+	if err != nil {
+		return errors.Wrap(err, "error deleting webhook delivery")
+	}
+
+	return nil
+}
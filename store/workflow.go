@@ -0,0 +1,132 @@
+package store
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Statuses of the default workflow
+const (
+	StatusTodo = "todo"
+	StatusDone = "done"
+)
+
+const (
+	maxWorkflowStatuses = 20
+	maxStatusLength     = 32
+)
+
+// Workflow is the ordered statuses the tasks of a user, or of a project, go
+// through. New tasks start in the first open status.
+type Workflow struct {
+	Statuses []WorkflowStatus `json:"statuses"`
+}
+
+type WorkflowStatus struct {
+	Name string `json:"name"`
+	// Terminal statuses complete the task
+	Terminal bool `json:"terminal"`
+	// Next are the statuses a task can move to from this one, any when empty
+	Next []string `json:"next,omitempty"`
+}
+
+// DefaultWorkflow returns the workflow of tasks that are either open or
+// completed
+func DefaultWorkflow() Workflow {
+	return Workflow{
+		Statuses: []WorkflowStatus{
+			{Name: StatusTodo},
+			{Name: StatusDone, Terminal: true},
+		},
+	}
+}
+
+// Validate checks that the statuses are named uniquely, that there is at
+// least one open and one terminal status and that transitions lead to
+// statuses of the workflow
+func (w *Workflow) Validate() error {
+	if len(w.Statuses) > maxWorkflowStatuses {
+		return errors.Errorf("error as a workflow has at most %v statuses", maxWorkflowStatuses)
+	}
+
+	names := make(map[string]bool)
+	var open, terminal bool
+	for _, status := range w.Statuses {
+		if status.Name == "" || status.Name != strings.TrimSpace(status.Name) ||
+			len(status.Name) > maxStatusLength {
+			return errors.Errorf("error as status name %q is invalid", status.Name)
+		}
+
+		if names[status.Name] {
+			return errors.Errorf("error as status %q is repeated", status.Name)
+		}
+		names[status.Name] = true
+
+		if status.Terminal {
+			terminal = true
+		} else {
+			open = true
+		}
+	}
+
+	if !open || !terminal {
+		return errors.New("error as a workflow needs an open and a terminal status")
+	}
+
+	for _, status := range w.Statuses {
+		for _, next := range status.Next {
+			if !names[next] {
+				return errors.Errorf("error as status %q moves to unknown status %q", status.Name, next)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Status returns the status of the name
+func (w *Workflow) Status(name string) (*WorkflowStatus, bool) {
+	for i := range w.Statuses {
+		if w.Statuses[i].Name == name {
+			return &w.Statuses[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// StatusOf returns the status of the task in the workflow. A task without a
+// status, or in one the workflow lacks or that disagrees with its
+// completion, is in the first terminal status once completed and in the
+// first open one otherwise.
+func (w *Workflow) StatusOf(task Task) string {
+	if status, ok := w.Status(task.Status); ok && status.Terminal == task.IsCompleted {
+		return status.Name
+	}
+
+	for _, status := range w.Statuses {
+		if status.Terminal == task.IsCompleted {
+			return status.Name
+		}
+	}
+
+	return ""
+}
+
+// CanMove reports whether a task can move between the statuses. A task in a
+// status the workflow lacks moves freely.
+func (w *Workflow) CanMove(from string, to string) bool {
+	status, ok := w.Status(from)
+	if !ok || from == to || len(status.Next) == 0 {
+		return true
+	}
+
+	for _, next := range status.Next {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
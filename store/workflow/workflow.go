@@ -0,0 +1,59 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/AjithPanneerselvam/task-etcd/store"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyWorkflowFormat = "workflow:%v"
+)
+
+type workflowStore struct {
+	clientv3.KV
+}
+
+func New(db clientv3.KV) store.WorkflowStore {
+	return &workflowStore{
+		db,
+	}
+}
+
+func (w *workflowStore) ReadWorkflow(ctx context.Context, userID string) (*store.Workflow, error) {
+	resp, err := w.Get(ctx, fmt.Sprintf(keyWorkflowFormat, userID))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading workflow from the store")
+	}
+
+	if len(resp.Kvs) != 1 {
+		workflow := store.DefaultWorkflow()
+		return &workflow, nil
+	}
+
+	var workflow store.Workflow
+	err = json.Unmarshal(resp.Kvs[0].Value, &workflow)
+	if err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling workflow response from store")
+	}
+
+	return &workflow, nil
+}
+
+func (w *workflowStore) UpsertWorkflow(ctx context.Context, userID string, workflow store.Workflow) error {
+	workflowInBytes, err := json.Marshal(workflow)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling workflow")
+	}
+
+	_, err = w.Put(ctx, fmt.Sprintf(keyWorkflowFormat, userID), string(workflowInBytes))
+	if err != nil {
+		return errors.Wrap(err, "error storing workflow")
+	}
+
+	return nil
+}